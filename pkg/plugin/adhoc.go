@@ -0,0 +1,299 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// adhocFilter is a Grafana ad hoc filter, as dashboards pass them in a query's adhocFilters. Grafana 12 also sends
+// how the filter is shown (keyLabel, valueLabels), where it came from (origin), the values of multi-value operators
+// (values) and, from older dashboards, its condition; those are accepted but only key, operator and value are used.
+type adhocFilter struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+
+	Condition   string   `json:"condition"`
+	KeyLabel    string   `json:"keyLabel"`
+	ValueLabels []string `json:"valueLabels"`
+	Values      []string `json:"values"`
+	Origin      string   `json:"origin"`
+}
+
+// validateJSON checks the types of a filter's fields, ignoring any others, as Grafana adds to filters from version to
+// version.
+func (f *adhocFilter) validateJSON(path string, raw json.RawMessage) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return typeMismatch(path, "object", raw)
+	}
+	fields := jsonFields(reflect.TypeFor[adhocFilter]())
+	for _, key := range slices.Sorted(maps.Keys(obj)) {
+		if field, ok := fields[key]; ok {
+			if err := validateJSONValue(joinPath(path, key), obj[key], field.Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// adhocComparators are the Harper comparators of the ad hoc filter operators that have one. Regex operators don't, and
+// neither does "!=", as search_by_conditions doesn't document a not-equal comparator.
+var adhocComparators = map[string]string{
+	"=":  "equals",
+	"<":  "less_than",
+	"<=": "less_than_equal",
+	">":  "greater_than",
+	">=": "greater_than_equal",
+}
+
+// adhocConditions converts ad hoc filters to conditions. Values that look like numbers or booleans are compared as
+// such, the way the query editor treats values of type auto.
+func adhocConditions(filters []adhocFilter) (Conditions, error) {
+	conditions := make(Conditions, 0, len(filters))
+	for i, f := range filters {
+		comparator, ok := adhocComparators[f.Operator]
+		if !ok {
+			return nil, &QueryValidationError{
+				Field:   fmt.Sprintf("adhocFilters[%d].operator", i),
+				Problem: "expected one of " + strings.Join(slices.Sorted(maps.Keys(adhocComparators)), ", "),
+			}
+		}
+		conditions = append(conditions, &Condition{Attribute: f.Key, Comparator: comparator, Value: SearchValue{Val: adhocValue(f.Value)}})
+	}
+	return conditions, nil
+}
+
+func adhocValue(s string) any {
+	switch strings.ToLower(s) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && strconv.FormatFloat(f, 'f', -1, 64) == s {
+		return f
+	}
+	return s
+}
+
+// addAdhocFilters adds conditions for filters to the query, which must match as well as its own conditions.
+func (q *SearchByConditionsQuery) addAdhocFilters(filters []adhocFilter) error {
+	conditions, err := adhocConditions(filters)
+	if err != nil || len(conditions) == 0 {
+		return err
+	}
+	if q.Operator == "or" && len(q.Conditions) > 1 {
+		q.Conditions = Conditions{{Operator: "or", Conditions: q.Conditions}}
+	}
+	q.Operator = "and"
+	q.Conditions = append(q.Conditions, conditions...)
+	return nil
+}
+
+// tagsHandler serves the keys and values Grafana offers for ad hoc filters: /tag-keys lists the attributes of the
+// metric or table given by the metric, or database and table, parameters, and /tag-values lists the values of the
+// attribute given by key. Analytics values are taken from the last hour unless from and to (epoch milliseconds) are
+// given.
+type tagsHandler struct {
+	datasource *Datasource
+}
+
+func newTagsHandler(datasource *Datasource) *tagsHandler {
+	return &tagsHandler{datasource: datasource}
+}
+
+// tag is a tag key or value in the form Grafana expects.
+type tag struct {
+	Text string `json:"text"`
+}
+
+type searchByValueOperation struct {
+	Operation       string   `json:"operation"`
+	Database        string   `json:"database"`
+	Table           string   `json:"table"`
+	SearchAttribute string   `json:"search_attribute"`
+	SearchValue     string   `json:"search_value"`
+	GetAttributes   []string `json:"get_attributes"`
+	Limit           int      `json:"limit,omitempty"`
+}
+
+func (o searchByValueOperation) Prepare() any {
+	return o
+}
+
+func (th *tagsHandler) tagKeys(client HarperClient, params map[string]string) ([]string, error) {
+	if params["metric"] != "" {
+		desc, err := client.DescribeMetric(params["metric"])
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(desc.Attributes))
+		for _, attr := range desc.Attributes {
+			if attr.Name != "id" {
+				keys = append(keys, attr.Name)
+			}
+		}
+		return keys, nil
+	}
+
+	op := describeTableOperation{Operation: harper.OP_DESCRIBE_TABLE, Database: params["database"], Table: params["table"]}
+	var desc tableDescription
+	if err := client.RawRequest(op, &desc); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(desc.Attributes))
+	for _, attr := range desc.Attributes {
+		keys = append(keys, attr.Attribute)
+	}
+	return keys, nil
+}
+
+const (
+	// tagValuesMaxRecords caps how many records are read to list an ad hoc filter key's values, and tagValuesLimit
+	// how many distinct values are listed.
+	tagValuesMaxRecords = 10_000
+	tagValuesLimit      = 1_000
+)
+
+func (th *tagsHandler) tagValues(ctx context.Context, client HarperClient, params map[string]string) ([]string, error) {
+	key := params["key"]
+	maxRecords := min(tagValuesMaxRecords, th.datasource.maxRows())
+
+	seen := make(map[string]bool)
+	// add records the value of key in record, returning false once there are enough values
+	add := func(record map[string]any) bool {
+		if v, ok := record[key]; ok && v != nil {
+			seen[fmt.Sprint(v)] = true
+		}
+		return len(seen) < tagValuesLimit
+	}
+
+	if params["metric"] != "" {
+		to := time.Now()
+		from := to.Add(-time.Hour)
+		if ms, err := strconv.ParseInt(params["from"], 10, 64); err == nil {
+			from = time.UnixMilli(ms)
+		}
+		if ms, err := strconv.ParseInt(params["to"], 10, 64); err == nil {
+			to = time.UnixMilli(ms)
+		}
+		req := harper.GetAnalyticsRequest{
+			Metric:        params["metric"],
+			GetAttributes: []string{key},
+			StartTime:     from.UnixMilli(),
+			EndTime:       to.UnixMilli(),
+		}
+		if th.datasource.streamsAnalytics {
+			// (streaming stops reading the response at maxRecords rows)
+			columns, err := streamAnalytics(ctx, client, req, "", maxRecords)
+			if err != nil {
+				return nil, err
+			}
+			for result := range columns.results() {
+				if !add(result) {
+					break
+				}
+			}
+		} else {
+			results, err := client.GetAnalytics(req)
+			if err != nil {
+				return nil, err
+			}
+			for _, result := range results[:min(len(results), maxRecords)] {
+				if !add(result) {
+					break
+				}
+			}
+		}
+	} else {
+		op := searchByValueOperation{
+			Operation:       harper.OP_SEARCH_BY_VALUE,
+			Database:        params["database"],
+			Table:           params["table"],
+			SearchAttribute: key,
+			SearchValue:     "*",
+			GetAttributes:   []string{key},
+			Limit:           maxRecords,
+		}
+		var records []map[string]any
+		if err := client.RawRequest(op, &records); err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			if !add(record) {
+				break
+			}
+		}
+	}
+
+	return slices.Sorted(maps.Keys(seen)), nil
+}
+
+func (th *tagsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+
+	params := make(map[string]string)
+	for _, name := range []string{"metric", "database", "table", "key", "from", "to"} {
+		params[name] = r.URL.Query().Get(name)
+	}
+	if params["metric"] == "" && (params["database"] == "" || params["table"] == "") {
+		http.Error(w, "expected a metric, or a database and table", http.StatusBadRequest)
+		return
+	}
+
+	pCtx := backend.PluginConfigFromContext(r.Context())
+	client, err := th.datasource.clientFor(withRequestHeaders(r.Context(), r.Header), pCtx)
+	if err != nil {
+		http.Error(w, err.Error(), int(statusFromError(err)))
+		return
+	}
+
+	var names []string
+	if r.URL.Path == "/tag-values" {
+		if params["key"] == "" {
+			http.Error(w, "expected a key", http.StatusBadRequest)
+			return
+		}
+		names, err = th.tagValues(r.Context(), client, params)
+	} else {
+		names, err = th.tagKeys(client, params)
+	}
+	if err != nil {
+		th.datasource.logger.Error("failed to list ad hoc filter tags", "path", r.URL.Path, "error", err)
+		err = asCredentialsError(err, th.datasource.settings.Username)
+		http.Error(w, err.Error(), int(statusFromError(err)))
+		return
+	}
+
+	tags := make([]tag, len(names))
+	for i, name := range names {
+		tags[i] = tag{Text: name}
+	}
+	jsonResp, err := json.Marshal(tags)
+	if err != nil {
+		th.datasource.logger.Error("error marshaling tags to JSON", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(jsonResp); err != nil {
+		th.datasource.logger.Error("error writing response", "error", err)
+	}
+}
@@ -0,0 +1,207 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestAdhocConditions(t *testing.T) {
+	conditions, err := adhocConditions([]adhocFilter{
+		{Key: "node", Operator: "=", Value: "node-1"},
+		{Key: "port", Operator: ">=", Value: "9925"},
+		{Key: "secure", Operator: "<", Value: "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Condition{
+		{Attribute: "node", Comparator: "equals", Value: SearchValue{Val: "node-1"}},
+		{Attribute: "port", Comparator: "greater_than_equal", Value: SearchValue{Val: 9925.0}},
+		{Attribute: "secure", Comparator: "less_than", Value: SearchValue{Val: true}},
+	}
+	for i, c := range conditions {
+		if c.Attribute != want[i].Attribute || c.Comparator != want[i].Comparator || c.Value != want[i].Value {
+			t.Errorf("expected %+v, got %+v", want[i], *c)
+		}
+	}
+
+	if _, err := adhocConditions([]adhocFilter{{Key: "node", Operator: "=~", Value: "node-.*"}}); err == nil {
+		t.Error("expected a regex filter to be rejected")
+	}
+	var vErr *QueryValidationError
+	if _, err := adhocConditions([]adhocFilter{{Key: "node", Operator: "!=", Value: "node-1"}}); !errors.As(err, &vErr) {
+		t.Errorf("expected a not-equal filter to be rejected, got %v", err)
+	}
+}
+
+func TestSearchByConditionsAdhocFilters(t *testing.T) {
+	var sent map[string]any
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "search_by_conditions" {
+			return nil, nil
+		}
+		sent = op
+		return []map[string]any{}, nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	queryJSON, _ := json.Marshal(map[string]any{
+		"operation":    "search_by_conditions",
+		"adhocFilters": []map[string]any{{"key": "breed", "operator": "=", "value": "Husky"}},
+		"queryAttrs": map[string]any{
+			"database": "dev",
+			"table":    "dog",
+			"operator": "or",
+			"conditions": []map[string]any{
+				{"attribute": "age", "comparator": "equals", "value": map[string]any{"val": 3}},
+				{"attribute": "age", "comparator": "equals", "value": map[string]any{"val": 5}},
+			},
+		},
+	})
+	if _, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: queryJSON}); err != nil {
+		t.Fatal(err)
+	}
+
+	conditions := sent["conditions"].([]any)
+	if sent["operator"] != "and" || len(conditions) != 2 {
+		t.Fatalf("expected the query's conditions and the filter to be and-ed, got %v", sent)
+	}
+	if group := conditions[0].(map[string]any); group["operator"] != "or" || len(group["conditions"].([]any)) != 2 {
+		t.Errorf("expected the query's conditions to stay or-ed, got %v", group)
+	}
+	if filter := conditions[1].(map[string]any); filter["attribute"] != "breed" || filter["value"] != "Husky" {
+		t.Errorf("expected the ad hoc filter condition, got %v", filter)
+	}
+}
+
+func TestAdhocFiltersGrafana12(t *testing.T) {
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_000_000)
+	for _, node := range []string{"node-1", "node-2"} {
+		client.addAnalytics("db-read", []time.Time{start}, map[string]any{"node": node, "count": 1.0})
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	// as Grafana 12 sends a dashboard's ad hoc filter
+	queryJSON := `{"refId": "A", "operation": "get_analytics", "queryAttrs": {"metric": "db-read"},
+		"adhocFilters": [{"key": "node", "operator": "=", "value": "node-1", "condition": "", "keyLabel": "node",
+			"valueLabels": ["node-1"], "values": ["node-1"], "origin": "dashboard", "forceEdit": false}]}`
+	res, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: []byte(queryJSON)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodes []string
+	for _, field := range res.Frames[0].Fields {
+		if node, ok := field.Labels["node"]; ok {
+			nodes = append(nodes, node)
+		}
+	}
+	if !slices.Equal(nodes, []string{"node-1"}) {
+		t.Errorf("expected only node-1's series, got %v", nodes)
+	}
+
+	_, err = parseQueryModel[GetAnalyticsQuery]([]byte(`{"operation": "get_analytics", "queryAttrs": {"metric": "db-read"},
+		"adhocFilters": [{"key": "node", "operator": "=", "value": "node-1", "values": "node-1"}]}`))
+	var vErr *QueryValidationError
+	if !errors.As(err, &vErr) || vErr.Field != "adhocFilters[0].values" {
+		t.Errorf("expected a mistyped filter field to be rejected, got %v", err)
+	}
+}
+
+func TestTagKeysAndValues(t *testing.T) {
+	client := newFakeHarperClient()
+	now := time.Now()
+	client.addAnalytics("db-read", []time.Time{now.Add(-time.Minute)}, map[string]any{"node": "node-1", "count": 1.0})
+	client.addAnalytics("db-read", []time.Time{now.Add(-2 * time.Minute)}, map[string]any{"node": "node-2", "count": 2.0})
+	client.raw = func(op map[string]any) (any, error) {
+		switch op["operation"] {
+		case "describe_table":
+			return map[string]any{"attributes": []map[string]any{{"attribute": "id"}, {"attribute": "breed"}}}, nil
+		case "search_by_value":
+			return []map[string]any{{"breed": "Husky"}, {"breed": "Corgi"}, {"breed": "Husky"}, {"breed": nil}}, nil
+		}
+		return nil, nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+	th := newTagsHandler(ds)
+
+	keys, err := th.tagKeys(client, map[string]string{"metric": "db-read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(keys, "node") || slices.Contains(keys, "id") {
+		t.Errorf("expected the metric's attributes, got %v", keys)
+	}
+
+	values, err := th.tagValues(context.Background(), client, map[string]string{"metric": "db-read", "key": "node"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(values, []string{"node-1", "node-2"}) {
+		t.Errorf("expected the metric's node values, got %v", values)
+	}
+
+	keys, err = th.tagKeys(client, map[string]string{"database": "dev", "table": "dog"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(keys, []string{"id", "breed"}) {
+		t.Errorf("expected the table's attributes, got %v", keys)
+	}
+
+	values, err = th.tagValues(context.Background(), client, map[string]string{"database": "dev", "table": "dog", "key": "breed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(values, []string{"Corgi", "Husky"}) {
+		t.Errorf("expected the table's distinct breeds, got %v", values)
+	}
+}
+
+func TestTagValuesLimit(t *testing.T) {
+	var sent map[string]any
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "search_by_value" {
+			return map[string]any{}, nil
+		}
+		sent = op
+		records := make([]map[string]any, tagValuesLimit+500)
+		for i := range records {
+			records[i] = map[string]any{"id": i}
+		}
+		return records, nil
+	}
+	var times []time.Time
+	for i := range tagValuesLimit + 500 {
+		times = append(times, time.Now().Add(-time.Duration(i)*time.Millisecond))
+	}
+	client.addAnalytics("db-read", times, map[string]any{"count": 1.0})
+	th := newTagsHandler(newTestDatasource(t, Settings{MaxRows: 2000}, client))
+
+	values, err := th.tagValues(context.Background(), client, map[string]string{"database": "dev", "table": "dog", "key": "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent["limit"] != float64(2000) {
+		t.Errorf("expected the search to be limited to the datasource's max rows, got %v", sent["limit"])
+	}
+	if len(values) != tagValuesLimit {
+		t.Errorf("expected %d values, got %d", tagValuesLimit, len(values))
+	}
+
+	values, err = th.tagValues(context.Background(), client, map[string]string{"metric": "db-read", "key": "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != tagValuesLimit {
+		t.Errorf("expected %d analytics values, got %d", tagValuesLimit, len(values))
+	}
+}
@@ -0,0 +1,299 @@
+package plugin
+
+import (
+	"cmp"
+	"fmt"
+	"iter"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+)
+
+// defaultAggregationInterval buckets aggregated analytics when neither the query nor Grafana sets an interval.
+const defaultAggregationInterval = time.Minute
+
+// analyticsAggregations are the functions get_analytics queries can aggregate buckets with.
+var analyticsAggregations = []string{"avg", "sum", "min", "max", "count"}
+
+type aggregationAccum struct {
+	bucket int64
+	series string
+	labels map[string]any
+	sums   map[string]float64
+	mins   map[string]float64
+	maxes  map[string]float64
+	counts map[string]int
+}
+
+// aggregateAnalytics buckets analytics rows by interval, separately for each series (the rows' non-numeric
+// attributes), and returns a row per bucket and series with each numeric attribute combined by fn. Rows are
+// timestamped with the start of their bucket and returned in ascending time order.
+func aggregateAnalytics(results []harper.GetAnalyticsResult, fn string, interval time.Duration) []harper.GetAnalyticsResult {
+	return aggregateAnalyticsRows(slices.Values(results), fn, interval)
+}
+
+// aggregateAnalyticsRows is aggregateAnalytics for rows read one at a time.
+func aggregateAnalyticsRows(rows iter.Seq[harper.GetAnalyticsResult], fn string, interval time.Duration) []harper.GetAnalyticsResult {
+	resolution := interval.Milliseconds()
+	accums := make(map[[2]any]*aggregationAccum)
+
+	for row := range rows {
+		ts, ok := row["id"].(time.Time)
+		if !ok {
+			continue
+		}
+		bucket := ts.UnixMilli() - ts.UnixMilli()%resolution
+
+		labels, values := splitAnalyticsRow(row)
+		series := seriesKey(labels)
+		acc, ok := accums[[2]any{bucket, series}]
+		if !ok {
+			acc = &aggregationAccum{
+				bucket: bucket,
+				series: series,
+				labels: labels,
+				sums:   make(map[string]float64),
+				mins:   make(map[string]float64),
+				maxes:  make(map[string]float64),
+				counts: make(map[string]int),
+			}
+			accums[[2]any{bucket, series}] = acc
+		}
+		for k, v := range values {
+			if acc.counts[k] == 0 || v < acc.mins[k] {
+				acc.mins[k] = v
+			}
+			if acc.counts[k] == 0 || v > acc.maxes[k] {
+				acc.maxes[k] = v
+			}
+			acc.sums[k] += v
+			acc.counts[k]++
+		}
+	}
+
+	sorted := slices.SortedFunc(maps.Values(accums), func(a, b *aggregationAccum) int {
+		return cmp.Or(cmp.Compare(a.bucket, b.bucket), cmp.Compare(a.series, b.series))
+	})
+
+	aggregated := make([]harper.GetAnalyticsResult, 0, len(sorted))
+	for _, acc := range sorted {
+		row := harper.GetAnalyticsResult{"id": time.UnixMilli(acc.bucket)}
+		maps.Copy(row, acc.labels)
+		for k, count := range acc.counts {
+			switch fn {
+			case "sum":
+				row[k] = acc.sums[k]
+			case "min":
+				row[k] = acc.mins[k]
+			case "max":
+				row[k] = acc.maxes[k]
+			case "count":
+				row[k] = float64(count)
+			default:
+				row[k] = acc.sums[k] / float64(count)
+			}
+		}
+		aggregated = append(aggregated, row)
+	}
+	return aggregated
+}
+
+const (
+	attributeRoleLabel = "label"
+	attributeRoleValue = "value"
+)
+
+// applyAttributeRoles converts the attributes of analytics rows that roles marks as labels to strings, and those it
+// marks as values to numbers (booleans become 0 or 1, and values that aren't numbers null), so they become series
+// labels or value fields regardless of their type. Other attributes are left as they are.
+func applyAttributeRoles(results []harper.GetAnalyticsResult, roles map[string]string) {
+	for _, row := range results {
+		for attr, role := range roles {
+			v, ok := row[attr]
+			if !ok || v == nil {
+				continue
+			}
+			switch role {
+			case attributeRoleLabel:
+				row[attr] = fmt.Sprint(v)
+			case attributeRoleValue:
+				row[attr] = numericValue(v)
+			}
+		}
+	}
+}
+
+// numericValue converts v to a float64, or nil if it isn't a number, numeric string or boolean.
+func numericValue(v any) any {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	case bool:
+		if v {
+			return 1.0
+		}
+		return 0.0
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// groupAnalytics makes the groupBy attributes of analytics rows their only labels, as strings, and drops their other
+// non-numeric attributes, so the rows form one series per combination of groupBy values. Rows of the same group with
+// the same timestamp are averaged.
+func groupAnalytics(results []harper.GetAnalyticsResult, groupBy []string) []harper.GetAnalyticsResult {
+	grouped := make([]harper.GetAnalyticsResult, 0, len(results))
+	for _, row := range results {
+		ts, ok := row["id"].(time.Time)
+		if !ok {
+			continue
+		}
+		_, values := splitAnalyticsRow(row)
+
+		out := harper.GetAnalyticsResult{"id": ts}
+		for _, attr := range groupBy {
+			out[attr] = ""
+			if v := row[attr]; v != nil {
+				out[attr] = fmt.Sprint(v)
+			}
+		}
+		for k, v := range values {
+			if !slices.Contains(groupBy, k) {
+				out[k] = v
+			}
+		}
+		grouped = append(grouped, out)
+	}
+	return aggregateAnalytics(grouped, "avg", time.Millisecond)
+}
+
+// splitAnalyticsRow splits an analytics row's attributes, other than its timestamp, into the labels that identify its
+// series and its numeric values.
+func splitAnalyticsRow(row harper.GetAnalyticsResult) (labels map[string]any, values map[string]float64) {
+	labels = make(map[string]any)
+	values = make(map[string]float64)
+	for k, v := range row {
+		if k == "id" {
+			continue
+		}
+		switch v := v.(type) {
+		case float64:
+			values[k] = v
+		case int64:
+			values[k] = float64(v)
+		default:
+			labels[k] = v
+		}
+	}
+	return labels, values
+}
+
+// downsampleInterval returns the bucket interval that brings every series in results (which are in ascending time
+// order) down to at most maxPoints points, or 0 if none has more than that.
+func downsampleInterval(results []harper.GetAnalyticsResult, maxPoints int64) time.Duration {
+	return downsampleRowsInterval(slices.Values(results), len(results), maxPoints)
+}
+
+// downsampleRowsInterval is downsampleInterval for n rows read one at a time.
+func downsampleRowsInterval(rows iter.Seq[harper.GetAnalyticsResult], n int, maxPoints int64) time.Duration {
+	if maxPoints < 2 || int64(n) <= maxPoints {
+		return 0
+	}
+
+	points := make(map[string]int64)
+	var mostPoints int64
+	var first, last time.Time
+	for row := range rows {
+		labels, _ := splitAnalyticsRow(row)
+		series := seriesKey(labels)
+		points[series]++
+		mostPoints = max(mostPoints, points[series])
+		if first.IsZero() {
+			first, _ = row["id"].(time.Time)
+		}
+		last, _ = row["id"].(time.Time)
+	}
+	if mostPoints <= maxPoints {
+		return 0
+	}
+
+	// Buckets are aligned to the epoch, so a span of less than maxPoints-1 intervals touches at most maxPoints of them.
+	return time.Duration(last.Sub(first).Milliseconds()/(maxPoints-1)+1) * time.Millisecond
+}
+
+// percentileAnalytics buckets analytics rows by interval, separately for each series, and returns a row per bucket
+// and series with a value for each of the given percentiles (0-100) of each numeric attribute, named by
+// percentileFieldName. Rows are timestamped with the start of their bucket and returned in ascending time order.
+func percentileAnalytics(results []harper.GetAnalyticsResult, percentiles []float64, interval time.Duration) []harper.GetAnalyticsResult {
+	type samples struct {
+		bucket int64
+		series string
+		labels map[string]any
+		values map[string][]float64
+	}
+	resolution := interval.Milliseconds()
+	buckets := make(map[[2]any]*samples)
+
+	for _, row := range results {
+		ts, ok := row["id"].(time.Time)
+		if !ok {
+			continue
+		}
+		bucket := ts.UnixMilli() - ts.UnixMilli()%resolution
+		labels, values := splitAnalyticsRow(row)
+		series := seriesKey(labels)
+
+		s, ok := buckets[[2]any{bucket, series}]
+		if !ok {
+			s = &samples{bucket: bucket, series: series, labels: labels, values: make(map[string][]float64)}
+			buckets[[2]any{bucket, series}] = s
+		}
+		for k, v := range values {
+			s.values[k] = append(s.values[k], v)
+		}
+	}
+
+	sorted := slices.SortedFunc(maps.Values(buckets), func(a, b *samples) int {
+		return cmp.Or(cmp.Compare(a.bucket, b.bucket), cmp.Compare(a.series, b.series))
+	})
+
+	rows := make([]harper.GetAnalyticsResult, 0, len(sorted))
+	for _, s := range sorted {
+		row := harper.GetAnalyticsResult{"id": time.UnixMilli(s.bucket)}
+		maps.Copy(row, s.labels)
+		for k, values := range s.values {
+			slices.Sort(values)
+			for _, p := range percentiles {
+				row[percentileFieldName(k, p)] = percentile(values, p)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// percentileFieldName names the field for percentile p of attr, e.g. "duration p95".
+func percentileFieldName(attr string, p float64) string {
+	return fmt.Sprintf("%s p%s", attr, strconv.FormatFloat(p, 'f', -1, 64))
+}
+
+// percentileSuffix matches the suffix percentileFieldName adds to attribute names.
+var percentileSuffix = regexp.MustCompile(` p\d+(\.\d+)?$`)
+
+// percentile returns percentile p (0-100) of sorted, interpolating linearly between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
@@ -0,0 +1,228 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestAggregateAnalytics(t *testing.T) {
+	start := time.UnixMilli(1_700_000_040_000) // a minute boundary
+	var results []harper.GetAnalyticsResult
+	for i, v := range []float64{1, 5, 3, 10} {
+		results = append(results,
+			harper.GetAnalyticsResult{"id": start.Add(time.Duration(i) * 20 * time.Second), "node": "node-1", "count": v},
+			harper.GetAnalyticsResult{"id": start.Add(time.Duration(i) * 20 * time.Second), "node": "node-2", "count": 2 * v},
+		)
+	}
+
+	tests := []struct {
+		fn   string
+		want float64
+	}{
+		{"avg", 3},
+		{"sum", 9},
+		{"min", 1},
+		{"max", 5},
+		{"count", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fn, func(t *testing.T) {
+			aggregated := aggregateAnalytics(results, tt.fn, time.Minute)
+			if len(aggregated) != 4 {
+				t.Fatalf("expected 2 buckets for 2 nodes, got %d rows", len(aggregated))
+			}
+			first := aggregated[0]
+			if first["node"] != "node-1" || !first["id"].(time.Time).Equal(start) {
+				t.Errorf("expected node-1's first bucket first, got %v", first)
+			}
+			if first["count"] != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, first["count"])
+			}
+			if !aggregated[2]["id"].(time.Time).Equal(start.Add(time.Minute)) {
+				t.Errorf("expected the second bucket to start a minute later, got %v", aggregated[2]["id"])
+			}
+		})
+	}
+}
+
+func TestQueryAnalyticsAggregation(t *testing.T) {
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_040_000)
+	times := make([]time.Time, 60)
+	for i := range times {
+		times[i] = start.Add(time.Duration(i) * time.Second)
+	}
+	client.addAnalytics("db-read", times, map[string]any{"node": "node-1", "count": 5.0})
+	ds := newTestDatasource(t, Settings{}, client)
+
+	res, err := ds.query(context.Background(), backend.PluginContext{},
+		analyticsQuery("A", map[string]any{"metric": "db-read", "aggregation": "sum", "interval": "30s"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := res.Frames[0]
+	if frame.Rows() != 2 {
+		t.Fatalf("expected 2 buckets, got %d rows", frame.Rows())
+	}
+	if v, _ := frame.Fields[1].NullableFloatAt(0); v == nil || *v != 150 {
+		t.Errorf("expected a sum of 150, got %v", v)
+	}
+
+	if _, err := ds.query(context.Background(), backend.PluginContext{},
+		analyticsQuery("B", map[string]any{"metric": "db-read", "aggregation": "median"})); err == nil {
+		t.Error("expected an unknown aggregation to be rejected")
+	}
+}
+
+func TestQueryAnalyticsMaxDataPoints(t *testing.T) {
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_000_123)
+	times := make([]time.Time, 1000)
+	for i := range times {
+		times[i] = start.Add(time.Duration(i) * time.Second)
+	}
+	client.addAnalytics("db-read", times, map[string]any{"node": "node-1", "count": 5.0})
+	client.addAnalytics("db-read", times, map[string]any{"node": "node-2", "count": 7.0})
+	ds := newTestDatasource(t, Settings{}, client)
+
+	query := analyticsQuery("A", map[string]any{"metric": "db-read"})
+	query.MaxDataPoints = 100
+	res, err := ds.query(context.Background(), backend.PluginContext{}, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := res.Frames[0]
+	if frame.Rows() > 100 || frame.Rows() < 90 {
+		t.Errorf("expected close to 100 rows, got %d", frame.Rows())
+	}
+	if v, _ := frame.Fields[1].NullableFloatAt(0); v == nil || *v != 5 {
+		t.Errorf("expected bucket means of 5, got %v", v)
+	}
+	if frame.Meta == nil || len(frame.Meta.Notices) != 1 {
+		t.Error("expected a downsampling notice")
+	}
+
+	query.MaxDataPoints = 1000
+	res, err = ds.query(context.Background(), backend.PluginContext{}, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := res.Frames[0].Rows(); rows != 1000 {
+		t.Errorf("expected all 1000 points, got %d", rows)
+	}
+}
+
+func TestQueryAnalyticsPercentiles(t *testing.T) {
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_040_000)
+	for i := range 101 {
+		client.addAnalytics("duration", []time.Time{start.Add(time.Duration(i) * 100 * time.Millisecond)},
+			map[string]any{"node": "node-1", "mean": float64(i)})
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	res, err := ds.query(context.Background(), backend.PluginContext{}, analyticsQuery("A", map[string]any{
+		"metric":      "duration",
+		"percentiles": []float64{50, 99},
+		"interval":    "1m",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := res.Frames[0]
+	if frame.Rows() != 1 {
+		t.Fatalf("expected 1 bucket, got %d rows", frame.Rows())
+	}
+	for name, want := range map[string]float64{"mean p50": 50, "mean p99": 99} {
+		field, _ := frame.FieldByName(name)
+		if field == nil {
+			t.Fatalf("expected a %s field", name)
+		}
+		if v, _ := field.NullableFloatAt(0); v == nil || *v != want {
+			t.Errorf("expected %s to be %v, got %v", name, want, v)
+		}
+		if field.Config.Unit != "ms" {
+			t.Errorf("expected %s to keep the metric's unit, got %q", name, field.Config.Unit)
+		}
+	}
+}
+
+func TestQueryAnalyticsGroupBy(t *testing.T) {
+	client := newFakeHarperClient()
+	times := []time.Time{time.UnixMilli(1_700_000_000_000), time.UnixMilli(1_700_000_001_000)}
+	client.addAnalytics("db-read", times, map[string]any{"node": "node-1", "path": "/a", "port": 9925.0, "count": 2.0})
+	client.addAnalytics("db-read", times, map[string]any{"node": "node-1", "path": "/b", "port": 9926.0, "count": 4.0})
+	ds := newTestDatasource(t, Settings{}, client)
+
+	res, err := ds.query(context.Background(), backend.PluginContext{},
+		analyticsQuery("A", map[string]any{"metric": "db-read", "groupBy": []string{"port"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := res.Frames[0]
+	// time + one count field per port; node and path no longer split the series
+	if len(frame.Fields) != 3 {
+		t.Fatalf("expected 3 fields, got %d", len(frame.Fields))
+	}
+	for i, port := range []string{"9925", "9926"} {
+		field := frame.Fields[i+1]
+		if field.Name != "count" || len(field.Labels) != 2 || field.Labels["port"] != port || field.Labels["metric"] != "db-read" {
+			t.Errorf("expected a count field labeled metric=db-read, port=%s, got %s %v", port, field.Name, field.Labels)
+		}
+	}
+
+	res, err = ds.query(context.Background(), backend.PluginContext{},
+		analyticsQuery("B", map[string]any{"metric": "db-read", "groupBy": []string{"node"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame = res.Frames[0]
+	// time + count and port (numeric, so a value) for the one node
+	if len(frame.Fields) != 3 {
+		t.Fatalf("expected 3 fields, got %d", len(frame.Fields))
+	}
+	count, _ := frame.FieldByName("count")
+	if v, _ := count.NullableFloatAt(0); v == nil || *v != 3 {
+		t.Errorf("expected a node's concurrent rows to be averaged to 3, got %v", v)
+	}
+}
+
+func TestQueryAnalyticsAttributeRoles(t *testing.T) {
+	client := newFakeHarperClient()
+	times := []time.Time{time.UnixMilli(1_700_000_000_000)}
+	client.addAnalytics("db-read", times, map[string]any{"node": "node-1", "port": 9925.0, "cached": true, "count": "12"})
+	client.addAnalytics("db-read", times, map[string]any{"node": "node-1", "port": 9926.0, "cached": false, "count": "7"})
+	ds := newTestDatasource(t, Settings{}, client)
+
+	res, err := ds.query(context.Background(), backend.PluginContext{}, analyticsQuery("A", map[string]any{
+		"metric":         "db-read",
+		"attributeRoles": map[string]string{"port": "label", "cached": "value", "count": "value"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := res.Frames[0]
+	for _, field := range frame.Fields[1:] {
+		if field.Labels["port"] == "" {
+			t.Errorf("expected port to be a label of %s, got %v", field.Name, field.Labels)
+		}
+		if !field.Type().Numeric() {
+			t.Errorf("expected %s to be numeric, got %s", field.Name, field.Type())
+		}
+	}
+	count, _ := frame.FieldByName("count")
+	if v, _ := count.NullableFloatAt(0); v == nil || *v != 12 {
+		t.Errorf("expected the count to be parsed as 12, got %v", v)
+	}
+
+	if _, err := ds.query(context.Background(), backend.PluginContext{}, analyticsQuery("B", map[string]any{
+		"metric":         "db-read",
+		"attributeRoles": map[string]string{"port": "dimension"},
+	})); err == nil {
+		t.Error("expected an unknown role to be rejected")
+	}
+}
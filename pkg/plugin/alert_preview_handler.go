@@ -0,0 +1,164 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	reductionLast = "last"
+	reductionAvg  = "avg"
+	reductionMax  = "max"
+)
+
+type alertPreviewHandler struct {
+	datasource *Datasource
+}
+
+func newAlertPreviewHandler(datasource *Datasource) *alertPreviewHandler {
+	return &alertPreviewHandler{datasource: datasource}
+}
+
+type alertPreviewRequest struct {
+	Query     json.RawMessage `json:"query"`
+	Reduction string          `json:"reduction"`
+}
+
+// alertPreviewSeries is one series reduced to a scalar. Value is nil if the series has no non-null values.
+type alertPreviewSeries struct {
+	Name   string      `json:"name"`
+	Labels data.Labels `json:"labels,omitempty"`
+	Value  *float64    `json:"value"`
+}
+
+type alertPreviewResponse struct {
+	Reduction string               `json:"reduction"`
+	Series    []alertPreviewSeries `json:"series"`
+}
+
+// alertPreview runs the query in req and reduces every numeric field of the result to a single value, the way a
+// Grafana alert rule's reduce expression would.
+func (ah *alertPreviewHandler) alertPreview(ctx context.Context, pCtx backend.PluginContext, req alertPreviewRequest) (*alertPreviewResponse, error) {
+	switch req.Reduction {
+	case reductionLast, reductionAvg, reductionMax:
+	default:
+		return nil, &QueryValidationError{
+			Field:   "reduction",
+			Problem: fmt.Sprintf("expected one of '%s', '%s' or '%s'", reductionLast, reductionAvg, reductionMax),
+		}
+	}
+
+	res, err := ah.datasource.runQuery(ctx, pCtx, backend.DataQuery{RefID: "alert-preview", JSON: req.Query})
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	resp := &alertPreviewResponse{Reduction: req.Reduction, Series: make([]alertPreviewSeries, 0)}
+	for _, frame := range res.Frames {
+		for _, field := range frame.Fields {
+			if !field.Type().Numeric() {
+				continue
+			}
+			resp.Series = append(resp.Series, alertPreviewSeries{
+				Name:   seriesName(field),
+				Labels: field.Labels,
+				Value:  reduceField(field, req.Reduction),
+			})
+		}
+	}
+
+	return resp, nil
+}
+
+// seriesName names a field the way Grafana's alerting does: its name followed by its labels.
+func seriesName(field *data.Field) string {
+	if len(field.Labels) == 0 {
+		return field.Name
+	}
+	return fmt.Sprintf("%s {%s}", field.Name, field.Labels)
+}
+
+// reduceField reduces the non-null, non-NaN values of a numeric field with reduction.
+func reduceField(field *data.Field, reduction string) *float64 {
+	var result *float64
+	var sum float64
+	var n int
+
+	for i := range field.Len() {
+		v, err := field.NullableFloatAt(i)
+		if err != nil || v == nil || math.IsNaN(*v) {
+			continue
+		}
+		n++
+		sum += *v
+
+		switch reduction {
+		case reductionLast:
+			result = v
+		case reductionMax:
+			if result == nil || *v > *result {
+				result = v
+			}
+		}
+	}
+
+	if reduction == reductionAvg && n > 0 {
+		avg := sum / float64(n)
+		result = &avg
+	}
+
+	return result
+}
+
+func (ah *alertPreviewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		ah.datasource.logger.Error("failed to read alert preview request body", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req alertPreviewRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, fmt.Sprintf("could not unmarshal alert preview request: '%s'", err), http.StatusBadRequest)
+		return
+	}
+
+	pCtx := backend.PluginConfigFromContext(r.Context())
+	resp, err := ah.alertPreview(withRequestHeaders(r.Context(), r.Header), pCtx, req)
+	if err != nil {
+		ah.datasource.logger.Error("failed to preview alert query", "error", err)
+		err = asCredentialsError(err, ah.datasource.settings.Username)
+		http.Error(w, err.Error(), int(statusFromError(err)))
+		return
+	}
+
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		ah.datasource.logger.Error("error marshaling alert preview to JSON", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(jsonResp)
+	if err != nil {
+		ah.datasource.logger.Error("error writing response", "error", err)
+	}
+}
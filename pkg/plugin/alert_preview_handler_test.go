@@ -0,0 +1,23 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestReduceField(t *testing.T) {
+	one, three := 1.0, 3.0
+	field := data.NewField("count", nil, []*float64{&three, nil, &one})
+
+	for reduction, want := range map[string]float64{"last": 1, "avg": 2, "max": 3} {
+		got := reduceField(field, reduction)
+		if got == nil || *got != want {
+			t.Errorf("%s: expected %v, got %v", reduction, want, got)
+		}
+	}
+
+	if got := reduceField(data.NewField("count", nil, []*float64{nil}), "avg"); got != nil {
+		t.Errorf("expected no value for an all-null series, got %v", *got)
+	}
+}
@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// queryAnalyticsMetrics runs query, a get_analytics query of several metrics, as a query of each metric at once, and
+// returns their frames in the order of the metrics. (Their values are labeled with their metric, as in every analytics
+// response.)
+func (d *Datasource) queryAnalyticsMetrics(ctx context.Context, pCtx backend.PluginContext, query backend.DataQuery, request GetAnalyticsQuery) (backend.DataResponse, error) {
+	if request.Metric != "" {
+		return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.metrics", Problem: "can't be combined with metric"}
+	}
+
+	var model map[string]any
+	dec := json.NewDecoder(bytes.NewReader(query.JSON))
+	dec.UseNumber()
+	if err := dec.Decode(&model); err != nil {
+		return backend.DataResponse{}, fmt.Errorf("could not unmarshal query JSON: '%w'", err)
+	}
+	attrs, _ := model["queryAttrs"].(map[string]any)
+
+	responses := make([]backend.DataResponse, len(request.Metrics))
+	errs := make([]error, len(request.Metrics))
+	var wg sync.WaitGroup
+	for i, metric := range request.Metrics {
+		metricAttrs := maps.Clone(attrs)
+		delete(metricAttrs, "metrics")
+		metricAttrs["metric"] = metric
+		metricModel := maps.Clone(model)
+		metricModel["queryAttrs"] = metricAttrs
+
+		metricQuery := query
+		var err error
+		if metricQuery.JSON, err = json.Marshal(metricModel); err != nil {
+			return backend.DataResponse{}, fmt.Errorf("could not marshal the query of '%s': '%w'", metric, err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i], errs[i] = d.query(ctx, pCtx, metricQuery)
+		}()
+	}
+	wg.Wait()
+
+	var response backend.DataResponse
+	for i, metric := range request.Metrics {
+		if errs[i] != nil {
+			return backend.DataResponse{}, fmt.Errorf("could not query '%s': '%w'", metric, errs[i])
+		}
+		if responses[i].Error != nil {
+			return responses[i], nil
+		}
+		response.Frames = append(response.Frames, responses[i].Frames...)
+	}
+	return response, nil
+}
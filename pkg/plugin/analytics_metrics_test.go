@@ -0,0 +1,44 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestQueryAnalyticsMetrics(t *testing.T) {
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_000_000)
+	client.addAnalytics("db-read", []time.Time{start}, map[string]any{"node": "node-1", "count": 5.0})
+	client.addAnalytics("db-write", []time.Time{start}, map[string]any{"node": "node-1", "count": 2.0})
+	ds := newTestDatasource(t, Settings{}, client)
+
+	res, err := ds.query(context.Background(), backend.PluginContext{},
+		analyticsQuery("A", map[string]any{"metrics": []string{"db-write", "db-read"}, "format": "time_series_multi"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Frames) != 2 {
+		t.Fatalf("expected a frame per metric, got %d", len(res.Frames))
+	}
+	for i, metric := range []string{"db-write", "db-read"} {
+		frame := res.Frames[i]
+		if frame.Name != "A: "+metric {
+			t.Errorf("expected frame %d to be %s's, got %s", i, metric, frame.Name)
+		}
+		if frame.Fields[1].Labels["metric"] != metric || frame.Fields[1].Labels["node"] != "node-1" {
+			t.Errorf("expected %s's values to be labeled with it, got %v", metric, frame.Fields[1].Labels)
+		}
+	}
+	if n := client.called("get_analytics"); n != 2 {
+		t.Errorf("expected a get_analytics call per metric, got %d", n)
+	}
+
+	if _, err := ds.query(context.Background(), backend.PluginContext{},
+		analyticsQuery("B", map[string]any{"metric": "db-read", "metrics": []string{"db-write"}})); err == nil {
+		t.Error("expected metric and metrics together to be rejected")
+	}
+}
@@ -0,0 +1,358 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// streamable reports whether the query's rows can be streamed into a frame as Harper's response is read: it needs
+// none of the processing that works on whole rows (grouping, transforms, aggregation, ...). Points are still
+// downsampled, once they've been read.
+func (q GetAnalyticsQuery) streamable() bool {
+	return !q.ComparePrevious && q.TimeShift == "" && len(q.AttributeRoles) == 0 && len(q.GroupBy) == 0 &&
+		q.Transform == "" && q.Aggregation == "" && len(q.Percentiles) == 0 && q.Format != analyticsFormatHeatmap
+}
+
+type getAnalyticsOperation struct {
+	Operation     string                  `json:"operation"`
+	Metric        string                  `json:"metric"`
+	GetAttributes harper.AttributeList    `json:"get_attributes,omitempty"`
+	StartTime     int64                   `json:"start_time,omitempty"`
+	EndTime       int64                   `json:"end_time,omitempty"`
+	CoalesceTime  bool                    `json:"coalesce_time,omitempty"`
+	Conditions    harper.SearchConditions `json:"conditions,omitempty"`
+}
+
+func (o getAnalyticsOperation) Prepare() any {
+	return o
+}
+
+// analyticsStreamKey is the context key of the *analyticsColumns a get_analytics request's response is decoded into.
+type analyticsStreamKey struct{}
+
+// streamAnalytics sends req through client with its response decoded into columns as it's read, up to maxRows rows if
+// it's over 0, with the rows' timestamps read in timeUnit (or the one detected from them). The client must be built on
+// a streamingTransport.
+func streamAnalytics(ctx context.Context, client HarperClient, req harper.GetAnalyticsRequest, timeUnit string, maxRows int) (*analyticsColumns, error) {
+	columns := newAnalyticsColumns()
+	columns.maxRows = maxRows
+	op := getAnalyticsOperation{
+		Operation:     harper.OP_GET_ANALYTICS,
+		Metric:        req.Metric,
+		GetAttributes: req.GetAttributes,
+		StartTime:     req.StartTime,
+		EndTime:       req.EndTime,
+		CoalesceTime:  req.CoalesceTime,
+		Conditions:    req.Conditions,
+	}
+	err := clientWithContext(client, context.WithValue(ctx, analyticsStreamKey{}, columns)).RawRequest(op, nil)
+	if err != nil {
+		return nil, err
+	}
+	if columns.err != nil {
+		return nil, columns.err
+	}
+	columns.setTimes(timeUnit)
+	return columns, nil
+}
+
+// streamingTransport wraps the transport of a Harper client to decode successful responses to requests whose context
+// carries an *analyticsColumns into it as they're read, leaving the SDK an empty body. The SDK would otherwise read
+// the whole body and unmarshal it into a map per row, many times the memory of the points themselves.
+type streamingTransport struct {
+	next http.RoundTripper
+}
+
+func (t streamingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	columns, ok := req.Context().Value(analyticsStreamKey{}).(*analyticsColumns)
+	if err != nil || !ok || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp, err
+	}
+	defer resp.Body.Close()
+
+	body := &readErrorRecorder{r: resp.Body}
+	if err := columns.decode(body); err != nil {
+		if body.err != nil {
+			// the connection failing part way through is a transport error like any other
+			return nil, body.err
+		}
+		// as the SDK reports responses it can't unmarshal
+		columns.err = &harper.OperationError{StatusCode: resp.StatusCode, Message: err.Error()}
+	}
+	resp.Body = http.NoBody
+	resp.ContentLength = 0
+	return resp, nil
+}
+
+// readErrorRecorder records the error, other than io.EOF, that reading r fails with.
+type readErrorRecorder struct {
+	r   io.Reader
+	err error
+}
+
+func (rr *readErrorRecorder) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	if err != nil && err != io.EOF {
+		rr.err = err
+	}
+	return n, err
+}
+
+// analyticsColumns are get_analytics rows decoded into a typed, nullable field per attribute. A field takes the type
+// of the first non-null value of its attribute; values of other types, and nested objects and arrays, are null.
+type analyticsColumns struct {
+	rows int
+	// ids are the rows' "id" timestamps as read (NaN where a row has none), until setTimes makes them a field.
+	ids    []float64
+	fields map[string]*data.Field
+	// untyped are the attributes that have only been null so far.
+	untyped map[string]bool
+
+	// maxRows is how many rows are decoded, if it's over 0, and truncated whether the response had more.
+	maxRows   int
+	truncated bool
+
+	// err is the error decoding the response failed with, if it did.
+	err error
+}
+
+func newAnalyticsColumns() *analyticsColumns {
+	return &analyticsColumns{fields: make(map[string]*data.Field), untyped: make(map[string]bool)}
+}
+
+// decode reads a get_analytics response, a JSON array of row objects, from r into c, replacing anything decoded
+// before (e.g. by an earlier attempt at the request). It stops reading at c's maxRows rows.
+func (c *analyticsColumns) decode(r io.Reader) error {
+	maxRows := c.maxRows
+	*c = *newAnalyticsColumns()
+	c.maxRows = maxRows
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '['); err != nil {
+		return err
+	}
+	for dec.More() {
+		if c.maxRows > 0 && c.rows == c.maxRows {
+			// (the rest of the response is left unread, closing the connection)
+			c.truncated = true
+			return nil
+		}
+		if err := c.decodeRow(dec); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+func (c *analyticsColumns) decodeRow(dec *json.Decoder) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	id := math.NaN()
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		value, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if _, ok := value.(json.Delim); ok {
+			if err := skipNested(dec); err != nil {
+				return err
+			}
+			value = nil
+		}
+		if key == "id" {
+			if ms, ok := value.(float64); ok {
+				id = ms
+			}
+			continue
+		}
+		c.set(key.(string), value)
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return err
+	}
+
+	c.ids = append(c.ids, id)
+	c.rows++
+	for _, f := range c.fields {
+		if f.Len() < c.rows {
+			f.Append(nil)
+		}
+	}
+	return nil
+}
+
+// set sets the attribute of the row being decoded to value.
+func (c *analyticsColumns) set(attr string, value any) {
+	f, ok := c.fields[attr]
+	if !ok {
+		var fieldType data.FieldType
+		switch value.(type) {
+		case string:
+			fieldType = data.FieldTypeNullableString
+		case bool:
+			fieldType = data.FieldTypeNullableBool
+		case float64:
+			fieldType = data.FieldTypeNullableFloat64
+		default:
+			c.untyped[attr] = true
+			return
+		}
+		f = data.NewFieldFromFieldType(fieldType, c.rows)
+		f.Name = attr
+		c.fields[attr] = f
+		delete(c.untyped, attr)
+	}
+	if f.Len() > c.rows {
+		// the attribute was repeated in the row
+		return
+	}
+
+	switch v := value.(type) {
+	case string:
+		if f.Type() == data.FieldTypeNullableString {
+			f.Append(&v)
+			return
+		}
+	case bool:
+		if f.Type() == data.FieldTypeNullableBool {
+			f.Append(&v)
+			return
+		}
+	case float64:
+		if f.Type() == data.FieldTypeNullableFloat64 {
+			f.Append(&v)
+			return
+		}
+	}
+	f.Append(nil)
+}
+
+// setTimes adds the rows' "id" timestamps as a time field, read in the named unit or the one detected from them, and
+// makes the string fields whose values are all RFC 3339 timestamps time fields, as fixAnalyticsTimes does for rows
+// read by the SDK.
+func (c *analyticsColumns) setTimes(unitName string) {
+	for attr, f := range c.fields {
+		if f.Type() == data.FieldTypeNullableString {
+			if times, ok := timeStringField(f); ok {
+				c.fields[attr] = times
+			}
+		}
+	}
+
+	values := make([]float64, 0, len(c.ids))
+	for _, id := range c.ids {
+		if !math.IsNaN(id) {
+			// (the SDK reads them as whole milliseconds)
+			values = append(values, float64(int64(id)))
+		}
+	}
+	if len(values) > 0 {
+		unit := epochUnit(unitName, values)
+		times := data.NewFieldFromFieldType(data.FieldTypeNullableTime, len(c.ids))
+		times.Name = "id"
+		for i, id := range c.ids {
+			if !math.IsNaN(id) {
+				ts := epochToTime(float64(int64(id)), unit)
+				times.Set(i, &ts)
+			}
+		}
+		c.fields["id"] = times
+	}
+	c.ids = nil
+}
+
+// timeStringField returns a nullable string field as a time field, if its values are all RFC 3339 timestamps.
+func timeStringField(f *data.Field) (*data.Field, bool) {
+	times := data.NewFieldFromFieldType(data.FieldTypeNullableTime, f.Len())
+	times.Name = f.Name
+	for i := range f.Len() {
+		s, ok := f.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		ts, ok := parseTimeString(s.(string))
+		if !ok {
+			return nil, false
+		}
+		times.Set(i, &ts)
+	}
+	return times, true
+}
+
+// results returns the rows as analytics results, one at a time, without their null attributes.
+func (c *analyticsColumns) results() iter.Seq[harper.GetAnalyticsResult] {
+	return func(yield func(harper.GetAnalyticsResult) bool) {
+		for i := range c.rows {
+			row := make(harper.GetAnalyticsResult, len(c.fields))
+			for name, f := range c.fields {
+				if v, ok := f.ConcreteAt(i); ok {
+					row[name] = v
+				}
+			}
+			if !yield(row) {
+				return
+			}
+		}
+	}
+}
+
+// frame returns the rows as a long frame with a field per attribute, in name order, and a "metric" field of metric.
+func (c *analyticsColumns) frame(metric string) *data.Frame {
+	fields := make(map[string]*data.Field, len(c.fields)+len(c.untyped))
+	maps.Copy(fields, c.fields)
+	for attr := range c.untyped {
+		fields[attr] = data.NewFieldFromFieldType(data.FieldTypeNullableString, c.rows)
+		fields[attr].Name = attr
+	}
+	delete(fields, "metric")
+
+	frame := data.NewFrame("")
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		frame.Fields = append(frame.Fields, fields[name])
+	}
+	return addMetricField(frame, metric, c.rows)
+}
+
+// expectDelim reads the next token from dec, failing unless it's want.
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return fmt.Errorf("unexpected %v in get_analytics response, expected '%s'", tok, want)
+	}
+	return nil
+}
+
+// skipNested reads the rest of the object or array just opened from dec.
+func skipNested(dec *json.Decoder) error {
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package plugin
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestAnalyticsColumnsDecode(t *testing.T) {
+	columns := newAnalyticsColumns()
+	err := columns.decode(strings.NewReader(`[
+		{"id": 1700000000, "node": "a", "count": 1, "nested": {"x": [1, 2]}, "unset": null},
+		{"id": 1700000060, "node": "b", "count": "many", "cached": true},
+		{"node": null, "count": 3.5}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns.setTimes("")
+
+	frame := columns.frame("db-read")
+	want := map[string]data.FieldType{
+		"cached": data.FieldTypeNullableBool,
+		"count":  data.FieldTypeNullableFloat64,
+		"id":     data.FieldTypeNullableTime,
+		"metric": data.FieldTypeNullableString,
+		"nested": data.FieldTypeNullableString,
+		"node":   data.FieldTypeNullableString,
+		"unset":  data.FieldTypeNullableString,
+	}
+	if len(frame.Fields) != len(want) {
+		t.Fatalf("expected fields %v, got %d", want, len(frame.Fields))
+	}
+	for i, f := range frame.Fields {
+		if i > 0 && f.Name < frame.Fields[i-1].Name {
+			t.Errorf("expected fields in name order, got %s after %s", f.Name, frame.Fields[i-1].Name)
+		}
+		if f.Type() != want[f.Name] || f.Len() != 3 {
+			t.Errorf("expected %s to be %d %s values, got %d %s", f.Name, 3, want[f.Name], f.Len(), f.Type())
+		}
+	}
+
+	// epoch seconds are detected from their magnitude
+	if ts, _ := frame.Fields[2].ConcreteAt(1); !ts.(time.Time).Equal(time.Unix(1700000060, 0)) {
+		t.Errorf("expected the second row at 1700000060s, got %v", ts)
+	}
+	// values of another type than the attribute's first are null, as are missing attributes
+	if _, ok := frame.Fields[1].ConcreteAt(1); ok {
+		t.Error("expected a string count to be null")
+	}
+	if _, ok := frame.Fields[0].ConcreteAt(0); ok {
+		t.Error("expected the first row's missing cached to be null")
+	}
+	if _, ok := frame.Fields[2].ConcreteAt(2); ok {
+		t.Error("expected the last row's missing id to be null")
+	}
+
+	for _, body := range []string{`{"error": "nope"}`, `[{"id": 1}`, `[1, 2]`} {
+		if err := newAnalyticsColumns().decode(strings.NewReader(body)); err == nil {
+			t.Errorf("expected %s to fail to decode", body)
+		}
+	}
+}
+
+// TestStreamAnalytics checks that queries streamed from Harper's responses return the same frames as they do when
+// their rows are read by the SDK.
+func TestStreamAnalytics(t *testing.T) {
+	start := time.UnixMilli(1700000000000)
+	var times []time.Time
+	for i := range 20 {
+		times = append(times, start.Add(time.Duration(i)*10*time.Second))
+	}
+	fake := newFakeHarperClient()
+	fake.addAnalytics("db-read", times, map[string]any{"node": "a", "count": 1.0})
+	fake.addAnalytics("db-read", times, map[string]any{"node": "b", "count": 2.0, "cached": true,
+		"lastRestart": "2024-05-01T12:00:00Z"})
+
+	var streamed int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var op map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&op)
+		w.Header().Set("Content-Type", "application/json")
+		if op["operation"] != "get_analytics" {
+			_, _ = w.Write([]byte("{}"))
+			return
+		}
+		streamed++
+		rows := make([]map[string]any, 0)
+		for _, row := range fake.analytics["db-read"] {
+			wire := make(map[string]any, len(row))
+			for k, v := range row {
+				wire[k] = v
+			}
+			wire["id"] = row["id"].(time.Time).UnixMilli()
+			rows = append(rows, wire)
+		}
+		// like Harper, in ascending time order
+		slices.SortStableFunc(rows, func(a, b map[string]any) int { return cmp.Compare(a["id"].(int64), b["id"].(int64)) })
+		_ = json.NewEncoder(w).Encode(rows)
+	}))
+	defer srv.Close()
+
+	jsonData, _ := json.Marshal(map[string]any{"opsAPIURL": srv.URL, "username": "admin", "metadataRefreshInterval": "0s"})
+	inst, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		UID:                     "stream-test",
+		JSONData:                jsonData,
+		DecryptedSecureJSONData: map[string]string{"password": "password"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := inst.(*Datasource)
+	defer ds.Dispose()
+
+	unstreamed, err := newDatasource("test-uid", Settings{}, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unstreamed.Dispose()
+
+	for _, tt := range []struct {
+		name          string
+		attrs         string
+		maxDataPoints int64
+	}{
+		{"time series", `{"metric": "db-read"}`, 100},
+		{"table", `{"metric": "db-read", "format": "table"}`, 100},
+		{"downsampled", `{"metric": "db-read"}`, 5},
+		{"instant", `{"metric": "db-read", "instant": true}`, 5},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			query := backend.DataQuery{
+				RefID:         "A",
+				MaxDataPoints: tt.maxDataPoints,
+				JSON:          []byte(`{"operation": "get_analytics", "queryAttrs": ` + tt.attrs + `}`),
+			}
+			before := streamed
+			got, err := ds.query(context.Background(), backend.PluginContext{}, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if streamed != before+1 {
+				t.Fatalf("expected the query to be streamed")
+			}
+			want, err := unstreamed.query(context.Background(), backend.PluginContext{}, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotJSON, _ := json.Marshal(got.Frames)
+			wantJSON, _ := json.Marshal(want.Frames)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("expected the streamed frames to match\n%s\ngot\n%s", wantJSON, gotJSON)
+			}
+		})
+	}
+}
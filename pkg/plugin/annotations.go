@@ -0,0 +1,154 @@
+package plugin
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	annotationLogAudit       = "audit"
+	annotationLogTransaction = "transaction"
+)
+
+// AnnotationsQuery turns a table's audit log (the default) or transaction log entries between From and To (epoch
+// milliseconds) into annotations, so deploys and bulk writes show up as event markers on dashboards. Operations, if
+// set, limits them to those operations (e.g. "insert", "delete"). At most Limit annotations, the latest, are
+// returned.
+type AnnotationsQuery struct {
+	Database   string   `json:"database" validate:"required"`
+	Table      string   `json:"table" validate:"required"`
+	Log        string   `json:"log"`
+	From       int64    `json:"from"`
+	To         int64    `json:"to"`
+	Operations []string `json:"operations"`
+	Limit      int      `json:"limit"`
+}
+
+type readAuditLogOperation struct {
+	Operation    string  `json:"operation"`
+	Schema       string  `json:"schema"`
+	Table        string  `json:"table"`
+	SearchType   string  `json:"search_type,omitempty"`
+	SearchValues []int64 `json:"search_values,omitempty"`
+}
+
+func (o readAuditLogOperation) Prepare() any {
+	return o
+}
+
+type readTransactionLogOperation struct {
+	Operation string `json:"operation"`
+	Schema    string `json:"schema"`
+	Table     string `json:"table"`
+	From      int64  `json:"from,omitempty"`
+	To        int64  `json:"to,omitempty"`
+}
+
+func (o readTransactionLogOperation) Prepare() any {
+	return o
+}
+
+// writeLogEntry is an entry of the audit or transaction log. Timestamps are epoch milliseconds, possibly fractional.
+type writeLogEntry struct {
+	Operation  string           `json:"operation"`
+	UserName   string           `json:"user_name"`
+	Timestamp  float64          `json:"timestamp"`
+	HashValues []any            `json:"hash_values"`
+	Records    []map[string]any `json:"records"`
+}
+
+// queryAnnotations returns the log entries as an annotations frame: their time, a text describing the write, and
+// tags naming the operation, table and user.
+func (d *Datasource) queryAnnotations(client HarperClient, refID string, request AnnotationsQuery) (backend.DataResponse, error) {
+	logName := cmp.Or(request.Log, annotationLogAudit)
+	var op harper.Operation
+	var operation string
+	switch logName {
+	case annotationLogAudit:
+		audit := readAuditLogOperation{Operation: harper.OP_READ_AUDIT_LOG, Schema: request.Database, Table: request.Table}
+		if request.From > 0 && request.To > 0 {
+			audit.SearchType = harper.LogSearchTypeTimestamp
+			audit.SearchValues = []int64{request.From, request.To}
+		}
+		op, operation = audit, audit.Operation
+	case annotationLogTransaction:
+		op = readTransactionLogOperation{
+			Operation: harper.OP_READ_TRANSACTION_LOG,
+			Schema:    request.Database,
+			Table:     request.Table,
+			From:      request.From,
+			To:        request.To,
+		}
+		operation = harper.OP_READ_TRANSACTION_LOG
+	default:
+		return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.log", Problem: "expected 'audit' or 'transaction'"}
+	}
+	limit := request.Limit
+	if limit <= 0 {
+		limit = defaultLogLimit
+	}
+
+	d.logger.Debug("executing Harper operation", "refID", refID, "operation", operation, "request", op)
+	start := time.Now()
+	var entries []writeLogEntry
+	if err := client.RawRequest(op, &entries); err != nil {
+		return backend.DataResponse{}, fmt.Errorf("could not read the %s log of '%s.%s': '%w'", logName, request.Database, request.Table, err)
+	}
+	d.logger.Debug("Harper operation completed", "refID", refID, "operation", operation,
+		"duration", time.Since(start), "results", len(entries))
+
+	entries = slices.DeleteFunc(entries, func(e writeLogEntry) bool {
+		ts := int64(e.Timestamp)
+		return (request.From > 0 && ts < request.From) || (request.To > 0 && ts > request.To) ||
+			(len(request.Operations) > 0 && !slices.Contains(request.Operations, e.Operation))
+	})
+	slices.SortStableFunc(entries, func(a, b writeLogEntry) int { return cmp.Compare(a.Timestamp, b.Timestamp) })
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+
+	table := request.Database + "." + request.Table
+	times := make([]time.Time, len(entries))
+	texts := make([]string, len(entries))
+	tags := make([]json.RawMessage, len(entries))
+	for i, entry := range entries {
+		times[i] = time.UnixMicro(int64(entry.Timestamp * 1000))
+		texts[i] = annotationText(entry, table)
+		entryTags := []string{entry.Operation, table}
+		if entry.UserName != "" {
+			entryTags = append(entryTags, entry.UserName)
+		}
+		tags[i], _ = json.Marshal(entryTags)
+	}
+
+	frame := data.NewFrame(frameName(refID, table+" "+logName+" log"),
+		data.NewField("time", nil, times),
+		data.NewField("text", nil, texts),
+		data.NewField("tags", nil, tags),
+	).SetRefID(refID)
+
+	return backend.DataResponse{Frames: data.Frames{frame}}, nil
+}
+
+// annotationText describes a log entry, e.g. "insert of 3 records in dev.dog by admin".
+func annotationText(entry writeLogEntry, table string) string {
+	count := max(len(entry.HashValues), len(entry.Records))
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s of %d record", entry.Operation, count)
+	if count != 1 {
+		b.WriteString("s")
+	}
+	fmt.Fprintf(&b, " in %s", table)
+	if entry.UserName != "" {
+		fmt.Fprintf(&b, " by %s", entry.UserName)
+	}
+	return b.String()
+}
@@ -0,0 +1,60 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestQueryAnnotations(t *testing.T) {
+	var sent map[string]any
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "read_audit_log" && op["operation"] != "read_transaction_log" {
+			return nil, nil
+		}
+		sent = op
+		return json.RawMessage(`[
+			{"operation":"delete","user_name":"admin","timestamp":1714564802000.5,"hash_values":[3]},
+			{"operation":"insert","user_name":"admin","timestamp":1714564801000,"hash_values":[1,2],"records":[{"id":1},{"id":2}]},
+			{"operation":"update","user_name":"admin","timestamp":1714564700000,"hash_values":[1]}
+		]`), nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	query := func(attrs map[string]any) backend.DataResponse {
+		t.Helper()
+		queryJSON, _ := json.Marshal(map[string]any{"operation": "annotations", "queryAttrs": attrs})
+		res, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: queryJSON})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := query(map[string]any{"database": "dev", "table": "dog", "from": 1714564800000, "to": 1714568400000})
+	if sent["operation"] != "read_audit_log" || sent["search_type"] != "timestamp" || sent["schema"] != "dev" {
+		t.Errorf("unexpected operation %v", sent)
+	}
+	frame := res.Frames[0]
+	// the update is before the range
+	if frame.Rows() != 2 {
+		t.Fatalf("expected 2 annotations, got %d", frame.Rows())
+	}
+	if text := frame.Fields[1].At(0); text != "insert of 2 records in dev.dog by admin" {
+		t.Errorf("expected the earliest entry first, got %v", text)
+	}
+	if tags := string(frame.Fields[2].At(1).(json.RawMessage)); tags != `["delete","dev.dog","admin"]` {
+		t.Errorf("unexpected tags %s", tags)
+	}
+
+	res = query(map[string]any{"database": "dev", "table": "dog", "log": "transaction", "operations": []string{"delete"}})
+	if sent["operation"] != "read_transaction_log" {
+		t.Errorf("expected the transaction log to be read, got %v", sent)
+	}
+	if res.Frames[0].Rows() != 1 {
+		t.Errorf("expected only the delete, got %d annotations", res.Frames[0].Rows())
+	}
+}
@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	auditSinkLog   = "log"
+	auditSinkTable = "table"
+)
+
+// AuditSettings configure the query audit trail. When enabled, every executed query is recorded either to the
+// plugin's log stream (Sink "log", the default) or as a record inserted into a Harper table (Sink "table").
+type AuditSettings struct {
+	Enabled  bool   `json:"enabled"`
+	Sink     string `json:"sink"`
+	Database string `json:"database"`
+	Table    string `json:"table"`
+}
+
+// auditRecord is what's recorded about each executed query.
+type auditRecord struct {
+	Timestamp    time.Time       `json:"timestamp"`
+	User         string          `json:"user"`
+	OrgID        int64           `json:"orgId"`
+	DashboardUID string          `json:"dashboardUid,omitempty"`
+	PanelID      string          `json:"panelId,omitempty"`
+	RefID        string          `json:"refId"`
+	Query        json.RawMessage `json:"query"`
+	DurationMs   int64           `json:"durationMs"`
+	Rows         int             `json:"rows"`
+	Error        string          `json:"error,omitempty"`
+}
+
+// auditor writes audit records to the configured sink.
+type auditor struct {
+	settings AuditSettings
+	logger   log.Logger
+
+	// client is used for the "table" sink. It's the datasource's underlying client, as audit inserts are the
+	// datasource's own writes and mustn't be blocked by the read-only operation policy.
+	client HarperClient
+}
+
+// newAuditor returns an auditor for settings, or nil if auditing is disabled.
+func newAuditor(settings AuditSettings, client HarperClient, logger log.Logger) (*auditor, error) {
+	if !settings.Enabled {
+		return nil, nil
+	}
+
+	switch settings.Sink {
+	case "", auditSinkLog:
+	case auditSinkTable:
+		if settings.Database == "" || settings.Table == "" {
+			return nil, fmt.Errorf("the audit table sink requires a database and table")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported audit sink '%s'", settings.Sink)
+	}
+
+	return &auditor{settings: settings, client: client, logger: logger}, nil
+}
+
+// record writes rec to the sink. Table inserts happen in the background so auditing doesn't slow queries down;
+// failures are logged.
+func (a *auditor) record(rec auditRecord) {
+	if a.settings.Sink != auditSinkTable {
+		a.logger.Info("Harper query audit", "user", rec.User, "orgID", rec.OrgID, "dashboardUID", rec.DashboardUID,
+			"panelID", rec.PanelID, "refID", rec.RefID, "query", string(rec.Query), "durationMs", rec.DurationMs,
+			"rows", rec.Rows, "error", rec.Error)
+		return
+	}
+
+	go func() {
+		op := rawOperation{
+			"operation": "insert",
+			"database":  a.settings.Database,
+			"table":     a.settings.Table,
+			"records":   []auditRecord{rec},
+		}
+		if err := a.client.RawRequest(op, nil); err != nil {
+			a.logger.Error("failed to write query audit record to Harper", "error", err)
+		}
+	}()
+}
+
+// newAuditRecord describes the query q as executed for pCtx's user, with the dashboard and panel taken from the
+// request headers Grafana sends along with panel queries.
+func newAuditRecord(pCtx backend.PluginContext, headers http.Header, q backend.DataQuery) auditRecord {
+	rec := auditRecord{
+		Timestamp: time.Now().UTC(),
+		OrgID:     pCtx.OrgID,
+		RefID:     q.RefID,
+		Query:     q.JSON,
+	}
+	if pCtx.User != nil {
+		rec.User = pCtx.User.Login
+	}
+	rec.DashboardUID = headers.Get("X-Dashboard-Uid")
+	rec.PanelID = headers.Get("X-Panel-Id")
+	return rec
+}
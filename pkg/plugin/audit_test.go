@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestAuditTableSink(t *testing.T) {
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_000_000)
+	client.addAnalytics("db-read", []time.Time{start, start.Add(time.Second)}, map[string]any{"node": "node-1", "count": 5.0})
+
+	inserted := make(chan map[string]any, 1)
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] == "insert" {
+			inserted <- op
+		}
+		return nil, nil
+	}
+
+	ds := newTestDatasource(t, Settings{
+		Audit: AuditSettings{Enabled: true, Sink: "table", Database: "grafana", Table: "audit"},
+	}, client)
+
+	req := &backend.QueryDataRequest{
+		PluginContext: backend.PluginContext{OrgID: 1, User: &backend.User{Login: "viewer"}},
+		Headers:       map[string]string{"X-Dashboard-Uid": "dash-1", "X-Panel-Id": "4"},
+		Queries:       []backend.DataQuery{analyticsQuery("A", map[string]any{"metric": "db-read"})},
+	}
+	if _, err := ds.QueryData(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case op := <-inserted:
+		if op["operation"] != "insert" || op["database"] != "grafana" || op["table"] != "audit" {
+			t.Fatalf("unexpected audit operation: %v", op)
+		}
+		rec := op["records"].([]any)[0].(map[string]any)
+		if rec["user"] != "viewer" || rec["dashboardUid"] != "dash-1" || rec["panelId"] != "4" || rec["rows"] != 2.0 {
+			t.Errorf("unexpected audit record: %v", rec)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no audit record was written")
+	}
+}
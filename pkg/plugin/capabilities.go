@@ -0,0 +1,181 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	harper "github.com/HarperFast/sdk-go"
+)
+
+// AnalyticsUnavailableError is returned for analytics operations when the Harper server doesn't support or has
+// disabled the analytics API. Other operations keep working.
+type AnalyticsUnavailableError struct {
+	Err error
+}
+
+func (e *AnalyticsUnavailableError) Error() string {
+	return fmt.Sprintf("the Harper analytics API isn't available on this server (%s) — use a Harper version with "+
+		"analytics enabled, or query tables instead of metrics", e.Err)
+}
+
+func (e *AnalyticsUnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// isUnsupportedOperationError reports whether err is Harper rejecting an operation it doesn't know or has disabled,
+// as opposed to the operation failing.
+func isUnsupportedOperationError(err error) bool {
+	var opErr *harper.OperationError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	if opErr.StatusCode == http.StatusNotImplemented {
+		return true
+	}
+	if opErr.StatusCode != http.StatusBadRequest && opErr.StatusCode != http.StatusNotFound {
+		return false
+	}
+
+	msg := strings.ToLower(opErr.Message)
+	if !strings.Contains(msg, "operation") {
+		return false
+	}
+	for _, s := range []string{"not found", "unknown", "not supported", "unsupported", "disabled", "invalid operation"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// capabilities tracks which optional Harper APIs the server turned out to support, as discovered by the operations
+// the datasource makes.
+type capabilities struct {
+	mu           sync.RWMutex
+	checked      bool
+	analyticsErr error
+}
+
+// observeAnalytics records the outcome of an analytics operation and returns err, converted to an
+// *AnalyticsUnavailableError if it shows the analytics API is unavailable.
+func (c *capabilities) observeAnalytics(err error) error {
+	unavailable := isUnsupportedOperationError(err)
+	if err != nil && !unavailable {
+		// an ordinary failure says nothing about support
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checked = true
+	if unavailable {
+		c.analyticsErr = &AnalyticsUnavailableError{Err: err}
+		return c.analyticsErr
+	}
+	c.analyticsErr = nil
+	return nil
+}
+
+// capabilityReport is the GET /capabilities response.
+type capabilityReport struct {
+	Analytics capabilityStatus `json:"analytics"`
+}
+
+// capabilityStatus reports whether an API is available. Checked is false until an operation has told either way.
+type capabilityStatus struct {
+	Checked   bool   `json:"checked"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+func (c *capabilities) report() capabilityReport {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	analytics := capabilityStatus{Checked: c.checked, Available: c.analyticsErr == nil}
+	if c.analyticsErr != nil {
+		analytics.Reason = c.analyticsErr.Error()
+	}
+	return capabilityReport{Analytics: analytics}
+}
+
+// capabilityClient wraps a HarperClient to track the availability of the analytics API.
+type capabilityClient struct {
+	HarperClient
+	capabilities *capabilities
+}
+
+func (cc *capabilityClient) withContext(ctx context.Context) HarperClient {
+	return &capabilityClient{HarperClient: clientWithContext(cc.HarperClient, ctx), capabilities: cc.capabilities}
+}
+
+func (cc *capabilityClient) GetAnalytics(req harper.GetAnalyticsRequest) ([]harper.GetAnalyticsResult, error) {
+	results, err := cc.HarperClient.GetAnalytics(req)
+	return results, cc.capabilities.observeAnalytics(err)
+}
+
+func (cc *capabilityClient) ListMetrics(req harper.ListMetricsRequest) ([]harper.ListMetricsResult, error) {
+	metrics, err := cc.HarperClient.ListMetrics(req)
+	return metrics, cc.capabilities.observeAnalytics(err)
+}
+
+func (cc *capabilityClient) DescribeMetric(metric string) (*harper.DescribeMetricResult, error) {
+	desc, err := cc.HarperClient.DescribeMetric(metric)
+	return desc, cc.capabilities.observeAnalytics(err)
+}
+
+// RawRequest tracks the analytics operations sent as raw requests too, as streamed analytics queries are.
+func (cc *capabilityClient) RawRequest(op harper.Operation, result any) error {
+	err := cc.HarperClient.RawRequest(op, result)
+	if isAnalyticsOperation(op) {
+		return cc.capabilities.observeAnalytics(err)
+	}
+	return err
+}
+
+// isAnalyticsOperation reports whether op is one of the analytics API's.
+func isAnalyticsOperation(op harper.Operation) bool {
+	switch op := op.(type) {
+	case getAnalyticsOperation:
+		return true
+	case rawOperation:
+		analyticsOperations := []any{harper.OP_GET_ANALYTICS, harper.OP_LIST_METRICS, harper.OP_DESCRIBE_METRIC}
+		return slices.Contains(analyticsOperations, op["operation"])
+	}
+	return false
+}
+
+type capabilitiesHandler struct {
+	datasource *Datasource
+}
+
+func newCapabilitiesHandler(datasource *Datasource) *capabilitiesHandler {
+	return &capabilitiesHandler{datasource: datasource}
+}
+
+func (ch *capabilitiesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+
+	jsonResp, err := json.Marshal(ch.datasource.capabilities.report())
+	if err != nil {
+		ch.datasource.logger.Error("error marshaling capabilities to JSON", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(jsonResp)
+	if err != nil {
+		ch.datasource.logger.Error("error writing response", "error", err)
+	}
+}
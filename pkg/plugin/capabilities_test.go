@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestAnalyticsUnavailable(t *testing.T) {
+	client := newFakeHarperClient()
+	client.err = &harper.OperationError{StatusCode: 400, Message: "Operation 'get_analytics' not found"}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{analyticsQuery("A", map[string]any{"metric": "db-read"})},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := resp.Responses["A"]
+	if res.Status != backend.StatusNotImplemented {
+		t.Errorf("expected an analytics unavailable error, got %v (%s)", res.Error, res.Status)
+	}
+	if report := ds.capabilities.report(); report.Analytics.Available {
+		t.Errorf("expected analytics to be reported unavailable")
+	}
+
+	if isUnsupportedOperationError(&harper.OperationError{StatusCode: 400, Message: "metric 'x' does not exist"}) {
+		t.Errorf("expected an ordinary error not to be taken for an unsupported operation")
+	}
+}
+
+func TestStreamedAnalyticsUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error": "Operation 'get_analytics' not found"}`))
+	}))
+	defer srv.Close()
+
+	jsonData, _ := json.Marshal(map[string]any{"opsAPIURL": srv.URL, "username": "admin", "metadataRefreshInterval": "0s"})
+	inst, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		UID:                     t.Name(),
+		JSONData:                jsonData,
+		DecryptedSecureJSONData: map[string]string{"password": "password"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := inst.(*Datasource)
+	defer ds.Dispose()
+	if !ds.streamsAnalytics {
+		t.Fatal("expected the datasource to stream analytics queries")
+	}
+
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{analyticsQuery("A", map[string]any{"metric": "db-read"})},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := resp.Responses["A"]; res.Status != backend.StatusNotImplemented {
+		t.Errorf("expected an analytics unavailable error, got %v (%s)", res.Error, res.Status)
+	}
+	if report := ds.capabilities.report(); !report.Analytics.Checked || report.Analytics.Available {
+		t.Errorf("expected analytics to be reported unavailable, got %+v", report.Analytics)
+	}
+}
@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// defaultMaxRows is how many rows a query reads from Harper unless MaxRows is set.
+	defaultMaxRows = 1_000_000
+	// defaultMaxSeries is how many series an analytics time series query returns unless MaxSeries is set.
+	defaultMaxSeries = 1_000
+)
+
+func (d *Datasource) maxRows() int {
+	return cmp.Or(d.settings.MaxRows, defaultMaxRows)
+}
+
+func (d *Datasource) maxSeries() int {
+	return cmp.Or(d.settings.MaxSeries, defaultMaxSeries)
+}
+
+func maxRowsNotice(maxRows int) data.Notice {
+	return data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text: fmt.Sprintf("Results truncated to the first %d rows, the datasource's maximum; narrow the time range "+
+			"or filter the query", maxRows),
+	}
+}
+
+func maxSeriesNotice(maxSeries int, total int) data.Notice {
+	return data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text: fmt.Sprintf("Showing the first %d of %d series by label, the datasource's maximum; filter the query "+
+			"or limit it to its top K series", maxSeries, total),
+	}
+}
+
+// labelSetKey orders series by their label values, in label name order: the order series are kept in when there are
+// more than the maximum.
+func labelSetKey(labels data.Labels) string {
+	values := make([]string, 0, len(labels))
+	for _, name := range slices.Sorted(maps.Keys(labels)) {
+		values = append(values, labels[name])
+	}
+	return strings.Join(values, "\x00")
+}
+
+// keptSeries returns which of keys, in labelSetKey order, are among the first maxSeries distinct ones, and how many
+// distinct keys there are.
+func keptSeries(keys []string, maxSeries int) (kept map[string]bool, total int) {
+	distinct := slices.Compact(slices.Sorted(slices.Values(keys)))
+	kept = make(map[string]bool, min(len(distinct), maxSeries))
+	for _, key := range distinct[:min(len(distinct), maxSeries)] {
+		kept[key] = true
+	}
+	return kept, len(distinct)
+}
+
+// capWideSeries drops the value fields of a wide frame's series after the first maxSeries, returning the notice of
+// it if it does. Fields without labels are kept.
+func capWideSeries(frame *data.Frame, maxSeries int) (data.Notice, bool) {
+	var keys []string
+	for _, field := range frame.Fields {
+		if len(field.Labels) > 0 {
+			keys = append(keys, labelSetKey(field.Labels))
+		}
+	}
+	kept, total := keptSeries(keys, maxSeries)
+	if total <= maxSeries {
+		return data.Notice{}, false
+	}
+
+	frame.Fields = slices.DeleteFunc(frame.Fields, func(f *data.Field) bool {
+		return len(f.Labels) > 0 && !kept[labelSetKey(f.Labels)]
+	})
+	return maxSeriesNotice(maxSeries, total), true
+}
+
+// capMultiSeries is capWideSeries for a multi time series, dropping the frames of series after the first maxSeries.
+func capMultiSeries(frames data.Frames, maxSeries int) (data.Frames, data.Notice, bool) {
+	keys := make([]string, len(frames))
+	for i, frame := range frames {
+		keys[i] = labelSetKey(frame.Fields[len(frame.Fields)-1].Labels)
+	}
+	kept, total := keptSeries(keys, maxSeries)
+	if total <= maxSeries {
+		return frames, data.Notice{}, false
+	}
+
+	var capped data.Frames
+	for i, frame := range frames {
+		if kept[keys[i]] {
+			capped = append(capped, frame)
+		}
+	}
+	return capped, maxSeriesNotice(maxSeries, total), true
+}
@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestMaxSeries(t *testing.T) {
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_000_000)
+	times := []time.Time{start, start.Add(time.Minute)}
+	// (the series kept are the first by label, whichever order they're seen in)
+	for _, node := range []string{"e", "c", "a", "d", "b"} {
+		client.addAnalytics("db-read", times, map[string]any{"node": node, "count": 1.0})
+	}
+
+	direct := newTestDatasource(t, Settings{MaxSeries: 2}, client)
+	legacy := newTestDatasource(t, Settings{MaxSeries: 2, LegacyTimeSeriesFrames: true}, client)
+
+	for _, attrs := range []map[string]any{
+		{"metric": "db-read"},
+		{"metric": "db-read", "format": analyticsFormatTimeSeriesMulti},
+		{"metric": "db-read", "topK": 1},
+	} {
+		query := analyticsQuery("A", attrs)
+		got, err := direct.query(context.Background(), backend.PluginContext{}, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := legacy.query(context.Background(), backend.PluginContext{}, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotJSON, _ := json.Marshal(got.Frames)
+		wantJSON, _ := json.Marshal(want.Frames)
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("%v: expected the direct frames to match\n%s\ngot\n%s", attrs, wantJSON, gotJSON)
+		}
+
+		var nodes []string
+		for _, frame := range got.Frames {
+			for _, field := range frame.Fields {
+				if field.Labels != nil {
+					nodes = append(nodes, field.Labels["node"])
+				}
+			}
+		}
+		if attrs["topK"] == nil && strings.Join(nodes, ",") != "a,b" {
+			t.Errorf("%v: expected the series of nodes a and b, got %v", attrs, nodes)
+		}
+		notices := got.Frames[0].Meta.Notices
+		if !slices.ContainsFunc(notices, func(n data.Notice) bool { return strings.Contains(n.Text, "first 2 of 5 series") }) {
+			t.Errorf("%v: expected a notice of the dropped series, got %v", attrs, notices)
+		}
+	}
+}
+
+func TestMaxRows(t *testing.T) {
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_000_000)
+	var times []time.Time
+	for i := range 5 {
+		times = append(times, start.Add(time.Duration(i)*time.Minute))
+	}
+	client.addAnalytics("db-read", times, map[string]any{"node": "a", "count": 1.0})
+	client.raw = func(op map[string]any) (any, error) {
+		switch op["operation"] {
+		case "sql":
+			return json.RawMessage(`[{"id":1},{"id":2},{"id":3},{"id":4}]`), nil
+		case "search_by_conditions":
+			records := []map[string]any{{"id": 1}, {"id": 2}, {"id": 3}, {"id": 4}}
+			if limit, ok := op["limit"].(float64); ok && int(limit) < len(records) {
+				records = records[:int(limit)]
+			}
+			return records, nil
+		}
+		return nil, nil
+	}
+	ds := newTestDatasource(t, Settings{MaxRows: 3}, client)
+
+	for _, tt := range []struct {
+		name  string
+		query backend.DataQuery
+	}{
+		{"analytics", analyticsQuery("A", map[string]any{"metric": "db-read", "format": analyticsFormatTable})},
+		{"sql", backend.DataQuery{RefID: "A", JSON: []byte(`{"operation": "sql", "queryAttrs": {"sql": "SELECT id FROM dev.dog"}}`)}},
+		{"search", backend.DataQuery{RefID: "A", JSON: []byte(`{"operation": "search_by_conditions", "queryAttrs": {"database": "dev", "table": "dog"}}`)}},
+		{"search over the maximum", backend.DataQuery{RefID: "A", JSON: []byte(`{"operation": "search_by_conditions", "queryAttrs": {"database": "dev", "table": "dog", "limit": 10}}`)}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ds.query(context.Background(), backend.PluginContext{}, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			frame := res.Frames[0]
+			if frame.Rows() != 3 {
+				t.Errorf("expected 3 rows, got %d", frame.Rows())
+			}
+			if frame.Meta == nil || len(frame.Meta.Notices) != 1 || frame.Meta.Notices[0].Severity != data.NoticeSeverityWarning {
+				t.Errorf("expected a truncation warning, got %+v", frame.Meta)
+			}
+		})
+	}
+
+	columns := newAnalyticsColumns()
+	columns.maxRows = 2
+	if err := columns.decode(strings.NewReader(`[{"id": 1}, {"id": 2}, {"id": 3}, {"id"`)); err != nil {
+		t.Fatal(err)
+	}
+	if columns.rows != 2 || !columns.truncated {
+		t.Errorf("expected decoding to stop after 2 rows, got %d (truncated: %t)", columns.rows, columns.truncated)
+	}
+}
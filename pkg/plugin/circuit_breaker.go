@@ -0,0 +1,260 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitCooldown         = 30 * time.Second
+)
+
+// CircuitBreakerSettings configure the circuit breaker that stops queries from waiting out full timeouts while
+// Harper is down. After FailureThreshold (default 5) consecutive operations fail because Harper can't be reached,
+// operations fail straight away for Cooldown (default "30s"); then one operation is let through as a probe, closing
+// the circuit if it succeeds and reopening it if not.
+type CircuitBreakerSettings struct {
+	Disabled         bool   `json:"disabled"`
+	FailureThreshold int    `json:"failureThreshold"`
+	Cooldown         string `json:"cooldown"`
+}
+
+// CircuitOpenError reports that an operation wasn't sent because Harper has been unreachable.
+type CircuitOpenError struct {
+	Failures int
+	Until    time.Time
+	LastErr  error
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("Harper is unreachable (%d consecutive failures, last: '%s'); not retrying until %s",
+		e.Failures, e.LastErr, e.Until.Format(time.TimeOnly))
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return e.LastErr
+}
+
+// circuitBreaker is the circuit state of an instance's connection to Harper.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	logger    log.Logger
+
+	mu       sync.Mutex
+	failures int
+	lastErr  error
+	// openUntil is when the circuit lets a probe through, or zero if it's closed.
+	openUntil time.Time
+	probing   bool
+}
+
+// newCircuitBreaker returns the circuit breaker for settings, or nil if it's disabled.
+func newCircuitBreaker(settings CircuitBreakerSettings, logger log.Logger) (*circuitBreaker, error) {
+	if settings.Disabled {
+		return nil, nil
+	}
+	cb := &circuitBreaker{threshold: defaultCircuitFailureThreshold, cooldown: defaultCircuitCooldown, logger: logger}
+	if settings.FailureThreshold < 0 {
+		return nil, fmt.Errorf("invalid failure threshold %d", settings.FailureThreshold)
+	}
+	if settings.FailureThreshold > 0 {
+		cb.threshold = settings.FailureThreshold
+	}
+	if settings.Cooldown != "" {
+		cooldown, err := time.ParseDuration(settings.Cooldown)
+		if err != nil || cooldown <= 0 {
+			return nil, fmt.Errorf("invalid cooldown '%s'", settings.Cooldown)
+		}
+		cb.cooldown = cooldown
+	}
+	return cb, nil
+}
+
+// allow returns a *CircuitOpenError if the circuit is open. Once the cooldown has passed, a single caller is allowed
+// through as the probe.
+func (cb *circuitBreaker) allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.openUntil.IsZero() {
+		return nil
+	}
+	if !cb.probing && !time.Now().Before(cb.openUntil) {
+		cb.probing = true
+		return nil
+	}
+	return &CircuitOpenError{Failures: cb.failures, Until: cb.openUntil, LastErr: cb.lastErr}
+}
+
+// record updates the circuit with the outcome of an operation that was allowed through.
+func (cb *circuitBreaker) record(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	wasProbe := cb.probing
+	cb.probing = false
+
+	if isCancelledError(err) {
+		// a caller giving up says nothing about Harper; the next caller probes instead
+		return
+	}
+	if err == nil || !isOutageError(err) {
+		if !cb.openUntil.IsZero() {
+			cb.logger.Info("Harper is reachable again; closing the circuit")
+		}
+		cb.failures = 0
+		cb.lastErr = nil
+		cb.openUntil = time.Time{}
+		return
+	}
+
+	cb.failures++
+	cb.lastErr = err
+	if wasProbe || cb.failures >= cb.threshold {
+		if cb.openUntil.IsZero() {
+			cb.logger.Warn("Harper is unreachable; opening the circuit", "failures", cb.failures, "error", err,
+				"cooldown", cb.cooldown)
+		}
+		cb.openUntil = time.Now().Add(cb.cooldown)
+	}
+}
+
+// release ends an operation that was allowed through without recording its outcome, as its caller gave up on it.
+// If it was the probe, the next caller probes instead.
+func (cb *circuitBreaker) release() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.probing = false
+}
+
+// circuitDiagnostics is a point-in-time copy of a circuitBreaker, as reported by /diagnostics.
+type circuitDiagnostics struct {
+	Open      bool      `json:"open"`
+	Failures  int       `json:"failures"`
+	OpenUntil time.Time `json:"openUntil,omitzero"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+func (cb *circuitBreaker) diagnostics() *circuitDiagnostics {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	diag := &circuitDiagnostics{Open: !cb.openUntil.IsZero(), Failures: cb.failures, OpenUntil: cb.openUntil}
+	if cb.lastErr != nil {
+		diag.LastError = cb.lastErr.Error()
+	}
+	return diag
+}
+
+// isOutageError reports whether err is Harper being unreachable or unavailable, rather than rejecting an operation.
+func isOutageError(err error) bool {
+	if isTimeoutError(err) {
+		return true
+	}
+	var opErr *harper.OperationError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	switch opErr.StatusCode {
+	case 0:
+		return !isCancelledError(err)
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// isCancelledError reports whether err is (or, for Harper client errors, describes) the caller cancelling the
+// operation.
+func isCancelledError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return true
+	}
+	var opErr *harper.OperationError
+	return errors.As(err, &opErr) && opErr.StatusCode == 0 && strings.Contains(opErr.Message, context.Canceled.Error())
+}
+
+// breakerClient wraps a HarperClient to fail operations fast while its circuit breaker is open. Health checks always
+// go through, so the datasource's health check and connection warm-up report Harper's actual state, and close the
+// circuit when they succeed.
+type breakerClient struct {
+	HarperClient
+	breaker *circuitBreaker
+
+	// ctx is the context the client's calls are made under. Operations that fail once it's done failed because the
+	// caller gave up, not because of Harper.
+	ctx context.Context
+}
+
+// newBreakerClient returns client wrapped in breaker, or client itself if breaker is nil.
+func newBreakerClient(client HarperClient, breaker *circuitBreaker) HarperClient {
+	if breaker == nil {
+		return client
+	}
+	return &breakerClient{HarperClient: client, breaker: breaker, ctx: context.Background()}
+}
+
+func (bc *breakerClient) withContext(ctx context.Context) HarperClient {
+	return &breakerClient{HarperClient: clientWithContext(bc.HarperClient, ctx), breaker: bc.breaker, ctx: ctx}
+}
+
+// record records the outcome of an operation with the breaker, unless it failed after the caller's context was done
+// (say a dashboard's own timeout) or while waiting for a request slot, which says nothing about Harper's health.
+func (bc *breakerClient) record(err error) {
+	var slotErr *SlotWaitError
+	if err != nil && (bc.ctx.Err() != nil || errors.As(err, &slotErr)) {
+		bc.breaker.release()
+		return
+	}
+	bc.breaker.record(err)
+}
+
+func (bc *breakerClient) Healthcheck() error {
+	err := bc.HarperClient.Healthcheck()
+	bc.record(err)
+	return err
+}
+
+func (bc *breakerClient) GetAnalytics(req harper.GetAnalyticsRequest) ([]harper.GetAnalyticsResult, error) {
+	if err := bc.breaker.allow(); err != nil {
+		return nil, err
+	}
+	results, err := bc.HarperClient.GetAnalytics(req)
+	bc.record(err)
+	return results, err
+}
+
+func (bc *breakerClient) ListMetrics(req harper.ListMetricsRequest) ([]harper.ListMetricsResult, error) {
+	if err := bc.breaker.allow(); err != nil {
+		return nil, err
+	}
+	metrics, err := bc.HarperClient.ListMetrics(req)
+	bc.record(err)
+	return metrics, err
+}
+
+func (bc *breakerClient) DescribeMetric(metric string) (*harper.DescribeMetricResult, error) {
+	if err := bc.breaker.allow(); err != nil {
+		return nil, err
+	}
+	desc, err := bc.HarperClient.DescribeMetric(metric)
+	bc.record(err)
+	return desc, err
+}
+
+func (bc *breakerClient) RawRequest(op harper.Operation, result any) error {
+	if err := bc.breaker.allow(); err != nil {
+		return err
+	}
+	err := bc.HarperClient.RawRequest(op, result)
+	bc.record(err)
+	return err
+}
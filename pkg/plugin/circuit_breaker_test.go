@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestBreakerClient(t *testing.T) {
+	breaker, err := newCircuitBreaker(CircuitBreakerSettings{FailureThreshold: 2, Cooldown: "20ms"}, log.DefaultLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newFakeHarperClient()
+	bc := newBreakerClient(client, breaker)
+	list := func() error {
+		_, err := bc.ListMetrics(harper.ListMetricsRequest{})
+		return err
+	}
+	sent := func() int { return client.calls[harper.OP_LIST_METRICS] }
+
+	// Harper rejecting operations doesn't trip the circuit
+	client.err = &harper.OperationError{StatusCode: 400, Message: "bad request"}
+	for range 3 {
+		_ = list()
+	}
+	if breaker.diagnostics().Open {
+		t.Fatal("expected rejected operations not to open the circuit")
+	}
+
+	client.err = &harper.OperationError{StatusCode: 0, Message: "dial tcp: connect: connection refused"}
+	_ = list()
+	_ = list()
+	err = list()
+	var circuitErr *CircuitOpenError
+	if !errors.As(err, &circuitErr) {
+		t.Fatalf("expected the circuit to open after 2 failures, got %v", err)
+	}
+	if sent() != 5 {
+		t.Errorf("expected the open circuit to fail fast, got %d calls", sent())
+	}
+	if statusFromError(err) != backend.StatusBadGateway || errorSourceFromError(err) != backend.ErrorSourceDownstream {
+		t.Errorf("expected a downstream bad gateway, got %v from %s", statusFromError(err), errorSourceFromError(err))
+	}
+
+	// a failed probe reopens the circuit straight away
+	time.Sleep(30 * time.Millisecond)
+	_ = list()
+	if err := list(); !errors.As(err, &circuitErr) || sent() != 6 {
+		t.Errorf("expected a single failed probe to reopen the circuit, got %v after %d calls", err, sent())
+	}
+
+	// a successful probe closes it
+	time.Sleep(30 * time.Millisecond)
+	client.err = nil
+	if err := list(); err != nil {
+		t.Fatalf("expected the probe to go through, got %v", err)
+	}
+	if err := list(); err != nil || breaker.diagnostics().Open {
+		t.Errorf("expected the circuit to close, got %v", err)
+	}
+}
+
+func TestBreakerClientHealthcheck(t *testing.T) {
+	breaker, _ := newCircuitBreaker(CircuitBreakerSettings{FailureThreshold: 1, Cooldown: "1h"}, log.DefaultLogger)
+	client := newFakeHarperClient()
+	bc := newBreakerClient(client, breaker)
+
+	client.err = &harper.OperationError{StatusCode: 503}
+	_, _ = bc.DescribeMetric("db-read")
+	if !breaker.diagnostics().Open {
+		t.Fatal("expected the circuit to open")
+	}
+
+	// health checks bypass the open circuit, and close it once Harper is back
+	client.err = nil
+	if err := bc.Healthcheck(); err != nil {
+		t.Fatal(err)
+	}
+	if breaker.diagnostics().Open {
+		t.Error("expected a successful health check to close the circuit")
+	}
+}
+
+// TestBreakerClientCallerTimeout checks that operations failing because their caller gave up, rather than because
+// Harper is down, don't open the circuit.
+func TestBreakerClientCallerTimeout(t *testing.T) {
+	breaker, _ := newCircuitBreaker(CircuitBreakerSettings{FailureThreshold: 1, Cooldown: "1h"}, log.DefaultLogger)
+	release := make(chan struct{})
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] == "cluster_status" {
+			<-release
+		}
+		return nil, nil
+	}
+	lc := newLimitedClient(client, 1, log.DefaultLogger)
+	bc := newBreakerClient(lc, breaker)
+
+	// a saturated limiter: operations time out waiting for the only slot
+	done := make(chan error)
+	go func() { done <- bc.RawRequest(rawOperation{"operation": "cluster_status"}, nil) }()
+	for len(lc.(*limitedClient).slots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for range 3 {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		err := clientWithContext(bc, ctx).RawRequest(rawOperation{"operation": "describe_all"}, nil)
+		cancel()
+		var slotErr *SlotWaitError
+		if !errors.As(err, &slotErr) {
+			t.Fatalf("expected the operation to give up waiting for a slot, got %v", err)
+		}
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if breaker.diagnostics().Open {
+		t.Fatal("expected a saturated limiter not to open the circuit")
+	}
+
+	// the caller's own deadline passing while Harper handles the operation
+	client.raw = func(op map[string]any) (any, error) {
+		return nil, &harper.OperationError{Message: "context deadline exceeded"}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := clientWithContext(bc, ctx).RawRequest(rawOperation{"operation": "describe_all"}, nil); err == nil {
+		t.Fatal("expected the operation to fail")
+	}
+	if breaker.diagnostics().Open {
+		t.Error("expected the caller's deadline not to open the circuit")
+	}
+
+	// while the same failure without the caller giving up is Harper timing out
+	if err := bc.RawRequest(rawOperation{"operation": "describe_all"}, nil); err == nil {
+		t.Fatal("expected the operation to fail")
+	}
+	if !breaker.diagnostics().Open {
+		t.Error("expected Harper timing out to open the circuit")
+	}
+}
+
+func TestNewCircuitBreaker(t *testing.T) {
+	if cb, err := newCircuitBreaker(CircuitBreakerSettings{Disabled: true}, log.DefaultLogger); cb != nil || err != nil {
+		t.Errorf("expected a disabled circuit breaker to be nil, got %v, %v", cb, err)
+	}
+	for _, settings := range []CircuitBreakerSettings{{FailureThreshold: -1}, {Cooldown: "0s"}, {Cooldown: "later"}} {
+		if _, err := newCircuitBreaker(settings, log.DefaultLogger); err == nil {
+			t.Errorf("expected %+v to be rejected", settings)
+		}
+	}
+}
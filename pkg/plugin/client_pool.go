@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// clientPool shares Harper clients, and so their HTTP connection pools, between datasource instances created with
+// identical settings. Grafana recreates instances whenever a datasource is saved, even unchanged, and may briefly run
+// the old and new instance side by side; pooling keeps that from multiplying connections to Harper.
+type clientPool struct {
+	mu      sync.Mutex
+	clients map[string]*pooledClient
+}
+
+type pooledClient struct {
+	client     HarperClient
+	httpClient *http.Client
+	refs       int
+}
+
+var harperClients = &clientPool{clients: make(map[string]*pooledClient)}
+
+// clientPoolKey identifies a datasource's settings: its UID and a hash of everything the client is created from.
+func clientPoolKey(s backend.DataSourceInstanceSettings) string {
+	h := sha256.New()
+	h.Write([]byte(s.URL))
+	h.Write([]byte{0})
+	h.Write(s.JSONData)
+	for _, k := range slices.Sorted(maps.Keys(s.DecryptedSecureJSONData)) {
+		h.Write([]byte{0})
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(s.DecryptedSecureJSONData[k]))
+	}
+	return s.UID + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// acquire returns the pooled client for key, calling create to make one if there's none, and a function that
+// releases it. The client's idle connections are closed once every holder has released it.
+func (p *clientPool) acquire(key string, create func() (HarperClient, *http.Client, error)) (HarperClient, func(), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pc, ok := p.clients[key]
+	if !ok {
+		client, httpClient, err := create()
+		if err != nil {
+			return nil, nil, err
+		}
+		pc = &pooledClient{client: client, httpClient: httpClient}
+		p.clients[key] = pc
+	}
+	pc.refs++
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() { p.release(key, pc) })
+	}
+	return pc.client, release, nil
+}
+
+func (p *clientPool) release(key string, pc *pooledClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pc.refs--
+	if pc.refs > 0 {
+		return
+	}
+	if p.clients[key] == pc {
+		delete(p.clients, key)
+	}
+	if pc.httpClient != nil {
+		pc.httpClient.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,212 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/proxy"
+)
+
+func TestClientPool(t *testing.T) {
+	pool := &clientPool{clients: make(map[string]*pooledClient)}
+	created := 0
+	create := func() (HarperClient, *http.Client, error) {
+		created++
+		return newFakeHarperClient(), &http.Client{}, nil
+	}
+
+	settings := backend.DataSourceInstanceSettings{UID: "harper", JSONData: []byte(`{"username":"a"}`)}
+	changed := settings
+	changed.JSONData = []byte(`{"username":"b"}`)
+
+	first, releaseFirst, _ := pool.acquire(clientPoolKey(settings), create)
+	second, releaseSecond, _ := pool.acquire(clientPoolKey(settings), create)
+	if first != second || created != 1 {
+		t.Fatalf("expected instances with the same settings to share a client, created %d", created)
+	}
+	if _, releaseChanged, _ := pool.acquire(clientPoolKey(changed), create); created != 2 {
+		t.Fatalf("expected changed settings to get a new client, created %d", created)
+	} else {
+		releaseChanged()
+	}
+
+	releaseFirst()
+	releaseFirst()
+	if len(pool.clients) != 1 {
+		t.Fatalf("expected the client to stay pooled while still held")
+	}
+	releaseSecond()
+	if len(pool.clients) != 0 {
+		t.Fatalf("expected the client to be dropped once released by every instance")
+	}
+}
+
+func TestNewDatasourceTransport(t *testing.T) {
+	var conns atomic.Int32
+	var missingHeader atomic.Bool
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Dashboard-Team") != "ops" {
+			missingHeader.Store(true)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	jsonData, _ := json.Marshal(map[string]any{
+		"opsAPIURL":               srv.URL,
+		"username":                "admin",
+		"metadataRefreshInterval": "0s",
+		"httpHeaderName1":         "X-Dashboard-Team",
+	})
+	inst, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		UID:                     "transport-test",
+		JSONData:                jsonData,
+		DecryptedSecureJSONData: map[string]string{"password": "password", "httpHeaderValue1": "ops"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := inst.(*Datasource)
+	defer ds.Dispose()
+
+	before := conns.Load()
+	for range 5 {
+		if res, err := ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{}); err != nil || res.Status != backend.HealthStatusOk {
+			t.Fatalf("expected the health check to succeed, got %v, %v", res, err)
+		}
+	}
+	// the instance's background work may open a connection of its own meanwhile, but health checks reuse theirs
+	if opened := conns.Load() - before; opened >= 5 {
+		t.Errorf("expected connections to be kept alive and reused, opened %d for 5 requests", opened)
+	}
+	if missingHeader.Load() {
+		t.Error("expected the custom headers middleware to add the configured header to every request")
+	}
+}
+
+func TestNewDatasourceTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	for _, tt := range []struct {
+		name     string
+		jsonData map[string]any
+		secrets  map[string]string
+		wantErr  bool
+	}{
+		{"untrusted", nil, nil, true},
+		{"skip verify", map[string]any{"tlsSkipVerify": true}, nil, false},
+		{"CA certificate", nil, map[string]string{"tlsCACert": string(caCert)}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonData := map[string]any{"opsAPIURL": srv.URL, "username": "admin", "metadataRefreshInterval": "0s"}
+			maps.Copy(jsonData, tt.jsonData)
+			secrets := map[string]string{"password": "password"}
+			maps.Copy(secrets, tt.secrets)
+			jsonBytes, _ := json.Marshal(jsonData)
+			inst, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+				UID:                     "tls-test",
+				JSONData:                jsonBytes,
+				DecryptedSecureJSONData: secrets,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ds := inst.(*Datasource)
+			defer ds.Dispose()
+
+			err = ds.harperClient.RawRequest(rawOperation{"operation": "user_info"}, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %t, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	_, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		JSONData:                []byte(`{"opsAPIURL": "https://harper.example"}`),
+		DecryptedSecureJSONData: map[string]string{"password": "password", "tlsCACert": "not a certificate"},
+	})
+	if err == nil {
+		t.Error("expected an invalid CA certificate to be rejected")
+	}
+}
+
+func TestNewDatasourceSecureSocksProxy(t *testing.T) {
+	// a proxy that only records connections, so requests through it fail
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxyListener.Close()
+	proxied := make(chan struct{}, 1)
+	go func() {
+		for {
+			conn, err := proxyListener.Accept()
+			if err != nil {
+				return
+			}
+			select {
+			case proxied <- struct{}{}:
+			default:
+			}
+			_ = conn.Close()
+		}
+	}()
+	ctx := backend.WithGrafanaConfig(context.Background(), backend.NewGrafanaCfg(map[string]string{
+		proxy.PluginSecureSocksProxyEnabled:       "true",
+		proxy.PluginSecureSocksProxyProxyAddress:  proxyListener.Addr().String(),
+		proxy.PluginSecureSocksProxyAllowInsecure: "true",
+	}))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	jsonData, _ := json.Marshal(map[string]any{
+		"opsAPIURL":               srv.URL,
+		"username":                "admin",
+		"metadataRefreshInterval": "0s",
+		"enableSecureSocksProxy":  true,
+	})
+	inst, err := NewDatasource(ctx, backend.DataSourceInstanceSettings{
+		UID:                     "proxy-test",
+		JSONData:                jsonData,
+		DecryptedSecureJSONData: map[string]string{"password": "password"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := inst.(*Datasource)
+	defer ds.Dispose()
+
+	if err := ds.harperClient.RawRequest(rawOperation{"operation": "user_info"}, nil); err == nil {
+		t.Error("expected the request to fail through the fake proxy")
+	}
+	select {
+	case <-proxied:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Harper to be reached through the secure SOCKS proxy")
+	}
+}
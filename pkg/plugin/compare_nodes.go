@@ -0,0 +1,130 @@
+package plugin
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// defaultCompareInterval buckets node comparisons when Grafana doesn't send a query interval.
+const defaultCompareInterval = time.Minute
+
+// CompareNodesQuery compares one numeric attribute of an analytics metric between two cluster nodes.
+type CompareNodesQuery struct {
+	Metric    string   `json:"metric" validate:"required"`
+	Attribute string   `json:"attribute" validate:"required"`
+	Nodes     []string `json:"nodes" validate:"required"`
+	From      int64    `json:"from"`
+	To        int64    `json:"to"`
+}
+
+// compareNodes fetches the attribute for both nodes and returns a wide frame with one column per node, aligned on
+// interval-sized time buckets (averaging within a bucket), plus the difference between the first node and the second.
+func compareNodes(client HarperClient, refID string, request CompareNodesQuery, interval time.Duration) (backend.DataResponse, error) {
+	if len(request.Nodes) != 2 || request.Nodes[0] == request.Nodes[1] {
+		return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.nodes", Problem: "expected two different nodes"}
+	}
+	if interval <= 0 {
+		interval = defaultCompareInterval
+	}
+
+	type bucket struct {
+		sum   float64
+		count int
+	}
+	perNode := make([]map[int64]*bucket, len(request.Nodes))
+
+	for i, node := range request.Nodes {
+		results, err := client.GetAnalytics(harper.GetAnalyticsRequest{
+			Metric:        request.Metric,
+			GetAttributes: []string{"id", "node", request.Attribute},
+			StartTime:     request.From,
+			EndTime:       request.To,
+			Conditions:    harper.SearchConditions{{Attribute: "node", Comparator: "equals", Value: node}},
+			CoalesceTime:  true,
+		})
+		if err != nil {
+			return backend.DataResponse{}, fmt.Errorf("could not query Harper analytics for node '%s': '%w'", node, err)
+		}
+
+		perNode[i] = make(map[int64]*bucket)
+		for _, row := range results {
+			ts, ok := row["id"].(time.Time)
+			if !ok {
+				continue
+			}
+			var v float64
+			switch val := row[request.Attribute].(type) {
+			case float64:
+				v = val
+			case int64:
+				v = float64(val)
+			default:
+				continue
+			}
+
+			key := ts.Truncate(interval).UnixMilli()
+			b, ok := perNode[i][key]
+			if !ok {
+				b = &bucket{}
+				perNode[i][key] = b
+			}
+			b.sum += v
+			b.count++
+		}
+	}
+
+	keys := make(map[int64]bool)
+	for _, buckets := range perNode {
+		for key := range buckets {
+			keys[key] = true
+		}
+	}
+
+	times := make([]time.Time, 0, len(keys))
+	values := [][]*float64{make([]*float64, 0, len(keys)), make([]*float64, 0, len(keys))}
+	diffs := make([]*float64, 0, len(keys))
+	for _, key := range slices.Sorted(maps.Keys(keys)) {
+		times = append(times, time.UnixMilli(key))
+		for i, buckets := range perNode {
+			var v *float64
+			if b, ok := buckets[key]; ok {
+				mean := b.sum / float64(b.count)
+				v = &mean
+			}
+			values[i] = append(values[i], v)
+		}
+
+		var diff *float64
+		if a, b := values[0][len(values[0])-1], values[1][len(values[1])-1]; a != nil && b != nil {
+			d := *a - *b
+			diff = &d
+		}
+		diffs = append(diffs, diff)
+	}
+
+	frame := data.NewFrame(frameName(refID, request.Metric+" "+request.Attribute),
+		data.NewField("time", nil, times),
+		data.NewField(request.Nodes[0], nil, values[0]),
+		data.NewField(request.Nodes[1], nil, values[1]),
+		data.NewField("difference", nil, diffs),
+	).SetMeta(&data.FrameMeta{
+		Type:                   data.FrameTypeTimeSeriesWide,
+		TypeVersion:            data.FrameTypeVersion{0, 1},
+		PreferredVisualization: data.VisTypeGraph,
+	}).SetRefID(refID)
+
+	setFieldDisplayHints(frame)
+	if unit := attributeUnit(request.Metric, request.Attribute); unit != "" {
+		for _, field := range frame.Fields[1:] {
+			field.Config.Unit = unit
+		}
+	}
+
+	return backend.DataResponse{Frames: data.Frames{frame}}, nil
+}
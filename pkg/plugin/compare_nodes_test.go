@@ -0,0 +1,36 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompareNodes(t *testing.T) {
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_000_000).Truncate(time.Minute)
+	client.addAnalytics("memory", []time.Time{start, start.Add(30 * time.Second)}, map[string]any{"node": "node-1", "heapUsed": 100.0})
+	client.addAnalytics("memory", []time.Time{start.Add(10 * time.Second), start.Add(time.Minute)}, map[string]any{"node": "node-2", "heapUsed": 40.0})
+
+	res, err := compareNodes(client, "A", CompareNodesQuery{
+		Metric:    "memory",
+		Attribute: "heapUsed",
+		Nodes:     []string{"node-1", "node-2"},
+	}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := res.Frames[0]
+	if frame.Rows() != 2 || len(frame.Fields) != 4 {
+		t.Fatalf("expected 2 buckets of time, node-1, node-2 and difference, got %d rows and %d fields", frame.Rows(), len(frame.Fields))
+	}
+	if diff, _ := frame.Fields[3].NullableFloatAt(0); diff == nil || *diff != 60 {
+		t.Errorf("expected a difference of 60 in the first bucket, got %v", diff)
+	}
+	if diff, _ := frame.Fields[3].NullableFloatAt(1); diff != nil {
+		t.Errorf("expected no difference where node-1 has no data, got %v", *diff)
+	}
+	if frame.Fields[1].Config.Unit != "decbytes" {
+		t.Errorf("expected node fields to carry the attribute's unit")
+	}
+}
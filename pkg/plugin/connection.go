@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	warmUpInitialBackoff = time.Second
+	warmUpMaxBackoff     = time.Minute
+)
+
+// connectionState tracks whether the instance has been able to reach Harper yet. Instances are created without
+// touching the network; the connection is validated lazily in the background so a Harper outage at startup doesn't
+// keep the datasource from initializing.
+type connectionState struct {
+	mu          sync.RWMutex
+	ready       bool
+	attempts    int
+	lastAttempt time.Time
+	lastErr     error
+
+	// authChecked is set once the credentials have been tested against Harper, with the result in authErr.
+	authChecked bool
+	authErr     error
+}
+
+func (cs *connectionState) record(err error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.attempts++
+	cs.lastAttempt = time.Now()
+	cs.lastErr = err
+	if err == nil {
+		cs.ready = true
+	}
+}
+
+func (cs *connectionState) isReady() bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.ready
+}
+
+func (cs *connectionState) recordAuth(err error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.authChecked = true
+	cs.authErr = err
+}
+
+// connectionDiagnostics is a point-in-time copy of a connectionState, as reported by /diagnostics.
+type connectionDiagnostics struct {
+	Ready       bool      `json:"ready"`
+	Attempts    int       `json:"attempts"`
+	LastAttempt time.Time `json:"lastAttempt"`
+	LastError   string    `json:"lastError,omitempty"`
+	AuthChecked bool      `json:"authChecked"`
+	AuthError   string    `json:"authError,omitempty"`
+}
+
+func (cs *connectionState) diagnostics() connectionDiagnostics {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	diag := connectionDiagnostics{
+		Ready:       cs.ready,
+		Attempts:    cs.attempts,
+		LastAttempt: cs.lastAttempt,
+		AuthChecked: cs.authChecked,
+	}
+	if cs.lastErr != nil {
+		diag.LastError = cs.lastErr.Error()
+	}
+	if cs.authErr != nil {
+		diag.AuthError = cs.authErr.Error()
+	}
+	return diag
+}
+
+// checkAuth tests the datasource's credentials with a user_info operation, since Harper's health endpoint doesn't
+// require authentication, so misconfigured credentials are reported at startup rather than on the first query.
+func (cs *connectionState) checkAuth(client HarperClient, username string, logger log.Logger) {
+	err := client.RawRequest(rawOperation{"operation": harper.OP_USER_INFO}, nil)
+	err = asCredentialsError(err, username)
+	cs.recordAuth(err)
+	if err != nil {
+		logger.Error("Harper connection test failed", "error", err)
+		return
+	}
+	logger.Info("Harper connection test succeeded", "username", username)
+}
+
+// warmUp health checks Harper until it succeeds or ctx is cancelled, backing off exponentially between attempts.
+// It reports whether the connection was established.
+func (cs *connectionState) warmUp(ctx context.Context, client HarperClient, logger log.Logger) bool {
+	backoff := warmUpInitialBackoff
+	for {
+		err := client.Healthcheck()
+		cs.record(err)
+		if err == nil {
+			logger.Debug("Harper connection established")
+			return true
+		}
+
+		logger.Warn("Harper connection attempt failed; retrying", "error", err, "retryIn", backoff)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, warmUpMaxBackoff)
+	}
+}
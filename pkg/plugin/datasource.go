@@ -1,20 +1,25 @@
 package plugin
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"iter"
 	"maps"
+	"net/http"
 	"slices"
-	"sort"
+	"strings"
 	"time"
 
 	harper "github.com/HarperFast/sdk-go"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/httpclient"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/experimental/concurrent"
 )
 
 // Make sure Datasource implements required interfaces. This is important to do
@@ -30,11 +35,102 @@ var (
 )
 
 type Settings struct {
-	OpsAPIURL     string `json:"opsAPIURL"`
-	Username      string `json:"username"`
-	TLSSkipVerify bool   `json:"tlsSkipVerify"`
+	OpsAPIURL string `json:"opsAPIURL"`
+	Username  string `json:"username"`
+
+	// TLSSkipVerify disables verifying Harper's certificate, for self-signed test clusters. To trust a private CA
+	// instead, set the tlsCACert secret to its PEM certificate (see applyCACert).
+	TLSSkipVerify bool `json:"tlsSkipVerify"`
+
+	// AuthMethod is how the datasource authenticates with Harper: "basic" (the default) sends the username and the
+	// password secret with every operation, and "token" an operation token (a JWT) instead. The token is the
+	// operationToken secret, if set; when Harper rejects it, as it does once it expires, it's refreshed with the
+	// refreshToken secret or, failing that, new tokens are created with the username and password.
+	AuthMethod string `json:"authMethod"`
+
+	// Timeout is how long a request to Harper may take, in seconds, and DialTimeout how long connecting to it may
+	// take. They default to the Grafana SDK's (30s and 10s), so slow analytics queries fail rather than hang until
+	// Grafana's own timeout.
+	Timeout     int `json:"timeout"`
+	DialTimeout int `json:"dialTimeout"`
+
+	// MetadataRefreshInterval is how often the cached metric list and descriptions are refreshed, as a Go duration
+	// string (e.g. "5m"). Defaults to 5m; "0s" prefetches once at startup and never refreshes.
+	MetadataRefreshInterval string `json:"metadataRefreshInterval"`
+
+	// LogLevel sets this instance's backend log level ("debug", "info", "warn" or "error") independently of the
+	// plugin-wide level. "debug" logs operation payloads and timings.
+	LogLevel string `json:"logLevel"`
+
+	// AllowWriteOperations lifts the read-only operation policy. It's an admin escape hatch; by default only
+	// read-only Harper operations may be sent, whatever the query.
+	AllowWriteOperations bool `json:"allowWriteOperations"`
+
+	// AccessRules restricts the databases and tables each Grafana org role may query.
+	AccessRules []AccessRule `json:"accessRules"`
+
+	// FieldNaming selects how attribute names are turned into frame field and label names: "original" (the
+	// default, as Harper returns them) or "snake_case".
+	FieldNaming string `json:"fieldNaming"`
+
+	// Audit records every executed query to a log stream or Harper table. Disabled by default.
+	Audit AuditSettings `json:"audit"`
+
+	// RecordingRules are queries run on a schedule whose results dashboards read with get_recorded queries.
+	RecordingRules []RecordingRule `json:"recordingRules"`
+
+	// Rollups configures in-memory downsampled copies of analytics metrics for long range queries.
+	Rollups RollupSettings `json:"rollups"`
+
+	// Tenancy maps each request's tenant to its own databases. Disabled by default.
+	Tenancy TenancySettings `json:"tenancy"`
+
+	// SearchPageSize, if set, makes search_by_conditions queries fetch records in pages of this many, so large
+	// tables are read in several smaller requests instead of one that may time out.
+	SearchPageSize int `json:"searchPageSize"`
+
+	// RawOperations are the Harper operations raw queries may send. Defaults to every read-only operation but the
+	// user and role ones; only read-only operations other than those may be listed.
+	RawOperations []string `json:"rawOperations"`
+
+	// MaxConcurrentQueries caps how many of a request's queries run at once. Defaults to defaultMaxConcurrentQueries;
+	// the SDK allows at most 10.
+	MaxConcurrentQueries int `json:"maxConcurrentQueries"`
+
+	// Retry configures retries of operations that fail transiently, e.g. while Harper restarts.
+	Retry RetrySettings `json:"retry"`
+
+	// CircuitBreaker fails operations fast while Harper is unreachable. Enabled by default.
+	CircuitBreaker CircuitBreakerSettings `json:"circuitBreaker"`
+
+	// MaxInFlightRequests caps how many Harper operations the instance has in flight at once, across all queries
+	// and requests; operations over it wait for a free slot. Unlimited by default.
+	MaxInFlightRequests int `json:"maxInFlightRequests"`
+
+	// MaxRows caps how many rows a query reads from Harper, and MaxSeries how many series (label sets) an analytics
+	// time series query returns, so a runaway query can't exhaust the plugin's memory. Results over them are
+	// truncated, with a notice. They default to defaultMaxRows and defaultMaxSeries.
+	MaxRows   int `json:"maxRows"`
+	MaxSeries int `json:"maxSeries"`
+
+	// LegacyTimeSeriesFrames builds analytics time series frames the old way, converting the long frame of the rows
+	// with data.LongToWide (or into a frame per series), rather than straight from the rows. It's a fallback in case
+	// the direct construction misbehaves, at the cost of holding every point twice over.
+	LegacyTimeSeriesFrames bool `json:"legacyTimeSeriesFrames"`
+
+	// QueryCacheTTL is how long successful query responses are cached for, as a Go duration string (e.g. "30s"), so
+	// auto-refreshing dashboards don't query Harper for the same window again. Disabled by default.
+	QueryCacheTTL string `json:"queryCacheTTL"`
 }
 
+// defaultMaxConcurrentQueries is how many of a request's queries run at once unless MaxConcurrentQueries is set.
+const defaultMaxConcurrentQueries = 5
+
+// NewDatasource creates a Datasource from a Grafana datasource's settings. Its Harper client's transport is built by
+// the SDK's httpclient from the settings, so it keeps connections alive and pools them (shared with other instances
+// created from the same settings), Grafana's standard middlewares (tracing, metrics, custom headers, error source)
+// apply to every request, and Harper is reached through Grafana's secure SOCKS proxy (Private Datasource Connect)
+// when it's enabled for the datasource, as configured in ctx.
 func NewDatasource(ctx context.Context, s backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
 	var settings Settings
 	err := json.Unmarshal(s.JSONData, &settings)
@@ -42,62 +138,333 @@ func NewDatasource(ctx context.Context, s backend.DataSourceInstanceSettings) (i
 		return nil, fmt.Errorf("error unmarshalling settings from JSON: %w", err)
 	}
 
+	if !slices.Contains(authMethods, settings.AuthMethod) {
+		return nil, fmt.Errorf("invalid authentication method '%s'", settings.AuthMethod)
+	}
 	password, exists := s.DecryptedSecureJSONData["password"]
-	if !exists {
-		return backend.DataResponse{}, fmt.Errorf("no password found for Harper connection")
+	operationToken, refreshToken := s.DecryptedSecureJSONData["operationToken"], s.DecryptedSecureJSONData["refreshToken"]
+	if settings.AuthMethod == authMethodToken {
+		if password == "" && operationToken == "" && refreshToken == "" {
+			return nil, fmt.Errorf("no operation token, refresh token or password found for Harper connection")
+		}
+	} else if !exists {
+		return nil, fmt.Errorf("no password found for Harper connection")
+	}
+
+	client, release, err := harperClients.acquire(clientPoolKey(s), func() (HarperClient, *http.Client, error) {
+		opts, err := s.HTTPClientOptions(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get HTTP client options: %w", err)
+		}
+		applyTimeouts(&opts, settings)
+		applyCACert(&opts, s.DecryptedSecureJSONData["tlsCACert"])
+		httpClient, err := httpclient.New(opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create HTTP client: %w", err)
+		}
+		httpClient.Transport = streamingTransport{next: httpClient.Transport}
+		if settings.AuthMethod == authMethodToken {
+			issuer := harper.NewClientWithHTTPClient(httpClient, settings.OpsAPIURL, settings.Username, password)
+			auth := newTokenAuth(issuer, settings.Username, password, operationToken, refreshToken,
+				log.DefaultLogger.With("datasourceUID", s.UID))
+			client := auth.authenticate(harper.NewClientWithHTTPClient(httpClient, settings.OpsAPIURL, "", ""))
+			return newTokenClient(client, auth), httpClient, nil
+		}
+		return harper.NewClientWithHTTPClient(httpClient, settings.OpsAPIURL, settings.Username, password), httpClient, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ds, err := newDatasource(s.UID, settings, client)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	ds.releaseClient = release
+	ds.streamsAnalytics = true
+
+	return ds, nil
+}
+
+// applyTimeouts sets the request and dial timeouts of opts from settings, where they're set. With Grafana's secure
+// SOCKS proxy (Private Datasource Connect) enabled, connections are dialed through the proxy instead, so the dial
+// timeout is the proxy's.
+func applyTimeouts(opts *httpclient.Options, settings Settings) {
+	if settings.Timeout <= 0 && settings.DialTimeout <= 0 {
+		return
+	}
+	if opts.Timeouts == nil {
+		timeouts := httpclient.DefaultTimeoutOptions
+		opts.Timeouts = &timeouts
+	}
+	if settings.Timeout > 0 {
+		opts.Timeouts.Timeout = time.Duration(settings.Timeout) * time.Second
+	}
+	if settings.DialTimeout > 0 {
+		opts.Timeouts.DialTimeout = time.Duration(settings.DialTimeout) * time.Second
+		if opts.ProxyOptions != nil && opts.ProxyOptions.Timeouts != nil {
+			opts.ProxyOptions.Timeouts.Timeout = opts.Timeouts.DialTimeout
+		}
+	}
+}
+
+// applyCACert makes opts trust the CA of the PEM certificate caCert, if set. The SDK only reads the tlsCACert secret
+// along with tlsAuthWithCACert, which the datasource doesn't otherwise use.
+func applyCACert(opts *httpclient.Options, caCert string) {
+	if caCert == "" {
+		return
+	}
+	if opts.TLS == nil {
+		opts.TLS = &httpclient.TLSOptions{}
+	}
+	if opts.TLS.CACertificate == "" {
+		opts.TLS.CACertificate = caCert
+	}
+}
+
+// newDatasource creates a Datasource talking to Harper through client and starts its background work. All
+// operations go through the datasource's operation policy.
+func newDatasource(uid string, settings Settings, client HarperClient) (*Datasource, error) {
+	var err error
+
+	metadataRefreshInterval := defaultMetadataRefreshInterval
+	if settings.MetadataRefreshInterval != "" {
+		metadataRefreshInterval, err = time.ParseDuration(settings.MetadataRefreshInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata refresh interval '%s': %w", settings.MetadataRefreshInterval, err)
+		}
+	}
+
+	logger, err := newInstanceLogger(log.DefaultLogger.With("datasourceUID", uid), settings.LogLevel)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level setting: %w", err)
+	}
+
+	if !slices.Contains(fieldNamingConventions, settings.FieldNaming) {
+		return nil, fmt.Errorf("invalid field naming convention '%s'", settings.FieldNaming)
 	}
 
-	opts, err := s.HTTPClientOptions(ctx)
+	// The audit trail is written whatever this instance's log level.
+	audit, err := newAuditor(settings.Audit, client, log.DefaultLogger.With("datasourceUID", uid, "logger", "audit"))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get HTTP client options: %w", err)
+		return nil, fmt.Errorf("invalid audit settings: %w", err)
 	}
-	httpClient, err := httpclient.New(opts)
+
+	if err := checkRawOperations(settings.RawOperations); err != nil {
+		return nil, fmt.Errorf("invalid raw operation allowlist: %w", err)
+	}
+	if err := settings.Tenancy.check(); err != nil {
+		return nil, fmt.Errorf("invalid tenancy settings: %w", err)
+	}
+	if settings.Timeout < 0 || settings.DialTimeout < 0 {
+		return nil, fmt.Errorf("invalid timeouts %ds and %ds: expected positive numbers of seconds", settings.Timeout, settings.DialTimeout)
+	}
+	if settings.MaxInFlightRequests < 0 {
+		return nil, fmt.Errorf("invalid max in-flight requests %d", settings.MaxInFlightRequests)
+	}
+	if settings.MaxRows < 0 || settings.MaxSeries < 0 {
+		return nil, fmt.Errorf("invalid max rows %d and max series %d", settings.MaxRows, settings.MaxSeries)
+	}
+	if settings.MaxConcurrentQueries < 0 || settings.MaxConcurrentQueries > 10 {
+		return nil, fmt.Errorf("invalid max concurrent queries %d: expected 1 to 10", settings.MaxConcurrentQueries)
+	}
+
+	retry, err := newRetryPolicy(settings.Retry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry settings: %w", err)
+	}
+
+	breaker, err := newCircuitBreaker(settings.CircuitBreaker, logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid circuit breaker settings: %w", err)
+	}
+
+	cache, err := newQueryCache(settings.QueryCacheTTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query cache TTL: %w", err)
+	}
+
+	recordingRules, err := newRecordingRules(settings.RecordingRules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recording rules: %w", err)
+	}
+
+	rollups, err := newRollups(settings.Rollups)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP client: %w", err)
+		return nil, fmt.Errorf("invalid rollup settings: %w", err)
 	}
-	client := harper.NewClientWithHTTPClient(httpClient, settings.OpsAPIURL, settings.Username, password)
 
+	bgCtx, cancel := context.WithCancel(context.Background())
+
+	// retries happen within the circuit breaker, which only sees operations that failed for good, and hold their
+	// request slot while backing off; operations the breaker fails fast don't wait for a slot
+	resilientClient := newBreakerClient(
+		newLimitedClient(newRetryClient(client, retry, logger), settings.MaxInFlightRequests, logger), breaker)
+
+	caps := &capabilities{}
 	ds := &Datasource{
+		uid:          uid,
 		settings:     settings,
-		harperClient: client,
+		logger:       logger,
+		harperClient: newPolicyClient(&capabilityClient{HarperClient: resilientClient, capabilities: caps}, settings),
+		capabilities: caps,
+		metadata:     newMetricMetadataCache(),
+		connection:   &connectionState{},
+		usage:        newUsageStats(),
+		recording:    recordingRules,
+		rollups:      rollups,
+		audit:        audit,
+		cache:        cache,
+		breaker:      breaker,
+		cancel:       cancel,
 	}
 	resourceHandler := ds.newResourceHandler()
 	ds.CallResourceHandler = resourceHandler
+
+	// Validate the connection and credentials in the background, retrying through Harper outages, and then start the
+	// recording rules and warm the metric metadata cache so the first query editor load doesn't stall on it.
+	go func() {
+		if ds.connection.warmUp(bgCtx, ds.harperClient, logger) {
+			ds.connection.checkAuth(ds.harperClient, settings.Username, logger)
+			ds.recording.run(bgCtx, ds, logger)
+			if ds.rollups != nil {
+				ds.rollups.run(bgCtx, ds.harperClient, logger)
+			}
+			ds.metadata.run(bgCtx, ds.harperClient, metadataRefreshInterval, logger)
+		}
+	}()
+
 	return ds, nil
 }
 
 // Datasource is an example datasource which can respond to data queries, reports
 // its health and has streaming skills.
 type Datasource struct {
+	uid      string
 	settings Settings
+	logger   log.Logger
 	backend.CallResourceHandler
-	harperClient *harper.Client
+	harperClient *policyClient
+	metadata     *metricMetadataCache
+	connection   *connectionState
+	usage        *usageStats
+	capabilities *capabilities
+	recording    *recordingRules
+	// rollups is nil unless rollups are configured.
+	rollups *rollups
+	// audit is nil unless the audit trail is enabled.
+	audit *auditor
+	// cache is nil unless the query cache is enabled.
+	cache *queryCache
+	// breaker is nil if the circuit breaker is disabled.
+	breaker *circuitBreaker
+	// streamsAnalytics is whether the Harper client is built on a streamingTransport, so analytics queries can be
+	// streamed into frames.
+	streamsAnalytics bool
+
+	// cancel stops the instance's background work (e.g. metadata refreshes).
+	cancel context.CancelFunc
+	// releaseClient, if set, returns the instance's Harper client to the client pool.
+	releaseClient func()
 }
 
 // Dispose here tells plugin SDK that plugin wants to clean up resources when a new instance
 // created. As soon as datasource settings change detected by SDK old datasource instance will
 // be disposed and a new one will be created using NewSampleDatasource factory function.
-func (d *Datasource) Dispose() {}
+func (d *Datasource) Dispose() {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	if d.releaseClient != nil {
+		d.releaseClient()
+	}
+}
+
+// clientFor returns the Harper client to use for requests made on behalf of pCtx's user, which enforces that user's
+// access rules on top of the datasource's operation policy and, in multi-tenant mode, maps operations to the
+// request's tenant. Its calls are made under ctx, so cancelled queries stop their Harper requests.
+func (d *Datasource) clientFor(ctx context.Context, pCtx backend.PluginContext) (HarperClient, error) {
+	tenant, err := d.settings.Tenancy.resolveTenant(ctx, pCtx)
+	if err != nil {
+		return nil, err
+	}
+	return d.harperClient.forUser(pCtx.User).forTenant(tenant).forContext(ctx), nil
+}
 
 // QueryData handles multiple queries and returns multiple responses.
 // req contains the queries []DataQuery (where each query contains RefID as a unique identifier).
 // The QueryDataResponse contains a map of RefID to the response for each query, and each response
 // contains Frames ([]*Frame).
 func (d *Datasource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
-	// create response struct
-	response := backend.NewQueryDataResponse()
+	ctx = withRequestHeaders(ctx, queryRequestHeaders(req))
+
+	// queries run concurrently, so a dashboard's panels don't wait on each other's round trips
+	limit := cmp.Or(d.settings.MaxConcurrentQueries, defaultMaxConcurrentQueries)
+
+	// panels sending the same query share one round trip to Harper
+	unique, duplicates := dedupeQueries(req.Queries)
+	if len(duplicates) > 0 {
+		d.logger.Debug("deduplicated identical queries", "queries", len(req.Queries), "unique", len(unique))
+		deduped := *req
+		deduped.Queries = unique
+		req = &deduped
+	}
+
+	resp, err := concurrent.QueryData(ctx, req, func(ctx context.Context, q concurrent.Query) backend.DataResponse {
+		var cacheKey string
+		if d.cache != nil {
+			if scope, ok := d.cacheScope(ctx, q.PluginContext); ok {
+				cacheKey = d.cache.key(scope, q.DataQuery)
+				if res, ok := d.cache.get(cacheKey, q.DataQuery.RefID); ok {
+					d.logger.Debug("serving query from cache", "refID", q.DataQuery.RefID)
+					return res
+				}
+			}
+		}
 
-	// loop over queries and execute them individually.
-	for _, q := range req.Queries {
-		res, err := d.query(ctx, req.PluginContext, q)
+		res, err := d.runQuery(ctx, q.PluginContext, q.DataQuery)
+		if cacheKey != "" && err == nil {
+			d.cache.set(cacheKey, q.DataQuery.RefID, res)
+		}
 		if err != nil {
-			response.Responses[q.RefID] = backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
-		} else {
-			response.Responses[q.RefID] = res
+			err = asCredentialsError(err, d.settings.Username)
+			// each query fails on its own, attributed to the plugin or downstream of it
+			return backend.ErrDataResponseWithSource(statusFromError(err), errorSourceFromError(err), err.Error())
+		}
+		return res
+	}, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for refID, from := range duplicates {
+		resp.Responses[refID] = responseForRefID(resp.Responses[from], from, refID)
+	}
+	return resp, nil
+}
+
+// runQuery executes query, counts it in the usage statistics and, if the audit trail is enabled, records it.
+func (d *Datasource) runQuery(ctx context.Context, pCtx backend.PluginContext, query backend.DataQuery) (backend.DataResponse, error) {
+	start := time.Now()
+	res, err := d.query(ctx, pCtx, query)
+	duration := time.Since(start)
+
+	d.usage.record(query.JSON, duration, err)
+
+	if d.audit != nil {
+		rec := newAuditRecord(pCtx, requestHeadersFromContext(ctx), query)
+		rec.DurationMs = duration.Milliseconds()
+		for _, frame := range res.Frames {
+			rec.Rows += frame.Rows()
 		}
+		if err != nil {
+			rec.Error = err.Error()
+		}
+		d.audit.record(rec)
 	}
 
-	return response, nil
+	return res, err
 }
 
 type SortVal struct {
@@ -117,29 +484,115 @@ type Condition struct {
 	Value      SearchValue  `json:"value"`
 	Operator   string       `json:"operator"`
 	Conditions []*Condition `json:"conditions"`
+
+	// ID and SearchValueType are query editor state; they're accepted but not used by the backend.
+	ID              string `json:"id"`
+	SearchValueType string `json:"searchValueType"`
 }
 
 type Conditions []*Condition
 
 type SearchByConditionsQuery struct {
-	Database   string     `json:"database"`
-	Table      string     `json:"table"`
+	Database   string     `json:"database" validate:"required"`
+	Table      string     `json:"table" validate:"required"`
 	Operator   string     `json:"operator"`
 	Sort       SortVal    `json:"sort"`
 	Attributes []string   `json:"attributes"`
 	Conditions Conditions `json:"conditions"`
+
+	// Limit caps the records returned (0 means no limit), starting at Offset.
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+
+	// TimeField, if set, names the attribute to use as the frame's time field, so records can be charted as a time
+	// series. Its values may be epoch timestamps, in TimeUnit ("s", "ms", "us" or "ns"; detected from their
+	// magnitude if unset), or RFC 3339 strings.
+	TimeField string `json:"timeField"`
+	TimeUnit  string `json:"timeUnit"`
 }
 
 type GetAnalyticsQuery struct {
-	Metric     string     `json:"metric"`
-	Attributes []string   `json:"attributes"`
-	From       int64      `json:"from"`
-	To         int64      `json:"to"`
-	Conditions Conditions `json:"conditions"`
+	Metric     string      `json:"metric" validate:"required_without=metrics"`
+	Attributes []string    `json:"attributes"`
+	From       epochMillis `json:"from"`
+	To         epochMillis `json:"to"`
+	Conditions Conditions  `json:"conditions"`
+
+	// Metrics, if set instead of Metric, queries each of the metrics concurrently with the rest of the query, returning
+	// their frames with a "metric" label on their values.
+	Metrics []string `json:"metrics"`
+
+	// StrictNumeric limits the response to time and numeric fields, for use with expressions and alert conditions.
+	StrictNumeric bool `json:"strictNumeric"`
+
+	// Aggregation, if set, buckets the points of each series by Interval (a Go duration, defaulting to the panel's
+	// interval) and combines each bucket with the named function (avg, sum, min, max or count).
+	Aggregation string `json:"aggregation"`
+	Interval    string `json:"interval"`
+
+	// Percentiles, if set, replaces each numeric attribute with the given percentiles (0-100) of its points in each
+	// Interval, as fields named like "duration p95". It can't be combined with Aggregation.
+	Percentiles []float64 `json:"percentiles"`
+
+	// AttributeRoles marks attributes as labels ("label") that identify series or as numeric values ("value"),
+	// overriding the default of treating strings and booleans as labels and numbers as values.
+	AttributeRoles map[string]string `json:"attributeRoles"`
+
+	// GroupBy, if set, lists the attributes whose values label the series. Other non-numeric attributes are dropped
+	// rather than splitting series further.
+	GroupBy []string `json:"groupBy"`
+
+	// TopK, if set, keeps only the K series with the highest average value, or last value if TopKBy is "last".
+	TopK   int    `json:"topK"`
+	TopKBy string `json:"topKBy"`
+
+	// TimeUnit is the unit of the metric's timestamps: "s", "ms", "us" or "ns". They're detected from their
+	// magnitude if unset.
+	TimeUnit string `json:"timeUnit"`
+
+	// Format shapes the response: "time_series" (the default) as a wide frame, "time_series_multi" as a frame per
+	// series, "table" or "logs" as the long frame of rows, and "heatmap" as counts of a distribution metric's values
+	// (like duration's) in the HeatmapBuckets upper bounds, per Interval.
+	Format         string    `json:"format"`
+	HeatmapBuckets []float64 `json:"heatmapBuckets"`
+
+	// Transform turns counters into their change between points: rate, increase or delta. It's applied before any
+	// aggregation.
+	Transform string `json:"transform"`
+
+	// Instant returns only the latest value of each series in the range, as a single-row numeric frame, for stat
+	// panels and alert conditions.
+	Instant bool `json:"instant"`
+
+	// TimeShift offsets the time range by a duration such as "-1d" or "-7d", with the returned timestamps shifted
+	// back into the unshifted range, so week-over-week series can be compared on the same panel.
+	TimeShift string `json:"timeShift"`
+
+	// LegendFormat, if set, names the series for display, with {{label}} placeholders for their labels, e.g.
+	// "{{node}} {{metric}}".
+	LegendFormat string `json:"legendFormat"`
+
+	// ComparePrevious also fetches the equal-length window just before the time range and returns it, shifted onto
+	// the range, as series labeled period="previous" alongside the period="current" ones.
+	ComparePrevious bool `json:"comparePrevious"`
 }
 
 type Query interface {
-	SearchByConditionsQuery | GetAnalyticsQuery
+	SearchByConditionsQuery | GetAnalyticsQuery | SQLQuery | RecordedQuery | CompareNodesQuery |
+		SystemInformationQuery | ReadLogQuery | GetJobQuery | SearchJobsQuery |
+		DescribeTableQuery | RawQuery | MetricMathQuery | JoinQuery | AnnotationsQuery
+}
+
+// timeRangeMillis returns from and to (epoch milliseconds), falling back to the query's time range for whichever is
+// unset, so queries that don't set their own range follow the dashboard's time picker.
+func timeRangeMillis[T ~int64](from T, to T, tr backend.TimeRange) (T, T) {
+	if from == 0 && !tr.From.IsZero() {
+		from = T(tr.From.UnixMilli())
+	}
+	if to == 0 && !tr.To.IsZero() {
+		to = T(tr.To.UnixMilli())
+	}
+	return from, to
 }
 
 type queryOperation struct {
@@ -149,12 +602,175 @@ type queryOperation struct {
 type queryModel[Q Query] struct {
 	Operation  string `json:"operation"`
 	QueryAttrs Q      `json:"queryAttrs"`
+
+	// AdhocFilters are the dashboard's ad hoc filters, which get_analytics and search_by_conditions queries apply as
+	// additional conditions.
+	AdhocFilters []adhocFilter `json:"adhocFilters"`
+
+	// ScopedVars are the values of the dashboard variables the query uses, which the frontend adds for the fields it
+	// doesn't interpolate itself. Queries from alert rules have none; the time range macros they may use are
+	// resolved from the query's time range instead.
+	ScopedVars map[string]scopedVar `json:"scopedVars"`
+}
+
+// analyticsResultsFrame returns analytics rows as a long frame with a field per attribute, in name order, and a
+// "metric" field of metric.
+func analyticsResultsFrame(results []harper.GetAnalyticsResult, metric string) *data.Frame {
+	// Grafana gets very cranky if any rows have a different set of fields (columns), so we have to make sure they
+	// all have all of them.
+	// The metric is kept as a string field, which becomes a label of the values in time series frames, so responses
+	// of several metrics and legend formats can tell them apart.
+	fieldTypes := analyticsFieldTypes(slices.Values(results))
+	delete(fieldTypes, "metric")
+
+	// Sort the field names so they don't get jumbled on every Grafana refresh
+	frame := data.NewFrame("")
+	for _, name := range slices.Sorted(maps.Keys(fieldTypes)) {
+		var field *data.Field
+		switch fieldTypes[name] {
+		case data.FieldTypeNullableBool:
+			field = data.NewField(name, nil, analyticsColumn[bool](results, name))
+		case data.FieldTypeNullableFloat64:
+			field = data.NewField(name, nil, analyticsColumn[float64](results, name))
+		case data.FieldTypeNullableInt64:
+			field = data.NewField(name, nil, analyticsColumn[int64](results, name))
+		case data.FieldTypeNullableTime:
+			field = data.NewField(name, nil, analyticsColumn[time.Time](results, name))
+		default:
+			// (attributes that are only ever null are strings)
+			field = data.NewField(name, nil, analyticsColumn[string](results, name))
+		}
+		frame.Fields = append(frame.Fields, field)
+	}
+	return addMetricField(frame, metric, len(results))
+}
+
+// analyticsFieldTypes returns the superset of the attributes of analytics rows, each typed by its first non-null
+// value (see analyticsFieldType).
+func analyticsFieldTypes(rows iter.Seq[harper.GetAnalyticsResult]) map[string]data.FieldType {
+	fieldTypes := make(map[string]data.FieldType)
+	for row := range rows {
+		for k, v := range row {
+			if fieldTypes[k] == data.FieldTypeUnknown {
+				fieldTypes[k] = analyticsFieldType(v)
+			}
+		}
+	}
+	return fieldTypes
+}
+
+// addMetricField adds a "metric" field of rows values of metric to frame, in field name order.
+func addMetricField(frame *data.Frame, metric string, rows int) *data.Frame {
+	metrics := make([]*string, rows)
+	for i := range metrics {
+		metrics[i] = &metric
+	}
+	i, _ := slices.BinarySearchFunc(frame.Fields, "metric", func(f *data.Field, name string) int {
+		return cmp.Compare(f.Name, name)
+	})
+	frame.Fields = slices.Insert(frame.Fields, i, data.NewField("metric", nil, metrics))
+	return frame
+}
+
+// analyticsFieldType returns the nullable field type of an analytics value, or data.FieldTypeUnknown for null and
+// values of other types.
+func analyticsFieldType(v any) data.FieldType {
+	switch v.(type) {
+	case string:
+		return data.FieldTypeNullableString
+	case bool:
+		return data.FieldTypeNullableBool
+	case float64:
+		return data.FieldTypeNullableFloat64
+	case int64:
+		return data.FieldTypeNullableInt64
+	case time.Time:
+		return data.FieldTypeNullableTime
+	default:
+		return data.FieldTypeUnknown
+	}
+}
+
+// timeSeriesFrames returns analytics rows as the time series frames request asks for: a wide frame, or a frame per
+// series for the multi format, limited to their first maxSeries series, and to the top K series and their latest
+// values where request says so. They're built straight from the rows, grouped into series.
+func timeSeriesFrames(rows iter.Seq[harper.GetAnalyticsResult], name string, refID string, request GetAnalyticsQuery, maxSeries int) (data.Frames, error) {
+	series, err := groupAnalyticsSeries(rows, request.Metric, maxSeries)
+	if err != nil {
+		return nil, fmt.Errorf("could not group rows into series: '%w'", err)
+	}
+	notice, capped := series.maxSeriesNotice(maxSeries)
+	if request.Format == analyticsFormatTimeSeriesMulti {
+		multi := series.multiFrames(name, refID)
+		if len(multi) > 0 && request.TopK > 0 {
+			multi = keepTopKFrames(multi, request.TopK, request.TopKBy)
+		}
+		if len(multi) > 0 && capped {
+			multi[0].AppendNotices(notice)
+		}
+		return multi, nil
+	}
+
+	wideFrame, err := series.wideFrame(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not build wide frame: '%w'", err)
+	}
+	if capped {
+		wideFrame.AppendNotices(notice)
+	}
+	return wideTimeSeriesFrames(wideFrame.SetRefID(refID), request), nil
+}
+
+// legacyTimeSeriesFrames is timeSeriesFrames for the rows' long frame, converted with data.LongToWide or longToMulti.
+func legacyTimeSeriesFrames(frame *data.Frame, request GetAnalyticsQuery, maxSeries int) (data.Frames, error) {
+	if request.Format == analyticsFormatTimeSeriesMulti {
+		multi, err := longToMulti(frame)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert frame to multi format: '%w'", err)
+		}
+		multi, notice, capped := capMultiSeries(multi, maxSeries)
+		if len(multi) > 0 && request.TopK > 0 {
+			multi = keepTopKFrames(multi, request.TopK, request.TopKBy)
+		}
+		if len(multi) > 0 && capped {
+			multi[0].AppendNotices(notice)
+		}
+		return multi, nil
+	}
+
+	wideFrame, err := data.LongToWide(frame, &data.FillMissing{Mode: data.FillModeNull})
+	if err != nil {
+		return nil, fmt.Errorf("could not convert frame to wide format: '%w'", err)
+	}
+	if notice, capped := capWideSeries(wideFrame, maxSeries); capped {
+		wideFrame.AppendNotices(notice)
+	}
+	return wideTimeSeriesFrames(wideFrame.SetRefID(frame.RefID), request), nil
+}
+
+// wideTimeSeriesFrames limits a wide frame to the top K series and their latest values where request says so.
+func wideTimeSeriesFrames(wideFrame *data.Frame, request GetAnalyticsQuery) data.Frames {
+	if request.TopK > 0 {
+		keepTopKSeries(wideFrame, request.TopK, request.TopKBy)
+	}
+	if request.Instant {
+		wideFrame = latestValues(wideFrame)
+	}
+	return data.Frames{wideFrame}
 }
 
-type analyticsTable struct {
-	Headers    []string
-	FieldTypes []data.FieldType
-	Rows       [][]any
+// analyticsColumn returns the values of attr in results, which are null where they're missing or not a T. The values
+// share one backing array rather than being allocated a cell at a time.
+func analyticsColumn[T any](results []harper.GetAnalyticsResult, attr string) []*T {
+	backing := make([]T, len(results))
+	column := make([]*T, len(results))
+	for i, result := range results {
+		if v, ok := result[attr].(T); ok {
+			backing[i] = v
+			column[i] = &backing[i]
+		}
+	}
+	return column
 }
 
 func (d *Datasource) query(ctx context.Context, pCtx backend.PluginContext, query backend.DataQuery) (backend.DataResponse, error) {
@@ -169,136 +785,489 @@ func (d *Datasource) query(ctx context.Context, pCtx backend.PluginContext, quer
 
 	switch qo.Operation {
 	case "get_analytics":
-		var qm queryModel[GetAnalyticsQuery]
-		err := json.Unmarshal(query.JSON, &qm)
+		qm, err := parseQueryModel[GetAnalyticsQuery](query.JSON)
 		if err != nil {
-			return backend.DataResponse{}, fmt.Errorf("could not unmarshal get_analytics query JSON: '%s': '%w'", query.JSON, err)
+			return backend.DataResponse{}, err
+		}
+		if len(qm.QueryAttrs.Metrics) > 0 {
+			return d.queryAnalyticsMetrics(ctx, pCtx, query, qm.QueryAttrs)
 		}
 		request := qm.QueryAttrs
+		request.From, request.To = timeRangeMillis(request.From, request.To, query.TimeRange)
+		if err := request.Conditions.expandTimeMacros(query.TimeRange, time.Now()); err != nil {
+			return backend.DataResponse{}, err
+		}
+		adhoc, err := adhocConditions(qm.AdhocFilters)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		request.Conditions = append(request.Conditions, adhoc...)
+
+		interval := cmp.Or(query.Interval, defaultAggregationInterval)
+		if request.Aggregation != "" && !slices.Contains(analyticsAggregations, request.Aggregation) {
+			return backend.DataResponse{}, &QueryValidationError{
+				Field:   "queryAttrs.aggregation",
+				Problem: "expected one of " + strings.Join(analyticsAggregations, ", "),
+			}
+		}
+		if request.Aggregation != "" && len(request.Percentiles) > 0 {
+			return backend.DataResponse{}, &QueryValidationError{
+				Field:   "queryAttrs.percentiles",
+				Problem: "percentiles can't be combined with an aggregation",
+			}
+		}
+		if slices.ContainsFunc(request.Percentiles, func(p float64) bool { return p < 0 || p > 100 }) {
+			return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.percentiles", Problem: "expected values from 0 to 100"}
+		}
+		for attr, role := range request.AttributeRoles {
+			if role != attributeRoleLabel && role != attributeRoleValue {
+				return backend.DataResponse{}, &QueryValidationError{
+					Field:   "queryAttrs.attributeRoles." + attr,
+					Problem: "expected 'label' or 'value'",
+				}
+			}
+		}
+		if slices.Contains(request.GroupBy, "") {
+			return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.groupBy", Problem: "attribute names must not be empty"}
+		}
+		if !slices.Contains(analyticsFormats, request.Format) {
+			return backend.DataResponse{}, &QueryValidationError{
+				Field:   "queryAttrs.format",
+				Problem: "expected one of " + strings.Join(analyticsFormats[1:], ", "),
+			}
+		}
+		if request.Instant && request.Format != "" && request.Format != analyticsFormatTimeSeries {
+			return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.format", Problem: "instant queries are always numeric"}
+		}
+		if request.Format == analyticsFormatHeatmap && (request.Aggregation != "" || len(request.Percentiles) > 0) {
+			return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.format", Problem: "heatmaps can't be combined with an aggregation or percentiles"}
+		}
+		if !slices.IsSorted(request.HeatmapBuckets) {
+			return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.heatmapBuckets", Problem: "expected bounds in ascending order"}
+		}
+		if _, ok := epochUnits[request.TimeUnit]; request.TimeUnit != "" && !ok {
+			return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.timeUnit", Problem: "expected s, ms, us or ns"}
+		}
+		if request.TopK < 0 {
+			return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.topK", Problem: "must not be negative"}
+		}
+		if !slices.Contains(topKScores, request.TopKBy) {
+			return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.topKBy", Problem: "expected 'avg' or 'last'"}
+		}
+		if request.Transform != "" && !slices.Contains(analyticsTransforms, request.Transform) {
+			return backend.DataResponse{}, &QueryValidationError{
+				Field:   "queryAttrs.transform",
+				Problem: "expected one of " + strings.Join(analyticsTransforms, ", "),
+			}
+		}
+		if request.Interval != "" {
+			if interval, err = time.ParseDuration(request.Interval); err != nil || interval <= 0 {
+				return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.interval", Problem: "expected a positive duration"}
+			}
+		}
+		var timeShift time.Duration
+		if request.TimeShift != "" {
+			if timeShift, err = parseTimeShift(request.TimeShift); err != nil {
+				return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.timeShift", Problem: "expected a duration such as -1d"}
+			}
+			request.From += epochMillis(timeShift.Milliseconds())
+			request.To += epochMillis(timeShift.Milliseconds())
+		}
+		if request.ComparePrevious && (request.From <= 0 || request.To <= request.From) {
+			return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.comparePrevious", Problem: "needs a time range"}
+		}
 
 		conditions := make(harper.SearchConditions, 0)
 		for _, c := range request.Conditions {
-			conditions = append(conditions, harper.SearchCondition{
-				Attribute:  c.Attribute,
-				Comparator: c.Comparator,
-				Value:      c.Value.Val,
-			})
+			sc, err := c.toSearchCondition()
+			if err != nil {
+				return backend.DataResponse{}, err
+			}
+			conditions = append(conditions, sc)
+		}
+
+		attributes := request.Attributes
+		if len(attributes) > 0 {
+			for _, attr := range request.GroupBy {
+				if !slices.Contains(attributes, attr) {
+					attributes = append(slices.Clip(attributes), attr)
+				}
+			}
 		}
 
 		req := harper.GetAnalyticsRequest{
 			Metric:        request.Metric,
-			GetAttributes: request.Attributes,
-			StartTime:     request.From,
-			EndTime:       request.To,
+			GetAttributes: attributes,
+			StartTime:     int64(request.From),
+			EndTime:       int64(request.To),
 			CoalesceTime:  true,
 		}
 		if len(conditions) > 0 {
 			req.Conditions = conditions
 		}
 
-		results, err := d.harperClient.GetAnalytics(req)
+		client, err := d.clientFor(ctx, pCtx)
 		if err != nil {
-			return backend.DataResponse{}, fmt.Errorf("could not query Harper analytics: '%s': '%w'", query.JSON, err)
+			return backend.DataResponse{}, err
 		}
 
-		// Collect the superset of all fields in the results.
-		// Grafana gets very cranky if any rows have a different set of fields (columns), so we have to make sure they
-		// all have all of them.
-		allFields := make(map[string]bool)
-		for _, result := range results {
-			for k := range result {
-				if k != "metric" {
-					allFields[k] = true
-				}
+		var results []harper.GetAnalyticsResult
+		var streamed *analyticsColumns
+		var usedRollups, truncated bool
+		var downsampledTo time.Duration
+		if d.streamsAnalytics && d.rollups == nil && request.streamable() {
+			d.logger.Debug("executing Harper operation", "refID", query.RefID, "operation", qo.Operation, "request", req,
+				"streaming", true)
+			start := time.Now()
+			columns, err := streamAnalytics(ctx, client, req, request.TimeUnit, d.maxRows())
+			if err != nil {
+				return backend.DataResponse{}, fmt.Errorf("could not query Harper analytics: '%s': '%w'", query.JSON, err)
 			}
-		}
+			d.logger.Debug("Harper operation completed", "refID", query.RefID, "operation", qo.Operation,
+				"duration", time.Since(start), "results", columns.rows)
+			truncated = columns.truncated
 
-		headers := slices.Collect(maps.Keys(allFields))
-		// Sort the header names so they don't get jumbled on every Grafana refresh
-		sort.Strings(headers)
-
-		grafanaAnalytics := analyticsTable{
-			Headers: headers,
-		}
-
-		grafanaAnalytics.FieldTypes = make([]data.FieldType, len(grafanaAnalytics.Headers))
-
-		for _, result := range results {
-			row := make([]any, len(grafanaAnalytics.Headers))
-			for i, header := range grafanaAnalytics.Headers {
-				val, ok := result[header]
-				if !ok {
-					row[i] = nil
-				} else {
-					switch v := val.(type) {
-					case string:
-						if grafanaAnalytics.FieldTypes[i] == data.FieldTypeUnknown {
-							grafanaAnalytics.FieldTypes[i] = data.FieldTypeNullableString
-						}
-						row[i] = &v
-					case bool:
-						if grafanaAnalytics.FieldTypes[i] == data.FieldTypeUnknown {
-							grafanaAnalytics.FieldTypes[i] = data.FieldTypeNullableBool
-						}
-						row[i] = &v
-					case float64:
-						if grafanaAnalytics.FieldTypes[i] == data.FieldTypeUnknown {
-							grafanaAnalytics.FieldTypes[i] = data.FieldTypeNullableFloat64
-						}
-						row[i] = &v
-					case int64:
-						if grafanaAnalytics.FieldTypes[i] == data.FieldTypeUnknown {
-							grafanaAnalytics.FieldTypes[i] = data.FieldTypeNullableInt64
-						}
-						row[i] = &v
-					case time.Time:
-						if grafanaAnalytics.FieldTypes[i] == data.FieldTypeUnknown {
-							grafanaAnalytics.FieldTypes[i] = data.FieldTypeNullableTime
-						}
-						row[i] = &v
-					case nil:
-						if grafanaAnalytics.FieldTypes[i] == data.FieldTypeUnknown {
-							grafanaAnalytics.FieldTypes[i] = data.FieldTypeNullableString
-						}
-						row[i] = nil
-					}
-				}
+			if !request.Instant {
+				downsampledTo = downsampleRowsInterval(columns.results(), columns.rows, query.MaxDataPoints)
+			}
+			if downsampledTo > 0 {
+				// (the columns are aggregated a row at a time, so only the downsampled rows are held as maps)
+				results = aggregateAnalyticsRows(columns.results(), "avg", downsampledTo)
+			} else {
+				streamed = columns
+			}
+		} else {
+			d.logger.Debug("executing Harper operation", "refID", query.RefID, "operation", qo.Operation, "request", req)
+			start := time.Now()
+			results, usedRollups, err = d.getAnalytics(client, req)
+			if err != nil {
+				return backend.DataResponse{}, fmt.Errorf("could not query Harper analytics: '%s': '%w'", query.JSON, err)
+			}
+			d.logger.Debug("Harper operation completed", "refID", query.RefID, "operation", qo.Operation,
+				"duration", time.Since(start), "results", len(results), "rollups", usedRollups)
+			if len(results) > d.maxRows() {
+				results, truncated = results[:d.maxRows()], true
 			}
-			grafanaAnalytics.Rows = append(grafanaAnalytics.Rows, row)
-		}
 
-		frame := data.NewFrameOfFieldTypes(
-			"response", 0,
-			grafanaAnalytics.FieldTypes...,
-		).SetMeta(
-			&data.FrameMeta{
-				Type:        data.FrameTypeTimeSeriesLong,
-				TypeVersion: data.FrameTypeVersion{0, 1},
-			},
-		).SetRefID(query.RefID)
+			fixAnalyticsTimes(results, request.TimeUnit)
+			if timeShift != 0 {
+				shiftAnalyticsTimes(results, -timeShift)
+			}
+			if request.ComparePrevious {
+				period := time.Duration(request.To-request.From) * time.Millisecond
+				previousReq := req
+				previousReq.StartTime, previousReq.EndTime = req.StartTime-period.Milliseconds(), req.StartTime-1
 
-		err = frame.SetFieldNames(grafanaAnalytics.Headers...)
-		if err != nil {
-			return backend.DataResponse{}, fmt.Errorf("could not set field names on frame: '%s': '%w'", query.JSON, err)
+				d.logger.Debug("executing Harper operation", "refID", query.RefID, "operation", qo.Operation, "request", previousReq)
+				start := time.Now()
+				previous, previousUsedRollups, err := d.getAnalytics(client, previousReq)
+				if err != nil {
+					return backend.DataResponse{}, fmt.Errorf("could not query Harper analytics for the previous period: '%s': '%w'", query.JSON, err)
+				}
+				d.logger.Debug("Harper operation completed", "refID", query.RefID, "operation", qo.Operation,
+					"duration", time.Since(start), "results", len(previous), "rollups", previousUsedRollups)
+				if len(previous) > d.maxRows() {
+					previous, truncated = previous[:d.maxRows()], true
+				}
+
+				fixAnalyticsTimes(previous, request.TimeUnit)
+				shiftAnalyticsTimes(previous, period-timeShift)
+				results = mergePeriods(results, previous)
+				usedRollups = usedRollups || previousUsedRollups
+			}
+			if len(request.AttributeRoles) > 0 {
+				applyAttributeRoles(results, request.AttributeRoles)
+			}
+			if len(request.GroupBy) > 0 {
+				results = groupAnalytics(results, request.GroupBy)
+			}
+			if request.Transform != "" {
+				results = transformCounters(results, request.Transform)
+			}
+			if request.Aggregation != "" {
+				results = aggregateAnalytics(results, request.Aggregation, interval)
+			} else if len(request.Percentiles) > 0 {
+				results = percentileAnalytics(results, request.Percentiles, interval)
+			} else if !request.Instant && request.Format != analyticsFormatHeatmap {
+				// (instant queries only return the latest values, and heatmaps are bucketed by interval, so there's nothing
+				// to downsample)
+				if downsampledTo = downsampleInterval(results, query.MaxDataPoints); downsampledTo > 0 {
+					results = aggregateAnalytics(results, "avg", downsampledTo)
+				}
+			}
 		}
 
-		for _, row := range grafanaAnalytics.Rows {
-			frame.AppendRow(row...)
+		rows, rowCount := slices.Values(results), len(results)
+		if streamed != nil {
+			rows, rowCount = streamed.results(), streamed.rows
+		}
+		source := request.Metric
+		if request.TimeShift != "" {
+			source += " (" + request.TimeShift + ")"
+		}
+		name := frameName(query.RefID, source)
+		longFrame := func() *data.Frame {
+			var frame *data.Frame
+			if streamed != nil {
+				frame = streamed.frame(request.Metric)
+			} else {
+				frame = analyticsResultsFrame(results, request.Metric)
+			}
+			frame.Name = name
+			return frame.SetMeta(
+				&data.FrameMeta{
+					Type:        data.FrameTypeTimeSeriesLong,
+					TypeVersion: data.FrameTypeVersion{0, 1},
+				},
+			).SetRefID(query.RefID)
 		}
 
-		if frame.Rows() == 0 {
-			// early return here so we don't get an error about being unable to convert to wide format
-			response.Frames = append(response.Frames, frame)
-			return response, nil
+		var frames data.Frames
+		visualization := data.VisTypeGraph
+		switch request.Format {
+		case analyticsFormatTable:
+			frames = data.Frames{longFrame()}
+			visualization = data.VisTypeTable
+		case analyticsFormatLogs:
+			frames = data.Frames{longFrame()}
+			visualization = data.VisTypeLogs
+		case analyticsFormatHeatmap:
+			bounds := request.HeatmapBuckets
+			if len(bounds) == 0 {
+				bounds = defaultHeatmapBuckets
+			}
+			heatmap := heatmapFrame(results, bounds, interval)
+			heatmap.Name = name
+			frames = data.Frames{heatmap.SetRefID(query.RefID)}
+			// (Grafana has no preferred visualization for heatmaps)
+			visualization = ""
+		default:
+			// an empty frame can't be converted to wide format, and needn't be
+			if rowCount == 0 {
+				frames = data.Frames{longFrame()}
+				break
+			}
+			if d.settings.LegacyTimeSeriesFrames {
+				frames, err = legacyTimeSeriesFrames(longFrame(), request, d.maxSeries())
+			} else {
+				frames, err = timeSeriesFrames(rows, name, query.RefID, request, d.maxSeries())
+			}
+			if err != nil {
+				return backend.DataResponse{}, err
+			}
+			if len(frames) == 0 {
+				frames = data.Frames{longFrame()}
+				break
+			}
+			if request.Instant {
+				visualization = ""
+			}
 		}
 
-		wideFrame, err := data.LongToWide(frame, &data.FillMissing{Mode: data.FillModeNull})
-		if err != nil {
-			return backend.DataResponse{}, fmt.Errorf("could not convert frame to wide format: '%w'", err)
+		units := d.describedAttributeUnits(client, request.Metric)
+		for _, f := range frames {
+			setFieldUnits(f, request.Metric, units)
+			if request.Format != analyticsFormatHeatmap {
+				// (heatmap fields are named by their bounds)
+				applyFieldNaming(f, d.settings.FieldNaming)
+			}
+			setFieldDisplayHints(f)
+			// (only time series are named by their labels)
+			isTimeSeries := request.Format == "" || request.Format == analyticsFormatTimeSeries ||
+				request.Format == analyticsFormatTimeSeriesMulti
+			if request.LegendFormat != "" && isTimeSeries {
+				applyLegendFormat(f, request.LegendFormat, request.Metric)
+			}
+			if f.Rows() > 0 {
+				f.Meta.PreferredVisualization = visualization
+			}
+			if request.StrictNumeric {
+				keepNumericFields(f)
+			}
+		}
+		if truncated {
+			frames[0].AppendNotices(maxRowsNotice(d.maxRows()))
+		}
+		if usedRollups {
+			frames[0].AppendNotices(data.Notice{
+				Severity: data.NoticeSeverityInfo,
+				Text:     fmt.Sprintf("Served from %s rollups (per-bucket means) with a raw tail", d.rollups.resolution),
+			})
+		}
+		if downsampledTo > 0 {
+			frames[0].AppendNotices(data.Notice{
+				Severity: data.NoticeSeverityInfo,
+				Text: fmt.Sprintf("Downsampled to at most %d points per series (means over %s)",
+					query.MaxDataPoints, downsampledTo),
+			})
 		}
 
-		response.Frames = append(response.Frames, wideFrame)
+		response.Frames = append(response.Frames, frames...)
 		return response, nil
+	case "search_by_conditions":
+		qm, err := parseQueryModel[SearchByConditionsQuery](query.JSON)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		if err := qm.QueryAttrs.Conditions.expandTimeMacros(query.TimeRange, time.Now()); err != nil {
+			return backend.DataResponse{}, err
+		}
+		if err := qm.QueryAttrs.addAdhocFilters(qm.AdhocFilters); err != nil {
+			return backend.DataResponse{}, err
+		}
+		client, err := d.clientFor(ctx, pCtx)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return d.querySearchByConditions(ctx, client, query.RefID, qm.QueryAttrs)
+	case "sql":
+		qm, err := parseQueryModel[SQLQuery](query.JSON)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		client, err := d.clientFor(ctx, pCtx)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return d.querySQL(client, query.RefID, qm.QueryAttrs)
+	case "compare_nodes":
+		qm, err := parseQueryModel[CompareNodesQuery](query.JSON)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		qm.QueryAttrs.From, qm.QueryAttrs.To = timeRangeMillis(qm.QueryAttrs.From, qm.QueryAttrs.To, query.TimeRange)
+		client, err := d.clientFor(ctx, pCtx)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return compareNodes(client, query.RefID, qm.QueryAttrs, query.Interval)
+	case "system_information":
+		qm, err := parseQueryModel[SystemInformationQuery](query.JSON)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		client, err := d.clientFor(ctx, pCtx)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return d.querySystemInformation(client, query.RefID, qm.QueryAttrs)
+	case "read_log":
+		qm, err := parseQueryModel[ReadLogQuery](query.JSON)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		qm.QueryAttrs.From, qm.QueryAttrs.To = timeRangeMillis(qm.QueryAttrs.From, qm.QueryAttrs.To, query.TimeRange)
+		client, err := d.clientFor(ctx, pCtx)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return d.queryReadLog(client, query.RefID, qm.QueryAttrs)
+	case "annotations":
+		qm, err := parseQueryModel[AnnotationsQuery](query.JSON)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		qm.QueryAttrs.From, qm.QueryAttrs.To = timeRangeMillis(qm.QueryAttrs.From, qm.QueryAttrs.To, query.TimeRange)
+		client, err := d.clientFor(ctx, pCtx)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return d.queryAnnotations(client, query.RefID, qm.QueryAttrs)
+	case "get_job":
+		qm, err := parseQueryModel[GetJobQuery](query.JSON)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		client, err := d.clientFor(ctx, pCtx)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return d.queryGetJob(client, query.RefID, qm.QueryAttrs)
+	case "search_jobs_by_start_date":
+		qm, err := parseQueryModel[SearchJobsQuery](query.JSON)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		qm.QueryAttrs.From, qm.QueryAttrs.To = timeRangeMillis(qm.QueryAttrs.From, qm.QueryAttrs.To, query.TimeRange)
+		client, err := d.clientFor(ctx, pCtx)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return d.querySearchJobs(client, query.RefID, qm.QueryAttrs)
+	case "describe_table":
+		qm, err := parseQueryModel[DescribeTableQuery](query.JSON)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		client, err := d.clientFor(ctx, pCtx)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return d.queryDescribeTable(client, query.RefID, qm.QueryAttrs)
+	case "describe_all":
+		client, err := d.clientFor(ctx, pCtx)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return d.queryDescribeAll(client, query.RefID)
+	case "list_users":
+		client, err := d.clientFor(ctx, pCtx)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return d.queryListUsers(client, query.RefID)
+	case "list_roles":
+		client, err := d.clientFor(ctx, pCtx)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return d.queryListRoles(client, query.RefID)
+	case "metric_math":
+		qm, err := parseQueryModel[MetricMathQuery](query.JSON)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		request := qm.QueryAttrs
+		request.From, request.To = timeRangeMillis(request.From, request.To, query.TimeRange)
+		interval := cmp.Or(query.Interval, defaultAggregationInterval)
+		if request.Interval != "" {
+			if interval, err = time.ParseDuration(request.Interval); err != nil || interval <= 0 {
+				return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.interval", Problem: "expected a positive duration"}
+			}
+		}
+		client, err := d.clientFor(ctx, pCtx)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return d.queryMetricMath(client, query.RefID, request, interval)
+	case "join":
+		qm, err := parseQueryModel[JoinQuery](query.JSON)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return d.queryJoin(ctx, pCtx, query, qm)
+	case "raw":
+		qm, err := parseQueryModel[RawQuery](query.JSON)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		client, err := d.clientFor(ctx, pCtx)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return d.queryRaw(client, query.RefID, qm.QueryAttrs)
+	case "registration_info":
+		client, err := d.clientFor(ctx, pCtx)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return d.queryRegistrationInfo(client, query.RefID)
+	case "get_recorded":
+		qm, err := parseQueryModel[RecordedQuery](query.JSON)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		return d.recording.result(qm.QueryAttrs.Rule, query.RefID)
 	default:
 		return backend.DataResponse{}, errors.New("unsupported Harper operation: " + qo.Operation)
 	}
@@ -308,24 +1277,35 @@ func (d *Datasource) query(ctx context.Context, pCtx backend.PluginContext, quer
 // The main use case for these health checks is the test button on the
 // datasource configuration page which allows users to verify that
 // a datasource is working as expected.
-func (d *Datasource) CheckHealth(_ context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
+func (d *Datasource) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
 	res := &backend.CheckHealthResult{}
 
-	err := d.harperClient.Healthcheck()
+	start := time.Now()
+	err := d.harperClient.forContext(ctx).Healthcheck()
+	latency := time.Since(start)
+	d.connection.record(err)
+
+	// Report the round-trip time even on failure so admins can tell "slow" from "down".
+	details, _ := json.Marshal(map[string]any{"latencyMs": latency.Milliseconds()})
+	res.JSONDetails = details
+	healthCheckLatency.WithLabelValues(d.uid).Set(latency.Seconds())
+
 	if err != nil {
 		res.Status = backend.HealthStatusError
 		var opErr *harper.OperationError
-		if errors.As(err, &opErr) {
-			res.Message = fmt.Sprintf("Health check returned unexpected status code: '%d' with message: '%s'",
-				opErr.StatusCode, opErr.Message)
+		var credsErr *CredentialsError
+		if errors.As(asCredentialsError(err, d.settings.Username), &credsErr) {
+			res.Message = credsErr.Error()
+		} else if errors.As(err, &opErr) {
+			res.Message = fmt.Sprintf("Health check failed (%s): Harper returned status code: '%d' with message: '%s'",
+				statusFromError(err), opErr.StatusCode, opErr.Message)
 		} else {
 			res.Message = "Health check returned unexpected error: " + err.Error()
 		}
 		return res, nil
 	}
 
-	return &backend.CheckHealthResult{
-		Status:  backend.HealthStatusOk,
-		Message: "Data source is working",
-	}, nil
+	res.Status = backend.HealthStatusOk
+	res.Message = fmt.Sprintf("Data source is working (Harper responded in %s)", latency.Round(time.Millisecond))
+	return res, nil
 }
@@ -2,9 +2,17 @@ package plugin
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
+	harper "github.com/HarperFast/sdk-go"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/httpclient"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/proxy"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
 
 func TestQueryData(t *testing.T) {
@@ -26,3 +34,307 @@ func TestQueryData(t *testing.T) {
 		t.Fatal("QueryData must return a response")
 	}
 }
+
+func TestQueryDataConcurrent(t *testing.T) {
+	const queries = 3
+	var mu sync.Mutex
+	arrived := 0
+	allArrived := make(chan struct{})
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "system_information" {
+			return nil, nil
+		}
+		// every query waits for the others, so they only all succeed if they run at once
+		mu.Lock()
+		if arrived++; arrived == queries {
+			close(allArrived)
+		}
+		mu.Unlock()
+		select {
+		case <-allArrived:
+			return map[string]any{"memory": map[string]any{"total": 1024}}, nil
+		case <-time.After(5 * time.Second):
+			return nil, fmt.Errorf("queries didn't run concurrently")
+		}
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	req := &backend.QueryDataRequest{}
+	for i := range queries {
+		req.Queries = append(req.Queries, backend.DataQuery{
+			RefID: fmt.Sprint(i),
+			// distinct, so they aren't deduplicated
+			JSON: json.RawMessage(fmt.Sprintf(`{"operation":"system_information","queryAttrs":{"attributes":["memory%d"]}}`, i)),
+		})
+	}
+	resp, err := ds.QueryData(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range req.Queries {
+		if res, ok := resp.Responses[q.RefID]; !ok || res.Error != nil {
+			t.Errorf("expected query %s to succeed, got %v", q.RefID, res.Error)
+		}
+	}
+}
+
+func TestQueryDataPerQueryErrors(t *testing.T) {
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "system_information" {
+			return nil, nil
+		}
+		return map[string]any{"memory": map[string]any{"total": 1024}}, nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			{RefID: "A", JSON: json.RawMessage(`{"operation":"system_information","queryAttrs":{}}`)},
+			{RefID: "B", JSON: json.RawMessage(`{"operation":"get_analytics","queryAttrs":{}}`)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res := resp.Responses["A"]; res.Error != nil {
+		t.Errorf("expected query A to succeed despite B failing, got %v", res.Error)
+	}
+	res := resp.Responses["B"]
+	if res.Error == nil {
+		t.Fatal("expected query B to fail validation")
+	}
+	if res.Status != backend.StatusBadRequest || res.ErrorSource != backend.ErrorSourceDownstream {
+		t.Errorf("expected a downstream bad request, got status %v from %q", res.Status, res.ErrorSource)
+	}
+}
+
+func TestApplyTimeouts(t *testing.T) {
+	opts := httpclient.Options{}
+	applyTimeouts(&opts, Settings{Timeout: 120})
+	if opts.Timeouts.Timeout != 2*time.Minute || opts.Timeouts.DialTimeout != httpclient.DefaultTimeoutOptions.DialTimeout {
+		t.Errorf("expected the request timeout to be set and the dial timeout defaulted, got %+v", opts.Timeouts)
+	}
+
+	opts = httpclient.Options{Timeouts: &httpclient.TimeoutOptions{Timeout: time.Minute}}
+	applyTimeouts(&opts, Settings{DialTimeout: 3})
+	if opts.Timeouts.Timeout != time.Minute || opts.Timeouts.DialTimeout != 3*time.Second {
+		t.Errorf("expected only the dial timeout to change, got %+v", opts.Timeouts)
+	}
+
+	opts = httpclient.Options{ProxyOptions: &proxy.Options{Enabled: true, Timeouts: &proxy.TimeoutOptions{Timeout: time.Minute}}}
+	applyTimeouts(&opts, Settings{DialTimeout: 3})
+	if opts.ProxyOptions.Timeouts.Timeout != 3*time.Second {
+		t.Errorf("expected the dial timeout to apply to the secure SOCKS proxy, got %+v", opts.ProxyOptions.Timeouts)
+	}
+
+	if _, err := newDatasource("test-uid", Settings{Timeout: -1}, newFakeHarperClient()); err == nil {
+		t.Error("expected a negative timeout to be rejected")
+	}
+}
+
+// newTestDatasource returns a Datasource backed by client, disposed of when the test ends.
+func newTestDatasource(t testing.TB, settings Settings, client HarperClient) *Datasource {
+	t.Helper()
+
+	if settings.LogLevel == "" {
+		// keep test and benchmark output readable
+		settings.LogLevel = "warn"
+	}
+
+	ds, err := newDatasource("test-uid", settings, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ds.Dispose)
+
+	return ds
+}
+
+func analyticsQuery(refID string, attrs map[string]any) backend.DataQuery {
+	queryJSON, _ := json.Marshal(map[string]any{
+		"refId":      refID,
+		"operation":  "get_analytics",
+		"queryAttrs": attrs,
+	})
+	return backend.DataQuery{RefID: refID, JSON: queryJSON}
+}
+
+func TestQueryAnalytics(t *testing.T) {
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_000_000)
+	times := []time.Time{start, start.Add(time.Second), start.Add(2 * time.Second)}
+	client.addAnalytics("db-read", times, map[string]any{"node": "node-1", "count": 5.0})
+	client.addAnalytics("db-read", times, map[string]any{"node": "node-2", "count": 7.0})
+
+	ds := newTestDatasource(t, Settings{}, client)
+
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{analyticsQuery("A", map[string]any{"metric": "db-read"})},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := resp.Responses["A"]
+	if res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	if len(res.Frames) != 1 {
+		t.Fatalf("expected 1 frame, got %d", len(res.Frames))
+	}
+
+	frame := res.Frames[0]
+	if frame.Name != "A: db-read" {
+		t.Errorf("unexpected frame name '%s'", frame.Name)
+	}
+	if frame.Rows() != 3 {
+		t.Errorf("expected 3 rows, got %d", frame.Rows())
+	}
+
+	// time + one count field per node
+	if len(frame.Fields) != 3 {
+		t.Fatalf("expected 3 fields, got %d", len(frame.Fields))
+	}
+	for _, field := range frame.Fields[1:] {
+		if field.Name != "count" || field.Labels["node"] == "" {
+			t.Errorf("expected a count field labeled by node, got '%s' %v", field.Name, field.Labels)
+		}
+	}
+	if frame.Meta.Type != data.FrameTypeTimeSeriesWide {
+		t.Errorf("expected a wide time series frame, got %s", frame.Meta.Type)
+	}
+}
+
+func TestQueryAnalyticsNestedConditions(t *testing.T) {
+	client := newFakeHarperClient()
+	client.addAnalytics("db-read", []time.Time{time.UnixMilli(1_700_000_000_000)}, map[string]any{"node": "node-1", "count": 5.0})
+	ds := newTestDatasource(t, Settings{}, client)
+
+	_, err := ds.query(context.Background(), backend.PluginContext{}, analyticsQuery("A", map[string]any{
+		"metric": "db-read",
+		"conditions": []map[string]any{{
+			"operator": "or",
+			"conditions": []map[string]any{
+				{"attribute": "node", "comparator": "equals", "value": map[string]any{"val": "node-1"}},
+				{"attribute": "node", "comparator": "equals", "value": map[string]any{"val": "node-2"}},
+			},
+		}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conditions := client.lastAnalyticsRequest.Conditions
+	if len(conditions) != 1 || conditions[0].Operator != "or" || len(conditions[0].Conditions) != 2 {
+		t.Fatalf("expected one OR group of two conditions, got %+v", conditions)
+	}
+	if nested := conditions[0].Conditions[1]; nested.Attribute != "node" || nested.Value != "node-2" {
+		t.Errorf("unexpected nested condition %+v", nested)
+	}
+}
+
+func TestQueryAnalyticsDashboardTimeRange(t *testing.T) {
+	client := newFakeHarperClient()
+	ds := newTestDatasource(t, Settings{}, client)
+
+	start := time.UnixMilli(1_700_000_000_000)
+	query := analyticsQuery("A", map[string]any{"metric": "db-read", "to": 1_700_000_900_000})
+	query.TimeRange = backend.TimeRange{From: start, To: start.Add(time.Hour)}
+	if _, err := ds.query(context.Background(), backend.PluginContext{}, query); err != nil {
+		t.Fatal(err)
+	}
+
+	req := client.lastAnalyticsRequest
+	if req.StartTime != start.UnixMilli() {
+		t.Errorf("expected the start time to fall back to the dashboard's, got %d", req.StartTime)
+	}
+	if req.EndTime != 1_700_000_900_000 {
+		t.Errorf("expected the query's own end time to be kept, got %d", req.EndTime)
+	}
+}
+
+func BenchmarkQueryAnalytics(b *testing.B) {
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_000_000)
+	times := make([]time.Time, 10_000)
+	for i := range times {
+		times[i] = start.Add(time.Duration(i) * time.Second)
+	}
+	for n := range 4 {
+		client.addAnalytics("db-read", times, map[string]any{"node": fmt.Sprintf("node-%d", n), "count": float64(n)})
+	}
+
+	ds := newTestDatasource(b, Settings{}, client)
+	req := &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{analyticsQuery("A", map[string]any{"metric": "db-read"})},
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		if _, err := ds.QueryData(context.Background(), req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestAnalyticsResultsFrame(t *testing.T) {
+	ts := time.UnixMilli(1_700_000_000_000)
+	frame := analyticsResultsFrame([]harper.GetAnalyticsResult{
+		{"id": ts, "node": "a", "count": nil, "cached": true},
+		{"id": ts.Add(time.Second), "count": 2.0, "cached": "yes"},
+		{"id": ts.Add(2 * time.Second), "node": "b", "count": 3.0, "unset": nil},
+	}, "db-read")
+
+	want := []struct {
+		name      string
+		fieldType data.FieldType
+		values    []any
+	}{
+		{"cached", data.FieldTypeNullableBool, []any{true, nil, nil}},
+		{"count", data.FieldTypeNullableFloat64, []any{nil, 2.0, 3.0}},
+		{"id", data.FieldTypeNullableTime, []any{ts, ts.Add(time.Second), ts.Add(2 * time.Second)}},
+		{"metric", data.FieldTypeNullableString, []any{"db-read", "db-read", "db-read"}},
+		{"node", data.FieldTypeNullableString, []any{"a", nil, "b"}},
+		{"unset", data.FieldTypeNullableString, []any{nil, nil, nil}},
+	}
+	if len(frame.Fields) != len(want) {
+		t.Fatalf("expected %d fields, got %d", len(want), len(frame.Fields))
+	}
+	for i, w := range want {
+		f := frame.Fields[i]
+		if f.Name != w.name || f.Type() != w.fieldType {
+			t.Errorf("expected field %d to be %s %s, got %s %s", i, w.fieldType, w.name, f.Type(), f.Name)
+			continue
+		}
+		for row, v := range w.values {
+			got, ok := f.ConcreteAt(row)
+			if !ok {
+				got = nil
+			}
+			if got != v {
+				t.Errorf("expected %s[%d] to be %v, got %v", w.name, row, v, got)
+			}
+		}
+	}
+}
+
+func BenchmarkAnalyticsResultsFrame(b *testing.B) {
+	start := time.UnixMilli(1_700_000_000_000)
+	results := make([]harper.GetAnalyticsResult, 300_000)
+	for i := range results {
+		results[i] = harper.GetAnalyticsResult{
+			"id":    start.Add(time.Duration(i) * time.Second),
+			"node":  fmt.Sprintf("node-%d", i%4),
+			"count": float64(i),
+			"p95":   float64(i) / 2,
+		}
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		analyticsResultsFrame(results, "db-read")
+	}
+}
@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// dedupeQueries returns the queries that have to run, leaving out those identical to an earlier one, and maps each
+// left out query's RefID to the RefID of the query whose response it shares.
+func dedupeQueries(queries []backend.DataQuery) ([]backend.DataQuery, map[string]string) {
+	unique := make([]backend.DataQuery, 0, len(queries))
+	duplicates := make(map[string]string)
+	seen := make(map[string]string, len(queries))
+	for _, q := range queries {
+		key := queryKey(q)
+		if refID, ok := seen[key]; ok {
+			duplicates[q.RefID] = refID
+			continue
+		}
+		seen[key] = q.RefID
+		unique = append(unique, q)
+	}
+	return unique, duplicates
+}
+
+// queryKey identifies what a query asks Harper for: its JSON, less the RefID Grafana includes in it, and the time
+// range and resolution it's run for.
+func queryKey(q backend.DataQuery) string {
+	model := string(q.JSON)
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(q.JSON, &fields); err == nil {
+		delete(fields, "refId")
+		// maps are marshalled with sorted keys, so key order doesn't tell queries apart
+		if canonical, err := json.Marshal(fields); err == nil {
+			model = string(canonical)
+		}
+	}
+	return fmt.Sprintf("%s\x00%d\x00%d\x00%d\x00%d\x00%s", q.QueryType, q.TimeRange.From.UnixNano(),
+		q.TimeRange.To.UnixNano(), q.Interval, q.MaxDataPoints, model)
+}
+
+// responseForRefID returns a copy of res, the response to query from, as the response to query to. Frames are
+// copied shallowly, with their RefID and any RefID prefix of their names replaced; their fields are shared.
+func responseForRefID(res backend.DataResponse, from string, to string) backend.DataResponse {
+	if res.Frames == nil {
+		return res
+	}
+	frames := make(data.Frames, len(res.Frames))
+	for i, frame := range res.Frames {
+		copied := *frame
+		copied.RefID = to
+		if copied.Name == from {
+			copied.Name = to
+		} else if source, ok := strings.CutPrefix(copied.Name, from+": "); ok {
+			copied.Name = frameName(to, source)
+		}
+		frames[i] = &copied
+	}
+	res.Frames = frames
+	return res
+}
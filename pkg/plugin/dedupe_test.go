@@ -0,0 +1,61 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestQueryDataDeduplicatesQueries(t *testing.T) {
+	var calls atomic.Int32
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "system_information" {
+			return nil, nil
+		}
+		calls.Add(1)
+		return map[string]any{"memory": map[string]any{"total": 1024}}, nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			{RefID: "A", JSON: json.RawMessage(`{"refId":"A","operation":"system_information","queryAttrs":{}}`)},
+			{RefID: "B", JSON: json.RawMessage(`{"queryAttrs":{},"operation":"system_information","refId":"B"}`)},
+			{RefID: "C", JSON: json.RawMessage(`{"refId":"C","operation":"system_information","queryAttrs":{"attributes":["memory"]}}`)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected the identical queries to run once, got %d system_information calls", got)
+	}
+	for _, refID := range []string{"A", "B", "C"} {
+		res := resp.Responses[refID]
+		if res.Error != nil || len(res.Frames) == 0 {
+			t.Fatalf("expected frames for query %s, got error %v", refID, res.Error)
+		}
+		if frame := res.Frames[0]; frame.RefID != refID || frame.Name != frameName(refID, "system_information") {
+			t.Errorf("expected query %s's frame to be its own, got RefID %q and name %q", refID, frame.RefID, frame.Name)
+		}
+	}
+	if resp.Responses["A"].Frames[0] == resp.Responses["B"].Frames[0] {
+		t.Error("expected the shared response's frames to be copied")
+	}
+}
+
+func TestDedupeQueriesTimeRange(t *testing.T) {
+	q := backend.DataQuery{RefID: "A", JSON: json.RawMessage(`{"operation":"system_information"}`)}
+	shifted := q
+	shifted.RefID = "B"
+	shifted.TimeRange.From = shifted.TimeRange.From.Add(1)
+
+	if unique, _ := dedupeQueries([]backend.DataQuery{q, shifted}); len(unique) != 2 {
+		t.Errorf("expected queries over different time ranges to both run, got %d", len(unique))
+	}
+}
@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// tableSummary is the part of each table's describe_all entry the inventory uses. TableSize is only reported by
+// Harper versions that track storage per table.
+type tableSummary struct {
+	RecordCount int64  `json:"record_count"`
+	TableSize   *int64 `json:"table_size"`
+}
+
+// queryDescribeAll returns an inventory frame with a row per table across every database. Tables the user's access
+// rule doesn't cover are left out.
+func (d *Datasource) queryDescribeAll(client HarperClient, refID string) (backend.DataResponse, error) {
+	op := simpleOperation{Operation: harper.OP_DESCRIBE_ALL}
+
+	d.logger.Debug("executing Harper operation", "refID", refID, "operation", op.Operation)
+	start := time.Now()
+	var databases map[string]map[string]tableSummary
+	if err := client.RawRequest(op, &databases); err != nil {
+		return backend.DataResponse{}, fmt.Errorf("could not describe Harper databases: '%w'", err)
+	}
+	d.logger.Debug("Harper operation completed", "refID", refID, "operation", op.Operation, "duration", time.Since(start))
+
+	pc, _ := client.(*policyClient)
+
+	frame := data.NewFrame(frameName(refID, "tables"),
+		data.NewField("database", nil, []string{}),
+		data.NewField("table", nil, []string{}),
+		data.NewField("record count", nil, []int64{}),
+		data.NewField("size", nil, []*int64{}).SetConfig(&data.FieldConfig{Unit: "bytes"}),
+	).SetMeta(&data.FrameMeta{PreferredVisualization: data.VisTypeTable}).SetRefID(refID)
+
+	for _, database := range slices.Sorted(maps.Keys(databases)) {
+		tables := databases[database]
+		for _, table := range slices.Sorted(maps.Keys(tables)) {
+			if pc != nil && pc.checkTableAccess(op.Operation, database, table) != nil {
+				continue
+			}
+			frame.AppendRow(database, table, tables[table].RecordCount, tables[table].TableSize)
+		}
+	}
+
+	return backend.DataResponse{Frames: data.Frames{frame}}, nil
+}
@@ -0,0 +1,52 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestQueryDescribeAll(t *testing.T) {
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "describe_all" {
+			return nil, nil
+		}
+		return json.RawMessage(`{
+			"dev": {"dog": {"record_count": 42, "table_size": 8192}, "breed": {"record_count": 3}},
+			"ops": {"audit": {"record_count": 1000, "table_size": 65536}}
+		}`), nil
+	}
+	ds := newTestDatasource(t, Settings{AccessRules: []AccessRule{{Role: "Viewer", Tables: []string{"dev.*"}}}}, client)
+
+	queryJSON, _ := json.Marshal(map[string]any{"operation": "describe_all"})
+
+	res, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: queryJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := res.Frames[0]
+	if frame.Rows() != 3 {
+		t.Fatalf("expected 3 rows, got %d", frame.Rows())
+	}
+	if frame.Fields[0].At(0) != "dev" || frame.Fields[1].At(0) != "breed" {
+		t.Errorf("expected rows sorted by database and table, got %v.%v first", frame.Fields[0].At(0), frame.Fields[1].At(0))
+	}
+	if size := frame.Fields[3].At(0).(*int64); size != nil {
+		t.Errorf("expected no size for breed, got %d", *size)
+	}
+	if size := frame.Fields[3].At(1).(*int64); size == nil || *size != 8192 {
+		t.Errorf("expected a size of 8192 for dog, got %v", size)
+	}
+
+	viewer := backend.PluginContext{User: &backend.User{Login: "viewer", Role: "Viewer"}}
+	res, err = ds.query(context.Background(), viewer, backend.DataQuery{RefID: "A", JSON: queryJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := res.Frames[0].Rows(); rows != 2 {
+		t.Errorf("expected the viewer to see 2 tables, got %d", rows)
+	}
+}
@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"fmt"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// DescribeTableQuery describes a Harper table's schema, e.g. to compare it across environments.
+type DescribeTableQuery struct {
+	Database string `json:"database" validate:"required"`
+	Table    string `json:"table" validate:"required"`
+}
+
+type describeTableOperation struct {
+	Operation string `json:"operation"`
+	Database  string `json:"database"`
+	Table     string `json:"table"`
+}
+
+func (o describeTableOperation) Prepare() any {
+	return o
+}
+
+// tableDescription is Harper's describe_table response. Attribute types and the indexed flag are only reported for
+// tables with a defined schema.
+type tableDescription struct {
+	HashAttribute string `json:"hash_attribute"`
+	PrimaryKey    string `json:"primary_key"`
+	RecordCount   int64  `json:"record_count"`
+	Attributes    []struct {
+		Attribute    string `json:"attribute"`
+		Type         string `json:"type"`
+		Indexed      bool   `json:"indexed"`
+		IsPrimaryKey bool   `json:"is_primary_key"`
+	} `json:"attributes"`
+}
+
+// queryDescribeTable returns a frame with a row per attribute of the table. The table's record count is repeated on
+// every row so it's kept when frames from several environments are joined.
+func (d *Datasource) queryDescribeTable(client HarperClient, refID string, request DescribeTableQuery) (backend.DataResponse, error) {
+	op := describeTableOperation{Operation: harper.OP_DESCRIBE_TABLE, Database: request.Database, Table: request.Table}
+
+	d.logger.Debug("executing Harper operation", "refID", refID, "operation", op.Operation, "request", op)
+	start := time.Now()
+	var desc tableDescription
+	if err := client.RawRequest(op, &desc); err != nil {
+		return backend.DataResponse{}, fmt.Errorf("could not describe Harper table '%s.%s': '%w'", request.Database, request.Table, err)
+	}
+	d.logger.Debug("Harper operation completed", "refID", refID, "operation", op.Operation, "duration", time.Since(start))
+
+	primaryKey := desc.PrimaryKey
+	if primaryKey == "" {
+		primaryKey = desc.HashAttribute
+	}
+
+	frame := data.NewFrame(frameName(refID, request.Database+"."+request.Table),
+		data.NewField("attribute", nil, []string{}),
+		data.NewField("type", nil, []string{}),
+		data.NewField("indexed", nil, []bool{}),
+		data.NewField("primary key", nil, []bool{}),
+		data.NewField("record count", nil, []int64{}),
+	).SetMeta(&data.FrameMeta{PreferredVisualization: data.VisTypeTable}).SetRefID(refID)
+
+	for _, attr := range desc.Attributes {
+		isPrimaryKey := attr.IsPrimaryKey || attr.Attribute == primaryKey
+		frame.AppendRow(attr.Attribute, attr.Type, attr.Indexed || isPrimaryKey, isPrimaryKey, desc.RecordCount)
+	}
+
+	return backend.DataResponse{Frames: data.Frames{frame}}, nil
+}
@@ -0,0 +1,56 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestQueryDescribeTable(t *testing.T) {
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "describe_table" || op["table"] != "dog" {
+			return nil, nil
+		}
+		return json.RawMessage(`{"name":"dog","database":"dev","primary_key":"id","record_count":42,"attributes":[
+			{"attribute":"id","type":"ID"},
+			{"attribute":"name","type":"String","indexed":true},
+			{"attribute":"age","type":"Int"}
+		]}`), nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	queryJSON, _ := json.Marshal(map[string]any{
+		"operation":  "describe_table",
+		"queryAttrs": map[string]any{"database": "dev", "table": "dog"},
+	})
+	res, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: queryJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := res.Frames[0]
+	if frame.Rows() != 3 {
+		t.Fatalf("expected 3 rows, got %d", frame.Rows())
+	}
+	for i, want := range []struct {
+		name       string
+		typ        string
+		indexed    bool
+		primaryKey bool
+	}{
+		{"id", "ID", true, true},
+		{"name", "String", true, false},
+		{"age", "Int", false, false},
+	} {
+		row := []any{frame.Fields[0].At(i), frame.Fields[1].At(i), frame.Fields[2].At(i), frame.Fields[3].At(i)}
+		if row[0] != want.name || row[1] != want.typ || row[2] != want.indexed || row[3] != want.primaryKey {
+			t.Errorf("unexpected row %d: %v", i, row)
+		}
+		if frame.Fields[4].At(i) != int64(42) {
+			t.Errorf("expected a record count of 42, got %v", frame.Fields[4].At(i))
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// diagnostics is the GET /diagnostics response: the state of the instance's connection to Harper, including the
+// result of the startup connection test, and the settings it was created with that affect connecting.
+type diagnostics struct {
+	URL        string                `json:"url"`
+	Username   string                `json:"username"`
+	Connection connectionDiagnostics `json:"connection"`
+	// CircuitBreaker is nil if the circuit breaker is disabled.
+	CircuitBreaker *circuitDiagnostics `json:"circuitBreaker,omitempty"`
+}
+
+type diagnosticsHandler struct {
+	datasource *Datasource
+}
+
+func newDiagnosticsHandler(datasource *Datasource) *diagnosticsHandler {
+	return &diagnosticsHandler{datasource: datasource}
+}
+
+func (dh *diagnosticsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+
+	diag := diagnostics{
+		URL:        dh.datasource.settings.OpsAPIURL,
+		Username:   dh.datasource.settings.Username,
+		Connection: dh.datasource.connection.diagnostics(),
+	}
+	if dh.datasource.breaker != nil {
+		diag.CircuitBreaker = dh.datasource.breaker.diagnostics()
+	}
+	jsonResp, err := json.Marshal(diag)
+	if err != nil {
+		dh.datasource.logger.Error("error marshaling diagnostics to JSON", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(jsonResp)
+	if err != nil {
+		dh.datasource.logger.Error("error writing response", "error", err)
+	}
+}
@@ -0,0 +1,147 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+)
+
+// epochUnits are the units epoch timestamps can be given in, by the names queries use for them.
+var epochUnits = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+// epochMillis is a query's epoch milliseconds timestamp. The query editor saves it as Grafana's "${__from}" or
+// "${__to}" variable, which queries that reach the backend without being interpolated, such as alert rules', still
+// hold; those are left unset (0) so the query's time range is used. Numeric strings are read as numbers.
+type epochMillis int64
+
+// timeRangeVariable matches Grafana's time range variables, with or without braces or a format.
+var timeRangeVariable = regexp.MustCompile(`^\$(__from|__to|\{__(from|to)(:[^}]*)?\})$`)
+
+func (m *epochMillis) UnmarshalJSON(b []byte) error {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case nil:
+		*m = 0
+	case float64:
+		*m = epochMillis(v)
+	case string:
+		s := strings.TrimSpace(v)
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			*m = epochMillis(n)
+		} else if s == "" || timeRangeVariable.MatchString(s) {
+			*m = 0
+		} else {
+			return fmt.Errorf("expected epoch milliseconds or ${__from} or ${__to}, got %q", v)
+		}
+	default:
+		return fmt.Errorf("expected epoch milliseconds or ${__from} or ${__to}, got %s", b)
+	}
+	return nil
+}
+
+// validateJSON accepts the values UnmarshalJSON reads, for query validation.
+func (m *epochMillis) validateJSON(path string, raw json.RawMessage) error {
+	var v epochMillis
+	if err := v.UnmarshalJSON(raw); err != nil {
+		return &QueryValidationError{Field: path, Problem: err.Error()}
+	}
+	return nil
+}
+
+// detectEpochUnit guesses the unit of a column of epoch timestamps from the magnitude of its largest value: any
+// timestamp between 1973 and 5138 has a different number of digits in each unit.
+func detectEpochUnit(values []float64) time.Duration {
+	var largest float64
+	for _, v := range values {
+		largest = max(largest, math.Abs(v))
+	}
+	switch {
+	case largest < 1e11:
+		return time.Second
+	case largest < 1e14:
+		return time.Millisecond
+	case largest < 1e17:
+		return time.Microsecond
+	default:
+		return time.Nanosecond
+	}
+}
+
+// epochUnit returns the named unit, or detects it from values if name is empty.
+func epochUnit(name string, values []float64) time.Duration {
+	if unit, ok := epochUnits[name]; ok {
+		return unit
+	}
+	return detectEpochUnit(values)
+}
+
+func epochToTime(v float64, unit time.Duration) time.Time {
+	return time.Unix(0, int64(v*float64(unit)))
+}
+
+// parseTimeString returns s as a time if it's an RFC 3339 (ISO 8601) timestamp.
+func parseTimeString(s string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	return t, err == nil
+}
+
+// fixAnalyticsTimes re-reads the "id" timestamps of analytics rows in the named unit, or the one detected from
+// them, as the SDK always reads them as epoch milliseconds, and parses the attributes whose values are all RFC 3339
+// strings into times, so they're time fields rather than strings.
+func fixAnalyticsTimes(results []harper.GetAnalyticsResult, unitName string) {
+	parseAnalyticsTimeStrings(results)
+
+	values := make([]float64, 0, len(results))
+	for _, row := range results {
+		if ts, ok := row["id"].(time.Time); ok {
+			values = append(values, float64(ts.UnixMilli()))
+		}
+	}
+	unit := epochUnit(unitName, values)
+	if unit == time.Millisecond {
+		return
+	}
+
+	for _, row := range results {
+		if ts, ok := row["id"].(time.Time); ok {
+			row["id"] = epochToTime(float64(ts.UnixMilli()), unit)
+		}
+	}
+}
+
+// parseAnalyticsTimeStrings converts the string values of the attributes of analytics rows whose every string value
+// is an RFC 3339 timestamp to times.
+func parseAnalyticsTimeStrings(results []harper.GetAnalyticsResult) {
+	isTime := make(map[string]bool)
+	for _, row := range results {
+		for k, v := range row {
+			if s, ok := v.(string); ok {
+				if parsed, seen := isTime[k]; parsed || !seen {
+					_, isTime[k] = parseTimeString(s)
+				}
+			}
+		}
+	}
+
+	for _, row := range results {
+		for k, v := range row {
+			if s, ok := v.(string); ok && isTime[k] {
+				row[k], _ = parseTimeString(s)
+			}
+		}
+	}
+}
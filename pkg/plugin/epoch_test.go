@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestDetectEpochUnit(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value float64
+		want  time.Duration
+	}{
+		{float64(ts.Unix()), time.Second},
+		{float64(ts.UnixMilli()), time.Millisecond},
+		{float64(ts.UnixMicro()), time.Microsecond},
+		{float64(ts.UnixNano()), time.Nanosecond},
+	}
+	for _, tt := range tests {
+		unit := detectEpochUnit([]float64{tt.value})
+		if unit != tt.want {
+			t.Errorf("expected %v to be in %v, got %v", tt.value, tt.want, unit)
+		}
+		if got := epochToTime(tt.value, unit); !got.Equal(ts) {
+			t.Errorf("expected %v to be %v, got %v", tt.value, ts, got)
+		}
+	}
+}
+
+func TestFixAnalyticsTimes(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// the SDK reads epoch seconds as milliseconds
+	results := []harper.GetAnalyticsResult{{"id": time.UnixMilli(ts.Unix())}}
+	fixAnalyticsTimes(results, "")
+	if got := results[0]["id"].(time.Time); !got.Equal(ts) {
+		t.Errorf("expected seconds to be detected, got %v", got)
+	}
+
+	results = []harper.GetAnalyticsResult{{"id": ts}}
+	fixAnalyticsTimes(results, "")
+	if got := results[0]["id"].(time.Time); !got.Equal(ts) {
+		t.Errorf("expected milliseconds to be left alone, got %v", got)
+	}
+
+	results = []harper.GetAnalyticsResult{{"id": ts}}
+	fixAnalyticsTimes(results, "us")
+	if got := results[0]["id"].(time.Time); !got.Equal(time.UnixMicro(ts.UnixMilli())) {
+		t.Errorf("expected the unit override to be used, got %v", got)
+	}
+}
+
+func TestParseAnalyticsTimeStrings(t *testing.T) {
+	results := []harper.GetAnalyticsResult{
+		{"lastRestart": "2024-05-01T12:00:00Z", "node": "a", "version": "2024-05-01T12:00:00Z"},
+		{"lastRestart": "2024-05-01T13:30:00.5+01:00", "node": "b", "version": "4.5.0"},
+		{"node": "c"},
+	}
+	fixAnalyticsTimes(results, "")
+
+	want := time.Date(2024, 5, 1, 12, 30, 0, 500_000_000, time.UTC)
+	if got, ok := results[1]["lastRestart"].(time.Time); !ok || !got.Equal(want) {
+		t.Errorf("expected the RFC 3339 string to be parsed, got %v", results[1]["lastRestart"])
+	}
+	if _, ok := results[0]["version"].(string); !ok {
+		t.Errorf("expected an attribute with other strings to be left alone, got %v", results[0]["version"])
+	}
+	if _, ok := results[2]["lastRestart"]; ok {
+		t.Errorf("expected a missing attribute to stay missing, got %v", results[2]["lastRestart"])
+	}
+
+	columns := newAnalyticsColumns()
+	if err := columns.decode(strings.NewReader(`[{"lastRestart": "2024-05-01T12:00:00Z", "version": "4.5.0"}, {"version": "2024-05-01T12:00:00Z"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	columns.setTimes("")
+	if got := columns.fields["lastRestart"].Type(); got != data.FieldTypeNullableTime {
+		t.Errorf("expected the streamed RFC 3339 strings to be a time field, got %s", got)
+	}
+	if got := columns.fields["version"].Type(); got != data.FieldTypeNullableString {
+		t.Errorf("expected the streamed mixed strings to stay strings, got %s", got)
+	}
+
+	// in a time series, each series' RFC 3339 attribute is a labeled time field, named like its other values
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_000_000)
+	for _, node := range []string{"a", "b"} {
+		client.addAnalytics("restarts", []time.Time{start, start.Add(time.Minute)},
+			map[string]any{"node": node, "lastRestart": "2024-05-01T12:00:00Z", "count": 1.0})
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+	res, err := ds.query(context.Background(), backend.PluginContext{}, analyticsQuery("A", map[string]any{"metric": "restarts"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restarts int
+	for _, field := range res.Frames[0].Fields {
+		if field.Name == "lastRestart" {
+			restarts++
+			if !field.Type().Time() || field.Labels["node"] == "" {
+				t.Errorf("expected a labeled time field, got %s %v", field.Type(), field.Labels)
+			}
+			if field.Config != nil && field.Config.DisplayNameFromDS == "Time" {
+				t.Errorf("expected the %v lastRestart field not to be displayed as the frame's time", field.Labels)
+			}
+		}
+	}
+	if restarts != 2 {
+		t.Errorf("expected a lastRestart field per series, got %d", restarts)
+	}
+	if got := res.Frames[0].Fields[0].Config.DisplayNameFromDS; got != "Time" {
+		t.Errorf("expected the timestamps to be displayed as Time, got %q", got)
+	}
+}
@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// CredentialsError reports that Harper rejected the datasource's configured credentials. Its message is meant to be
+// shown as-is on dashboards, telling the user what to fix rather than surfacing a generic query failure.
+type CredentialsError struct {
+	Username string
+	Err      error
+}
+
+func (e *CredentialsError) Error() string {
+	if e.Username == "" {
+		// (authenticated with an operation token alone)
+		return "Harper authentication failed — update the datasource credentials"
+	}
+	return fmt.Sprintf("Harper authentication failed for user '%s' — update the datasource credentials", e.Username)
+}
+
+func (e *CredentialsError) Unwrap() error {
+	return e.Err
+}
+
+// asCredentialsError wraps err in a *CredentialsError if it's Harper rejecting username's credentials (HTTP 401), and
+// returns it unchanged otherwise.
+func asCredentialsError(err error, username string) error {
+	var opErr *harper.OperationError
+	if errors.As(err, &opErr) && opErr.StatusCode == http.StatusUnauthorized {
+		return &CredentialsError{Username: username, Err: err}
+	}
+	return err
+}
+
+// statusFromError maps an error from a query or the Harper client to the closest Grafana backend.Status, so
+// Grafana reports e.g. bad credentials as Unauthorized rather than as a generic query failure.
+func statusFromError(err error) backend.Status {
+	var vErr *QueryValidationError
+	if errors.As(err, &vErr) {
+		return backend.StatusBadRequest
+	}
+
+	var policyErr *OperationNotAllowedError
+	if errors.As(err, &policyErr) {
+		return backend.StatusForbidden
+	}
+
+	var unavailableErr *AnalyticsUnavailableError
+	if errors.As(err, &unavailableErr) {
+		return backend.StatusNotImplemented
+	}
+
+	var tenantErr *TenantError
+	if errors.As(err, &tenantErr) {
+		return backend.StatusForbidden
+	}
+
+	var circuitErr *CircuitOpenError
+	if errors.As(err, &circuitErr) {
+		return backend.StatusBadGateway
+	}
+
+	if isTimeoutError(err) {
+		return backend.StatusTimeout
+	}
+
+	var opErr *harper.OperationError
+	if errors.As(err, &opErr) {
+		return statusFromHarperStatusCode(opErr.StatusCode)
+	}
+
+	if isMalformedQueryError(err) {
+		return backend.StatusBadRequest
+	}
+
+	// anything else is the plugin failing to handle a valid query
+	return backend.StatusInternal
+}
+
+// errorSourceFromError attributes an error from a query or the Harper client to the plugin or to what's downstream of
+// it, so Grafana only counts the plugin's own failures against it. Errors caused by the query, the datasource's
+// configuration or Harper itself are downstream.
+func errorSourceFromError(err error) backend.ErrorSource {
+	if backend.IsPluginError(err) {
+		return backend.ErrorSourcePlugin
+	}
+	if backend.IsDownstreamError(err) || isTimeoutError(err) {
+		return backend.ErrorSourceDownstream
+	}
+
+	var vErr *QueryValidationError
+	var policyErr *OperationNotAllowedError
+	var unavailableErr *AnalyticsUnavailableError
+	var tenantErr *TenantError
+	var circuitErr *CircuitOpenError
+	var opErr *harper.OperationError
+	if errors.As(err, &vErr) || errors.As(err, &policyErr) || errors.As(err, &unavailableErr) ||
+		errors.As(err, &tenantErr) || errors.As(err, &circuitErr) || errors.As(err, &opErr) ||
+		isMalformedQueryError(err) {
+		return backend.ErrorSourceDownstream
+	}
+
+	return backend.ErrorSourcePlugin
+}
+
+// isMalformedQueryError reports whether err is a query's JSON failing to parse.
+func isMalformedQueryError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
+}
+
+func statusFromHarperStatusCode(code int) backend.Status {
+	switch {
+	case code == 0:
+		// the SDK reports transport failures (connection refused, DNS, TLS, ...) with no status code
+		return backend.StatusBadGateway
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		return backend.StatusUnauthorized
+	case code == http.StatusNotFound:
+		return backend.StatusNotFound
+	case code == http.StatusTooManyRequests:
+		return backend.StatusTooManyRequests
+	case code == http.StatusRequestTimeout, code == http.StatusGatewayTimeout:
+		return backend.StatusTimeout
+	case code == http.StatusBadGateway, code == http.StatusServiceUnavailable:
+		return backend.StatusBadGateway
+	case code >= 400 && code < 500:
+		return backend.StatusBadRequest
+	default:
+		return backend.StatusInternal
+	}
+}
+
+// isTimeoutError reports whether err is (or, for Harper client errors, describes) a timeout. The Harper SDK flattens
+// transport errors into OperationError messages, so those are matched on their text.
+func isTimeoutError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err) {
+		return true
+	}
+
+	var opErr *harper.OperationError
+	if errors.As(err, &opErr) && opErr.StatusCode == 0 {
+		msg := strings.ToLower(opErr.Message)
+		return strings.Contains(msg, "timeout") || strings.Contains(msg, "deadline exceeded")
+	}
+
+	return false
+}
@@ -0,0 +1,80 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestStatusFromError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want backend.Status
+	}{
+		{&harper.OperationError{StatusCode: 401, Message: "Login failed"}, backend.StatusUnauthorized},
+		{&harper.OperationError{StatusCode: 403, Message: "not authorized"}, backend.StatusUnauthorized},
+		{&harper.OperationError{StatusCode: 404, Message: "not found"}, backend.StatusNotFound},
+		{&harper.OperationError{StatusCode: 429, Message: "slow down"}, backend.StatusTooManyRequests},
+		{&harper.OperationError{StatusCode: 0, Message: "Client.Timeout exceeded"}, backend.StatusTimeout},
+		{&harper.OperationError{StatusCode: 0, Message: "connection refused"}, backend.StatusBadGateway},
+		{&harper.OperationError{StatusCode: 500, Message: "boom"}, backend.StatusInternal},
+		{fmt.Errorf("wrapped: '%w'", &harper.OperationError{StatusCode: 401}), backend.StatusUnauthorized},
+		{&QueryValidationError{Field: "operation", Problem: "is required"}, backend.StatusBadRequest},
+		{fmt.Errorf("could not unmarshal: '%w'", &json.SyntaxError{}), backend.StatusBadRequest},
+		{errors.New("could not convert frame"), backend.StatusInternal},
+	}
+
+	for _, tt := range tests {
+		if got := statusFromError(tt.err); got != tt.want {
+			t.Errorf("statusFromError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestErrorSourceFromError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want backend.ErrorSource
+	}{
+		{&harper.OperationError{StatusCode: 401, Message: "Login failed"}, backend.ErrorSourceDownstream},
+		{&harper.OperationError{StatusCode: 500, Message: "boom"}, backend.ErrorSourceDownstream},
+		{&harper.OperationError{StatusCode: 0, Message: "connection refused"}, backend.ErrorSourceDownstream},
+		{fmt.Errorf("wrapped: '%w'", context.DeadlineExceeded), backend.ErrorSourceDownstream},
+		{&QueryValidationError{Field: "operation", Problem: "is required"}, backend.ErrorSourceDownstream},
+		{&OperationNotAllowedError{Operation: "sql"}, backend.ErrorSourceDownstream},
+		{errors.New("could not convert frame"), backend.ErrorSourcePlugin},
+		{backend.PluginError(&harper.OperationError{StatusCode: 400}), backend.ErrorSourcePlugin},
+	}
+
+	for _, tt := range tests {
+		if got := errorSourceFromError(tt.err); got != tt.want {
+			t.Errorf("errorSourceFromError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestAsCredentialsError(t *testing.T) {
+	err := asCredentialsError(fmt.Errorf("could not query: '%w'", &harper.OperationError{StatusCode: 401}), "grafana")
+
+	var credsErr *CredentialsError
+	if !errors.As(err, &credsErr) {
+		t.Fatalf("expected a CredentialsError, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "'grafana'") {
+		t.Errorf("expected the error to name the user, got: %s", err)
+	}
+	if statusFromError(err) != backend.StatusUnauthorized {
+		t.Errorf("expected credentials errors to map to Unauthorized, got: %v", statusFromError(err))
+	}
+
+	other := &harper.OperationError{StatusCode: 500}
+	if asCredentialsError(other, "grafana") != error(other) {
+		t.Error("expected non-401 errors to be returned unchanged")
+	}
+}
@@ -0,0 +1,173 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+)
+
+// fakeHarperClient is an in-memory HarperClient for tests and benchmarks. Analytics rows are keyed by metric and,
+// like Harper does, filtered by start_time/end_time (and "equals" conditions) and returned in ascending order of
+// their "id" timestamp.
+type fakeHarperClient struct {
+	mu sync.Mutex
+
+	analytics    map[string][]harper.GetAnalyticsResult
+	metrics      []harper.ListMetricsResult
+	descriptions map[string]*harper.DescribeMetricResult
+
+	// raw handles RawRequest operations, receiving the operation as a JSON object. The value it returns is
+	// round-tripped through JSON into the caller's result.
+	raw func(op map[string]any) (any, error)
+
+	// err, if set, is returned from every operation.
+	err error
+
+	// calls counts the operations made, by operation name.
+	calls map[string]int
+
+	// lastAnalyticsRequest is the most recent GetAnalytics request.
+	lastAnalyticsRequest harper.GetAnalyticsRequest
+}
+
+var _ HarperClient = (*fakeHarperClient)(nil)
+
+func newFakeHarperClient() *fakeHarperClient {
+	return &fakeHarperClient{
+		analytics:    make(map[string][]harper.GetAnalyticsResult),
+		descriptions: make(map[string]*harper.DescribeMetricResult),
+		calls:        make(map[string]int),
+	}
+}
+
+// addAnalytics adds one row per timestamp to metric, with the given attributes, and describes metric as having
+// those attributes.
+func (f *fakeHarperClient) addAnalytics(metric string, times []time.Time, attrs map[string]any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !slices.Contains(f.metrics, harper.ListMetricsResult(metric)) {
+		f.metrics = append(f.metrics, harper.ListMetricsResult(metric))
+		f.descriptions[metric] = &harper.DescribeMetricResult{}
+	}
+	for _, name := range slices.Sorted(maps.Keys(attrs)) {
+		desc := f.descriptions[metric]
+		if slices.ContainsFunc(desc.Attributes, func(a harper.AttributeDesc) bool { return a.Name == name }) {
+			continue
+		}
+		attrType := "string"
+		if _, ok := attrs[name].(float64); ok {
+			attrType = "number"
+		}
+		desc.Attributes = append(desc.Attributes, harper.AttributeDesc{Name: name, Type: attrType})
+	}
+	for _, ts := range times {
+		row := harper.GetAnalyticsResult{"id": ts, "metric": metric}
+		maps.Copy(row, attrs)
+		f.analytics[metric] = append(f.analytics[metric], row)
+	}
+}
+
+func (f *fakeHarperClient) called(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[op]
+}
+
+func (f *fakeHarperClient) record(op string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[op]++
+	return f.err
+}
+
+func (f *fakeHarperClient) Healthcheck() error {
+	return f.record("healthcheck")
+}
+
+func (f *fakeHarperClient) GetAnalytics(req harper.GetAnalyticsRequest) ([]harper.GetAnalyticsResult, error) {
+	if err := f.record(harper.OP_GET_ANALYTICS); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastAnalyticsRequest = req
+
+	results := make([]harper.GetAnalyticsResult, 0)
+	for _, row := range f.analytics[req.Metric] {
+		ts := row["id"].(time.Time).UnixMilli()
+		if (req.StartTime != 0 && ts < req.StartTime) || (req.EndTime != 0 && ts > req.EndTime) {
+			continue
+		}
+		if slices.ContainsFunc(req.Conditions, func(c harper.SearchCondition) bool {
+			return c.Comparator == "equals" && row[c.Attribute] != c.Value
+		}) {
+			continue
+		}
+		results = append(results, maps.Clone(row))
+	}
+
+	slices.SortStableFunc(results, func(a, b harper.GetAnalyticsResult) int {
+		return a["id"].(time.Time).Compare(b["id"].(time.Time))
+	})
+
+	return results, nil
+}
+
+func (f *fakeHarperClient) ListMetrics(_ harper.ListMetricsRequest) ([]harper.ListMetricsResult, error) {
+	if err := f.record(harper.OP_LIST_METRICS); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]harper.ListMetricsResult(nil), f.metrics...), nil
+}
+
+func (f *fakeHarperClient) DescribeMetric(metric string) (*harper.DescribeMetricResult, error) {
+	if err := f.record(harper.OP_DESCRIBE_METRIC); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if desc, ok := f.descriptions[metric]; ok {
+		return desc, nil
+	}
+	return nil, &harper.OperationError{StatusCode: 404, Message: fmt.Sprintf("metric '%s' does not exist", metric)}
+}
+
+func (f *fakeHarperClient) RawRequest(op harper.Operation, result any) error {
+	opJSON, err := json.Marshal(op.Prepare())
+	if err != nil {
+		return err
+	}
+	var opMap map[string]any
+	if err := json.Unmarshal(opJSON, &opMap); err != nil {
+		return err
+	}
+
+	name, _ := opMap["operation"].(string)
+	if err := f.record(name); err != nil {
+		return err
+	}
+	if f.raw == nil {
+		return &harper.OperationError{StatusCode: 400, Message: fmt.Sprintf("unsupported operation '%s'", name)}
+	}
+
+	resp, err := f.raw(opMap)
+	if err != nil || result == nil {
+		return err
+	}
+	respJSON, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(respJSON, result)
+}
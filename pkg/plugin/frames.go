@@ -0,0 +1,674 @@
+package plugin
+
+import (
+	"cmp"
+	"fmt"
+	"iter"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// frameName names a response frame after the query that produced it (e.g. "A: resource-usage") so multi-query panels
+// and the query inspector show where each frame came from.
+func frameName(refID string, source string) string {
+	if refID == "" {
+		return source
+	}
+	if source == "" {
+		return refID
+	}
+	return fmt.Sprintf("%s: %s", refID, source)
+}
+
+// setFieldDisplayHints gives every field in frame a config with consistent display hints: the first time field, the
+// frame's timestamps, is shown as "Time", unlabeled fields keep their attribute name, and labeled fields are left for
+// Grafana to name from their labels so series in a wide frame stay distinguishable. Other time fields, such as RFC
+// 3339 attributes, are named like any other value.
+func setFieldDisplayHints(frame *data.Frame) {
+	timeNamed := false
+	for _, field := range frame.Fields {
+		if field.Config == nil {
+			field.Config = &data.FieldConfig{}
+		}
+
+		switch {
+		case field.Type().Time() && !timeNamed:
+			field.Config.DisplayNameFromDS = "Time"
+			timeNamed = true
+		case len(field.Labels) == 0:
+			field.Config.DisplayNameFromDS = field.Name
+		}
+	}
+}
+
+// legendPattern matches the {{name}} placeholders of a legend format.
+var legendPattern = regexp.MustCompile(`\{\{\s*([\w.-]+)\s*\}\}`)
+
+// applyLegendFormat names frame's value fields for display by rendering legendFormat, e.g. "{{node}} {{metric}}",
+// with each field's labels, so series are named the same way by every panel type and Grafana version. "{{metric}}"
+// and "{{field}}" are the metric and the field's name unless there are labels of those names, and placeholders for
+// labels a field doesn't have are left empty.
+func applyLegendFormat(frame *data.Frame, legendFormat string, metric string) {
+	for _, field := range frame.Fields {
+		if field.Type().Time() {
+			continue
+		}
+		if field.Config == nil {
+			field.Config = &data.FieldConfig{}
+		}
+		field.Config.DisplayNameFromDS = legendPattern.ReplaceAllStringFunc(legendFormat, func(match string) string {
+			name := legendPattern.FindStringSubmatch(match)[1]
+			if v, ok := field.Labels[name]; ok {
+				return v
+			}
+			switch name {
+			case "metric":
+				return metric
+			case "field":
+				return field.Name
+			}
+			return ""
+		})
+	}
+}
+
+// metricUnits are the Grafana units of the values of Harper's builtin analytics metrics, where they have one.
+var metricUnits = map[string]string{
+	"TTFB":                    "ms",
+	"bytes-sent":              "decbytes",
+	"database-size":           "decbytes",
+	"duration":                "ms",
+	"main-thread-utilization": "percentunit",
+	"table-size":              "decbytes",
+	"transfer":                "ms",
+	"utilization":             "percentunit",
+}
+
+// attributeUnits are the Grafana units of analytics attributes whose unit doesn't depend on the metric.
+var attributeUnits = map[string]string{
+	"arrayBuffers":  "decbytes",
+	"count":         "none",
+	"external":      "decbytes",
+	"heapTotal":     "decbytes",
+	"heapUsed":      "decbytes",
+	"rss":           "decbytes",
+	"systemCPUTime": "µs",
+	"userCPUTime":   "µs",
+}
+
+// attributeUnit returns the Grafana unit of metric's attribute, or "" if it has none or it isn't known.
+func attributeUnit(metric string, attribute string) string {
+	unit, ok := attributeUnits[attribute]
+	if !ok {
+		unit = metricUnits[metric]
+	}
+	if unit == "none" {
+		return ""
+	}
+	return unit
+}
+
+// harperUnits maps the units Harper metric descriptions give attributes to Grafana's. Others are passed through as
+// they are.
+var harperUnits = map[string]string{
+	"%":            "percent",
+	"bytes":        "decbytes",
+	"microseconds": "µs",
+	"milliseconds": "ms",
+	"percent":      "percent",
+	"ratio":        "percentunit",
+	"seconds":      "s",
+	"us":           "µs",
+}
+
+type describeMetricOperation struct {
+	Operation string `json:"operation"`
+	Metric    string `json:"metric"`
+}
+
+func (o describeMetricOperation) Prepare() any {
+	return o
+}
+
+// describedAttributeUnits returns the Grafana units of metric's attributes that its describe_metric description gives
+// a unit for. Units are only display hints, so if the description can't be fetched there are none.
+func (d *Datasource) describedAttributeUnits(client HarperClient, metric string) map[string]string {
+	if units, ok := d.metadata.attributeUnits(metric); ok {
+		return units
+	}
+
+	var desc struct {
+		Attributes []struct {
+			Name string `json:"name"`
+			Unit string `json:"unit"`
+		} `json:"attributes"`
+	}
+	if err := client.RawRequest(describeMetricOperation{Operation: harper.OP_DESCRIBE_METRIC, Metric: metric}, &desc); err != nil {
+		d.logger.Debug("could not describe metric for its units", "metric", metric, "error", err)
+		return nil
+	}
+	units := make(map[string]string)
+	for _, attr := range desc.Attributes {
+		if attr.Unit != "" {
+			units[attr.Name] = cmp.Or(harperUnits[strings.ToLower(attr.Unit)], attr.Unit)
+		}
+	}
+	d.metadata.setAttributeUnits(metric, units)
+	return units
+}
+
+// setFieldUnits embeds the unit of every numeric field of an analytics frame for metric in its config, so panels,
+// snapshots and exported dashboards render values correctly without asking the datasource. Units from the metric's
+// description (described, by attribute) take precedence over the builtin ones.
+func setFieldUnits(frame *data.Frame, metric string, described map[string]string) {
+	for _, field := range frame.Fields {
+		if !field.Type().Numeric() {
+			continue
+		}
+		attribute := percentileSuffix.ReplaceAllString(field.Name, "")
+		unit, ok := described[attribute]
+		if !ok {
+			unit = attributeUnit(metric, attribute)
+		}
+		if unit == "" {
+			continue
+		}
+		if field.Config == nil {
+			field.Config = &data.FieldConfig{}
+		}
+		field.Config.Unit = unit
+	}
+}
+
+// keepNumericFields removes every field from frame that isn't a time or numeric field, so server-side expressions and
+// alert conditions never see string columns. Boolean fields are kept as 0/1 values. (String attributes of analytics
+// series are already labels in wide frames.) The names of dropped fields are reported in a notice.
+func keepNumericFields(frame *data.Frame) {
+	var kept []*data.Field
+	var dropped []string
+
+	for _, field := range frame.Fields {
+		switch {
+		case field.Type().Time(), field.Type().Numeric():
+			kept = append(kept, field)
+		case field.Type() == data.FieldTypeBool || field.Type() == data.FieldTypeNullableBool:
+			kept = append(kept, boolToNumericField(field))
+		default:
+			dropped = append(dropped, field.Name)
+		}
+	}
+
+	frame.Fields = kept
+	if len(dropped) > 0 {
+		frame.AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityInfo,
+			Text:     fmt.Sprintf("Strict numeric output dropped non-numeric fields: %s", strings.Join(dropped, ", ")),
+		})
+	}
+}
+
+const (
+	analyticsFormatTimeSeries      = "time_series"
+	analyticsFormatTimeSeriesMulti = "time_series_multi"
+	analyticsFormatTable           = "table"
+	analyticsFormatLogs            = "logs"
+	analyticsFormatHeatmap         = "heatmap"
+)
+
+var analyticsFormats = []string{"", analyticsFormatTimeSeries, analyticsFormatTimeSeriesMulti, analyticsFormatTable,
+	analyticsFormatLogs, analyticsFormatHeatmap}
+
+// longToMulti converts a long time series frame, sorted by time, into a multi time series: one frame per value field
+// and combination of label (string or boolean field) values. It's the alternative to data.LongToWide for responses
+// with many series, where a wide frame would be mostly nulls.
+func longToMulti(long *data.Frame) (data.Frames, error) {
+	schema := long.TimeSeriesSchema()
+	if schema.Type != data.TimeSeriesTypeLong {
+		return nil, fmt.Errorf("expected a long time series, got %s", schema.Type)
+	}
+	timeField := long.Fields[schema.TimeIndex]
+
+	type series struct {
+		times  []time.Time
+		values *data.Field
+	}
+	seriesByKey := make(map[string]*series)
+
+	for row := range long.Rows() {
+		ts, ok := timeField.ConcreteAt(row)
+		if !ok {
+			continue
+		}
+
+		labels := make(data.Labels, len(schema.FactorIndices))
+		for _, i := range schema.FactorIndices {
+			v, _ := long.Fields[i].ConcreteAt(row)
+			labels[long.Fields[i].Name] = ""
+			if v != nil {
+				labels[long.Fields[i].Name] = fmt.Sprint(v)
+			}
+		}
+
+		for _, i := range schema.ValueIndices {
+			valueField := long.Fields[i]
+			key := valueField.Name + "{" + labels.String() + "}"
+			s, ok := seriesByKey[key]
+			if !ok {
+				values := data.NewFieldFromFieldType(valueField.Type(), 0)
+				values.Name = valueField.Name
+				values.Labels = labels
+				s = &series{values: values}
+				seriesByKey[key] = s
+			}
+			s.times = append(s.times, ts.(time.Time))
+			s.values.Append(valueField.At(row))
+		}
+	}
+
+	frames := make(data.Frames, 0, len(seriesByKey))
+	for _, key := range slices.Sorted(maps.Keys(seriesByKey)) {
+		s := seriesByKey[key]
+		frame := data.NewFrame(long.Name, data.NewField(timeField.Name, nil, s.times), s.values).SetMeta(&data.FrameMeta{
+			Type:        data.FrameTypeTimeSeriesMulti,
+			TypeVersion: data.FrameTypeVersion{0, 1},
+		}).SetRefID(long.RefID)
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// analyticsSeries are analytics rows grouped into series by their labels: the values of their string and boolean
+// attributes, and the metric. Time series frames are built from them straight from the rows, without the long frame
+// and data.LongToWide or longToMulti conversion, which would hold every point twice over.
+type analyticsSeries struct {
+	timeAttr   string
+	valueAttrs []string
+	valueTypes []data.FieldType
+	labelAttrs []string
+	// labelDefaults are the label attributes' values for rows without them: "false" for booleans, as in the labels
+	// data.LongToWide gives null factors, and "" otherwise.
+	labelDefaults []string
+
+	// times are the rows' distinct timestamps, in ascending order: a wide frame's rows.
+	times  []time.Time
+	groups map[string]*seriesGroup
+	// dropped are the keys of the series after the first maxSeries, whose rows are skipped.
+	dropped map[string]bool
+}
+
+type seriesGroup struct {
+	labels data.Labels
+	// rows are the indices in times of the group's rows.
+	rows []int
+	// values are the group's values of each of the value attributes, a row at a time.
+	values []*data.Field
+}
+
+// groupAnalyticsSeries groups analytics rows, which must be in ascending time order, into series. As in a long frame
+// of the rows, the first time attribute by name is their time, and the other attributes that aren't labels are their
+// values; rows without a time are skipped. If maxSeries is over 0, only the first maxSeries series in labelSetKey order
+// are kept: a series is dropped as soon as maxSeries earlier ones have been seen, so no more are ever held.
+func groupAnalyticsSeries(rows iter.Seq[harper.GetAnalyticsResult], metric string, maxSeries int) (*analyticsSeries, error) {
+	s := &analyticsSeries{groups: make(map[string]*seriesGroup), dropped: make(map[string]bool)}
+	fieldTypes := analyticsFieldTypes(rows)
+	fieldTypes["metric"] = data.FieldTypeNullableString
+	for _, attr := range slices.Sorted(maps.Keys(fieldTypes)) {
+		switch fieldType := fieldTypes[attr]; {
+		case fieldType == data.FieldTypeNullableTime && s.timeAttr == "":
+			s.timeAttr = attr
+		case fieldType == data.FieldTypeNullableString, fieldType == data.FieldTypeNullableBool,
+			fieldType == data.FieldTypeUnknown:
+			s.labelAttrs = append(s.labelAttrs, attr)
+			if fieldType == data.FieldTypeNullableBool {
+				s.labelDefaults = append(s.labelDefaults, "false")
+			} else {
+				s.labelDefaults = append(s.labelDefaults, "")
+			}
+		default:
+			s.valueAttrs = append(s.valueAttrs, attr)
+			s.valueTypes = append(s.valueTypes, fieldType)
+		}
+	}
+	if s.timeAttr == "" || len(s.valueAttrs) == 0 {
+		return nil, fmt.Errorf("expected a time attribute and numeric attributes")
+	}
+
+	labelValues := make([]string, len(s.labelAttrs))
+	// last is the greatest key in groups
+	var last string
+	for row := range rows {
+		ts, ok := row[s.timeAttr].(time.Time)
+		if !ok {
+			continue
+		}
+		if len(s.times) == 0 || ts.After(s.times[len(s.times)-1]) {
+			s.times = append(s.times, ts)
+		} else if ts.Before(s.times[len(s.times)-1]) {
+			return nil, data.ErrorSeriesUnsorted
+		}
+
+		for i, attr := range s.labelAttrs {
+			switch v := row[attr].(type) {
+			case string:
+				labelValues[i] = v
+			case bool:
+				labelValues[i] = strconv.FormatBool(v)
+			default:
+				labelValues[i] = s.labelDefaults[i]
+			}
+			if attr == "metric" {
+				labelValues[i] = metric
+			}
+		}
+		key := strings.Join(labelValues, "\x00")
+		group, ok := s.groups[key]
+		if !ok {
+			if s.dropped[key] {
+				continue
+			}
+			if maxSeries > 0 && len(s.groups) >= maxSeries {
+				if key > last {
+					s.dropped[key] = true
+					continue
+				}
+				delete(s.groups, last)
+				s.dropped[last] = true
+				last = ""
+				for k := range s.groups {
+					last = max(last, k)
+				}
+			}
+			last = max(last, key)
+			group = &seriesGroup{labels: make(data.Labels, len(s.labelAttrs))}
+			for i, attr := range s.labelAttrs {
+				group.labels[attr] = labelValues[i]
+			}
+			for i, attr := range s.valueAttrs {
+				values := data.NewFieldFromFieldType(s.valueTypes[i], 0)
+				values.Name = attr
+				group.values = append(group.values, values)
+			}
+			s.groups[key] = group
+		}
+
+		group.rows = append(group.rows, len(s.times)-1)
+		for i, attr := range s.valueAttrs {
+			group.values[i].Append(nullableValue(row[attr], s.valueTypes[i]))
+		}
+	}
+	return s, nil
+}
+
+// nullableValue returns v as a value of a field of fieldType, or a nil one if it isn't of its type.
+func nullableValue(v any, fieldType data.FieldType) any {
+	switch fieldType {
+	case data.FieldTypeNullableFloat64:
+		if f, ok := v.(float64); ok {
+			return &f
+		}
+		return (*float64)(nil)
+	case data.FieldTypeNullableInt64:
+		if i, ok := v.(int64); ok {
+			return &i
+		}
+		return (*int64)(nil)
+	default:
+		if t, ok := v.(time.Time); ok {
+			return &t
+		}
+		return (*time.Time)(nil)
+	}
+}
+
+// wideFrame returns the series as a wide frame, as data.LongToWide would convert their long frame, with null where
+// a series has no point at a time.
+func (s *analyticsSeries) wideFrame(name string) (*data.Frame, error) {
+	frame := data.NewFrame(name, data.NewField(s.timeAttr, nil, s.times))
+	for _, group := range s.groups {
+		for _, values := range group.values {
+			field := data.NewFieldFromFieldType(values.Type(), len(s.times))
+			field.Name, field.Labels = values.Name, group.labels.Copy()
+			for i, row := range group.rows {
+				field.Set(row, values.At(i))
+			}
+			frame.Fields = append(frame.Fields, field)
+		}
+	}
+	if err := data.SortWideFrameFields(frame, s.labelAttrs...); err != nil {
+		return nil, err
+	}
+	return frame.SetMeta(&data.FrameMeta{Type: data.FrameTypeTimeSeriesWide, TypeVersion: data.FrameTypeVersion{0, 1}}), nil
+}
+
+// maxSeriesNotice returns the notice of the series being capped at maxSeries, if any were dropped.
+func (s *analyticsSeries) maxSeriesNotice(maxSeries int) (data.Notice, bool) {
+	if len(s.dropped) == 0 {
+		return data.Notice{}, false
+	}
+	return maxSeriesNotice(maxSeries, len(s.groups)+len(s.dropped)), true
+}
+
+// multiFrames returns the series as a multi time series, as longToMulti would convert their long frame.
+func (s *analyticsSeries) multiFrames(name string, refID string) data.Frames {
+	byKey := make(map[string]*data.Frame)
+	for _, group := range s.groups {
+		times := make([]time.Time, len(group.rows))
+		for i, row := range group.rows {
+			times[i] = s.times[row]
+		}
+		for _, values := range group.values {
+			values.Labels = group.labels.Copy()
+			byKey[values.Name+"{"+values.Labels.String()+"}"] = data.NewFrame(name,
+				data.NewField(s.timeAttr, nil, slices.Clone(times)), values).SetMeta(&data.FrameMeta{
+				Type:        data.FrameTypeTimeSeriesMulti,
+				TypeVersion: data.FrameTypeVersion{0, 1},
+			}).SetRefID(refID)
+		}
+	}
+
+	frames := make(data.Frames, 0, len(byKey))
+	for _, key := range slices.Sorted(maps.Keys(byKey)) {
+		frames = append(frames, byKey[key])
+	}
+	return frames
+}
+
+// topKScores are the ways series can be ranked for top-K limiting.
+var topKScores = []string{"", "avg", "last"}
+
+// topKSeries ranks the numeric fields among fields by their average, or last non-null, value, depending on by, and
+// returns the indices of those that aren't in the top k, and how many numeric fields there were.
+func topKSeries(fields []*data.Field, k int, by string) (dropped map[int]bool, total int) {
+	type scored struct {
+		index int
+		score float64
+	}
+	var series []scored
+	for i, field := range fields {
+		if !field.Type().Numeric() {
+			continue
+		}
+		// series without values rank last
+		last, sum, count := math.Inf(-1), 0.0, 0
+		for j := range field.Len() {
+			v, err := field.NullableFloatAt(j)
+			if err != nil || v == nil {
+				continue
+			}
+			last = *v
+			sum += *v
+			count++
+		}
+		score := last
+		if by != "last" && count > 0 {
+			score = sum / float64(count)
+		}
+		series = append(series, scored{index: i, score: score})
+	}
+
+	dropped = make(map[int]bool)
+	if len(series) <= k {
+		return dropped, len(series)
+	}
+	slices.SortStableFunc(series, func(a, b scored) int { return cmp.Compare(b.score, a.score) })
+	for _, s := range series[k:] {
+		dropped[s.index] = true
+	}
+	return dropped, len(series)
+}
+
+func topKNotice(k int, total int, dropped int, by string) data.Notice {
+	scoreName := "average"
+	if by == "last" {
+		scoreName = "last value"
+	}
+	return data.Notice{
+		Severity: data.NoticeSeverityInfo,
+		Text:     fmt.Sprintf("Showing the top %d of %d series by %s; %d dropped", k, total, scoreName, dropped),
+	}
+}
+
+// keepTopKSeries keeps only the k numeric fields (series) of a wide frame with the highest average, or last non-null,
+// value, depending on by, in their original order. Other fields are kept. A notice reports how many were dropped.
+func keepTopKSeries(frame *data.Frame, k int, by string) {
+	dropped, total := topKSeries(frame.Fields, k, by)
+	if len(dropped) == 0 {
+		return
+	}
+
+	var kept []*data.Field
+	for i, field := range frame.Fields {
+		if !dropped[i] {
+			kept = append(kept, field)
+		}
+	}
+	frame.Fields = kept
+	frame.AppendNotices(topKNotice(k, total, len(dropped), by))
+}
+
+// keepTopKFrames is keepTopKSeries for a multi time series, keeping the k frames whose value field ranks highest. A
+// notice on the first frame reports how many were dropped.
+func keepTopKFrames(frames data.Frames, k int, by string) data.Frames {
+	values := make([]*data.Field, len(frames))
+	for i, frame := range frames {
+		values[i] = frame.Fields[len(frame.Fields)-1]
+	}
+	dropped, total := topKSeries(values, k, by)
+	if len(dropped) == 0 {
+		return frames
+	}
+
+	var kept data.Frames
+	for i, frame := range frames {
+		if !dropped[i] {
+			kept = append(kept, frame)
+		}
+	}
+	kept[0].AppendNotices(topKNotice(k, total, len(dropped), by))
+	return kept
+}
+
+// latestValues converts a wide time series frame to a numeric frame of a single row with the last non-null value of
+// each numeric field (series). The time field and any other fields are dropped.
+func latestValues(wide *data.Frame) *data.Frame {
+	numeric := data.NewFrame(wide.Name).SetMeta(&data.FrameMeta{
+		Type:        data.FrameTypeNumericWide,
+		TypeVersion: data.FrameTypeVersion{0, 1},
+	}).SetRefID(wide.RefID)
+	if wide.Meta != nil {
+		numeric.Meta.Notices = wide.Meta.Notices
+	}
+
+	for _, field := range wide.Fields {
+		if !field.Type().Numeric() {
+			continue
+		}
+		var latest *float64
+		for i := field.Len() - 1; i >= 0 && latest == nil; i-- {
+			if v, err := field.NullableFloatAt(i); err == nil {
+				latest = v
+			}
+		}
+		value := data.NewField(field.Name, field.Labels, []*float64{latest})
+		value.Config = field.Config
+		numeric.Fields = append(numeric.Fields, value)
+	}
+	return numeric
+}
+
+func boolToNumericField(field *data.Field) *data.Field {
+	values := make([]*float64, field.Len())
+	for i := range values {
+		v, ok := field.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		var f float64
+		if v.(bool) {
+			f = 1
+		}
+		values[i] = &f
+	}
+
+	numeric := data.NewField(field.Name, field.Labels, values)
+	numeric.Config = field.Config
+	return numeric
+}
+
+const (
+	fieldNamingOriginal  = "original"
+	fieldNamingSnakeCase = "snake_case"
+)
+
+var fieldNamingConventions = []string{"", fieldNamingOriginal, fieldNamingSnakeCase}
+
+// applyFieldNaming renames frame's fields and label keys to the naming convention. It must run before display names
+// are derived from the field names.
+func applyFieldNaming(frame *data.Frame, convention string) {
+	if convention != fieldNamingSnakeCase {
+		return
+	}
+
+	for _, field := range frame.Fields {
+		field.Name = snakeCase(field.Name)
+		if len(field.Labels) > 0 {
+			labels := make(data.Labels, len(field.Labels))
+			for k, v := range field.Labels {
+				labels[snakeCase(k)] = v
+			}
+			field.Labels = labels
+		}
+	}
+}
+
+// snakeCase converts a camelCase or dotted name to snake_case, e.g. "heapUsed" to "heap_used" and "cpu.userTime" to
+// "cpu_user_time". Runs of capitals are kept together ("TTFB" stays "ttfb").
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case r == '.' || r == '-' || r == ' ':
+			b.WriteRune('_')
+		case unicode.IsUpper(r):
+			prevLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsLower(runes[i+1])
+			if prevLower || nextLower {
+				b.WriteRune('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,321 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestSetFieldUnits(t *testing.T) {
+	frame := data.NewFrame("A: duration",
+		data.NewField("id", nil, []float64{1}),
+		data.NewField("count", nil, []float64{1}),
+		data.NewField("p95", nil, []float64{1}),
+		data.NewField("heapUsed", nil, []float64{1}),
+		data.NewField("path", nil, []string{"/"}),
+	)
+
+	setFieldUnits(frame, "duration", map[string]string{"heapUsed": "bytes"})
+
+	want := map[string]string{"count": "", "p95": "ms", "heapUsed": "bytes", "path": ""}
+	for _, field := range frame.Fields[1:] {
+		var unit string
+		if field.Config != nil {
+			unit = field.Config.Unit
+		}
+		if unit != want[field.Name] {
+			t.Errorf("expected %s to have unit %q, got %q", field.Name, want[field.Name], unit)
+		}
+	}
+}
+
+func TestKeepNumericFields(t *testing.T) {
+	frame := data.NewFrame("A: db-read",
+		data.NewField("id", nil, []time.Time{time.UnixMilli(0)}),
+		data.NewField("count", nil, []float64{1}),
+		data.NewField("cached", nil, []bool{true}),
+		data.NewField("path", nil, []string{"/"}),
+	)
+
+	keepNumericFields(frame)
+
+	if len(frame.Fields) != 3 {
+		t.Fatalf("expected the string field to be dropped, got %d fields", len(frame.Fields))
+	}
+	if v, _ := frame.Fields[2].NullableFloatAt(0); v == nil || *v != 1 {
+		t.Errorf("expected the bool field to become 1, got %v", v)
+	}
+	if len(frame.Meta.Notices) != 1 {
+		t.Errorf("expected a notice about the dropped field")
+	}
+}
+
+func TestKeepTopKSeries(t *testing.T) {
+	newFrame := func() *data.Frame {
+		return data.NewFrame("A: db-read",
+			data.NewField("time", nil, []time.Time{time.UnixMilli(0), time.UnixMilli(1000)}),
+			data.NewField("count", data.Labels{"node": "a"}, []*float64{ptr(10.0), ptr(1.0)}),
+			data.NewField("count", data.Labels{"node": "b"}, []*float64{ptr(2.0), ptr(3.0)}),
+			data.NewField("count", data.Labels{"node": "c"}, []*float64{ptr(4.0), nil}),
+			data.NewField("count", data.Labels{"node": "d"}, []*float64{nil, nil}),
+		)
+	}
+
+	tests := []struct {
+		by   string
+		want []string
+	}{
+		{"", []string{"a", "c"}},
+		{"last", []string{"c", "b"}},
+	}
+	for _, tt := range tests {
+		frame := newFrame()
+		keepTopKSeries(frame, 2, tt.by)
+
+		if len(frame.Fields) != 3 {
+			t.Fatalf("expected time and 2 series by %q, got %d fields", tt.by, len(frame.Fields))
+		}
+		got := []string{frame.Fields[1].Labels["node"], frame.Fields[2].Labels["node"]}
+		// fields keep their order in the frame
+		slices.Sort(tt.want)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("expected series %v by %q, got %v", tt.want, tt.by, got)
+		}
+		if len(frame.Meta.Notices) != 1 {
+			t.Errorf("expected a notice about the dropped series")
+		}
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"heapUsed":      "heap_used",
+		"cpu.userTime":  "cpu_user_time",
+		"TTFB":          "ttfb",
+		"p99":           "p99",
+		"HTTPRequests":  "http_requests",
+		"arrayBuffers2": "array_buffers2",
+	} {
+		if got := snakeCase(in); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestQueryAnalyticsFormat(t *testing.T) {
+	client := newFakeHarperClient()
+	times := []time.Time{time.UnixMilli(1_700_000_000_000), time.UnixMilli(1_700_000_001_000)}
+	client.addAnalytics("db-read", times, map[string]any{"node": "node-1", "count": 5.0})
+	client.addAnalytics("db-read", times, map[string]any{"node": "node-2", "count": 7.0})
+	ds := newTestDatasource(t, Settings{}, client)
+
+	query := func(format string) data.Frames {
+		t.Helper()
+		res, err := ds.query(context.Background(), backend.PluginContext{},
+			analyticsQuery("A", map[string]any{"metric": "db-read", "format": format}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Frames
+	}
+
+	frames := query("table")
+	if len(frames) != 1 || frames[0].Rows() != 4 || frames[0].Meta.PreferredVisualization != data.VisTypeTable {
+		t.Errorf("expected one long table frame with 4 rows, got %d frames", len(frames))
+	}
+
+	frames = query("time_series_multi")
+	if len(frames) != 2 {
+		t.Fatalf("expected a frame per series, got %d", len(frames))
+	}
+	for _, frame := range frames {
+		if frame.Meta.Type != data.FrameTypeTimeSeriesMulti || len(frame.Fields) != 2 || frame.Rows() != 2 {
+			t.Errorf("expected a 2-row multi time series frame, got %s with %d fields", frame.Meta.Type, len(frame.Fields))
+		}
+		if frame.Fields[1].Labels["node"] == "" {
+			t.Errorf("expected the value field to keep its labels")
+		}
+	}
+
+	if _, err := ds.query(context.Background(), backend.PluginContext{},
+		analyticsQuery("B", map[string]any{"metric": "db-read", "format": "histogram"})); err == nil {
+		t.Error("expected an unknown format to be rejected")
+	}
+}
+
+func TestQueryAnalyticsInstant(t *testing.T) {
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_000_000)
+	client.addAnalytics("db-read", []time.Time{start, start.Add(time.Second)}, map[string]any{"node": "node-1", "count": 5.0})
+	client.addAnalytics("db-read", []time.Time{start.Add(2 * time.Second)}, map[string]any{"node": "node-1", "count": 6.0})
+	client.addAnalytics("db-read", []time.Time{start}, map[string]any{"node": "node-2", "count": 7.0})
+	ds := newTestDatasource(t, Settings{}, client)
+
+	res, err := ds.query(context.Background(), backend.PluginContext{},
+		analyticsQuery("A", map[string]any{"metric": "db-read", "instant": true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := res.Frames[0]
+	if frame.Meta.Type != data.FrameTypeNumericWide || frame.Rows() != 1 {
+		t.Fatalf("expected a single-row numeric frame, got %s with %d rows", frame.Meta.Type, frame.Rows())
+	}
+	latest := make(map[string]float64)
+	for _, field := range frame.Fields {
+		if v, err := field.NullableFloatAt(0); err == nil && v != nil {
+			latest[field.Labels["node"]] = *v
+		}
+	}
+	if latest["node-1"] != 6 || latest["node-2"] != 7 {
+		t.Errorf("expected the latest value of each series, got %v", latest)
+	}
+
+	if _, err := ds.query(context.Background(), backend.PluginContext{},
+		analyticsQuery("B", map[string]any{"metric": "db-read", "instant": true, "format": "table"})); err == nil {
+		t.Error("expected an instant table query to be rejected")
+	}
+}
+
+func TestLongToMulti(t *testing.T) {
+	long := data.NewFrame("A: db-read",
+		data.NewField("id", nil, []time.Time{time.UnixMilli(0), time.UnixMilli(0), time.UnixMilli(1000), time.UnixMilli(2000)}),
+		data.NewField("node", nil, []*string{ptr("b"), ptr("a"), ptr("a"), ptr("b")}),
+		data.NewField("count", nil, []*float64{ptr(1.0), ptr(2.0), ptr(3.0), ptr(4.0)}),
+	).SetRefID("A")
+
+	frames, err := longToMulti(long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("expected a frame per node, got %d", len(frames))
+	}
+
+	// series only have the points they were given, not nulls where other series have points
+	for i, want := range []struct {
+		node   string
+		values []float64
+	}{
+		{"a", []float64{2, 3}},
+		{"b", []float64{1, 4}},
+	} {
+		frame := frames[i]
+		if frame.RefID != "A" || frame.Meta.Type != data.FrameTypeTimeSeriesMulti {
+			t.Errorf("expected a multi time series frame for A, got %s for %s", frame.Meta.Type, frame.RefID)
+		}
+		values := frame.Fields[1]
+		if values.Labels["node"] != want.node || values.Len() != len(want.values) {
+			t.Fatalf("expected %d points for node %s, got %d for %v", len(want.values), want.node, values.Len(), values.Labels)
+		}
+		for j, v := range want.values {
+			if got, _ := values.NullableFloatAt(j); got == nil || *got != v {
+				t.Errorf("expected node %s point %d to be %v, got %v", want.node, j, v, got)
+			}
+		}
+	}
+
+	kept := keepTopKFrames(frames, 1, "last")
+	if len(kept) != 1 || kept[0].Fields[1].Labels["node"] != "b" {
+		t.Errorf("expected node b to be the top series by last value")
+	}
+}
+
+func TestApplyLegendFormat(t *testing.T) {
+	frame := data.NewFrame("A: db-read",
+		data.NewField("time", nil, []time.Time{time.UnixMilli(0)}),
+		data.NewField("count", data.Labels{"node": "node-1", "path": "/a"}, []float64{1}),
+		data.NewField("p95", nil, []float64{1}),
+	)
+
+	applyLegendFormat(frame, "{{node}}{{path}} {{ metric }} {{field}} {{database}}", "db-read")
+
+	if name := frame.Fields[1].Config.DisplayNameFromDS; name != "node-1/a db-read count " {
+		t.Errorf("unexpected display name %q", name)
+	}
+	if name := frame.Fields[2].Config.DisplayNameFromDS; name != " db-read p95 " {
+		t.Errorf("unexpected display name %q", name)
+	}
+	if frame.Fields[0].Config != nil {
+		t.Error("expected the time field to be left alone")
+	}
+}
+
+func TestQueryAnalyticsDescribedUnits(t *testing.T) {
+	client := newFakeHarperClient()
+	client.addAnalytics("queue", []time.Time{time.UnixMilli(1_700_000_000_000)}, map[string]any{"node": "node-1", "backlog": 5.0, "wait": 1.0})
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "describe_metric" || op["metric"] != "queue" {
+			return nil, nil
+		}
+		return map[string]any{"attributes": []map[string]any{
+			{"name": "backlog", "type": "number", "unit": "bytes"},
+			{"name": "wait", "type": "number", "unit": "ms"},
+		}}, nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	for range 2 {
+		res, err := ds.query(context.Background(), backend.PluginContext{}, analyticsQuery("A", map[string]any{"metric": "queue"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range map[string]string{"backlog": "decbytes", "wait": "ms"} {
+			field, _ := res.Frames[0].FieldByName(name)
+			if field == nil || field.Config == nil || field.Config.Unit != want {
+				t.Errorf("expected %s to have unit %q", name, want)
+			}
+		}
+	}
+	if n := client.called("describe_metric"); n != 1 {
+		t.Errorf("expected the units to be cached, got %d describe_metric calls", n)
+	}
+}
+
+// TestTimeSeriesFramesMatchLegacy checks that time series frames built straight from the rows are the ones
+// data.LongToWide and longToMulti convert the rows' long frame into.
+func TestTimeSeriesFramesMatchLegacy(t *testing.T) {
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_000_000)
+	times := []time.Time{start, start.Add(time.Minute), start.Add(2 * time.Minute)}
+	client.addAnalytics("db-read", times, map[string]any{"node": "a", "count": 1.0, "p95": 10.0})
+	client.addAnalytics("db-read", times[1:], map[string]any{"node": "b", "count": 2.0, "cached": true})
+	client.addAnalytics("db-read", times[:1], map[string]any{"node": "b", "count": 3.0, "cached": false})
+
+	direct := newTestDatasource(t, Settings{}, client)
+	legacy := newTestDatasource(t, Settings{LegacyTimeSeriesFrames: true}, client)
+
+	for _, attrs := range []map[string]any{
+		{"metric": "db-read"},
+		{"metric": "db-read", "format": analyticsFormatTimeSeriesMulti},
+		{"metric": "db-read", "topK": 1},
+		{"metric": "db-read", "format": analyticsFormatTimeSeriesMulti, "topK": 2, "topKBy": "last"},
+		{"metric": "db-read", "instant": true},
+		{"metric": "db-read", "attributes": []string{"count", "node"}},
+	} {
+		query := analyticsQuery("A", attrs)
+		got, err := direct.query(context.Background(), backend.PluginContext{}, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := legacy.query(context.Background(), backend.PluginContext{}, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotJSON, _ := json.Marshal(got.Frames)
+		wantJSON, _ := json.Marshal(want.Frames)
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("%v: expected the direct frames to match\n%s\ngot\n%s", attrs, wantJSON, gotJSON)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/go-resty/resty/v2"
+)
+
+// HarperClient is the set of Harper operations the datasource depends on. The Harper Go SDK's *harper.Client
+// implements it; alternative transports (and the in-memory fake used by the tests) can be plugged in by implementing
+// it too.
+type HarperClient interface {
+	Healthcheck() error
+	GetAnalytics(req harper.GetAnalyticsRequest) ([]harper.GetAnalyticsResult, error)
+	ListMetrics(req harper.ListMetricsRequest) ([]harper.ListMetricsResult, error)
+	DescribeMetric(metric string) (*harper.DescribeMetricResult, error)
+
+	// RawRequest sends an arbitrary operation and unmarshals the response into result.
+	RawRequest(op harper.Operation, result any) error
+}
+
+var _ HarperClient = (*harper.Client)(nil)
+
+// operationName returns the name of op, e.g. "search_by_value", or "" if it can't be told.
+func operationName(op harper.Operation) string {
+	return inspectOperation(op).Operation
+}
+
+// inspectOperation returns what the policy needs to know about op, leaving out what can't be told.
+func inspectOperation(op harper.Operation) operationInfo {
+	var info operationInfo
+	if opJSON, err := json.Marshal(op.Prepare()); err == nil {
+		_ = json.Unmarshal(opJSON, &info)
+	}
+	return info
+}
+
+// contextBinder is implemented by HarperClients wrapping another, to bind the wrapped client's calls to a context.
+type contextBinder interface {
+	withContext(ctx context.Context) HarperClient
+}
+
+// clientWithContext returns a copy of client whose calls are made under ctx, so cancelling ctx (e.g. Grafana
+// cancelling a query or timing it out) aborts their HTTP requests. The SDK's methods take no context, so its client
+// is copied with one set on every request. Clients that can't be bound are returned as they are.
+func clientWithContext(client HarperClient, ctx context.Context) HarperClient {
+	switch c := client.(type) {
+	case *harper.Client:
+		bound := *c
+		bound.HttpClient = c.HttpClient.Clone().OnBeforeRequest(func(_ *resty.Client, r *resty.Request) error {
+			r.SetContext(ctx)
+			return nil
+		})
+		return &bound
+	case contextBinder:
+		return c.withContext(ctx)
+	default:
+		return client
+	}
+}
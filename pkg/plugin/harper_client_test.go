@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestClientWithContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			// health checks answer straight away
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	client := harper.NewClientWithHTTPClient(srv.Client(), srv.URL, "admin", "password")
+	pc := newPolicyClient(&capabilityClient{HarperClient: client, capabilities: &capabilities{}}, Settings{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := pc.forContext(ctx).ListMetrics(harper.ListMetricsRequest{})
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("expected the call to be aborted by the context, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the call to be aborted promptly, took %s", elapsed)
+	}
+	if statusFromError(err) != backend.StatusTimeout {
+		t.Errorf("expected the aborted call to be a timeout, got %v", statusFromError(err))
+	}
+
+	// the context is bound to the copy only
+	if err := pc.Healthcheck(); err != nil {
+		t.Errorf("expected the unbound client to be unaffected, got %v", err)
+	}
+}
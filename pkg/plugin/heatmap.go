@@ -0,0 +1,113 @@
+package plugin
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// frameTypeHeatmapRows is Grafana's frame type for pre-bucketed heatmaps: a time field and a count field per bucket,
+// named by its upper bound. The SDK doesn't define it.
+const frameTypeHeatmapRows data.FrameType = "heatmap-rows"
+
+// defaultHeatmapBuckets are the bucket upper bounds heatmaps use if the query doesn't set any. They suit latencies in
+// milliseconds, like those of the duration and TTFB metrics.
+var defaultHeatmapBuckets = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000}
+
+// distributionQuantiles are the attributes distribution metrics summarize their values with, and the fraction of
+// values at or below each.
+var distributionQuantiles = []struct {
+	attribute string
+	quantile  float64
+}{
+	{"min", 0},
+	{"p1", 0.01},
+	{"p10", 0.1},
+	{"p25", 0.25},
+	{"median", 0.5},
+	{"p75", 0.75},
+	{"p90", 0.9},
+	{"p95", 0.95},
+	{"p99", 0.99},
+	{"max", 1},
+}
+
+// heatmapFrame converts the rows of a distribution metric (each a count of values summarized by the quantile
+// attributes in distributionQuantiles) into a heatmap-rows frame: the estimated number of values in each bucket of
+// bounds, per interval, across all series. The values' distribution between quantiles is taken to be uniform, and a
+// final "+Inf" bucket counts those above the last bound. Rows without a count or any quantiles are skipped.
+func heatmapFrame(results []harper.GetAnalyticsResult, bounds []float64, interval time.Duration) *data.Frame {
+	resolution := interval.Milliseconds()
+	counts := make(map[int64][]float64)
+	for _, row := range results {
+		ts, ok := row["id"].(time.Time)
+		count, hasCount := numberValue(row["count"])
+		if !ok || !hasCount {
+			continue
+		}
+		var points [][2]float64
+		for _, q := range distributionQuantiles {
+			if v, ok := numberValue(row[q.attribute]); ok {
+				points = append(points, [2]float64{v, q.quantile})
+			}
+		}
+		if len(points) == 0 {
+			continue
+		}
+
+		bucket := ts.UnixMilli() - ts.UnixMilli()%resolution
+		if counts[bucket] == nil {
+			counts[bucket] = make([]float64, len(bounds)+1)
+		}
+		below := 0.0
+		for i, bound := range bounds {
+			cumulative := count * distributionCDF(points, bound)
+			counts[bucket][i] += cumulative - below
+			below = cumulative
+		}
+		counts[bucket][len(bounds)] += count - below
+	}
+
+	buckets := slices.Sorted(maps.Keys(counts))
+	times := make([]time.Time, len(buckets))
+	for i, bucket := range buckets {
+		times[i] = time.UnixMilli(bucket)
+	}
+	frame := data.NewFrame("", data.NewField("time", nil, times)).SetMeta(&data.FrameMeta{
+		Type:        frameTypeHeatmapRows,
+		TypeVersion: data.FrameTypeVersion{0, 1},
+	})
+	for i := range len(bounds) + 1 {
+		name := "+Inf"
+		if i < len(bounds) {
+			name = strconv.FormatFloat(bounds[i], 'f', -1, 64)
+		}
+		values := make([]float64, len(buckets))
+		for j, bucket := range buckets {
+			values[j] = counts[bucket][i]
+		}
+		frame.Fields = append(frame.Fields, data.NewField(name, nil, values))
+	}
+	return frame
+}
+
+// distributionCDF estimates the fraction of values at or below x from points, (value, quantile) pairs in ascending
+// order, interpolating linearly between them.
+func distributionCDF(points [][2]float64, x float64) float64 {
+	first, last := points[0], points[len(points)-1]
+	if x < first[0] {
+		// below the lowest known quantile, which is the min if there is one
+		return 0
+	}
+	if x >= last[0] {
+		// above the highest known quantile, which is the max if there is one
+		return 1
+	}
+	i := slices.IndexFunc(points, func(p [2]float64) bool { return x < p[0] })
+	lo, hi := points[i-1], points[i]
+	return lo[1] + (hi[1]-lo[1])*(x-lo[0])/(hi[0]-lo[0])
+}
@@ -0,0 +1,63 @@
+package plugin
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestHeatmapFrame(t *testing.T) {
+	start := time.UnixMilli(1_700_000_000_000)
+	results := []harper.GetAnalyticsResult{
+		// uniform from 0 to 100
+		{"id": start, "count": 100.0, "min": 0.0, "median": 50.0, "max": 100.0},
+		{"id": start.Add(10 * time.Second), "count": 100.0, "min": 0.0, "median": 50.0, "max": 100.0},
+		{"id": start.Add(time.Minute), "count": 10.0, "p99": 5.0},
+		{"id": start.Add(time.Minute), "median": 5.0},
+	}
+
+	frame := heatmapFrame(results, []float64{10, 50}, time.Minute)
+
+	if frame.Rows() != 2 || len(frame.Fields) != 4 {
+		t.Fatalf("expected 2 rows of time and 3 buckets, got %d rows of %d fields", frame.Rows(), len(frame.Fields))
+	}
+	for i, want := range map[int][]float64{0: {20, 80, 100}, 1: {10, 0, 0}} {
+		for j, w := range want {
+			if got := frame.Fields[j+1].At(i).(float64); math.Abs(got-w) > 1e-9 {
+				t.Errorf("expected row %d bucket %s to have %v, got %v", i, frame.Fields[j+1].Name, w, got)
+			}
+		}
+	}
+	if frame.Fields[3].Name != "+Inf" {
+		t.Errorf("expected the last bucket to be +Inf, got %q", frame.Fields[3].Name)
+	}
+}
+
+func TestQueryAnalyticsHeatmap(t *testing.T) {
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_000_000)
+	client.addAnalytics("duration", []time.Time{start}, map[string]any{"path": "/a", "count": 4.0, "min": 1.0, "max": 3.0})
+	ds := newTestDatasource(t, Settings{FieldNaming: fieldNamingSnakeCase}, client)
+
+	res, err := ds.query(context.Background(), backend.PluginContext{},
+		analyticsQuery("A", map[string]any{"metric": "duration", "format": "heatmap", "heatmapBuckets": []float64{2, 2.5}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := res.Frames[0]
+	if frame.Meta.Type != frameTypeHeatmapRows || frame.Fields[2].Name != "2.5" {
+		t.Errorf("expected a heatmap frame with fields named by their bounds, got %s", frame.Meta.Type)
+	}
+	if v := frame.Fields[1].At(0).(float64); v != 2 {
+		t.Errorf("expected half the values at or below 2, got %v", v)
+	}
+
+	if _, err := ds.query(context.Background(), backend.PluginContext{},
+		analyticsQuery("B", map[string]any{"metric": "duration", "format": "heatmap", "heatmapBuckets": []float64{5, 1}})); err == nil {
+		t.Error("expected unordered buckets to be rejected")
+	}
+}
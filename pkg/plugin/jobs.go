@@ -0,0 +1,101 @@
+package plugin
+
+import (
+	"fmt"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// GetJobQuery fetches one Harper job (an export, import, CSV load, ...) by ID.
+type GetJobQuery struct {
+	ID string `json:"id" validate:"required"`
+}
+
+// SearchJobsQuery fetches the Harper jobs started between From and To (epoch milliseconds). Harper matches whole
+// days, in UTC.
+type SearchJobsQuery struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+type jobOperation struct {
+	Operation string `json:"operation"`
+	ID        string `json:"id,omitempty"`
+	FromDate  string `json:"from_date,omitempty"`
+	ToDate    string `json:"to_date,omitempty"`
+}
+
+func (o jobOperation) Prepare() any {
+	return o
+}
+
+// jobRecord is a job as Harper returns it, with times in epoch milliseconds.
+type jobRecord struct {
+	ID              string   `json:"id"`
+	Type            string   `json:"type"`
+	Status          string   `json:"status"`
+	User            string   `json:"user"`
+	Message         string   `json:"message"`
+	CreatedDateTime *float64 `json:"created_datetime"`
+	StartDateTime   *float64 `json:"start_datetime"`
+	EndDateTime     *float64 `json:"end_datetime"`
+}
+
+func (d *Datasource) queryGetJob(client HarperClient, refID string, request GetJobQuery) (backend.DataResponse, error) {
+	op := jobOperation{Operation: harper.OP_GET_JOB, ID: request.ID}
+	return d.queryJobs(client, refID, op, "job "+request.ID)
+}
+
+func (d *Datasource) querySearchJobs(client HarperClient, refID string, request SearchJobsQuery) (backend.DataResponse, error) {
+	if request.From <= 0 || request.To <= 0 {
+		return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.from", Problem: "expected a time range"}
+	}
+	op := jobOperation{
+		Operation: harper.OP_SEARCH_JOBS,
+		FromDate:  time.UnixMilli(request.From).UTC().Format(harper.DATE_FORMAT),
+		ToDate:    time.UnixMilli(request.To).UTC().Format(harper.DATE_FORMAT),
+	}
+	return d.queryJobs(client, refID, op, "jobs")
+}
+
+// queryJobs sends a job operation and returns the jobs as a table frame, one row per job.
+func (d *Datasource) queryJobs(client HarperClient, refID string, op jobOperation, name string) (backend.DataResponse, error) {
+	d.logger.Debug("executing Harper operation", "refID", refID, "operation", op.Operation, "request", op)
+	start := time.Now()
+	var jobs []jobRecord
+	if err := client.RawRequest(op, &jobs); err != nil {
+		return backend.DataResponse{}, fmt.Errorf("could not get Harper jobs: '%w'", err)
+	}
+	d.logger.Debug("Harper operation completed", "refID", refID, "operation", op.Operation,
+		"duration", time.Since(start), "results", len(jobs))
+
+	frame := data.NewFrame(frameName(refID, name),
+		data.NewField("id", nil, []string{}),
+		data.NewField("type", nil, []string{}),
+		data.NewField("status", nil, []string{}),
+		data.NewField("user", nil, []string{}),
+		data.NewField("created", nil, []*time.Time{}),
+		data.NewField("start", nil, []*time.Time{}),
+		data.NewField("end", nil, []*time.Time{}),
+		data.NewField("message", nil, []string{}),
+	).SetMeta(&data.FrameMeta{PreferredVisualization: data.VisTypeTable}).SetRefID(refID)
+
+	for _, job := range jobs {
+		frame.AppendRow(job.ID, job.Type, job.Status, job.User,
+			epochMillisToTime(job.CreatedDateTime), epochMillisToTime(job.StartDateTime), epochMillisToTime(job.EndDateTime),
+			job.Message)
+	}
+
+	return backend.DataResponse{Frames: data.Frames{frame}}, nil
+}
+
+func epochMillisToTime(ms *float64) *time.Time {
+	if ms == nil || *ms == 0 {
+		return nil
+	}
+	t := time.UnixMilli(int64(*ms))
+	return &t
+}
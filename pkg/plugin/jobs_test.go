@@ -0,0 +1,60 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestQueryJobs(t *testing.T) {
+	var sent map[string]any
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "search_jobs_by_start_date" {
+			return nil, nil
+		}
+		sent = op
+		return json.RawMessage(`[
+			{"id":"job-1","type":"export_to_s3","status":"COMPLETE","user":"admin","message":"exported 10 records",
+			 "created_datetime":1714564800000,"start_datetime":1714564801000,"end_datetime":1714564802000},
+			{"id":"job-2","type":"csv_file_load","status":"IN_PROGRESS","user":"admin","start_datetime":1714564803000}
+		]`), nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	queryJSON, _ := json.Marshal(map[string]any{
+		"operation":  "search_jobs_by_start_date",
+		"queryAttrs": map[string]any{"from": 1714564800000, "to": 1714651200000},
+	})
+	res, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: queryJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent["from_date"] != "2024-05-01" || sent["to_date"] != "2024-05-02" {
+		t.Errorf("unexpected operation %v", sent)
+	}
+
+	frame := res.Frames[0]
+	if frame.Rows() != 2 {
+		t.Fatalf("expected 2 rows, got %d", frame.Rows())
+	}
+	status, _ := frame.FieldByName("status")
+	if status.At(1) != "IN_PROGRESS" {
+		t.Errorf("expected the second job to be in progress, got %v", status.At(1))
+	}
+	end, _ := frame.FieldByName("end")
+	if v := end.At(0).(*time.Time); v == nil || v.UnixMilli() != 1714564802000 {
+		t.Errorf("unexpected end time %v", v)
+	}
+	if v := end.At(1).(*time.Time); v != nil {
+		t.Errorf("expected no end time for a running job, got %v", v)
+	}
+
+	getJSON, _ := json.Marshal(map[string]any{"operation": "get_job", "queryAttrs": map[string]any{}})
+	if _, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "B", JSON: getJSON}); err == nil {
+		t.Error("expected get_job without an ID to be rejected")
+	}
+}
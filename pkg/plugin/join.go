@@ -0,0 +1,284 @@
+package plugin
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	joinInner = "inner"
+	joinOuter = "outer"
+)
+
+// JoinQuery runs two analytics queries and joins their rows on timestamp and the labels they share, so they can be
+// charted or tabulated together without Grafana's join transformations. An inner join (the default) keeps only the
+// rows both sides have; an outer join keeps all rows, with nulls for the missing side's values. Points only meet if
+// their timestamps match exactly, so both sides usually set the same aggregation and interval.
+type JoinQuery struct {
+	Left  GetAnalyticsQuery `json:"left" validate:"required"`
+	Right GetAnalyticsQuery `json:"right" validate:"required"`
+	Join  string            `json:"join"`
+
+	// Format is "time_series" (the default) for a wide frame or "table" for the joined rows. The sides' own formats
+	// are ignored.
+	Format string `json:"format"`
+}
+
+func (d *Datasource) queryJoin(ctx context.Context, pCtx backend.PluginContext, query backend.DataQuery, qm queryModel[JoinQuery]) (backend.DataResponse, error) {
+	request := qm.QueryAttrs
+	join := cmp.Or(request.Join, joinInner)
+	if join != joinInner && join != joinOuter {
+		return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.join", Problem: "expected 'inner' or 'outer'"}
+	}
+	if request.Format != "" && request.Format != analyticsFormatTimeSeries && request.Format != analyticsFormatTable {
+		return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.format", Problem: "expected time_series or table"}
+	}
+
+	var sides [2]*data.Frame
+	for i, side := range []struct {
+		name    string
+		request GetAnalyticsQuery
+	}{{"left", request.Left}, {"right", request.Right}} {
+		// each side runs as an ordinary analytics query, as rows
+		side.request.Format = analyticsFormatTable
+		attrs, err := json.Marshal(side.request)
+		if err != nil {
+			return backend.DataResponse{}, fmt.Errorf("could not marshal the %s query: '%w'", side.name, err)
+		}
+		subQuery := query
+		subQuery.JSON, err = json.Marshal(map[string]any{
+			"operation":    "get_analytics",
+			"queryAttrs":   json.RawMessage(attrs),
+			"adhocFilters": qm.AdhocFilters,
+		})
+		if err != nil {
+			return backend.DataResponse{}, fmt.Errorf("could not marshal the %s query: '%w'", side.name, err)
+		}
+
+		res, err := d.query(ctx, pCtx, subQuery)
+		if err != nil {
+			var validationErr *QueryValidationError
+			if errors.As(err, &validationErr) {
+				field, _ := strings.CutPrefix(validationErr.Field, "queryAttrs")
+				return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs." + side.name + field, Problem: validationErr.Problem}
+			}
+			return backend.DataResponse{}, fmt.Errorf("could not query the %s side of the join: '%w'", side.name, err)
+		}
+		if res.Error != nil {
+			return res, nil
+		}
+		// the sides' metrics differ, so they'd never match; clashing value names are prefixed with them instead
+		sides[i] = res.Frames[0]
+		sides[i].Fields = slices.DeleteFunc(sides[i].Fields, func(f *data.Field) bool { return f.Name == "metric" })
+	}
+
+	leftName, rightName := request.Left.Metric, request.Right.Metric
+	if leftName == rightName {
+		leftName, rightName = "left", "right"
+	}
+	long := joinFrames(sides[0], sides[1], leftName, rightName, join == joinOuter)
+	long.Name = frameName(query.RefID, request.Left.Metric+" "+join+" join "+request.Right.Metric)
+	long.SetRefID(query.RefID)
+
+	frame := long
+	var visualization data.VisType = data.VisTypeTable
+	if request.Format != analyticsFormatTable && long.Rows() > 0 {
+		visualization = data.VisTypeGraph
+		if slices.ContainsFunc(long.Fields, func(f *data.Field) bool { return f.Type() == data.FieldTypeNullableString }) {
+			wide, err := data.LongToWide(long, &data.FillMissing{Mode: data.FillModeNull})
+			if err != nil {
+				return backend.DataResponse{}, fmt.Errorf("could not convert frame to wide format: '%w'", err)
+			}
+			frame = wide.SetRefID(query.RefID)
+		} else {
+			// without labels the joined rows are already one value per field per time
+			long.Meta.Type = data.FrameTypeTimeSeriesWide
+		}
+	}
+	frame.Meta.PreferredVisualization = visualization
+	setFieldDisplayHints(frame)
+
+	return backend.DataResponse{Frames: data.Frames{frame}}, nil
+}
+
+// joinFrames joins the rows of two long analytics frames on their time field and the label (string) fields they
+// share, keeping unmatched rows of either side if outer. Value fields whose names clash are prefixed with the side's
+// name. Like the frames analytics queries return, both frames' fields must be nullable.
+func joinFrames(left *data.Frame, right *data.Frame, leftName string, rightName string, outer bool) *data.Frame {
+	type side struct {
+		frame  *data.Frame
+		name   string
+		time   int
+		labels []int
+		values []int
+		// rows lists the frame's row indexes by join key
+		rows map[string][]int
+	}
+	sides := []*side{{frame: left, name: leftName}, {frame: right, name: rightName}}
+	for _, s := range sides {
+		s.time = -1
+		for i, f := range s.frame.Fields {
+			switch {
+			case s.time < 0 && f.Type() == data.FieldTypeNullableTime:
+				s.time = i
+			case f.Type() == data.FieldTypeNullableString:
+				s.labels = append(s.labels, i)
+			default:
+				s.values = append(s.values, i)
+			}
+		}
+	}
+
+	labelNames := func(s *side) []string {
+		names := make([]string, len(s.labels))
+		for i, l := range s.labels {
+			names[i] = s.frame.Fields[l].Name
+		}
+		return names
+	}
+	var shared []string
+	for _, name := range labelNames(sides[0]) {
+		if slices.Contains(labelNames(sides[1]), name) {
+			shared = append(shared, name)
+		}
+	}
+
+	// the joined frame has the time, the shared labels, each side's own labels, and then each side's values
+	out := data.NewFrame("", data.NewFieldFromFieldType(data.FieldTypeNullableTime, 0)).SetMeta(&data.FrameMeta{
+		Type:        data.FrameTypeTimeSeriesLong,
+		TypeVersion: data.FrameTypeVersion{0, 1},
+	})
+	out.Fields[0].Name = "time"
+	if s := sides[0]; s.time >= 0 {
+		out.Fields[0].Name = s.frame.Fields[s.time].Name
+	}
+	for _, name := range shared {
+		out.Fields = append(out.Fields, data.NewFieldFromFieldType(data.FieldTypeNullableString, 0))
+		out.Fields[len(out.Fields)-1].Name = name
+	}
+	// columns maps each side's fields to the joined frame's
+	columns := make([]map[int]int, len(sides))
+	for i, s := range sides {
+		columns[i] = make(map[int]int)
+		if s.time >= 0 {
+			columns[i][s.time] = 0
+		}
+		for _, l := range s.labels {
+			if j := slices.Index(shared, s.frame.Fields[l].Name); j >= 0 {
+				columns[i][l] = 1 + j
+				continue
+			}
+			columns[i][l] = len(out.Fields)
+			out.Fields = append(out.Fields, data.NewFieldFromFieldType(data.FieldTypeNullableString, 0))
+			out.Fields[len(out.Fields)-1].Name = s.frame.Fields[l].Name
+		}
+	}
+	for i, s := range sides {
+		other := sides[1-i]
+		for _, v := range s.values {
+			field := s.frame.Fields[v]
+			name := field.Name
+			if slices.ContainsFunc(other.values, func(o int) bool { return other.frame.Fields[o].Name == name }) {
+				name = s.name + " " + name
+			}
+			columns[i][v] = len(out.Fields)
+			joined := data.NewFieldFromFieldType(field.Type(), 0)
+			joined.Name = name
+			joined.Labels = field.Labels
+			joined.Config = field.Config
+			out.Fields = append(out.Fields, joined)
+		}
+	}
+
+	for _, s := range sides {
+		s.rows = make(map[string][]int)
+		for row := range s.frame.Rows() {
+			s.rows[joinKey(s.frame, row, s.time, shared)] = append(s.rows[joinKey(s.frame, row, s.time, shared)], row)
+		}
+	}
+
+	// joinRows returns a joined row from the given rows of each side, -1 for none
+	joinRows := func(rows [2]int) []any {
+		values := make([]any, len(out.Fields))
+		for i, s := range sides {
+			if rows[i] < 0 {
+				continue
+			}
+			for from, to := range columns[i] {
+				// matched rows agree on the time and shared labels, so either side's will do
+				values[to] = s.frame.Fields[from].At(rows[i])
+			}
+		}
+		return values
+	}
+
+	var joined [][]any
+	matched := make(map[int]bool)
+	for row := range left.Rows() {
+		rights := sides[1].rows[joinKey(left, row, sides[0].time, shared)]
+		for _, r := range rights {
+			joined = append(joined, joinRows([2]int{row, r}))
+			matched[r] = true
+		}
+		if len(rights) == 0 && outer {
+			joined = append(joined, joinRows([2]int{row, -1}))
+		}
+	}
+	if outer {
+		for row := range right.Rows() {
+			if !matched[row] {
+				joined = append(joined, joinRows([2]int{-1, row}))
+			}
+		}
+	}
+
+	// LongToWide needs the rows in time order
+	slices.SortStableFunc(joined, func(a, b []any) int {
+		var ta, tb time.Time
+		if t, ok := a[0].(*time.Time); ok && t != nil {
+			ta = *t
+		}
+		if t, ok := b[0].(*time.Time); ok && t != nil {
+			tb = *t
+		}
+		return ta.Compare(tb)
+	})
+	for _, row := range joined {
+		out.AppendRow(row...)
+	}
+
+	for _, s := range sides {
+		if s.frame.Meta != nil {
+			out.AppendNotices(s.frame.Meta.Notices...)
+		}
+	}
+	return out
+}
+
+// joinKey identifies the row's time and shared label values.
+func joinKey(frame *data.Frame, row int, timeField int, shared []string) string {
+	var key strings.Builder
+	if timeField >= 0 {
+		if t, ok := frame.Fields[timeField].ConcreteAt(row); ok {
+			fmt.Fprint(&key, t.(time.Time).UnixNano())
+		}
+	}
+	for _, name := range shared {
+		key.WriteByte(0)
+		if field, _ := frame.FieldByName(name); field != nil {
+			if v, ok := field.ConcreteAt(row); ok {
+				fmt.Fprint(&key, v)
+			}
+		}
+	}
+	return key.String()
+}
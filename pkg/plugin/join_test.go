@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func joinQuery(refID string, attrs map[string]any) backend.DataQuery {
+	queryJSON, _ := json.Marshal(map[string]any{
+		"refId":      refID,
+		"operation":  "join",
+		"queryAttrs": attrs,
+	})
+	return backend.DataQuery{RefID: refID, JSON: queryJSON}
+}
+
+func TestQueryJoin(t *testing.T) {
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_000_000)
+	client.addAnalytics("db-read", []time.Time{start, start.Add(time.Second)}, map[string]any{"node": "node-1", "count": 5.0})
+	client.addAnalytics("db-read", []time.Time{start}, map[string]any{"node": "node-2", "count": 7.0})
+	client.addAnalytics("db-write", []time.Time{start}, map[string]any{"node": "node-1", "count": 2.0})
+	client.addAnalytics("db-write", []time.Time{start.Add(2 * time.Second)}, map[string]any{"node": "node-1", "count": 3.0})
+	ds := newTestDatasource(t, Settings{}, client)
+
+	query := func(join string) *data.Frame {
+		t.Helper()
+		res, err := ds.query(context.Background(), backend.PluginContext{}, joinQuery("A", map[string]any{
+			"left":   map[string]any{"metric": "db-read"},
+			"right":  map[string]any{"metric": "db-write"},
+			"join":   join,
+			"format": "table",
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Frames[0]
+	}
+
+	// only node-1's first point is in both
+	frame := query("inner")
+	if frame.Rows() != 1 {
+		t.Fatalf("expected 1 joined row, got %d", frame.Rows())
+	}
+	for name, want := range map[string]float64{"db-read count": 5, "db-write count": 2} {
+		field, _ := frame.FieldByName(name)
+		if field == nil {
+			t.Fatalf("expected a %q field", name)
+		}
+		if v, _ := field.NullableFloatAt(0); v == nil || *v != want {
+			t.Errorf("expected %s to be %v, got %v", name, want, v)
+		}
+	}
+
+	frame = query("outer")
+	if frame.Rows() != 4 {
+		t.Fatalf("expected every row of either side, got %d", frame.Rows())
+	}
+	for i := 1; i < frame.Rows(); i++ {
+		prev, _ := frame.Fields[0].ConcreteAt(i - 1)
+		cur, _ := frame.Fields[0].ConcreteAt(i)
+		if cur.(time.Time).Before(prev.(time.Time)) {
+			t.Errorf("expected the joined rows in time order")
+		}
+	}
+	writes, _ := frame.FieldByName("db-write count")
+	nulls := 0
+	for i := range frame.Rows() {
+		if v, _ := writes.NullableFloatAt(i); v == nil {
+			nulls++
+		}
+	}
+	if nulls != 2 {
+		t.Errorf("expected the 2 unmatched db-read rows to have no db-write count, got %d", nulls)
+	}
+
+	res, err := ds.query(context.Background(), backend.PluginContext{}, joinQuery("B", map[string]any{
+		"left":  map[string]any{"metric": "db-read"},
+		"right": map[string]any{"metric": "db-write"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Frames[0].Meta.Type != data.FrameTypeTimeSeriesWide {
+		t.Errorf("expected a wide frame by default, got %s", res.Frames[0].Meta.Type)
+	}
+
+	_, err = ds.query(context.Background(), backend.PluginContext{}, joinQuery("C", map[string]any{
+		"left":  map[string]any{"metric": "db-read", "aggregation": "median"},
+		"right": map[string]any{"metric": "db-write"},
+	}))
+	if verr, ok := err.(*QueryValidationError); !ok || verr.Field != "queryAttrs.left.aggregation" {
+		t.Errorf("expected the left query's aggregation to be rejected, got %v", err)
+	}
+	if _, err := ds.query(context.Background(), backend.PluginContext{}, joinQuery("D", map[string]any{
+		"left":  map[string]any{"metric": "db-read"},
+		"right": map[string]any{"metric": "db-write"},
+		"join":  "cross",
+	})); err == nil {
+		t.Error("expected an unknown join to be rejected")
+	}
+}
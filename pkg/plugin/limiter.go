@@ -0,0 +1,101 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// SlotWaitError is returned for an operation that gave up waiting for a request slot because its context was done.
+type SlotWaitError struct {
+	Operation   string
+	MaxInFlight int
+	Err         error
+}
+
+func (e *SlotWaitError) Error() string {
+	return fmt.Sprintf("gave up waiting to send the %s operation, with %d already in flight: %s", e.Operation,
+		e.MaxInFlight, e.Err)
+}
+
+func (e *SlotWaitError) Unwrap() error {
+	return e.Err
+}
+
+// limitedClient wraps a HarperClient to cap how many of its operations are in flight at once, across every query
+// and request of the instance, so a large dashboard refreshing can't overwhelm a small Harper node. Operations over
+// the cap wait for a slot until their context is done. Health checks aren't limited.
+type limitedClient struct {
+	HarperClient
+	// slots holds a token per operation in flight.
+	slots  chan struct{}
+	logger log.Logger
+
+	// ctx is the context the client's calls are made under, whose cancellation stops them waiting for a slot.
+	ctx context.Context
+}
+
+// newLimitedClient returns client limited to maxInFlight operations at once, or client itself if maxInFlight is 0.
+func newLimitedClient(client HarperClient, maxInFlight int, logger log.Logger) HarperClient {
+	if maxInFlight <= 0 {
+		return client
+	}
+	return &limitedClient{HarperClient: client, slots: make(chan struct{}, maxInFlight), logger: logger, ctx: context.Background()}
+}
+
+func (lc *limitedClient) withContext(ctx context.Context) HarperClient {
+	return &limitedClient{HarperClient: clientWithContext(lc.HarperClient, ctx), slots: lc.slots, logger: lc.logger, ctx: ctx}
+}
+
+// do runs try once a slot is free.
+func (lc *limitedClient) do(operation string, try func() error) error {
+	select {
+	case lc.slots <- struct{}{}:
+	default:
+		start := time.Now()
+		lc.logger.Debug("waiting for a free Harper request slot", "operation", operation, "maxInFlight", cap(lc.slots))
+		select {
+		case lc.slots <- struct{}{}:
+			lc.logger.Debug("got a Harper request slot", "operation", operation, "waited", time.Since(start))
+		case <-lc.ctx.Done():
+			return &SlotWaitError{Operation: operation, MaxInFlight: cap(lc.slots), Err: lc.ctx.Err()}
+		}
+	}
+	defer func() { <-lc.slots }()
+
+	return try()
+}
+
+func (lc *limitedClient) GetAnalytics(req harper.GetAnalyticsRequest) ([]harper.GetAnalyticsResult, error) {
+	var results []harper.GetAnalyticsResult
+	err := lc.do(harper.OP_GET_ANALYTICS, func() (err error) {
+		results, err = lc.HarperClient.GetAnalytics(req)
+		return err
+	})
+	return results, err
+}
+
+func (lc *limitedClient) ListMetrics(req harper.ListMetricsRequest) ([]harper.ListMetricsResult, error) {
+	var metrics []harper.ListMetricsResult
+	err := lc.do(harper.OP_LIST_METRICS, func() (err error) {
+		metrics, err = lc.HarperClient.ListMetrics(req)
+		return err
+	})
+	return metrics, err
+}
+
+func (lc *limitedClient) DescribeMetric(metric string) (*harper.DescribeMetricResult, error) {
+	var desc *harper.DescribeMetricResult
+	err := lc.do(harper.OP_DESCRIBE_METRIC, func() (err error) {
+		desc, err = lc.HarperClient.DescribeMetric(metric)
+		return err
+	})
+	return desc, err
+}
+
+func (lc *limitedClient) RawRequest(op harper.Operation, result any) error {
+	return lc.do(operationName(op), func() error { return lc.HarperClient.RawRequest(op, result) })
+}
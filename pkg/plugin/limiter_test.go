@@ -0,0 +1,80 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestLimitedClient(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return nil, nil
+	}
+	lc := newLimitedClient(client, 2, log.DefaultLogger)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			if err := lc.RawRequest(rawOperation{"operation": "cluster_status"}, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got != 2 {
+		t.Errorf("expected at most 2 operations in flight, got %d", got)
+	}
+}
+
+func TestLimitedClientContext(t *testing.T) {
+	release := make(chan struct{})
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		<-release
+		return nil, nil
+	}
+	lc := newLimitedClient(client, 1, log.DefaultLogger)
+
+	done := make(chan error)
+	go func() { done <- lc.RawRequest(rawOperation{"operation": "cluster_status"}, nil) }()
+	// wait for the first operation to take the only slot
+	for len(lc.(*limitedClient).slots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := clientWithContext(lc, ctx).RawRequest(rawOperation{"operation": "cluster_status"}, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the queued operation to give up with its context, got %v", err)
+	}
+	if statusFromError(err) != backend.StatusTimeout {
+		t.Errorf("expected a timeout, got %v", statusFromError(err))
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := lc.RawRequest(rawOperation{"operation": "cluster_status"}, nil); err != nil {
+		t.Errorf("expected the slot to be freed, got %v", err)
+	}
+}
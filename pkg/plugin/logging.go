@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// instanceLogger applies a datasource instance's own log level on top of the plugin-wide logger. Grafana filters
+// plugin logs by the global plugin log level, so when an instance asks for debug logging its debug messages are
+// promoted to info (tagged verbose=true) to get through without flooding the logs of every other instance.
+type instanceLogger struct {
+	log.Logger
+	level log.Level
+}
+
+// newInstanceLogger returns a logger for a datasource instance at the given level ("debug", "info", "warn" or
+// "error"). An empty level leaves the plugin-wide log level in charge.
+func newInstanceLogger(base log.Logger, level string) (log.Logger, error) {
+	var l log.Level
+	switch strings.ToLower(level) {
+	case "":
+		return base, nil
+	case "debug":
+		l = log.Debug
+	case "info":
+		l = log.Info
+	case "warn":
+		l = log.Warn
+	case "error":
+		l = log.Error
+	default:
+		return nil, fmt.Errorf("unsupported log level '%s'", level)
+	}
+
+	return &instanceLogger{Logger: base, level: l}, nil
+}
+
+func (l *instanceLogger) Debug(msg string, args ...any) {
+	if l.level == log.Debug {
+		l.Logger.Info(msg, append(args, "verbose", true)...)
+	}
+}
+
+func (l *instanceLogger) Info(msg string, args ...any) {
+	if l.level <= log.Info {
+		l.Logger.Info(msg, args...)
+	}
+}
+
+func (l *instanceLogger) Warn(msg string, args ...any) {
+	if l.level <= log.Warn {
+		l.Logger.Warn(msg, args...)
+	}
+}
+
+func (l *instanceLogger) With(args ...any) log.Logger {
+	return &instanceLogger{Logger: l.Logger.With(args...), level: l.level}
+}
+
+func (l *instanceLogger) Level() log.Level {
+	return l.level
+}
+
+func (l *instanceLogger) FromContext(ctx context.Context) log.Logger {
+	return &instanceLogger{Logger: l.Logger.FromContext(ctx), level: l.level}
+}
@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// defaultLogLimit caps the log entries returned when the query doesn't set a limit.
+const defaultLogLimit = 1000
+
+// ReadLogQuery reads entries from the Harper log between From and To (epoch milliseconds), newest first unless Order
+// is "asc". Level, if set, limits the entries to one level (e.g. "error").
+type ReadLogQuery struct {
+	From  int64  `json:"from"`
+	To    int64  `json:"to"`
+	Limit int    `json:"limit"`
+	Level string `json:"level"`
+	Order string `json:"order"`
+}
+
+type readLogOperation struct {
+	Operation string `json:"operation"`
+	Limit     int    `json:"limit"`
+	From      string `json:"from,omitempty"`
+	Until     string `json:"until,omitempty"`
+	Level     string `json:"level,omitempty"`
+	Order     string `json:"order"`
+}
+
+func (o readLogOperation) Prepare() any {
+	return o
+}
+
+type logEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Level     string    `json:"level"`
+	Thread    string    `json:"thread"`
+	Message   string    `json:"message"`
+}
+
+// queryReadLog returns the Harper log entries as a logs frame, so Explore and logs panels render them natively.
+func (d *Datasource) queryReadLog(client HarperClient, refID string, request ReadLogQuery) (backend.DataResponse, error) {
+	op := readLogOperation{
+		Operation: harper.OP_READ_LOG,
+		Limit:     request.Limit,
+		Level:     request.Level,
+		Order:     request.Order,
+	}
+	if op.Limit <= 0 {
+		op.Limit = defaultLogLimit
+	}
+	if op.Order == "" {
+		op.Order = harper.LogOrderDesc
+	} else if op.Order != harper.LogOrderAsc && op.Order != harper.LogOrderDesc {
+		return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.order", Problem: "expected 'asc' or 'desc'"}
+	}
+	if request.From > 0 {
+		op.From = time.UnixMilli(request.From).UTC().Format(time.RFC3339Nano)
+	}
+	if request.To > 0 {
+		op.Until = time.UnixMilli(request.To).UTC().Format(time.RFC3339Nano)
+	}
+
+	d.logger.Debug("executing Harper operation", "refID", refID, "operation", op.Operation, "request", op)
+	start := time.Now()
+	var raw json.RawMessage
+	if err := client.RawRequest(op, &raw); err != nil {
+		return backend.DataResponse{}, fmt.Errorf("could not read Harper log: '%w'", err)
+	}
+	entries, err := decodeLogEntries(raw)
+	if err != nil {
+		return backend.DataResponse{}, fmt.Errorf("could not decode Harper log: '%w'", err)
+	}
+	d.logger.Debug("Harper operation completed", "refID", refID, "operation", op.Operation,
+		"duration", time.Since(start), "results", len(entries))
+
+	timestamps := make([]time.Time, len(entries))
+	levels := make([]string, len(entries))
+	threads := make([]string, len(entries))
+	messages := make([]string, len(entries))
+	for i, entry := range entries {
+		timestamps[i] = entry.Timestamp
+		levels[i] = entry.Level
+		threads[i] = entry.Thread
+		messages[i] = entry.Message
+	}
+
+	frame := data.NewFrame(frameName(refID, "Harper log"),
+		data.NewField("timestamp", nil, timestamps),
+		data.NewField("level", nil, levels),
+		data.NewField("thread", nil, threads),
+		data.NewField("message", nil, messages),
+	).SetMeta(&data.FrameMeta{PreferredVisualization: data.VisTypeLogs}).SetRefID(refID)
+
+	return backend.DataResponse{Frames: data.Frames{frame}}, nil
+}
+
+// decodeLogEntries decodes a read_log response. Harper returns a list of entries; older versions wrap it in an
+// object's "file" attribute.
+func decodeLogEntries(raw json.RawMessage) ([]logEntry, error) {
+	var entries []logEntry
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+		err := json.Unmarshal(raw, &entries)
+		return entries, err
+	}
+
+	var wrapped struct {
+		File []logEntry `json:"file"`
+	}
+	err := json.Unmarshal(raw, &wrapped)
+	return wrapped.File, err
+}
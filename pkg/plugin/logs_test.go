@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestQueryReadLog(t *testing.T) {
+	var sent map[string]any
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "read_log" {
+			return nil, nil
+		}
+		sent = op
+		return json.RawMessage(`[
+			{"level":"error","thread":"http/1","message":"boom","timestamp":"2024-05-01T12:00:01.000Z"},
+			{"level":"info","thread":"main/0","message":"started","timestamp":"2024-05-01T12:00:00.000Z"}
+		]`), nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	queryJSON, _ := json.Marshal(map[string]any{
+		"operation":  "read_log",
+		"queryAttrs": map[string]any{"from": 1714564800000, "to": 1714568400000, "limit": 50},
+	})
+	res, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: queryJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sent["limit"] != float64(50) || sent["order"] != "desc" || sent["from"] != "2024-05-01T12:00:00Z" {
+		t.Errorf("unexpected operation %v", sent)
+	}
+
+	frame := res.Frames[0]
+	if frame.Meta == nil || frame.Meta.PreferredVisualization != data.VisTypeLogs {
+		t.Error("expected the frame to prefer the logs visualization")
+	}
+	if frame.Rows() != 2 {
+		t.Fatalf("expected 2 rows, got %d", frame.Rows())
+	}
+	if frame.Fields[0].Type() != data.FieldTypeTime {
+		t.Errorf("expected a time field, got %s", frame.Fields[0].Type())
+	}
+	for i, name := range []string{"timestamp", "level", "thread", "message"} {
+		if frame.Fields[i].Name != name {
+			t.Errorf("expected field %d to be %s, got %s", i, name, frame.Fields[i].Name)
+		}
+	}
+	if frame.Fields[3].At(0) != "boom" {
+		t.Errorf("expected the first message to be boom, got %v", frame.Fields[3].At(0))
+	}
+}
+
+func TestDecodeLogEntriesWrapped(t *testing.T) {
+	entries, err := decodeLogEntries(json.RawMessage(`{"file":[{"level":"warn","message":"slow","timestamp":"2024-05-01T12:00:00Z"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Level != "warn" {
+		t.Errorf("unexpected entries %v", entries)
+	}
+}
@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
+)
+
+// expandTimeMacros replaces the time macros in the condition values of cs, and their nested conditions, with epoch
+// milliseconds, so saved queries follow the dashboard's time range however they're run. A value, or each element of a
+// list value (including a string of comma-separated values), may be $__from or $__to, the query's time range, or a
+// Grafana relative time such as "now-1h" or "now/d". Values with a macro are compared as timestamps unless they have
+// a numeric type.
+func (cs Conditions) expandTimeMacros(tr backend.TimeRange, now time.Time) error {
+	for _, c := range cs {
+		if c == nil {
+			continue
+		}
+
+		expanded := false
+		switch val := c.Value.Val.(type) {
+		case string:
+			elems := strings.Split(val, ",")
+			for i, elem := range elems {
+				ms, ok, err := expandTimeMacro(elem, tr, now)
+				if err != nil {
+					return &QueryValidationError{Field: "queryAttrs.conditions", Problem: fmt.Sprintf("value of '%s' %s", c.Attribute, err)}
+				}
+				if ok {
+					elems[i] = strconv.FormatInt(ms, 10)
+					expanded = true
+				}
+			}
+			c.Value.Val = strings.Join(elems, ",")
+		case []any:
+			for i, elem := range val {
+				s, isString := elem.(string)
+				if !isString {
+					continue
+				}
+				ms, ok, err := expandTimeMacro(s, tr, now)
+				if err != nil {
+					return &QueryValidationError{Field: "queryAttrs.conditions", Problem: fmt.Sprintf("value of '%s' %s", c.Attribute, err)}
+				}
+				if ok {
+					val[i] = strconv.FormatInt(ms, 10)
+					expanded = true
+				}
+			}
+		}
+		if expanded && (c.Value.Type == "" || c.Value.Type == "auto" || c.Value.Type == searchValueTypeString) {
+			c.Value.Type = searchValueTypeTimestamp
+		}
+
+		if err := Conditions(c.Conditions).expandTimeMacros(tr, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandTimeMacro returns the epoch milliseconds s stands for if it's a time macro.
+func expandTimeMacro(s string, tr backend.TimeRange, now time.Time) (int64, bool, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "$__from", "${__from}":
+		return tr.From.UnixMilli(), true, nil
+	case "$__to", "${__to}":
+		return tr.To.UnixMilli(), true, nil
+	}
+	if s != "now" && !strings.HasPrefix(s, "now-") && !strings.HasPrefix(s, "now+") && !strings.HasPrefix(s, "now/") {
+		return 0, false, nil
+	}
+
+	t, err := gtime.TimeRange{From: s, Now: now}.ParseFrom()
+	if err != nil {
+		return 0, false, fmt.Errorf("'%s' isn't a valid relative time", s)
+	}
+	return t.UnixMilli(), true, nil
+}
+
+// scopedVar is a dashboard variable's value as Grafana passes it in a query's scopedVars. Value is a list for
+// multi-value variables.
+type scopedVar struct {
+	Text  any `json:"text"`
+	Value any `json:"value"`
+}
+
+// variablePattern matches the variable syntaxes Grafana supports: $name, ${name} (optionally with a format, which is
+// ignored) and [[name]].
+var variablePattern = regexp.MustCompile(`\$\{(\w+)(?::\w+)?\}|\$(\w+)|\[\[(\w+)\]\]`)
+
+// interpolateVariables replaces the variables in every string of v, a decoded JSON value, with their values from
+// vars, so queries that aren't interpolated by the frontend (e.g. alert rules) can still be templated. Multi-value
+// variables are replaced with their values as "{a,b}", which the in comparator accepts. Variables not in vars,
+// including Grafana's time macros, are left as they are.
+func interpolateVariables(v any, vars map[string]scopedVar) any {
+	switch v := v.(type) {
+	case string:
+		return variablePattern.ReplaceAllStringFunc(v, func(match string) string {
+			groups := variablePattern.FindStringSubmatch(match)
+			name := groups[1] + groups[2] + groups[3]
+			sv, ok := vars[name]
+			if !ok {
+				return match
+			}
+			return sv.format()
+		})
+	case map[string]any:
+		for k, elem := range v {
+			v[k] = interpolateVariables(elem, vars)
+		}
+	case []any:
+		for i, elem := range v {
+			v[i] = interpolateVariables(elem, vars)
+		}
+	}
+	return v
+}
+
+func (sv scopedVar) format() string {
+	values, ok := sv.Value.([]any)
+	if !ok {
+		return fmt.Sprint(sv.Value)
+	}
+	if len(values) == 1 {
+		return fmt.Sprint(values[0])
+	}
+	elems := make([]string, len(values))
+	for i, value := range values {
+		elems[i] = fmt.Sprint(value)
+	}
+	return "{" + strings.Join(elems, ",") + "}"
+}
@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestExpandTimeMacros(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	tr := backend.TimeRange{From: now.Add(-6 * time.Hour), To: now}
+
+	conditions := Conditions{
+		{Attribute: "__createdtime__", Comparator: "greater_than", Value: SearchValue{Val: "now-1h", Type: "string"}},
+		{Attribute: "__updatedtime__", Comparator: "between", Value: SearchValue{Val: "$__from, ${__to}"}},
+		{Operator: "or", Conditions: []*Condition{
+			{Attribute: "expires", Comparator: "less_than", Value: SearchValue{Val: []any{"now/d"}, Type: "number"}},
+		}},
+		{Attribute: "name", Comparator: "equals", Value: SearchValue{Val: "nowhere", Type: "string"}},
+	}
+	if err := conditions.expandTimeMacros(tr, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := conditions[0].Value; v.Val != "1714563000000" || v.Type != "timestamp" {
+		t.Errorf("expected now-1h to be expanded to a timestamp, got %+v", v)
+	}
+	if v := conditions[1].Value; v.Val != "1714545000000,1714566600000" || v.Type != "timestamp" {
+		t.Errorf("expected the time range to be expanded, got %+v", v)
+	}
+	if v := conditions[2].Conditions[0].Value; v.Val.([]any)[0] != "1714521600000" || v.Type != "number" {
+		t.Errorf("expected now/d to be expanded in a nested condition, got %+v", v)
+	}
+	if v := conditions[3].Value; v.Val != "nowhere" || v.Type != "string" {
+		t.Errorf("expected other values to be left alone, got %+v", v)
+	}
+
+	bad := Conditions{{Attribute: "__createdtime__", Comparator: "greater_than", Value: SearchValue{Val: "now-1 fortnight"}}}
+	if err := bad.expandTimeMacros(tr, now); err == nil {
+		t.Error("expected an invalid relative time to be rejected")
+	}
+}
+
+// TestQueryTemplating runs analytics queries shaped like those Grafana sends: from a dashboard, with the variables
+// the frontend serialized into scopedVars, and from an alert rule, uninterpolated and without them.
+func TestQueryTemplating(t *testing.T) {
+	start := time.UnixMilli(1_700_000_000_000)
+	fake := newFakeHarperClient()
+	fake.addAnalytics("db-read", []time.Time{start, start.Add(time.Minute)}, map[string]any{"node": "a", "count": 1.0})
+	ds := newTestDatasource(t, Settings{}, fake)
+	tr := backend.TimeRange{From: start.Add(-time.Hour), To: start.Add(time.Hour)}
+
+	for _, tt := range []struct {
+		name string
+		json string
+	}{
+		{"dashboard", `{"refId":"A","datasource":{"type":"harperfast-harper-datasource","uid":"P1"},
+			"operation":"get_analytics","intervalMs":15000,"maxDataPoints":1000,
+			"queryAttrs":{"metric":"$metric","from":1699996400000,"to":1700003600000,
+				"conditions":[{"attribute":"node","comparator":"equals","value":{"val":"a","type":"string"}}]},
+			"scopedVars":{"metric":{"text":"db-read","value":"db-read"}}}`},
+		{"alert rule", `{"refId":"A","datasource":{"type":"harperfast-harper-datasource","uid":"P1"},
+			"operation":"get_analytics","intervalMs":15000,"maxDataPoints":1000,
+			"queryAttrs":{"metric":"db-read","from":"${__from}","to":"${__to}",
+				"conditions":[{"attribute":"node","comparator":"equals","value":{"val":"a","type":"string"}},
+					{"attribute":"id","comparator":"greater_than","value":{"val":"$__from"}}]}}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			query := backend.DataQuery{RefID: "A", TimeRange: tr, MaxDataPoints: 1000, JSON: []byte(tt.json)}
+			resp, err := ds.query(context.Background(), backend.PluginContext{}, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := fake.lastAnalyticsRequest
+			if req.Metric != "db-read" || req.StartTime != tr.From.UnixMilli() || req.EndTime != tr.To.UnixMilli() {
+				t.Errorf("expected db-read over the query's time range, got %+v", req)
+			}
+			for _, c := range req.Conditions {
+				if c.Attribute == "id" && c.Value != tr.From.UnixMilli() {
+					t.Errorf("expected $__from to be the query's start, got %v", c.Value)
+				}
+			}
+			if len(resp.Frames) == 0 || resp.Frames[0].Rows() != 2 {
+				t.Errorf("expected both rows, got %v", resp.Frames)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const defaultMetadataRefreshInterval = 5 * time.Minute
+
+// metricMetadataCache holds the metric list and per-metric descriptions fetched from Harper, so the query editor
+// doesn't have to wait on list_metrics and describe_metric every time it opens.
+type metricMetadataCache struct {
+	mu           sync.RWMutex
+	metrics      []harper.ListMetricsResult
+	descriptions map[string]*harper.DescribeMetricResult
+
+	// units holds the Grafana units of each metric's attributes, from their descriptions.
+	units map[string]map[string]string
+}
+
+func newMetricMetadataCache() *metricMetadataCache {
+	return &metricMetadataCache{
+		descriptions: make(map[string]*harper.DescribeMetricResult),
+		units:        make(map[string]map[string]string),
+	}
+}
+
+// listMetrics returns the cached list of all (builtin and custom) metrics, if it's been fetched.
+func (c *metricMetadataCache) listMetrics() ([]harper.ListMetricsResult, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.metrics, c.metrics != nil
+}
+
+func (c *metricMetadataCache) describeMetric(metric string) (*harper.DescribeMetricResult, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	desc, ok := c.descriptions[metric]
+	return desc, ok
+}
+
+func (c *metricMetadataCache) setDescription(metric string, desc *harper.DescribeMetricResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.descriptions[metric] = desc
+}
+
+func (c *metricMetadataCache) attributeUnits(metric string) (map[string]string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	units, ok := c.units[metric]
+	return units, ok
+}
+
+func (c *metricMetadataCache) setAttributeUnits(metric string, units map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.units[metric] = units
+}
+
+// refresh fetches the full metric list and a description of every metric in it from Harper, replacing the cache
+// contents only once everything has been fetched.
+func (c *metricMetadataCache) refresh(client HarperClient) error {
+	metrics, err := client.ListMetrics(harper.ListMetricsRequest{
+		MetricTypes: []harper.MetricType{harper.MetricTypeBuiltin, harper.MetricTypeCustom},
+	})
+	if err != nil {
+		return err
+	}
+
+	descriptions := make(map[string]*harper.DescribeMetricResult, len(metrics))
+	for _, metric := range metrics {
+		desc, err := client.DescribeMetric(string(metric))
+		if err != nil {
+			return err
+		}
+		descriptions[string(metric)] = desc
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.metrics = metrics
+	c.descriptions = descriptions
+	// units are fetched again as metrics are queried, in case their descriptions changed
+	c.units = make(map[string]map[string]string)
+
+	return nil
+}
+
+// run refreshes the cache immediately and then every interval until ctx is cancelled. An interval <= 0 prefetches
+// once and never refreshes.
+func (c *metricMetadataCache) run(ctx context.Context, client HarperClient, interval time.Duration, logger log.Logger) {
+	for {
+		start := time.Now()
+		if err := c.refresh(client); err != nil {
+			logger.Warn("failed to prefetch Harper metric metadata", "error", err)
+		} else {
+			logger.Debug("prefetched Harper metric metadata", "duration", time.Since(start))
+		}
+
+		if interval <= 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
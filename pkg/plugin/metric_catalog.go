@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	harper "github.com/HarperFast/sdk-go"
+)
+
+// catalogMetric describes one metric in the exported metric catalog.
+type catalogMetric struct {
+	Name       string             `json:"name"`
+	Type       string             `json:"type"`
+	Attributes []catalogAttribute `json:"attributes"`
+}
+
+type catalogAttribute struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Unit string `json:"unit,omitempty"`
+}
+
+type metricCatalogHandler struct {
+	datasource *Datasource
+}
+
+func newMetricCatalogHandler(datasource *Datasource) *metricCatalogHandler {
+	return &metricCatalogHandler{datasource: datasource}
+}
+
+// catalog returns every builtin and custom metric with its attributes and their units, sorted by type and name.
+func (ch *metricCatalogHandler) catalog() ([]catalogMetric, error) {
+	client := ch.datasource.harperClient
+	var catalog []catalogMetric
+
+	for _, metricType := range []struct {
+		name string
+		typ  harper.MetricType
+	}{
+		{"builtin", harper.MetricTypeBuiltin},
+		{"custom", harper.MetricTypeCustom},
+	} {
+		metrics, err := client.ListMetrics(harper.ListMetricsRequest{MetricTypes: []harper.MetricType{metricType.typ}})
+		if err != nil {
+			return nil, err
+		}
+		slices.Sort(metrics)
+
+		for _, metric := range metrics {
+			name := string(metric)
+			desc, ok := ch.datasource.metadata.describeMetric(name)
+			if !ok {
+				desc, err = client.DescribeMetric(name)
+				if err != nil {
+					return nil, err
+				}
+				ch.datasource.metadata.setDescription(name, desc)
+			}
+
+			cm := catalogMetric{Name: name, Type: metricType.name, Attributes: make([]catalogAttribute, 0, len(desc.Attributes))}
+			for _, attr := range desc.Attributes {
+				ca := catalogAttribute{Name: attr.Name, Type: attr.Type}
+				if attr.Type == "number" {
+					ca.Unit = attributeUnit(name, attr.Name)
+				}
+				cm.Attributes = append(cm.Attributes, ca)
+			}
+			catalog = append(catalog, cm)
+		}
+	}
+
+	return catalog, nil
+}
+
+// writeCatalogCSV writes catalog as CSV with one row per metric attribute.
+func writeCatalogCSV(w http.ResponseWriter, catalog []catalogMetric) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"metric", "type", "attribute", "attribute_type", "unit"}); err != nil {
+		return err
+	}
+	for _, metric := range catalog {
+		if len(metric.Attributes) == 0 {
+			if err := cw.Write([]string{metric.Name, metric.Type, "", "", ""}); err != nil {
+				return err
+			}
+		}
+		for _, attr := range metric.Attributes {
+			if err := cw.Write([]string{metric.Name, metric.Type, attr.Name, attr.Type, attr.Unit}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ServeHTTP serves GET /metrics/export, the full metric catalog as JSON or, with ?format=csv, CSV.
+func (ch *metricCatalogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, "unsupported export format '"+format+"': expected 'json' or 'csv'", http.StatusBadRequest)
+		return
+	}
+
+	catalog, err := ch.catalog()
+	if err != nil {
+		ch.datasource.logger.Error("failed to export metric catalog", "error", err)
+		err = asCredentialsError(err, ch.datasource.settings.Username)
+		http.Error(w, err.Error(), int(statusFromError(err)))
+		return
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="harper-metrics.csv"`)
+		if err := writeCatalogCSV(w, catalog); err != nil {
+			ch.datasource.logger.Error("error writing response", "error", err)
+		}
+		return
+	}
+
+	jsonResp, err := json.Marshal(catalog)
+	if err != nil {
+		ch.datasource.logger.Error("error marshaling metric catalog to JSON", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(jsonResp)
+	if err != nil {
+		ch.datasource.logger.Error("error writing response", "error", err)
+	}
+}
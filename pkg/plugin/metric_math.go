@@ -0,0 +1,281 @@
+package plugin
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// MetricMathQuery evaluates Expression, e.g. "A / B * 100", over the named metric operands after aligning them on
+// timestamps: each operand's attribute is aggregated into Interval buckets (a Go duration, defaulting to Grafana's
+// interval), and the expression is evaluated for every bucket all operands have a value in.
+type MetricMathQuery struct {
+	Metrics    map[string]MetricOperand `json:"metrics" validate:"required"`
+	Expression string                   `json:"expression" validate:"required"`
+	From       int64                    `json:"from"`
+	To         int64                    `json:"to"`
+	Interval   string                   `json:"interval"`
+}
+
+// MetricOperand is an attribute of a metric used in a metric math expression. Its rows in each bucket are combined
+// with Aggregation, "sum" by default.
+type MetricOperand struct {
+	Metric      string     `json:"metric" validate:"required"`
+	Attribute   string     `json:"attribute" validate:"required"`
+	Aggregation string     `json:"aggregation"`
+	Conditions  Conditions `json:"conditions"`
+}
+
+func (d *Datasource) queryMetricMath(client HarperClient, refID string, request MetricMathQuery, interval time.Duration) (backend.DataResponse, error) {
+	expr, names, err := parseMathExpr(request.Expression)
+	if err != nil {
+		return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.expression", Problem: err.Error()}
+	}
+	for _, name := range names {
+		if _, ok := request.Metrics[name]; !ok {
+			return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.expression", Problem: fmt.Sprintf("'%s' isn't one of the metrics", name)}
+		}
+	}
+
+	// operands maps each operand's name to its value in each bucket
+	operands := make(map[string]map[int64]float64, len(names))
+	for _, name := range names {
+		operand := request.Metrics[name]
+		aggregation := cmp.Or(operand.Aggregation, "sum")
+		if !slices.Contains(analyticsAggregations, aggregation) {
+			return backend.DataResponse{}, &QueryValidationError{
+				Field:   fmt.Sprintf("queryAttrs.metrics.%s.aggregation", name),
+				Problem: "expected one of " + strings.Join(analyticsAggregations, ", "),
+			}
+		}
+
+		req := harper.GetAnalyticsRequest{
+			Metric:        operand.Metric,
+			GetAttributes: []string{operand.Attribute},
+			StartTime:     request.From,
+			EndTime:       request.To,
+			CoalesceTime:  true,
+		}
+		for _, c := range operand.Conditions {
+			sc, err := c.toSearchCondition()
+			if err != nil {
+				return backend.DataResponse{}, err
+			}
+			req.Conditions = append(req.Conditions, sc)
+		}
+
+		d.logger.Debug("executing Harper operation", "refID", refID, "operation", harper.OP_GET_ANALYTICS, "request", req)
+		start := time.Now()
+		results, usedRollups, err := d.getAnalytics(client, req)
+		if err != nil {
+			return backend.DataResponse{}, fmt.Errorf("could not query Harper analytics for '%s': '%w'", name, err)
+		}
+		d.logger.Debug("Harper operation completed", "refID", refID, "operation", harper.OP_GET_ANALYTICS,
+			"duration", time.Since(start), "results", len(results), "rollups", usedRollups)
+		fixAnalyticsTimes(results, "")
+
+		// only the operand's attribute is kept, so every row is part of one series
+		rows := make([]harper.GetAnalyticsResult, 0, len(results))
+		for _, result := range results {
+			rows = append(rows, harper.GetAnalyticsResult{"id": result["id"], operand.Attribute: numericValue(result[operand.Attribute])})
+		}
+		operands[name] = make(map[int64]float64)
+		for _, row := range aggregateAnalytics(rows, aggregation, interval) {
+			if v, ok := row[operand.Attribute].(float64); ok {
+				operands[name][row["id"].(time.Time).UnixMilli()] = v
+			}
+		}
+	}
+
+	var buckets []int64
+	if len(names) > 0 {
+		for bucket := range operands[names[0]] {
+			if !slices.ContainsFunc(names, func(name string) bool { _, ok := operands[name][bucket]; return !ok }) {
+				buckets = append(buckets, bucket)
+			}
+		}
+	}
+	slices.Sort(buckets)
+
+	times := make([]time.Time, len(buckets))
+	values := make([]*float64, len(buckets))
+	vars := make(map[string]float64, len(names))
+	for i, bucket := range buckets {
+		for _, name := range names {
+			vars[name] = operands[name][bucket]
+		}
+		times[i] = time.UnixMilli(bucket)
+		// division by zero and the like give no value
+		if v := expr(vars); !math.IsNaN(v) && !math.IsInf(v, 0) {
+			values[i] = &v
+		}
+	}
+
+	frame := data.NewFrame(frameName(refID, request.Expression),
+		data.NewField("time", nil, times),
+		data.NewField(request.Expression, nil, values),
+	).SetMeta(&data.FrameMeta{
+		Type:                   data.FrameTypeTimeSeriesWide,
+		TypeVersion:            data.FrameTypeVersion{0, 1},
+		ExecutedQueryString:    request.Expression,
+		PreferredVisualization: data.VisTypeGraph,
+	}).SetRefID(refID)
+	applyFieldNaming(frame, d.settings.FieldNaming)
+	setFieldDisplayHints(frame)
+
+	return backend.DataResponse{Frames: data.Frames{frame}}, nil
+}
+
+// mathExpr is a parsed arithmetic expression, evaluated with the values of its variables.
+type mathExpr func(vars map[string]float64) float64
+
+// parseMathExpr parses an arithmetic expression of numbers, variables, +, -, *, / and parentheses, returning it and
+// the names of its variables in sorted order.
+func parseMathExpr(s string) (mathExpr, []string, error) {
+	p := &mathParser{names: make(map[string]bool)}
+	if err := p.tokenize(s); err != nil {
+		return nil, nil, err
+	}
+	expr, err := p.parseSum()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, nil, fmt.Errorf("unexpected '%s'", p.tokens[p.pos])
+	}
+	return expr, slices.Sorted(maps.Keys(p.names)), nil
+}
+
+type mathParser struct {
+	tokens []string
+	pos    int
+	names  map[string]bool
+}
+
+func (p *mathParser) tokenize(s string) error {
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("+-*/()", r):
+			p.tokens = append(p.tokens, string(r))
+			i++
+		case unicode.IsDigit(r) || r == '.':
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			p.tokens = append(p.tokens, string(runes[i:j]))
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			p.tokens = append(p.tokens, string(runes[i:j]))
+			i = j
+		default:
+			return fmt.Errorf("unexpected '%c'", r)
+		}
+	}
+	return nil
+}
+
+func (p *mathParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// parseSum parses terms separated by + and -.
+func (p *mathParser) parseSum() (mathExpr, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.next(); op == "+" || op == "-"; op = p.next() {
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == "+" {
+			left = func(vars map[string]float64) float64 { return l(vars) + right(vars) }
+		} else {
+			left = func(vars map[string]float64) float64 { return l(vars) - right(vars) }
+		}
+	}
+	return left, nil
+}
+
+// parseProduct parses factors separated by * and /.
+func (p *mathParser) parseProduct() (mathExpr, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.next(); op == "*" || op == "/"; op = p.next() {
+		p.pos++
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == "*" {
+			left = func(vars map[string]float64) float64 { return l(vars) * right(vars) }
+		} else {
+			left = func(vars map[string]float64) float64 { return l(vars) / right(vars) }
+		}
+	}
+	return left, nil
+}
+
+// parseFactor parses a number, variable, negation or parenthesized expression.
+func (p *mathParser) parseFactor() (mathExpr, error) {
+	tok := p.next()
+	p.pos++
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case tok == "-":
+		operand, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return func(vars map[string]float64) float64 { return -operand(vars) }, nil
+	case tok == "(":
+		inner, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("expected ')'")
+		}
+		p.pos++
+		return inner, nil
+	case unicode.IsDigit(rune(tok[0])) || tok[0] == '.':
+		n, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' isn't a number", tok)
+		}
+		return func(map[string]float64) float64 { return n }, nil
+	case unicode.IsLetter(rune(tok[0])) || tok[0] == '_':
+		p.names[tok] = true
+		return func(vars map[string]float64) float64 { return vars[tok] }, nil
+	}
+	return nil, fmt.Errorf("unexpected '%s'", tok)
+}
@@ -0,0 +1,104 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestParseMathExpr(t *testing.T) {
+	vars := map[string]float64{"A": 6, "B": 3}
+	for in, want := range map[string]float64{
+		"A / B * 100":   200,
+		"A + B * 2":     12,
+		"(A + B) * 2":   18,
+		"-(A - 2) * 3":  -12,
+		"A - B - 1":     2,
+		"A / 4":         1.5,
+		"  B*B  /  A  ": 1.5,
+		"A * -B":        -18,
+		"((A))":         6,
+	} {
+		expr, _, err := parseMathExpr(in)
+		if err != nil {
+			t.Errorf("parseMathExpr(%q): %v", in, err)
+			continue
+		}
+		if got := expr(vars); got != want {
+			t.Errorf("%q = %v, want %v", in, got, want)
+		}
+	}
+
+	for _, in := range []string{"", "A +", "(A", "A B", "A % B", "A)"} {
+		if _, _, err := parseMathExpr(in); err == nil {
+			t.Errorf("expected %q to be rejected", in)
+		}
+	}
+}
+
+func metricMathQuery(refID string, attrs map[string]any) backend.DataQuery {
+	queryJSON, _ := json.Marshal(map[string]any{
+		"refId":      refID,
+		"operation":  "metric_math",
+		"queryAttrs": attrs,
+	})
+	return backend.DataQuery{RefID: refID, JSON: queryJSON}
+}
+
+func TestQueryMetricMath(t *testing.T) {
+	client := newFakeHarperClient()
+	start := time.UnixMilli(1_700_000_000_000)
+	client.addAnalytics("errors", []time.Time{start, start.Add(time.Minute)}, map[string]any{"count": 5.0})
+	client.addAnalytics("errors", []time.Time{start.Add(2 * time.Minute)}, map[string]any{"count": 1.0})
+	client.addAnalytics("requests", []time.Time{start, start.Add(time.Minute)}, map[string]any{"count": 50.0})
+	client.addAnalytics("requests", []time.Time{start.Add(2 * time.Minute)}, map[string]any{"count": 0.0})
+	client.addAnalytics("requests", []time.Time{start.Add(3 * time.Minute)}, map[string]any{"count": 10.0})
+	ds := newTestDatasource(t, Settings{}, client)
+
+	res, err := ds.query(context.Background(), backend.PluginContext{}, metricMathQuery("A", map[string]any{
+		"metrics": map[string]any{
+			"E": map[string]any{"metric": "errors", "attribute": "count"},
+			"R": map[string]any{"metric": "requests", "attribute": "count"},
+		},
+		"expression": "E / R * 100",
+		"interval":   "1m",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := res.Frames[0]
+	// the last bucket only has requests, so it's left out
+	if frame.Rows() != 3 {
+		t.Fatalf("expected a row per bucket both metrics have, got %d", frame.Rows())
+	}
+	for i, want := range []*float64{ptr(10.0), ptr(10.0), nil} {
+		got, _ := frame.Fields[1].NullableFloatAt(i)
+		if (got == nil) != (want == nil) || (got != nil && *got != *want) {
+			t.Errorf("expected row %d to be %v, got %v", i, want, got)
+		}
+	}
+
+	for name, attrs := range map[string]map[string]any{
+		"unknown variable": {
+			"metrics":    map[string]any{"E": map[string]any{"metric": "errors", "attribute": "count"}},
+			"expression": "E / R",
+		},
+		"bad expression": {
+			"metrics":    map[string]any{"E": map[string]any{"metric": "errors", "attribute": "count"}},
+			"expression": "E /",
+		},
+		"bad interval": {
+			"metrics":    map[string]any{"E": map[string]any{"metric": "errors", "attribute": "count"}},
+			"expression": "E",
+			"interval":   "-1m",
+		},
+	} {
+		if _, err := ds.query(context.Background(), backend.PluginContext{}, metricMathQuery("B", attrs)); err == nil {
+			t.Errorf("expected a query with a %s to be rejected", name)
+		}
+	}
+}
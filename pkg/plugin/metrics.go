@@ -0,0 +1,17 @@
+package plugin
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Plugin self-metrics. These are registered with the default Prometheus registry, which the plugin SDK exposes to
+// Grafana's plugin metrics endpoint.
+var (
+	healthCheckLatency = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "grafana",
+		Subsystem: "plugin",
+		Name:      "harper_health_check_latency_seconds",
+		Help:      "Round-trip time of the most recent Harper health check, per datasource",
+	}, []string{"datasource_uid"})
+)
@@ -0,0 +1,285 @@
+package plugin
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// readOnlyOperations are the Harper operations the datasource may send without AllowWriteOperations. Anything not
+// listed here (inserts, updates, deletes, DDL, configuration and user management changes, ...) is rejected.
+var readOnlyOperations = []string{
+	harper.OP_CLUSTER_NETWORK,
+	harper.OP_CLUSTER_STATUS,
+	harper.OP_DESCRIBE_ALL,
+	harper.OP_DESCRIBE_DATABASE,
+	harper.OP_DESCRIBE_METRIC,
+	harper.OP_DESCRIBE_SCHEMA,
+	harper.OP_DESCRIBE_TABLE,
+	harper.OP_GET_ANALYTICS,
+	harper.OP_GET_JOB,
+	harper.OP_LIST_METRICS,
+	harper.OP_LIST_ROLES,
+	harper.OP_LIST_USERS,
+	harper.OP_READ_AUDIT_LOG,
+	harper.OP_READ_LOG,
+	harper.OP_READ_TRANSACTION_LOG,
+	harper.OP_REGISTRATION_INFO,
+	harper.OP_SEARCH_BY_CONDITIONS,
+	harper.OP_SEARCH_BY_HASH,
+	harper.OP_SEARCH_BY_ID,
+	harper.OP_SEARCH_BY_VALUE,
+	harper.OP_SEARCH_JOBS,
+	harper.OP_SQL, // SELECT statements only, see checkSQL
+	harper.OP_SYSTEM_INFORMATION,
+	harper.OP_USER_INFO,
+}
+
+// OperationNotAllowedError is returned for operations the datasource's policy doesn't permit.
+type OperationNotAllowedError struct {
+	Operation string
+	Reason    string
+}
+
+func (e *OperationNotAllowedError) Error() string {
+	return fmt.Sprintf("Harper operation '%s' is not allowed: %s", e.Operation, e.Reason)
+}
+
+// AccessRule restricts the databases and tables users with a given Grafana org role may query. Tables are
+// "database.table" patterns where either part may be "*" (e.g. "dev.*"). Roles without a rule are unrestricted.
+// Grafana doesn't pass team memberships to plugins, so rules can only be keyed by role.
+type AccessRule struct {
+	Role   string   `json:"role"`
+	Tables []string `json:"tables"`
+}
+
+// operationInfo is what the policy needs to know about an operation.
+type operationInfo struct {
+	Operation string `json:"operation"`
+	SQL       string `json:"sql"`
+	Database  string `json:"database"`
+	Schema    string `json:"schema"`
+	Table     string `json:"table"`
+}
+
+// policyClient wraps a HarperClient and checks every outgoing operation against the datasource's policy before
+// sending it, whichever query type or code path it came from.
+type policyClient struct {
+	HarperClient
+	allowWrites bool
+	accessRules []AccessRule
+	tenancy     TenancySettings
+
+	// user is the Grafana user the operations are made for, or nil for the datasource's own background work.
+	user *backend.User
+	// tenant is the tenant whose databases operations are mapped to, or "" when tenancy is disabled.
+	tenant string
+}
+
+func newPolicyClient(client HarperClient, settings Settings) *policyClient {
+	return &policyClient{
+		HarperClient: client,
+		allowWrites:  settings.AllowWriteOperations,
+		accessRules:  settings.AccessRules,
+		tenancy:      settings.Tenancy,
+	}
+}
+
+// forUser returns a copy of the client that also enforces user's access rules.
+func (pc *policyClient) forUser(user *backend.User) *policyClient {
+	userClient := *pc
+	userClient.user = user
+	return &userClient
+}
+
+// forTenant returns a copy of the client that maps the databases of every raw operation to tenant's.
+func (pc *policyClient) forTenant(tenant string) *policyClient {
+	tenantClient := *pc
+	tenantClient.tenant = tenant
+	return &tenantClient
+}
+
+// forContext returns a copy of the client whose operations are made under ctx, so cancelling ctx aborts them.
+func (pc *policyClient) forContext(ctx context.Context) *policyClient {
+	boundClient := *pc
+	boundClient.HarperClient = clientWithContext(pc.HarperClient, ctx)
+	return &boundClient
+}
+
+func (pc *policyClient) withContext(ctx context.Context) HarperClient {
+	return pc.forContext(ctx)
+}
+
+// checkOperation returns an *OperationNotAllowedError if op may not be sent.
+func (pc *policyClient) checkOperation(op operationInfo) error {
+	if !pc.allowWrites {
+		if !slices.Contains(readOnlyOperations, op.Operation) {
+			return &OperationNotAllowedError{Operation: op.Operation, Reason: "only read-only operations are permitted"}
+		}
+		if op.Operation == harper.OP_SQL {
+			if err := checkSQL(op.SQL); err != nil {
+				return err
+			}
+		}
+	}
+	if pc.tenant != "" {
+		if err := checkTenantOperation(op.Operation); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := pc.accessRule(); !ok {
+		return nil
+	}
+
+	// Harper may read the database from either key, so both are checked, and a table without either on its own.
+	for _, database := range []string{op.Database, op.Schema} {
+		if database != "" {
+			if err := pc.checkTableAccess(op.Operation, database, op.Table); err != nil {
+				return err
+			}
+		}
+	}
+	if op.Table != "" && op.Database == "" && op.Schema == "" {
+		if err := pc.checkTableAccess(op.Operation, "", op.Table); err != nil {
+			return err
+		}
+	}
+	if op.SQL != "" {
+		tables, ok := sqlTables(op.SQL)
+		if !ok {
+			return &OperationNotAllowedError{
+				Operation: op.Operation,
+				Reason:    fmt.Sprintf("the tables the %s role's SQL queries use must all be known", pc.user.Role),
+			}
+		}
+		for _, table := range tables {
+			if table.database == "" {
+				return &OperationNotAllowedError{
+					Operation: op.Operation,
+					Reason: fmt.Sprintf("the %s role's SQL queries must name the database of table '%s'",
+						pc.user.Role, table.table),
+				}
+			}
+			if err := pc.checkTableAccess(op.Operation, table.database, table.table); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// accessRule returns the access rule for the user's role, if there is a user and their role has one.
+func (pc *policyClient) accessRule() (AccessRule, bool) {
+	if pc.user == nil {
+		return AccessRule{}, false
+	}
+	idx := slices.IndexFunc(pc.accessRules, func(r AccessRule) bool { return strings.EqualFold(r.Role, pc.user.Role) })
+	if idx < 0 {
+		return AccessRule{}, false
+	}
+	return pc.accessRules[idx], true
+}
+
+// checkTableAccess applies the access rule for the user's role, if any, to database.table. An empty table means
+// the whole database.
+func (pc *policyClient) checkTableAccess(op string, database string, table string) error {
+	rule, ok := pc.accessRule()
+	if !ok {
+		return nil
+	}
+
+	for _, pattern := range rule.Tables {
+		dbPattern, tablePattern, _ := strings.Cut(pattern, ".")
+		dbOK, _ := path.Match(dbPattern, database)
+		tableOK, _ := path.Match(cmp.Or(tablePattern, "*"), table)
+		if dbOK && tableOK {
+			return nil
+		}
+	}
+
+	target := database
+	if table != "" {
+		target += "." + table
+	}
+	return &OperationNotAllowedError{
+		Operation: op,
+		Reason:    fmt.Sprintf("the %s role may not query '%s'", pc.user.Role, target),
+	}
+}
+
+// checkSQL allows single SELECT statements only. Semicolons and keywords in quotes and comments are ignored.
+func checkSQL(stmt string) error {
+	tokens, ok := sqlTokens(stmt)
+	if !ok {
+		return &OperationNotAllowedError{
+			Operation: harper.OP_SQL,
+			Reason:    "the statement can't be read: it has an unclosed quote or comment, or a backslash in a string",
+		}
+	}
+	statements := sqlStatements(tokens)
+	if len(statements) > 1 {
+		return &OperationNotAllowedError{Operation: harper.OP_SQL, Reason: "only a single statement is permitted"}
+	}
+	if len(statements) == 0 || !statements[0][0].isWord("select") {
+		return &OperationNotAllowedError{Operation: harper.OP_SQL, Reason: "only SELECT statements are permitted"}
+	}
+	return nil
+}
+
+func (pc *policyClient) GetAnalytics(req harper.GetAnalyticsRequest) ([]harper.GetAnalyticsResult, error) {
+	if err := pc.checkOperation(operationInfo{Operation: harper.OP_GET_ANALYTICS}); err != nil {
+		return nil, err
+	}
+	return pc.HarperClient.GetAnalytics(req)
+}
+
+func (pc *policyClient) ListMetrics(req harper.ListMetricsRequest) ([]harper.ListMetricsResult, error) {
+	if err := pc.checkOperation(operationInfo{Operation: harper.OP_LIST_METRICS}); err != nil {
+		return nil, err
+	}
+	return pc.HarperClient.ListMetrics(req)
+}
+
+func (pc *policyClient) DescribeMetric(metric string) (*harper.DescribeMetricResult, error) {
+	if err := pc.checkOperation(operationInfo{Operation: harper.OP_DESCRIBE_METRIC}); err != nil {
+		return nil, err
+	}
+	return pc.HarperClient.DescribeMetric(metric)
+}
+
+func (pc *policyClient) RawRequest(op harper.Operation, result any) error {
+	var body operationInfo
+	opJSON, err := json.Marshal(op.Prepare())
+	if err != nil {
+		return fmt.Errorf("could not inspect Harper operation: '%w'", err)
+	}
+	if err := json.Unmarshal(opJSON, &body); err != nil {
+		return fmt.Errorf("could not inspect Harper operation: '%w'", err)
+	}
+
+	if err := pc.checkOperation(body); err != nil {
+		return err
+	}
+
+	// Access rules apply to the database names dashboards use, so tenant mapping comes after the policy checks.
+	if pc.tenant != "" {
+		var raw rawOperation
+		if err := json.Unmarshal(opJSON, &raw); err != nil {
+			return fmt.Errorf("could not inspect Harper operation: '%w'", err)
+		}
+		if op, err = pc.tenancy.rewriteForTenant(pc.tenant, raw); err != nil {
+			return err
+		}
+	}
+
+	return pc.HarperClient.RawRequest(op, result)
+}
@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+type testOperation map[string]any
+
+func (o testOperation) Prepare() any {
+	return map[string]any(o)
+}
+
+func TestPolicyClient(t *testing.T) {
+	tests := []struct {
+		name        string
+		op          testOperation
+		allowWrites bool
+		wantAllowed bool
+	}{
+		{"read", testOperation{"operation": "describe_all"}, false, true},
+		{"write", testOperation{"operation": "insert", "table": "dog"}, false, false},
+		{"ddl", testOperation{"operation": "drop_table", "table": "dog"}, false, false},
+		{"select", testOperation{"operation": "sql", "sql": "SELECT * FROM dev.dog;"}, false, true},
+		{"delete", testOperation{"operation": "sql", "sql": "  delete FROM dev.dog"}, false, false},
+		{"stacked", testOperation{"operation": "sql", "sql": "SELECT 1; DROP TABLE dev.dog"}, false, false},
+		{"select on lines", testOperation{"operation": "sql", "sql": "SELECT\n*\nFROM dev.dog"}, false, true},
+		{"select with tabs", testOperation{"operation": "sql", "sql": "\tSELECT\t* FROM dev.dog"}, false, true},
+		{"quoted semicolon", testOperation{"operation": "sql", "sql": "SELECT * FROM dev.dog WHERE name = 'a;b' OR name = 'it''s;'"}, false, true},
+		{"commented semicolon", testOperation{"operation": "sql", "sql": "SELECT * FROM dev.dog -- one; two\n"}, false, true},
+		{"commented select", testOperation{"operation": "sql", "sql": "/* SELECT */ DELETE FROM dev.dog"}, false, false},
+		{"stacked after a string", testOperation{"operation": "sql", "sql": "SELECT 'a'; DELETE FROM dev.dog"}, false, false},
+		{"unclosed quote", testOperation{"operation": "sql", "sql": "SELECT 'a; DELETE FROM dev.dog"}, false, false},
+		{"backslash in a string", testOperation{"operation": "sql", "sql": "SELECT 'a\\'; DELETE FROM dev.dog; SELECT ''"}, false, false},
+		{"override", testOperation{"operation": "insert", "table": "dog"}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeHarperClient()
+			fake.raw = func(map[string]any) (any, error) { return nil, nil }
+			pc := newPolicyClient(fake, Settings{AllowWriteOperations: tt.allowWrites})
+
+			err := pc.RawRequest(tt.op, nil)
+
+			var policyErr *OperationNotAllowedError
+			if tt.wantAllowed && err != nil {
+				t.Errorf("expected operation to be allowed, got: %v", err)
+			}
+			if !tt.wantAllowed && !errors.As(err, &policyErr) {
+				t.Errorf("expected an OperationNotAllowedError, got: %v", err)
+			}
+			if allowed := fake.called(tt.op["operation"].(string)) == 1; allowed != tt.wantAllowed {
+				t.Errorf("expected operation to reach Harper: %v, got: %v", tt.wantAllowed, allowed)
+			}
+		})
+	}
+}
+
+func TestPolicyClientAccessRules(t *testing.T) {
+	settings := Settings{AccessRules: []AccessRule{{Role: "Viewer", Tables: []string{"dev.dog", "metrics.*"}}}}
+
+	tests := []struct {
+		name        string
+		role        string
+		op          testOperation
+		wantAllowed bool
+	}{
+		{"allowed table", "Viewer", testOperation{"operation": "describe_table", "database": "dev", "table": "dog"}, true},
+		{"other table", "Viewer", testOperation{"operation": "describe_table", "database": "dev", "table": "cat"}, false},
+		{"wildcard", "Viewer", testOperation{"operation": "describe_table", "schema": "metrics", "table": "cpu"}, true},
+		{"sql join", "Viewer", testOperation{"operation": "sql", "sql": "SELECT * FROM dev.dog d JOIN hr.salary s ON d.id = s.id"}, false},
+		{"sql comma join", "Viewer", testOperation{"operation": "sql", "sql": "SELECT * FROM dev.dog, hr.salaries"}, false},
+		{"sql aliased comma join", "Viewer", testOperation{"operation": "sql", "sql": "SELECT * FROM dev.dog d, hr.salaries s"}, false},
+		{"sql spaced reference", "Viewer", testOperation{"operation": "sql", "sql": "SELECT * FROM hr . salaries"}, false},
+		{"sql quoted reference", "Viewer", testOperation{"operation": "sql", "sql": "SELECT * FROM `hr`.`salaries`"}, false},
+		{"sql unqualified table", "Viewer", testOperation{"operation": "sql", "sql": "SELECT * FROM salaries"}, false},
+		{"sql subquery", "Viewer", testOperation{"operation": "sql", "sql": "SELECT * FROM (SELECT * FROM hr.salaries) s"}, false},
+		{"sql table function", "Viewer", testOperation{"operation": "sql", "sql": "SELECT * FROM files('hr')"}, false},
+		{"sql allowed tables", "Viewer", testOperation{"operation": "sql", "sql": "SELECT * FROM dev.dog AS d,\n\tmetrics.cpu c JOIN (SELECT id FROM metrics.memory) m ON c.id = m.id WHERE d.name = 'from hr.salaries'"}, true},
+		{"schema and database", "Viewer", testOperation{"operation": "describe_table", "database": "dev", "schema": "hr", "table": "dog"}, false},
+		{"unrestricted role", "Editor", testOperation{"operation": "describe_table", "database": "hr", "table": "salary"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeHarperClient()
+			fake.raw = func(map[string]any) (any, error) { return nil, nil }
+			pc := newPolicyClient(fake, settings).forUser(&backend.User{Login: "someone", Role: tt.role})
+
+			err := pc.RawRequest(tt.op, nil)
+			if tt.wantAllowed && err != nil {
+				t.Errorf("expected operation to be allowed, got: %v", err)
+			}
+			var policyErr *OperationNotAllowedError
+			if !tt.wantAllowed && !errors.As(err, &policyErr) {
+				t.Errorf("expected an OperationNotAllowedError, got: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	previewMaxRows = 10
+	previewTimeout = 2 * time.Second
+)
+
+type previewHandler struct {
+	datasource *Datasource
+}
+
+func newPreviewHandler(datasource *Datasource) *previewHandler {
+	return &previewHandler{datasource: datasource}
+}
+
+type previewColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type previewFrame struct {
+	Name      string          `json:"name"`
+	Columns   []previewColumn `json:"columns"`
+	Rows      [][]any         `json:"rows"`
+	Truncated bool            `json:"truncated"`
+}
+
+type previewResponse struct {
+	Frames []previewFrame `json:"frames"`
+}
+
+// preview runs the query in queryJSON, limited to one more row than it shows, and returns at most previewMaxRows rows
+// of each resulting frame. If the query doesn't finish within previewTimeout, its Harper requests are cancelled and an
+// error is returned.
+func (ph *previewHandler) preview(ctx context.Context, pCtx backend.PluginContext, queryJSON []byte) (*previewResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+	queryJSON = limitPreviewQuery(queryJSON, previewMaxRows+1)
+
+	type result struct {
+		res backend.DataResponse
+		err error
+	}
+	done := make(chan result, 1)
+
+	go func() {
+		res, err := ph.datasource.runQuery(ctx, pCtx, backend.DataQuery{RefID: "preview", JSON: queryJSON})
+		done <- result{res, err}
+	}()
+
+	var r result
+	select {
+	case r = <-done:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("preview did not complete within %s: '%w'", previewTimeout, ctx.Err())
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.res.Error != nil {
+		return nil, r.res.Error
+	}
+
+	resp := &previewResponse{Frames: make([]previewFrame, 0, len(r.res.Frames))}
+	for _, frame := range r.res.Frames {
+		resp.Frames = append(resp.Frames, toPreviewFrame(frame))
+	}
+
+	return resp, nil
+}
+
+// limitPreviewQuery returns queryJSON with its search, SQL or raw search or SQL operation limited to limit rows, so
+// Harper doesn't send the rows the preview won't show. Queries of other operations, or that don't parse, are returned
+// as they are.
+func limitPreviewQuery(queryJSON []byte, limit int) []byte {
+	var query map[string]any
+	if err := json.Unmarshal(queryJSON, &query); err != nil {
+		return queryJSON
+	}
+	attrs, _ := query["queryAttrs"].(map[string]any)
+	if attrs == nil {
+		return queryJSON
+	}
+
+	// (a raw query's operation is its body)
+	name, op := query["operation"], attrs
+	if name == "raw" {
+		if op, _ = attrs["body"].(map[string]any); op == nil {
+			return queryJSON
+		}
+		name = op["operation"]
+	}
+
+	switch name {
+	case harper.OP_SQL:
+		if sql, ok := op["sql"].(string); ok {
+			op["sql"] = limitSQL(sql, limit)
+		}
+	case harper.OP_SEARCH_BY_CONDITIONS, harper.OP_SEARCH_BY_VALUE:
+		if current, ok := op["limit"].(float64); !ok || current <= 0 || int(current) > limit {
+			op["limit"] = limit
+		}
+	default:
+		return queryJSON
+	}
+
+	limited, err := json.Marshal(query)
+	if err != nil {
+		return queryJSON
+	}
+	return limited
+}
+
+// limitSQL returns the SQL statement sql limited to limit rows, lowering its LIMIT clause if it has a higher one or
+// adding one if it has none. Only a LIMIT clause ending the statement, outside subqueries, strings and comments, is
+// the statement's. Statements that can't be read, or whose limit isn't a number, are left as they are.
+func limitSQL(sql string, limit int) string {
+	tokens, ok := sqlTokens(sql)
+	if !ok {
+		return sql
+	}
+	statements := sqlStatements(tokens)
+	if len(statements) != 1 {
+		return sql
+	}
+	stmt := statements[0]
+	// (anything after the last token, such as a semicolon or comment, is left out)
+	end := stmt[len(stmt)-1].end
+
+	depth, limitAt := 0, -1
+	for i, t := range stmt {
+		switch {
+		case t.kind == sqlPunct && t.text == "(":
+			depth++
+		case t.kind == sqlPunct && t.text == ")":
+			depth--
+		case depth == 0 && t.isWord("limit"):
+			limitAt = i
+		}
+	}
+	if limitAt < 0 {
+		return sql[:end] + " LIMIT " + strconv.Itoa(limit)
+	}
+
+	// LIMIT count, LIMIT count OFFSET skip or LIMIT skip, count
+	var count sqlToken
+	switch clause := stmt[limitAt+1:]; {
+	case len(clause) == 1, len(clause) == 3 && clause[1].isWord("offset"):
+		count = clause[0]
+	case len(clause) == 3 && clause[1].kind == sqlPunct && clause[1].text == ",":
+		count = clause[2]
+	default:
+		return sql
+	}
+	current, err := strconv.Atoi(count.text)
+	if count.kind != sqlWord || err != nil {
+		return sql
+	}
+	if current <= limit {
+		return sql[:end]
+	}
+	return sql[:count.start] + strconv.Itoa(limit) + sql[count.end:end]
+}
+
+func toPreviewFrame(frame *data.Frame) previewFrame {
+	pf := previewFrame{
+		Name:    frame.Name,
+		Columns: make([]previewColumn, len(frame.Fields)),
+		Rows:    make([][]any, 0, min(frame.Rows(), previewMaxRows)),
+	}
+
+	for i, field := range frame.Fields {
+		pf.Columns[i] = previewColumn{Name: field.Name, Type: field.Type().ItemTypeString()}
+	}
+
+	rowCount := frame.Rows()
+	if rowCount > previewMaxRows {
+		pf.Truncated = true
+		rowCount = previewMaxRows
+	}
+
+	for i := range rowCount {
+		row := make([]any, len(frame.Fields))
+		for j, field := range frame.Fields {
+			if v, ok := field.ConcreteAt(i); ok {
+				row[j] = v
+			}
+		}
+		pf.Rows = append(pf.Rows, row)
+	}
+
+	return pf
+}
+
+func (ph *previewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		ph.datasource.logger.Error("failed to read preview request body", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pCtx := backend.PluginConfigFromContext(r.Context())
+	resp, err := ph.preview(withRequestHeaders(r.Context(), r.Header), pCtx, body)
+	if err != nil {
+		ph.datasource.logger.Error("failed to preview query", "error", err)
+		err = asCredentialsError(err, ph.datasource.settings.Username)
+		http.Error(w, err.Error(), int(statusFromError(err)))
+		return
+	}
+
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		ph.datasource.logger.Error("error marshaling preview to JSON", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(jsonResp)
+	if err != nil {
+		ph.datasource.logger.Error("error writing response", "error", err)
+	}
+}
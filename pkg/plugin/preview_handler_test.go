@@ -0,0 +1,75 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestPreviewLimit(t *testing.T) {
+	var sent []map[string]any
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] == harper.OP_USER_INFO {
+			// the datasource's connection check, run in the background
+			return map[string]any{}, nil
+		}
+		sent = append(sent, op)
+		records := make([]map[string]any, 50)
+		for i := range records {
+			records[i] = map[string]any{"id": i}
+		}
+		return records, nil
+	}
+	ph := newPreviewHandler(newTestDatasource(t, Settings{}, client))
+
+	for _, tt := range []struct {
+		name  string
+		query string
+		check func(op map[string]any) bool
+	}{
+		// (searches ask for a record more than their limit, to tell whether there are more)
+		{"search", `{"operation": "search_by_conditions", "queryAttrs": {"database": "dev", "table": "dog"}}`,
+			func(op map[string]any) bool { return op["limit"] == float64(previewMaxRows+2) }},
+		{"sql", `{"operation": "sql", "queryAttrs": {"sql": "SELECT id FROM dev.dog;"}}`,
+			func(op map[string]any) bool { return op["sql"] == "SELECT id FROM dev.dog LIMIT 11" }},
+		{"sql with a higher limit", `{"operation": "sql", "queryAttrs": {"sql": "SELECT id FROM dev.dog LIMIT 500 OFFSET 5"}}`,
+			func(op map[string]any) bool { return op["sql"] == "SELECT id FROM dev.dog LIMIT 11 OFFSET 5" }},
+		{"sql with a lower limit", `{"operation": "sql", "queryAttrs": {"sql": "SELECT id FROM dev.dog limit 3"}}`,
+			func(op map[string]any) bool { return op["sql"] == "SELECT id FROM dev.dog limit 3" }},
+		{"sql with a trailing comment", `{"operation": "sql", "queryAttrs": {"sql": "SELECT id FROM dev.dog -- all of them"}}`,
+			func(op map[string]any) bool { return op["sql"] == "SELECT id FROM dev.dog LIMIT 11" }},
+		{"sql with limit in a string", `{"operation": "sql", "queryAttrs": {"sql": "SELECT id FROM dev.dog WHERE name = 'LIMIT 500'"}}`,
+			func(op map[string]any) bool {
+				return op["sql"] == "SELECT id FROM dev.dog WHERE name = 'LIMIT 500' LIMIT 11"
+			}},
+		{"sql with limit in a subquery", `{"operation": "sql", "queryAttrs": {"sql": "SELECT id FROM dev.dog WHERE id IN (SELECT id FROM dev.cat LIMIT 500)"}}`,
+			func(op map[string]any) bool {
+				return op["sql"] == "SELECT id FROM dev.dog WHERE id IN (SELECT id FROM dev.cat LIMIT 500) LIMIT 11"
+			}},
+		{"sql with an offset first", `{"operation": "sql", "queryAttrs": {"sql": "SELECT id FROM dev.dog OFFSET 5 LIMIT 500"}}`,
+			func(op map[string]any) bool { return op["sql"] == "SELECT id FROM dev.dog OFFSET 5 LIMIT 11" }},
+		{"sql with limit skip, count", `{"operation": "sql", "queryAttrs": {"sql": "SELECT id FROM dev.dog LIMIT 5, 500"}}`,
+			func(op map[string]any) bool { return op["sql"] == "SELECT id FROM dev.dog LIMIT 5, 11" }},
+		{"raw search", `{"operation": "raw", "queryAttrs": {"body": {"operation": "search_by_value", "database": "dev", "table": "dog", "search_attribute": "id", "search_value": "*"}}}`,
+			func(op map[string]any) bool { return op["limit"] == float64(previewMaxRows+1) }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sent = nil
+			resp, err := ph.preview(context.Background(), backend.PluginContext{}, []byte(tt.query))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sent) != 1 || !tt.check(sent[0]) {
+				opJSON, _ := json.Marshal(sent)
+				t.Errorf("expected the operation sent to be limited, got %s", opJSON)
+			}
+			if frame := resp.Frames[0]; len(frame.Rows) != previewMaxRows || !frame.Truncated {
+				t.Errorf("expected %d rows, truncated, got %d (truncated: %t)", previewMaxRows, len(frame.Rows), frame.Truncated)
+			}
+		})
+	}
+}
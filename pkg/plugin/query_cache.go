@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// maxQueryCacheEntries bounds the query cache's size; once it's full, responses aren't cached until entries expire.
+const maxQueryCacheEntries = 1000
+
+// queryCache holds successful query responses for a TTL, so auto-refreshing dashboards asking for the same window
+// again are answered without a round trip to Harper.
+type queryCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]queryCacheEntry
+}
+
+type queryCacheEntry struct {
+	// refID is the RefID of the query the response was for.
+	refID    string
+	response backend.DataResponse
+	expires  time.Time
+}
+
+// newQueryCache returns a cache holding responses for ttl, a Go duration string, or nil if ttl is unset or zero.
+func newQueryCache(ttl string) (*queryCache, error) {
+	if ttl == "" {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		return nil, err
+	}
+	if d < 0 {
+		return nil, fmt.Errorf("expected a positive duration, got '%s'", ttl)
+	}
+	if d == 0 {
+		return nil, nil
+	}
+	return &queryCache{ttl: d, entries: make(map[string]queryCacheEntry)}, nil
+}
+
+// key identifies query as run by scope (the user and tenant it's run for): its operation, its model less its RefID,
+// and its time range truncated to the TTL, so refreshes of a relative range within one TTL share an entry.
+func (c *queryCache) key(scope string, query backend.DataQuery) string {
+	var qo queryOperation
+	_ = json.Unmarshal(query.JSON, &qo)
+	bucketed := query
+	bucketed.TimeRange = backend.TimeRange{
+		From: query.TimeRange.From.Truncate(c.ttl),
+		To:   query.TimeRange.To.Truncate(c.ttl),
+	}
+	return scope + "\x00" + qo.Operation + "\x00" + queryKey(bucketed)
+}
+
+// get returns the cached response for key, as the response to the query refID, if there's one that hasn't expired.
+func (c *queryCache) get(key string, refID string) (backend.DataResponse, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok || time.Now().After(entry.expires) {
+		return backend.DataResponse{}, false
+	}
+	return responseForRefID(entry.response, entry.refID, refID), true
+}
+
+// set caches res, the response to the query refID, under key. Failed responses aren't cached.
+func (c *queryCache) set(key string, refID string, res backend.DataResponse) {
+	if res.Error != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= maxQueryCacheEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxQueryCacheEntries {
+			return
+		}
+	}
+	c.entries[key] = queryCacheEntry{refID: refID, response: res, expires: now.Add(c.ttl)}
+}
+
+// cacheScope identifies who a query is run for, since access rules and tenancy make the same query's response
+// differ between users and tenants. ok is false if the tenant can't be resolved, in which case the query isn't
+// cached.
+func (d *Datasource) cacheScope(ctx context.Context, pCtx backend.PluginContext) (string, bool) {
+	tenant, err := d.settings.Tenancy.resolveTenant(ctx, pCtx)
+	if err != nil {
+		return "", false
+	}
+	scope := fmt.Sprintf("%d\x00%s", pCtx.OrgID, tenant)
+	if pCtx.User != nil {
+		scope += "\x00" + pCtx.User.Login + "\x00" + pCtx.User.Role
+	}
+	return scope, true
+}
@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestQueryDataCache(t *testing.T) {
+	var calls atomic.Int32
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "system_information" {
+			return nil, nil
+		}
+		calls.Add(1)
+		return map[string]any{"memory": map[string]any{"total": 1024}}, nil
+	}
+	ds := newTestDatasource(t, Settings{QueryCacheTTL: "1m"}, client)
+
+	now := time.Now().Truncate(time.Minute)
+	query := func(refID string, from time.Time) *backend.QueryDataRequest {
+		return &backend.QueryDataRequest{Queries: []backend.DataQuery{{
+			RefID:     refID,
+			JSON:      json.RawMessage(`{"operation":"system_information","queryAttrs":{}}`),
+			TimeRange: backend.TimeRange{From: from, To: from.Add(time.Hour)},
+		}}}
+	}
+
+	if _, err := ds.QueryData(context.Background(), query("A", now)); err != nil {
+		t.Fatal(err)
+	}
+	// a refresh moments later falls in the same time bucket
+	resp, err := ds.QueryData(context.Background(), query("B", now.Add(time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected the refresh to be served from the cache, got %d system_information calls", got)
+	}
+	if frame := resp.Responses["B"].Frames[0]; frame.RefID != "B" || frame.Name != frameName("B", "system_information") {
+		t.Errorf("expected the cached frame to be the query's own, got RefID %q and name %q", frame.RefID, frame.Name)
+	}
+
+	if _, err := ds.QueryData(context.Background(), query("A", now.Add(time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected a later window to query Harper again, got %d system_information calls", got)
+	}
+}
+
+func TestQueryCacheExpiry(t *testing.T) {
+	cache, err := newQueryCache("1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.set("key", "A", backend.DataResponse{})
+	if _, ok := cache.get("key", "A"); !ok {
+		t.Fatal("expected the response to be cached")
+	}
+
+	entry := cache.entries["key"]
+	entry.expires = time.Now().Add(-time.Second)
+	cache.entries["key"] = entry
+	if _, ok := cache.get("key", "A"); ok {
+		t.Error("expected the expired response not to be served")
+	}
+
+	cache.set("failed", "A", backend.ErrDataResponse(backend.StatusInternal, "boom"))
+	if _, ok := cache.get("failed", "A"); ok {
+		t.Error("expected failed responses not to be cached")
+	}
+}
+
+func TestNewQueryCache(t *testing.T) {
+	for _, ttl := range []string{"", "0s"} {
+		if cache, err := newQueryCache(ttl); err != nil || cache != nil {
+			t.Errorf("expected TTL %q to disable the cache, got %v, %v", ttl, cache, err)
+		}
+	}
+	for _, ttl := range []string{"soon", "-1m"} {
+		if _, err := newQueryCache(ttl); err == nil {
+			t.Errorf("expected TTL %q to be rejected", ttl)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// grafanaQueryFields are the top-level keys Grafana adds to every query model alongside our own. They're
+// accepted as-is and never validated.
+var grafanaQueryFields = []string{
+	"datasource",
+	"datasourceId",
+	"hide",
+	"intervalMs",
+	"key",
+	"maxDataPoints",
+	"queryType",
+	"refId",
+}
+
+// queryModelFields are the optional top-level keys of a query model besides operation and queryAttrs, and their types.
+var queryModelFields = map[string]reflect.Type{
+	"adhocFilters": reflect.TypeFor[[]adhocFilter](),
+	"scopedVars":   reflect.TypeFor[map[string]scopedVar](),
+}
+
+// QueryValidationError describes the first problem found in an incoming query's JSON. Field is the dotted path to
+// the offending field, e.g. "queryAttrs.conditions[0].comparator".
+type QueryValidationError struct {
+	Field   string
+	Problem string
+}
+
+func (e *QueryValidationError) Error() string {
+	return fmt.Sprintf("invalid query field '%s': %s", e.Field, e.Problem)
+}
+
+// parseQueryModel validates raw against the schema for queryModel[Q] and then unmarshals it. Validation rejects
+// unknown fields, missing required fields (tagged `validate:"required"`), and values of the wrong JSON type, naming
+// the offending field in the returned *QueryValidationError. Fields tagged `validate:"required_without=other"` are
+// required unless the other field is set. Variables in queryAttrs' strings are then replaced with their values from
+// scopedVars, if given.
+func parseQueryModel[Q Query](raw json.RawMessage) (queryModel[Q], error) {
+	var qm queryModel[Q]
+
+	if err := validateQueryJSON(raw, reflect.TypeFor[Q]()); err != nil {
+		return qm, err
+	}
+
+	if err := json.Unmarshal(raw, &qm); err != nil {
+		return qm, fmt.Errorf("could not unmarshal query JSON: '%w'", err)
+	}
+
+	if len(qm.ScopedVars) > 0 {
+		var top struct {
+			QueryAttrs any `json:"queryAttrs"`
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&top); err != nil {
+			return qm, fmt.Errorf("could not unmarshal query JSON: '%w'", err)
+		}
+		attrs, err := json.Marshal(interpolateVariables(top.QueryAttrs, qm.ScopedVars))
+		if err != nil {
+			return qm, fmt.Errorf("could not interpolate query variables: '%w'", err)
+		}
+		var interpolated Q
+		if err := json.Unmarshal(attrs, &interpolated); err != nil {
+			return qm, fmt.Errorf("could not unmarshal query JSON: '%w'", err)
+		}
+		qm.QueryAttrs = interpolated
+	}
+
+	return qm, nil
+}
+
+// validateQueryJSON checks the top level of a query model (operation, queryAttrs and the Grafana-managed fields) and
+// then validates queryAttrs against attrsType.
+func validateQueryJSON(raw json.RawMessage, attrsType reflect.Type) error {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &top); err != nil {
+		return &QueryValidationError{Field: "(root)", Problem: "expected a JSON object"}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(top)) {
+		if key != "operation" && key != "queryAttrs" && !slices.Contains(grafanaQueryFields, key) {
+			if _, ok := queryModelFields[key]; !ok {
+				return &QueryValidationError{Field: key, Problem: "unknown field"}
+			}
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(queryModelFields)) {
+		if v, ok := top[key]; ok {
+			if err := validateJSONValue(key, v, queryModelFields[key]); err != nil {
+				return err
+			}
+		}
+	}
+
+	op, ok := top["operation"]
+	if !ok || isJSONNull(op) {
+		return &QueryValidationError{Field: "operation", Problem: "is required"}
+	}
+	if err := validateJSONValue("operation", op, reflect.TypeFor[string]()); err != nil {
+		return err
+	}
+
+	attrs, ok := top["queryAttrs"]
+	if !ok || isJSONNull(attrs) {
+		return &QueryValidationError{Field: "queryAttrs", Problem: "is required"}
+	}
+
+	return validateJSONValue("queryAttrs", attrs, attrsType)
+}
+
+// jsonValidator is implemented by query field types that accept more than their kind's JSON values, to validate them.
+type jsonValidator interface {
+	validateJSON(path string, raw json.RawMessage) error
+}
+
+// validateJSONValue recursively checks that raw can be decoded into a value of type t without any surprises. JSON
+// null is accepted everywhere (and treated as absent for required fields).
+func validateJSONValue(path string, raw json.RawMessage, t reflect.Type) error {
+	raw = bytes.TrimSpace(raw)
+	if isJSONNull(raw) {
+		return nil
+	}
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if v, ok := reflect.New(t).Interface().(jsonValidator); ok {
+		return v.validateJSON(path, raw)
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return typeMismatch(path, "object", raw)
+		}
+
+		fields := jsonFields(t)
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			f, ok := fields[key]
+			if !ok {
+				return &QueryValidationError{Field: joinPath(path, key), Problem: "unknown field"}
+			}
+			if err := validateJSONValue(joinPath(path, key), obj[key], f.Type); err != nil {
+				return err
+			}
+		}
+
+		present := func(name string) bool {
+			v, ok := obj[name]
+			return ok && !isJSONNull(v)
+		}
+		for _, name := range slices.Sorted(maps.Keys(fields)) {
+			rule := fields[name].Tag.Get("validate")
+			if other, ok := strings.CutPrefix(rule, "required_without="); ok {
+				if !present(name) && !present(other) {
+					return &QueryValidationError{Field: joinPath(path, name), Problem: "is required unless " + other + " is set"}
+				}
+				continue
+			}
+			if rule == "required" && !present(name) {
+				return &QueryValidationError{Field: joinPath(path, name), Problem: "is required"}
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return typeMismatch(path, "array", raw)
+		}
+		for i, elem := range elems {
+			if err := validateJSONValue(fmt.Sprintf("%s[%d]", path, i), elem, t.Elem()); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return typeMismatch(path, "object", raw)
+		}
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			if err := validateJSONValue(joinPath(path, key), obj[key], t.Elem()); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		if raw[0] != '"' {
+			return typeMismatch(path, "string", raw)
+		}
+	case reflect.Bool:
+		if !bytes.Equal(raw, []byte("true")) && !bytes.Equal(raw, []byte("false")) {
+			return typeMismatch(path, "boolean", raw)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if _, err := strconv.ParseInt(string(raw), 10, 64); err != nil {
+			return typeMismatch(path, "integer", raw)
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(string(raw), 64); err != nil {
+			return typeMismatch(path, "number", raw)
+		}
+	case reflect.Interface:
+		// any JSON value is acceptable
+	default:
+		return fmt.Errorf("no query validation rule for field '%s' of kind %s", path, t.Kind())
+	}
+
+	return nil
+}
+
+// jsonFields maps the JSON names of t's exported fields to their struct fields.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+func typeMismatch(path string, expected string, raw json.RawMessage) error {
+	return &QueryValidationError{Field: path, Problem: fmt.Sprintf("expected %s, got %s", expected, jsonKind(raw))}
+}
+
+func jsonKind(raw json.RawMessage) string {
+	switch raw[0] {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "boolean"
+	default:
+		return "number"
+	}
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return len(raw) == 0 || bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestParseQueryModel(t *testing.T) {
+	tests := []struct {
+		name      string
+		json      string
+		wantField string
+	}{
+		{
+			name: "valid",
+			json: `{"refId":"A","operation":"get_analytics","queryAttrs":{"metric":"db-read","from":1,"to":2,
+				"conditions":[{"id":"condition-1","attribute":"node","comparator":"equals","value":{"val":"a","type":"string"}}]}}`,
+		},
+		{
+			name:      "missing operation",
+			json:      `{"queryAttrs":{"metric":"db-read"}}`,
+			wantField: "operation",
+		},
+		{
+			name:      "unknown top-level field",
+			json:      `{"operation":"get_analytics","bogus":true,"queryAttrs":{"metric":"db-read"}}`,
+			wantField: "bogus",
+		},
+		{
+			name:      "missing required attr",
+			json:      `{"operation":"get_analytics","queryAttrs":{"from":1}}`,
+			wantField: "queryAttrs.metric",
+		},
+		{
+			// (as the query editor saves them, and alert rules send them)
+			name: "uninterpolated time range",
+			json: `{"operation":"get_analytics","queryAttrs":{"metric":"db-read","from":"${__from}","to":"$__to"}}`,
+		},
+		{
+			name:      "wrong type",
+			json:      `{"operation":"get_analytics","queryAttrs":{"metric":"db-read","from":"yesterday"}}`,
+			wantField: "queryAttrs.from",
+		},
+		{
+			name:      "wrong nested type",
+			json:      `{"operation":"get_analytics","queryAttrs":{"metric":"db-read","topK":"3"}}`,
+			wantField: "queryAttrs.topK",
+		},
+		{
+			name:      "malformed scoped vars",
+			json:      `{"operation":"get_analytics","scopedVars":{"node":"a"},"queryAttrs":{"metric":"db-read"}}`,
+			wantField: "scopedVars.node",
+		},
+		{
+			name:      "unknown nested field",
+			json:      `{"operation":"get_analytics","queryAttrs":{"metric":"db-read","conditions":[{"attr":"node"}]}}`,
+			wantField: "queryAttrs.conditions[0].attr",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseQueryModel[GetAnalyticsQuery]([]byte(tt.json))
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var vErr *QueryValidationError
+			if !errors.As(err, &vErr) {
+				t.Fatalf("expected a QueryValidationError, got: %v", err)
+			}
+			if vErr.Field != tt.wantField {
+				t.Errorf("expected error for field '%s', got '%s'", tt.wantField, vErr.Field)
+			}
+		})
+	}
+}
+
+func TestParseQueryModelTimeRange(t *testing.T) {
+	qm, err := parseQueryModel[GetAnalyticsQuery]([]byte(`{"operation":"get_analytics",
+		"queryAttrs":{"metric":"db-read","from":"${__from}","to":"1700000000000"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qm.QueryAttrs.From != 0 || qm.QueryAttrs.To != 1_700_000_000_000 {
+		t.Errorf("expected ${__from} to be unset and the numeric string to be read, got %d and %d",
+			qm.QueryAttrs.From, qm.QueryAttrs.To)
+	}
+
+	tr := backend.TimeRange{From: time.UnixMilli(1_600_000_000_000), To: time.UnixMilli(1_800_000_000_000)}
+	if from, to := timeRangeMillis(qm.QueryAttrs.From, qm.QueryAttrs.To, tr); from != 1_600_000_000_000 || to != 1_700_000_000_000 {
+		t.Errorf("expected the unset start to be the query's, got %d and %d", from, to)
+	}
+}
+
+func TestParseQueryModelScopedVars(t *testing.T) {
+	qm, err := parseQueryModel[SearchByConditionsQuery]([]byte(`{"operation":"search_by_conditions",
+		"scopedVars":{"db":{"text":"dev","value":"dev"},"node":{"text":"All","value":["node-1","node-2"]}},
+		"queryAttrs":{"database":"$db","table":"[[db]]_dogs","limit":10,
+			"conditions":[{"attribute":"node","comparator":"in","value":{"val":"${node:csv}","type":"string"}},
+				{"attribute":"__createdtime__","comparator":"greater_than","value":{"val":"$__from"}}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attrs := qm.QueryAttrs
+	if attrs.Database != "dev" || attrs.Table != "dev_dogs" || attrs.Limit != 10 {
+		t.Errorf("expected the database and table to be interpolated, got %+v", attrs)
+	}
+	if v := attrs.Conditions[0].Value.Val; v != "{node-1,node-2}" {
+		t.Errorf("expected the multi-value variable to be interpolated, got %v", v)
+	}
+	if v := attrs.Conditions[1].Value.Val; v != "$__from" {
+		t.Errorf("expected unknown variables to be left alone, got %v", v)
+	}
+}
@@ -0,0 +1,102 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// RawQuery sends Body, an arbitrary Harper operation, for operations the query editor doesn't model yet. Only the
+// operations in the datasource's raw operation allowlist may be sent.
+type RawQuery struct {
+	Body map[string]any `json:"body" validate:"required"`
+}
+
+// rawUserOperations are the read-only operations raw queries can't send, since their responses include users'
+// password hashes. The users and roles query types return the same records without them.
+var rawUserOperations = []string{harper.OP_LIST_ROLES, harper.OP_LIST_USERS, harper.OP_USER_INFO}
+
+// rawOperationAllowlist returns the operations raw queries may send: the configured ones, or else every read-only
+// operation but the user and role ones.
+func (d *Datasource) rawOperationAllowlist() []string {
+	if len(d.settings.RawOperations) > 0 {
+		return d.settings.RawOperations
+	}
+	return slices.DeleteFunc(slices.Clone(readOnlyOperations), func(op string) bool {
+		return slices.Contains(rawUserOperations, op)
+	})
+}
+
+// checkRawOperations checks that every operation in a raw operation allowlist is read-only and doesn't return users.
+func checkRawOperations(operations []string) error {
+	for _, op := range operations {
+		if !slices.Contains(readOnlyOperations, op) {
+			return fmt.Errorf("'%s' isn't a read-only operation", op)
+		}
+		if slices.Contains(rawUserOperations, op) {
+			return fmt.Errorf("'%s' can't be sent as a raw query, use the users and roles queries instead", op)
+		}
+	}
+	return nil
+}
+
+// queryRaw sends a raw query's operation and returns the response as a table frame: a row per element of an array
+// response, or a single row for an object. Elements that aren't objects, and scalar responses, are returned in a
+// "value" field.
+func (d *Datasource) queryRaw(client HarperClient, refID string, request RawQuery) (backend.DataResponse, error) {
+	name, _ := request.Body["operation"].(string)
+	if name == "" {
+		return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.body.operation", Problem: "is required"}
+	}
+	if !slices.Contains(d.rawOperationAllowlist(), name) {
+		return backend.DataResponse{}, &OperationNotAllowedError{Operation: name, Reason: "not in the raw operation allowlist"}
+	}
+	op := rawOperation(request.Body)
+
+	d.logger.Debug("executing Harper operation", "refID", refID, "operation", name, "request", op)
+	start := time.Now()
+	var raw json.RawMessage
+	if err := client.RawRequest(op, &raw); err != nil {
+		return backend.DataResponse{}, fmt.Errorf("could not run Harper operation '%s': '%w'", name, err)
+	}
+	d.logger.Debug("Harper operation completed", "refID", refID, "operation", name, "duration", time.Since(start))
+
+	var rows []json.RawMessage
+	raw = bytes.TrimSpace(raw)
+	switch {
+	case len(raw) > 0 && raw[0] == '[':
+		if err := json.Unmarshal(raw, &rows); err != nil {
+			return backend.DataResponse{}, fmt.Errorf("could not decode Harper response: '%w'", err)
+		}
+	case len(raw) > 0:
+		rows = []json.RawMessage{raw}
+	}
+	for i, row := range rows {
+		if row[0] != '{' {
+			rows[i] = json.RawMessage(`{"value":` + string(row) + `}`)
+		}
+	}
+
+	records, columns, err := decodeRecords(rows)
+	if err != nil {
+		return backend.DataResponse{}, fmt.Errorf("could not decode Harper response: '%w'", err)
+	}
+	frame, err := recordsToFrame(frameName(refID, name), records, columns)
+	if err != nil {
+		return backend.DataResponse{}, err
+	}
+
+	body, _ := json.Marshal(request.Body)
+	frame.SetRefID(refID)
+	frame.SetMeta(&data.FrameMeta{ExecutedQueryString: string(body), PreferredVisualization: data.VisTypeTable})
+	applyFieldNaming(frame, d.settings.FieldNaming)
+	setFieldDisplayHints(frame)
+
+	return backend.DataResponse{Frames: data.Frames{frame}}, nil
+}
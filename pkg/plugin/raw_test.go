@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func rawQuery(body map[string]any) backend.DataQuery {
+	queryJSON, _ := json.Marshal(map[string]any{"operation": "raw", "queryAttrs": map[string]any{"body": body}})
+	return backend.DataQuery{RefID: "A", JSON: queryJSON}
+}
+
+func TestQueryRaw(t *testing.T) {
+	var sent map[string]any
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] == "user_info" {
+			// the datasource's background credentials check
+			return nil, nil
+		}
+		sent = op
+		switch op["operation"] {
+		case "cluster_status":
+			return map[string]any{"node_name": "node-1", "is_enabled": true}, nil
+		case "search_by_hash":
+			return []any{map[string]any{"id": 1, "name": "Harper"}, "not a record"}, nil
+		}
+		return nil, nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	res, err := ds.query(context.Background(), backend.PluginContext{}, rawQuery(map[string]any{"operation": "cluster_status"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := res.Frames[0]
+	if frame.Name != "A: cluster_status" || frame.Rows() != 1 || len(frame.Fields) != 2 {
+		t.Errorf("expected a single row of the object's attributes, got %d rows of %d fields in '%s'",
+			frame.Rows(), len(frame.Fields), frame.Name)
+	}
+
+	res, err = ds.query(context.Background(), backend.PluginContext{}, rawQuery(map[string]any{
+		"operation": "search_by_hash", "database": "dev", "table": "dog", "hash_values": []any{1},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent["table"] != "dog" {
+		t.Errorf("expected the body to be sent as it is, got %v", sent)
+	}
+	frame = res.Frames[0]
+	if frame.Rows() != 2 {
+		t.Fatalf("expected a row per element, got %d", frame.Rows())
+	}
+	if field, _ := frame.FieldByName("value"); field == nil || field.Type() != data.FieldTypeNullableString {
+		t.Errorf("expected the non-record element in a value field, got %v", field)
+	}
+
+	var notAllowed *OperationNotAllowedError
+	if _, err := ds.query(context.Background(), backend.PluginContext{}, rawQuery(map[string]any{"operation": "drop_table"})); !errors.As(err, &notAllowed) {
+		t.Errorf("expected a write operation to be rejected, got %v", err)
+	}
+	var vErr *QueryValidationError
+	if _, err := ds.query(context.Background(), backend.PluginContext{}, rawQuery(map[string]any{"table": "dog"})); !errors.As(err, &vErr) {
+		t.Errorf("expected a body without an operation to be rejected, got %v", err)
+	}
+}
+
+func TestRawOperationAllowlist(t *testing.T) {
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) { return []any{}, nil }
+	ds := newTestDatasource(t, Settings{RawOperations: []string{"cluster_status"}}, client)
+
+	if _, err := ds.query(context.Background(), backend.PluginContext{}, rawQuery(map[string]any{"operation": "cluster_status"})); err != nil {
+		t.Errorf("expected an allowed operation to run, got %v", err)
+	}
+	var notAllowed *OperationNotAllowedError
+	if _, err := ds.query(context.Background(), backend.PluginContext{}, rawQuery(map[string]any{"operation": "describe_all"})); !errors.As(err, &notAllowed) {
+		t.Errorf("expected an operation outside the allowlist to be rejected, got %v", err)
+	}
+
+	if _, err := newDatasource("test-uid", Settings{RawOperations: []string{"drop_table"}}, client); err == nil {
+		t.Error("expected a write operation in the allowlist to be rejected")
+	}
+	if _, err := newDatasource("test-uid", Settings{RawOperations: []string{"list_users"}}, client); err == nil {
+		t.Error("expected a user operation in the allowlist to be rejected")
+	}
+}
+
+func TestRawUserOperations(t *testing.T) {
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		return []any{map[string]any{"username": "admin", "password": "hash"}}, nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	for _, name := range []string{"list_users", "list_roles", "user_info"} {
+		var notAllowed *OperationNotAllowedError
+		if _, err := ds.query(context.Background(), backend.PluginContext{}, rawQuery(map[string]any{"operation": name})); !errors.As(err, &notAllowed) {
+			t.Errorf("expected a raw %s query to be rejected by default, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// RecordingRule is a heavy query that the datasource runs on a schedule, caching the result for dashboards to read
+// with a get_recorded query instead of hitting Harper on every refresh. Query is a query model as the query editor
+// saves it; if Range is set, its from/to are moved to the Range leading up to each run. Rules run as the datasource
+// itself and their results are shared by every user, so per-role access rules don't apply to them and they aren't
+// available in multi-tenant mode.
+type RecordingRule struct {
+	Name     string          `json:"name"`
+	Interval string          `json:"interval"`
+	Range    string          `json:"range"`
+	Query    json.RawMessage `json:"query"`
+}
+
+type RecordedQuery struct {
+	Rule string `json:"rule" validate:"required"`
+}
+
+// recordedResult is the outcome of a recording rule's latest run.
+type recordedResult struct {
+	response   backend.DataResponse
+	err        error
+	recordedAt time.Time
+}
+
+type recordingRule struct {
+	RecordingRule
+	interval  time.Duration
+	timeRange time.Duration
+}
+
+// recordingRules runs the datasource's recording rules and holds their latest results.
+type recordingRules struct {
+	rules []recordingRule
+
+	mu      sync.RWMutex
+	results map[string]recordedResult
+}
+
+func newRecordingRules(rules []RecordingRule) (*recordingRules, error) {
+	rr := &recordingRules{results: make(map[string]recordedResult)}
+
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("recording rule has no name")
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("duplicate recording rule '%s'", rule.Name)
+		}
+		seen[rule.Name] = true
+
+		interval, err := time.ParseDuration(rule.Interval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid interval '%s' for recording rule '%s'", rule.Interval, rule.Name)
+		}
+
+		var timeRange time.Duration
+		if rule.Range != "" {
+			timeRange, err = time.ParseDuration(rule.Range)
+			if err != nil || timeRange <= 0 {
+				return nil, fmt.Errorf("invalid range '%s' for recording rule '%s'", rule.Range, rule.Name)
+			}
+		}
+
+		rr.rules = append(rr.rules, recordingRule{RecordingRule: rule, interval: interval, timeRange: timeRange})
+	}
+
+	return rr, nil
+}
+
+// run evaluates every rule immediately and then every rule's interval until ctx is cancelled.
+func (rr *recordingRules) run(ctx context.Context, d *Datasource, logger log.Logger) {
+	for _, rule := range rr.rules {
+		go func() {
+			for {
+				rr.evaluate(ctx, d, rule, logger)
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(rule.interval):
+				}
+			}
+		}()
+	}
+}
+
+func (rr *recordingRules) evaluate(ctx context.Context, d *Datasource, rule recordingRule, logger log.Logger) {
+	start := time.Now()
+
+	queryJSON, err := rule.queryJSON(start)
+	var res backend.DataResponse
+	if err == nil {
+		res, err = d.query(ctx, backend.PluginContext{}, backend.DataQuery{RefID: rule.Name, JSON: queryJSON})
+	}
+	if err != nil {
+		logger.Warn("recording rule failed", "rule", rule.Name, "error", err)
+	} else {
+		logger.Debug("recording rule evaluated", "rule", rule.Name, "duration", time.Since(start))
+	}
+
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.results[rule.Name] = recordedResult{response: res, err: err, recordedAt: start}
+}
+
+// queryJSON returns the rule's query with its time range moved to end at now.
+func (r recordingRule) queryJSON(now time.Time) (json.RawMessage, error) {
+	if r.timeRange == 0 {
+		return r.Query, nil
+	}
+
+	var qm map[string]any
+	if err := json.Unmarshal(r.Query, &qm); err != nil {
+		return nil, fmt.Errorf("could not unmarshal recording rule query: '%w'", err)
+	}
+	attrs, ok := qm["queryAttrs"].(map[string]any)
+	if !ok {
+		return nil, &QueryValidationError{Field: "queryAttrs", Problem: "is required"}
+	}
+	attrs["from"] = now.Add(-r.timeRange).UnixMilli()
+	attrs["to"] = now.UnixMilli()
+
+	return json.Marshal(qm)
+}
+
+// result returns the latest result of the named rule for refID.
+func (rr *recordingRules) result(name string, refID string) (backend.DataResponse, error) {
+	rr.mu.RLock()
+	recorded, ok := rr.results[name]
+	rr.mu.RUnlock()
+
+	if !ok {
+		for _, rule := range rr.rules {
+			if rule.Name == name {
+				return backend.DataResponse{}, fmt.Errorf("recording rule '%s' hasn't been evaluated yet", name)
+			}
+		}
+		return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.rule", Problem: fmt.Sprintf("no recording rule named '%s'", name)}
+	}
+	if recorded.err != nil {
+		return backend.DataResponse{}, fmt.Errorf("recording rule '%s' failed at %s: '%w'", name, recorded.recordedAt.Format(time.RFC3339), recorded.err)
+	}
+
+	// The recorded frames are shared between queries, so each response gets its own shallow copies.
+	var response backend.DataResponse
+	for _, frame := range recorded.response.Frames {
+		meta := data.FrameMeta{}
+		if frame.Meta != nil {
+			meta = *frame.Meta
+		}
+		meta.Notices = append(meta.Notices[:len(meta.Notices):len(meta.Notices)], data.Notice{
+			Severity: data.NoticeSeverityInfo,
+			Text:     fmt.Sprintf("Precomputed by recording rule '%s' at %s", name, recorded.recordedAt.Format(time.RFC3339)),
+		})
+
+		response.Frames = append(response.Frames, &data.Frame{
+			Name:   frame.Name,
+			Fields: frame.Fields,
+			RefID:  refID,
+			Meta:   &meta,
+		})
+	}
+
+	return response, nil
+}
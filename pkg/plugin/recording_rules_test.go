@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestRecordingRules(t *testing.T) {
+	client := newFakeHarperClient()
+	now := time.Now()
+	client.addAnalytics("db-read", []time.Time{now.Add(-2 * time.Hour), now.Add(-time.Minute)}, map[string]any{"node": "node-1", "count": 5.0})
+
+	ruleQuery, _ := json.Marshal(map[string]any{
+		"operation":  "get_analytics",
+		"queryAttrs": map[string]any{"metric": "db-read"},
+	})
+	ds := newTestDatasource(t, Settings{RecordingRules: []RecordingRule{
+		{Name: "hourly-reads", Interval: "1h", Range: "1h", Query: ruleQuery},
+	}}, client)
+
+	rule := ds.recording.rules[0]
+	ds.recording.evaluate(context.Background(), ds, rule, ds.logger)
+
+	recordedJSON, _ := json.Marshal(map[string]any{
+		"operation":  "get_recorded",
+		"queryAttrs": map[string]any{"rule": "hourly-reads"},
+	})
+	res, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "B", JSON: recordedJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Frames) != 1 || res.Frames[0].Rows() != 1 || res.Frames[0].RefID != "B" {
+		t.Fatalf("expected one frame with the last hour's row for refID B, got %v", res.Frames)
+	}
+	if len(res.Frames[0].Meta.Notices) != 1 {
+		t.Errorf("expected a notice that the result was precomputed")
+	}
+
+	missingJSON, _ := json.Marshal(map[string]any{
+		"operation":  "get_recorded",
+		"queryAttrs": map[string]any{"rule": "daily-reads"},
+	})
+	if _, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "C", JSON: missingJSON}); err == nil {
+		t.Errorf("expected an error for an unknown rule")
+	}
+}
@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"fmt"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// queryRegistrationInfo returns the Harper license as a single-row frame. Days until expiration and the RAM
+// allocation are numeric so alert rules can threshold them.
+func (d *Datasource) queryRegistrationInfo(client HarperClient, refID string) (backend.DataResponse, error) {
+	op := simpleOperation{Operation: harper.OP_REGISTRATION_INFO}
+
+	d.logger.Debug("executing Harper operation", "refID", refID, "operation", op.Operation)
+	start := time.Now()
+	var info harper.RegistrationInfoResponse
+	if err := client.RawRequest(op, &info); err != nil {
+		return backend.DataResponse{}, fmt.Errorf("could not get Harper registration info: '%w'", err)
+	}
+	d.logger.Debug("Harper operation completed", "refID", refID, "operation", op.Operation, "duration", time.Since(start))
+
+	var expiration *time.Time
+	var daysLeft *float64
+	if t, err := parseLicenseDate(info.LicenseExpirationDate); err == nil {
+		days := t.Sub(start).Hours() / 24
+		expiration, daysLeft = &t, &days
+	} else if info.LicenseExpirationDate != "" {
+		d.logger.Warn("could not parse Harper license expiration date", "date", info.LicenseExpirationDate, "error", err)
+	}
+
+	frame := data.NewFrame(frameName(refID, "registration"),
+		data.NewField("time", nil, []time.Time{start}),
+		data.NewField("version", nil, []string{info.Version}),
+		data.NewField("registered", nil, []bool{info.Registered}),
+		data.NewField("storage type", nil, []string{info.StorageType}),
+		data.NewField("ram allocation", nil, []int64{int64(info.RAMAllocation)}).
+			SetConfig(&data.FieldConfig{Unit: "decmbytes"}),
+		data.NewField("license expiration", nil, []*time.Time{expiration}),
+		data.NewField("days until expiration", nil, []*float64{daysLeft}).SetConfig(&data.FieldConfig{Unit: "d"}),
+	).SetRefID(refID)
+
+	return backend.DataResponse{Frames: data.Frames{frame}}, nil
+}
+
+// parseLicenseDate parses a license expiration date, which Harper reports either as a date or a timestamp.
+func parseLicenseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(harper.DATE_FORMAT, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,42 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestQueryRegistrationInfo(t *testing.T) {
+	expires := time.Now().AddDate(0, 0, 10).UTC().Format("2006-01-02")
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "registration_info" {
+			return nil, nil
+		}
+		return json.RawMessage(`{"registered":true,"version":"4.4.0","storage_type":"lmdb","ram_allocation":2048,` +
+			`"license_expiration_date":"` + expires + `"}`), nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	queryJSON, _ := json.Marshal(map[string]any{"operation": "registration_info"})
+	res, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: queryJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := res.Frames[0]
+	if frame.Rows() != 1 {
+		t.Fatalf("expected 1 row, got %d", frame.Rows())
+	}
+	ram, _ := frame.FieldByName("ram allocation")
+	if ram.At(0) != int64(2048) {
+		t.Errorf("expected a RAM allocation of 2048, got %v", ram.At(0))
+	}
+	days, _ := frame.FieldByName("days until expiration")
+	if v, _ := days.NullableFloatAt(0); v == nil || *v < 9 || *v > 10 {
+		t.Errorf("expected 9-10 days until expiration, got %v", v)
+	}
+}
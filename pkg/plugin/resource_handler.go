@@ -1,22 +1,41 @@
 package plugin
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	harper "github.com/HarperFast/sdk-go"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
-	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+	"golang.org/x/sync/singleflight"
 	"net/http"
 	"slices"
 	"strconv"
+	"sync"
+	"time"
 )
 
+// metricListCacheTTL is how long metric lists the metadata cache doesn't hold (those of only some metric types or
+// with a custom metrics window) are kept, so the query editors of a dashboard's panels share one fetch.
+const metricListCacheTTL = 30 * time.Second
+
 type metricsHandler struct {
 	datasource *Datasource
+
+	// calls collapses concurrent identical metadata calls into one Harper request.
+	calls singleflight.Group
+
+	mu    sync.Mutex
+	lists map[string]cachedMetricList
+}
+
+type cachedMetricList struct {
+	metrics []harper.ListMetricsResult
+	expires time.Time
 }
 
 func newMetricsHandler(datasource *Datasource) *metricsHandler {
-	return &metricsHandler{datasource: datasource}
+	return &metricsHandler{datasource: datasource, lists: make(map[string]cachedMetricList)}
 }
 
 func (d *Datasource) newResourceHandler() backend.CallResourceHandler {
@@ -25,14 +44,34 @@ func (d *Datasource) newResourceHandler() backend.CallResourceHandler {
 	mh := newMetricsHandler(d)
 	mux.Handle("/metrics", mh)
 	mux.Handle("/metrics/{metric}", mh)
+	// more specific than /metrics/{metric}, so it shadows a metric named "export"
+	mux.Handle("/metrics/export", newMetricCatalogHandler(d))
+	mux.Handle("/preview", newPreviewHandler(d))
+	mux.Handle("/alert-preview", newAlertPreviewHandler(d))
+	sh := newStarterDashboardsHandler(d)
+	mux.Handle("/dashboards", sh)
+	mux.Handle("/dashboards/{id}", sh)
+	mux.Handle("/capabilities", newCapabilitiesHandler(d))
+	mux.Handle("/diagnostics", newDiagnosticsHandler(d))
+	mux.Handle("/usage", newUsageHandler(d))
+	th := newTagsHandler(d)
+	mux.Handle("/tag-keys", th)
+	mux.Handle("/tag-values", th)
 
 	return httpadapter.New(mux)
 }
 
-func (mh *metricsHandler) listMetrics(metricTypes []string, customMetricsWindow int64) ([]harper.ListMetricsResult, error) {
+func (mh *metricsHandler) listMetrics(ctx context.Context, client HarperClient, metricTypes []string, customMetricsWindow int64) ([]harper.ListMetricsResult, error) {
 	var metrics []harper.ListMetricsResult
 	var err error
 
+	allTypes := len(metricTypes) == 0 || (slices.Contains(metricTypes, "builtin") && slices.Contains(metricTypes, "custom"))
+	if allTypes && customMetricsWindow <= 0 {
+		if cached, ok := mh.datasource.metadata.listMetrics(); ok {
+			return cached, nil
+		}
+	}
+
 	var harperMetricTypes []harper.MetricType
 
 	if len(metricTypes) == 0 {
@@ -51,32 +90,100 @@ func (mh *metricsHandler) listMetrics(metricTypes []string, customMetricsWindow
 	}
 
 	if customMetricsWindow > 0 {
-		log.DefaultLogger.Debug("listMetrics request", "customMetricsWindow", customMetricsWindow)
+		mh.datasource.logger.Debug("listMetrics request", "customMetricsWindow", customMetricsWindow)
 		metricsRequest.CustomMetricsWindow = customMetricsWindow
 	}
 
-	metrics, err = mh.datasource.harperClient.ListMetrics(metricsRequest)
+	key := fmt.Sprintf("list %v %d", harperMetricTypes, customMetricsWindow)
+	if cached, ok := mh.cachedList(key); ok {
+		return cached, nil
+	}
+
+	result, err := mh.do(ctx, key, func() (any, error) {
+		// a call that just finished may have cached the list
+		if cached, ok := mh.cachedList(key); ok {
+			return cached, nil
+		}
+		metrics, err := client.ListMetrics(metricsRequest)
+		if err != nil {
+			return nil, err
+		}
+		mh.mu.Lock()
+		defer mh.mu.Unlock()
+		mh.lists[key] = cachedMetricList{metrics: metrics, expires: time.Now().Add(metricListCacheTTL)}
+		return metrics, nil
+	})
 	if err != nil {
-		return nil, err
+		return nil, asCredentialsError(err, mh.datasource.settings.Username)
 	}
+	metrics = result.([]harper.ListMetricsResult)
 
 	return metrics, nil
 }
 
-func (mh *metricsHandler) describeMetric(metric string) (*harper.DescribeMetricResult, error) {
-	return mh.datasource.harperClient.DescribeMetric(metric)
+// do calls fn for key, sharing the call with concurrent callers of the same key, as calls does. A caller whose
+// request is still live calls it again if the call it joined was cancelled, as the request that made it went away.
+func (mh *metricsHandler) do(ctx context.Context, key string, fn func() (any, error)) (any, error) {
+	for {
+		result, err, shared := mh.calls.Do(key, fn)
+		if shared && isCancelledError(err) && ctx.Err() == nil {
+			continue
+		}
+		return result, err
+	}
+}
+
+// cachedList returns the metric list cached under key, if it hasn't expired.
+func (mh *metricsHandler) cachedList(key string) ([]harper.ListMetricsResult, bool) {
+	mh.mu.Lock()
+	defer mh.mu.Unlock()
+	cached, ok := mh.lists[key]
+	if !ok || time.Now().After(cached.expires) {
+		return nil, false
+	}
+	return cached.metrics, true
+}
+
+func (mh *metricsHandler) describeMetric(ctx context.Context, client HarperClient, metric string) (*harper.DescribeMetricResult, error) {
+	if cached, ok := mh.datasource.metadata.describeMetric(metric); ok {
+		return cached, nil
+	}
+
+	result, err := mh.do(ctx, "describe "+metric, func() (any, error) {
+		if cached, ok := mh.datasource.metadata.describeMetric(metric); ok {
+			return cached, nil
+		}
+		desc, err := client.DescribeMetric(metric)
+		if err != nil {
+			return nil, err
+		}
+		mh.datasource.metadata.setDescription(metric, desc)
+		return desc, nil
+	})
+	if err != nil {
+		return nil, asCredentialsError(err, mh.datasource.settings.Username)
+	}
+
+	return result.(*harper.DescribeMetricResult), nil
 }
 
 func (mh *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	metric := r.PathValue("metric")
-	log.DefaultLogger.Debug("metricsHandler request", "urlPathValue", metric)
-	log.DefaultLogger.Debug("metricsHandler request", "urlParams", r.URL.Query())
+	mh.datasource.logger.Debug("metricsHandler request", "urlPathValue", metric)
+	mh.datasource.logger.Debug("metricsHandler request", "urlParams", r.URL.Query())
 
 	if r.Method != http.MethodGet {
 		http.NotFound(w, r)
 		return
 	}
 
+	pCtx := backend.PluginConfigFromContext(r.Context())
+	client, err := mh.datasource.clientFor(withRequestHeaders(r.Context(), r.Header), pCtx)
+	if err != nil {
+		http.Error(w, err.Error(), int(statusFromError(err)))
+		return
+	}
+
 	var jsonResp []byte
 	if metric == "" {
 		metricTypes := r.URL.Query()["types"]
@@ -84,29 +191,29 @@ func (mh *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			customMetricsWindow = 0
 		}
-		metrics, err := mh.listMetrics(metricTypes, customMetricsWindow)
+		metrics, err := mh.listMetrics(r.Context(), client, metricTypes, customMetricsWindow)
 		if err != nil {
-			log.DefaultLogger.Error("failed to list metrics", "error", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			mh.datasource.logger.Error("failed to list metrics", "error", err)
+			http.Error(w, err.Error(), int(statusFromError(err)))
 			return
 		}
 
 		jsonResp, err = json.Marshal(metrics)
 		if err != nil {
-			log.DefaultLogger.Error("error marshaling metrics to JSON", "error", err)
+			mh.datasource.logger.Error("error marshaling metrics to JSON", "error", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 	} else {
-		metricAttrs, err := mh.describeMetric(metric)
+		metricAttrs, err := mh.describeMetric(r.Context(), client, metric)
 		if err != nil {
-			log.DefaultLogger.Error("failed to describe metric", "metric", metric, "error", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			mh.datasource.logger.Error("failed to describe metric", "metric", metric, "error", err)
+			http.Error(w, err.Error(), int(statusFromError(err)))
 			return
 		}
 		jsonResp, err = json.Marshal(metricAttrs)
 		if err != nil {
-			log.DefaultLogger.Error("error marshaling metric attributes to JSON", "metric", metric, "error", err)
+			mh.datasource.logger.Error("error marshaling metric attributes to JSON", "metric", metric, "error", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -114,8 +221,8 @@ func (mh *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
-	_, err := w.Write(jsonResp)
+	_, err = w.Write(jsonResp)
 	if err != nil {
-		log.DefaultLogger.Error("error writing response", "error", err)
+		mh.datasource.logger.Error("error writing response", "error", err)
 	}
 }
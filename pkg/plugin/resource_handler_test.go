@@ -0,0 +1,110 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// newTestMetricsHandler returns a metricsHandler for a datasource without background work, so the client only sees
+// the handler's calls.
+func newTestMetricsHandler(client HarperClient) *metricsHandler {
+	return newMetricsHandler(&Datasource{
+		logger:       log.DefaultLogger,
+		harperClient: newPolicyClient(client, Settings{}),
+		metadata:     newMetricMetadataCache(),
+	})
+}
+
+func TestMetricsHandlerCachesLists(t *testing.T) {
+	client := newFakeHarperClient()
+	client.metrics = []harper.ListMetricsResult{"db-read"}
+	mh := newTestMetricsHandler(client)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Go(func() {
+			metrics, err := mh.listMetrics(context.Background(), mh.datasource.harperClient, []string{"custom"}, 60_000)
+			if err != nil || len(metrics) != 1 {
+				t.Errorf("expected the metric list, got %v, %v", metrics, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := client.calls[harper.OP_LIST_METRICS]; got != 1 {
+		t.Errorf("expected one list_metrics call, got %d", got)
+	}
+
+	if _, err := mh.listMetrics(context.Background(), mh.datasource.harperClient, []string{"builtin"}, 60_000); err != nil {
+		t.Fatal(err)
+	}
+	if got := client.calls[harper.OP_LIST_METRICS]; got != 2 {
+		t.Errorf("expected a list of other metric types to be fetched, got %d list_metrics calls", got)
+	}
+}
+
+func TestMetricsHandlerDescribeMetric(t *testing.T) {
+	client := newFakeHarperClient()
+	client.descriptions["db-read"] = &harper.DescribeMetricResult{}
+	mh := newTestMetricsHandler(client)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Go(func() {
+			if _, err := mh.describeMetric(context.Background(), mh.datasource.harperClient, "db-read"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := client.calls[harper.OP_DESCRIBE_METRIC]; got != 1 {
+		t.Errorf("expected one describe_metric call, got %d", got)
+	}
+	if _, err := mh.describeMetric(context.Background(), mh.datasource.harperClient, "missing"); statusFromError(err) != backend.StatusNotFound {
+		t.Errorf("expected a missing metric to be not found, got %v", err)
+	}
+}
+
+func TestMetricsHandlerRequestContext(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := harper.NewClientWithHTTPClient(srv.Client(), srv.URL, "admin", "password")
+	mh := newTestMetricsHandler(&capabilityClient{HarperClient: client, capabilities: &capabilities{}})
+
+	for _, target := range []string{"/metrics?customMetricsWindow=0", "/metrics/db-read"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		req := httptest.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if metric, ok := strings.CutPrefix(req.URL.Path, "/metrics/"); ok {
+			req.SetPathValue("metric", metric)
+		}
+		rec := httptest.NewRecorder()
+
+		start := time.Now()
+		mh.ServeHTTP(rec, req)
+		cancel()
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: expected the Harper call to be aborted with the request, took %s", target, elapsed)
+		}
+		if rec.Code == http.StatusOK {
+			t.Errorf("%s: expected an error, got %d", target, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	defaultRetryAttempts       = 3
+	defaultRetryInitialBackoff = 200 * time.Millisecond
+	defaultRetryMaxBackoff     = 2 * time.Second
+)
+
+// RetrySettings configure retries of Harper operations that fail transiently: rate limiting (429), Harper or a proxy
+// in front of it being briefly unavailable (502, 503), and connections being reset or refused, as when Harper
+// restarts. Each operation is tried up to MaxAttempts times (default 3; 1 disables retries), waiting between tries
+// for a jittered backoff that starts at InitialBackoff (default "200ms") and doubles up to MaxBackoff (default "2s").
+// Only read-only operations are retried.
+type RetrySettings struct {
+	MaxAttempts    int    `json:"maxAttempts"`
+	InitialBackoff string `json:"initialBackoff"`
+	MaxBackoff     string `json:"maxBackoff"`
+}
+
+type retryPolicy struct {
+	attempts       int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func newRetryPolicy(settings RetrySettings) (retryPolicy, error) {
+	p := retryPolicy{
+		attempts:       defaultRetryAttempts,
+		initialBackoff: defaultRetryInitialBackoff,
+		maxBackoff:     defaultRetryMaxBackoff,
+	}
+	if settings.MaxAttempts < 0 {
+		return p, fmt.Errorf("invalid max attempts %d", settings.MaxAttempts)
+	}
+	if settings.MaxAttempts > 0 {
+		p.attempts = settings.MaxAttempts
+	}
+	for _, d := range []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"initial backoff", settings.InitialBackoff, &p.initialBackoff},
+		{"max backoff", settings.MaxBackoff, &p.maxBackoff},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v <= 0 {
+			return p, fmt.Errorf("invalid %s '%s'", d.name, d.value)
+		}
+		*d.dest = v
+	}
+	if p.maxBackoff < p.initialBackoff {
+		return p, fmt.Errorf("max backoff %s is less than the initial backoff %s", p.maxBackoff, p.initialBackoff)
+	}
+	return p, nil
+}
+
+// retryClient wraps a HarperClient to retry read-only operations that fail transiently, as set by its policy.
+type retryClient struct {
+	HarperClient
+	policy retryPolicy
+	logger log.Logger
+
+	// ctx is the context the client's calls are made under, whose cancellation stops any further tries.
+	ctx context.Context
+}
+
+// newRetryClient returns client wrapped to retry transient failures, or client itself if the policy allows a
+// single attempt.
+func newRetryClient(client HarperClient, policy retryPolicy, logger log.Logger) HarperClient {
+	if policy.attempts <= 1 {
+		return client
+	}
+	return &retryClient{HarperClient: client, policy: policy, logger: logger, ctx: context.Background()}
+}
+
+func (rc *retryClient) withContext(ctx context.Context) HarperClient {
+	return &retryClient{HarperClient: clientWithContext(rc.HarperClient, ctx), policy: rc.policy, logger: rc.logger, ctx: ctx}
+}
+
+// do calls try until it succeeds, fails other than transiently, runs out of attempts, or the client's context is
+// done, and returns its last error.
+func (rc *retryClient) do(operation string, try func() error) error {
+	backoff := rc.policy.initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := try()
+		if err == nil || attempt >= rc.policy.attempts || !isTransientError(err) {
+			return err
+		}
+
+		// wait between half and all of the backoff, so clients retrying together spread out
+		wait := backoff/2 + rand.N(backoff/2+1)
+		rc.logger.Debug("Harper operation failed transiently; retrying", "operation", operation, "attempt", attempt,
+			"error", err, "retryIn", wait)
+		select {
+		case <-rc.ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, rc.policy.maxBackoff)
+	}
+}
+
+func (rc *retryClient) Healthcheck() error {
+	return rc.do("healthcheck", rc.HarperClient.Healthcheck)
+}
+
+func (rc *retryClient) GetAnalytics(req harper.GetAnalyticsRequest) ([]harper.GetAnalyticsResult, error) {
+	var results []harper.GetAnalyticsResult
+	err := rc.do(harper.OP_GET_ANALYTICS, func() (err error) {
+		results, err = rc.HarperClient.GetAnalytics(req)
+		return err
+	})
+	return results, err
+}
+
+func (rc *retryClient) ListMetrics(req harper.ListMetricsRequest) ([]harper.ListMetricsResult, error) {
+	var metrics []harper.ListMetricsResult
+	err := rc.do(harper.OP_LIST_METRICS, func() (err error) {
+		metrics, err = rc.HarperClient.ListMetrics(req)
+		return err
+	})
+	return metrics, err
+}
+
+func (rc *retryClient) DescribeMetric(metric string) (*harper.DescribeMetricResult, error) {
+	var desc *harper.DescribeMetricResult
+	err := rc.do(harper.OP_DESCRIBE_METRIC, func() (err error) {
+		desc, err = rc.HarperClient.DescribeMetric(metric)
+		return err
+	})
+	return desc, err
+}
+
+// RawRequest retries op only if it's read-only: a write whose connection was reset may still have been applied. SQL
+// is only retried when it's a single SELECT statement, as writes may be sent as SQL when they're allowed.
+func (rc *retryClient) RawRequest(op harper.Operation, result any) error {
+	info := inspectOperation(op)
+	readOnly := slices.Contains(readOnlyOperations, info.Operation)
+	if !readOnly || (info.Operation == harper.OP_SQL && checkSQL(info.SQL) != nil) {
+		return rc.HarperClient.RawRequest(op, result)
+	}
+	return rc.do(info.Operation, func() error { return rc.HarperClient.RawRequest(op, result) })
+}
+
+// isTransientError reports whether err is a Harper operation failing in a way that may well succeed if retried.
+func isTransientError(err error) bool {
+	var opErr *harper.OperationError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	switch opErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return true
+	case 0:
+		// the SDK flattens transport errors into the message
+		msg := strings.ToLower(opErr.Message)
+		return strings.Contains(msg, "connection reset") || strings.Contains(msg, "connection refused")
+	default:
+		return false
+	}
+}
@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestRetryClient(t *testing.T) {
+	policy := retryPolicy{attempts: 3, initialBackoff: time.Millisecond, maxBackoff: 2 * time.Millisecond}
+	tests := []struct {
+		name      string
+		operation string
+		sql       string
+		failures  []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "transient failures are retried",
+			operation: "cluster_status",
+			failures: []error{
+				&harper.OperationError{StatusCode: 503, Message: "Service Unavailable"},
+				&harper.OperationError{StatusCode: 0, Message: "read: connection reset by peer"},
+			},
+			wantCalls: 3,
+		},
+		{
+			name:      "attempts run out",
+			operation: "cluster_status",
+			failures: []error{
+				&harper.OperationError{StatusCode: 429},
+				&harper.OperationError{StatusCode: 502},
+				&harper.OperationError{StatusCode: 503},
+			},
+			wantCalls: 3,
+			wantErr:   true,
+		},
+		{
+			name:      "other failures aren't retried",
+			operation: "cluster_status",
+			failures:  []error{&harper.OperationError{StatusCode: 400, Message: "bad request"}},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "writes aren't retried",
+			operation: "insert",
+			failures:  []error{&harper.OperationError{StatusCode: 503}},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "SELECT statements are retried",
+			operation: "sql",
+			sql:       "SELECT * FROM dev.dog",
+			failures:  []error{&harper.OperationError{StatusCode: 502}},
+			wantCalls: 2,
+		},
+		{
+			name:      "SQL writes aren't retried",
+			operation: "sql",
+			sql:       "UPDATE dev.dog SET age = age + 1",
+			failures:  []error{&harper.OperationError{StatusCode: 502}},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeHarperClient()
+			calls := 0
+			client.raw = func(op map[string]any) (any, error) {
+				calls++
+				if calls <= len(tt.failures) {
+					return nil, tt.failures[calls-1]
+				}
+				return map[string]any{}, nil
+			}
+
+			op := rawOperation{"operation": tt.operation}
+			if tt.sql != "" {
+				op["sql"] = tt.sql
+			}
+			err := newRetryClient(client, policy, log.DefaultLogger).RawRequest(op, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("unexpected error %v", err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestRetryClientContext(t *testing.T) {
+	client := newFakeHarperClient()
+	client.err = &harper.OperationError{StatusCode: 503}
+	policy := retryPolicy{attempts: 5, initialBackoff: time.Minute, maxBackoff: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := clientWithContext(newRetryClient(client, policy, log.DefaultLogger), ctx).ListMetrics(harper.ListMetricsRequest{}); err == nil {
+		t.Fatal("expected the call to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected cancelling the context to stop the retries, took %s", elapsed)
+	}
+	if got := client.calls[harper.OP_LIST_METRICS]; got != 1 {
+		t.Errorf("expected a single try, got %d", got)
+	}
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	p, err := newRetryPolicy(RetrySettings{})
+	if err != nil || p.attempts != defaultRetryAttempts || p.initialBackoff != defaultRetryInitialBackoff {
+		t.Errorf("expected the defaults, got %+v, %v", p, err)
+	}
+
+	for _, settings := range []RetrySettings{
+		{MaxAttempts: -1},
+		{InitialBackoff: "soon"},
+		{MaxBackoff: "-1s"},
+		{InitialBackoff: "5s", MaxBackoff: "1s"},
+	} {
+		if _, err := newRetryPolicy(settings); err == nil {
+			t.Errorf("expected %+v to be rejected", settings)
+		}
+	}
+
+	if client := newFakeHarperClient(); newRetryClient(client, retryPolicy{attempts: 1}, log.DefaultLogger) != HarperClient(client) {
+		t.Error("expected a single attempt not to wrap the client")
+	}
+}
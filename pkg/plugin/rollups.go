@@ -0,0 +1,297 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	defaultRollupResolution = time.Minute
+	defaultRollupRetention  = 90 * 24 * time.Hour
+	defaultRollupMinRange   = 24 * time.Hour
+
+	// rollupBackfillChunk is how much raw data is fetched per request while backfilling.
+	rollupBackfillChunk = 6 * time.Hour
+)
+
+// RollupSettings configure in-memory rollups of analytics metrics. The plugin keeps Metrics downsampled to
+// Resolution (default "1m") for Retention (default "2160h", 90 days); queries spanning at least MinRange (default
+// "24h") are served from the rollups plus a raw tail, rather than pulling raw data for the whole range. Rollups hold
+// the mean of each numeric attribute per series and bucket; queries with conditions always use raw data.
+type RollupSettings struct {
+	Metrics    []string `json:"metrics"`
+	Resolution string   `json:"resolution"`
+	Retention  string   `json:"retention"`
+	MinRange   string   `json:"minRange"`
+}
+
+// rollups holds the rollup of every configured metric.
+type rollups struct {
+	resolution time.Duration
+	retention  time.Duration
+	minRange   time.Duration
+	stores     map[string]*rollupStore
+}
+
+// rollupStore is one metric's rollup: per-bucket, per-series accumulators covering [coveredFrom, coveredTo).
+type rollupStore struct {
+	metric string
+
+	mu          sync.RWMutex
+	buckets     map[int64]map[string]*rollupAccum
+	coveredFrom int64
+	coveredTo   int64
+	ready       bool
+}
+
+// rollupAccum accumulates one series' rows within a bucket. labels are the row's non-numeric attributes, which
+// identify the series.
+type rollupAccum struct {
+	labels map[string]any
+	sums   map[string]float64
+	counts map[string]int
+}
+
+// newRollups returns the rollups for settings, or nil if none are configured.
+func newRollups(settings RollupSettings) (*rollups, error) {
+	if len(settings.Metrics) == 0 {
+		return nil, nil
+	}
+
+	r := &rollups{
+		resolution: defaultRollupResolution,
+		retention:  defaultRollupRetention,
+		minRange:   defaultRollupMinRange,
+		stores:     make(map[string]*rollupStore, len(settings.Metrics)),
+	}
+	for _, d := range []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"resolution", settings.Resolution, &r.resolution},
+		{"retention", settings.Retention, &r.retention},
+		{"minimum range", settings.MinRange, &r.minRange},
+	} {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid rollup %s '%s'", d.name, d.value)
+		}
+		*d.dest = parsed
+	}
+
+	for _, metric := range settings.Metrics {
+		r.stores[metric] = &rollupStore{metric: metric, buckets: make(map[int64]map[string]*rollupAccum)}
+	}
+
+	return r, nil
+}
+
+// run backfills every rollup and then keeps them up to date, once per resolution, until ctx is cancelled.
+func (r *rollups) run(ctx context.Context, client HarperClient, logger log.Logger) {
+	for _, store := range r.stores {
+		go func() {
+			for {
+				start := time.Now()
+				if err := r.update(store, client, start); err != nil {
+					logger.Warn("failed to update analytics rollup", "metric", store.metric, "error", err)
+				} else {
+					logger.Debug("updated analytics rollup", "metric", store.metric, "duration", time.Since(start))
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(r.resolution):
+				}
+			}
+		}()
+	}
+}
+
+// update folds the raw data for every complete bucket since the store was last updated into it and drops buckets
+// older than the retention.
+func (r *rollups) update(store *rollupStore, client HarperClient, now time.Time) error {
+	resolution := r.resolution.Milliseconds()
+	until := now.Truncate(r.resolution).UnixMilli()
+	oldest := now.Add(-r.retention).Truncate(r.resolution).UnixMilli()
+
+	store.mu.RLock()
+	from := store.coveredTo
+	store.mu.RUnlock()
+	if from < oldest {
+		from = oldest
+	}
+
+	for from < until {
+		to := min(from+rollupBackfillChunk.Milliseconds(), until)
+		results, err := client.GetAnalytics(harper.GetAnalyticsRequest{
+			Metric:       store.metric,
+			StartTime:    from,
+			EndTime:      to - 1,
+			CoalesceTime: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		store.mu.Lock()
+		store.fold(results, resolution)
+		if !store.ready {
+			store.coveredFrom = from
+			store.ready = true
+		}
+		store.coveredTo = to
+		store.mu.Unlock()
+
+		from = to
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for bucket := range store.buckets {
+		if bucket < oldest {
+			delete(store.buckets, bucket)
+		}
+	}
+	store.coveredFrom = max(store.coveredFrom, oldest)
+
+	return nil
+}
+
+// fold adds raw analytics rows to their buckets. The caller must hold the write lock.
+func (s *rollupStore) fold(results []harper.GetAnalyticsResult, resolution int64) {
+	for _, row := range results {
+		ts, ok := row["id"].(time.Time)
+		if !ok {
+			continue
+		}
+		bucket := ts.UnixMilli() - ts.UnixMilli()%resolution
+
+		labels := make(map[string]any)
+		values := make(map[string]float64)
+		for k, v := range row {
+			if k == "id" || k == "metric" {
+				continue
+			}
+			switch v := v.(type) {
+			case float64:
+				values[k] = v
+			case int64:
+				values[k] = float64(v)
+			default:
+				labels[k] = v
+			}
+		}
+
+		series := seriesKey(labels)
+		if s.buckets[bucket] == nil {
+			s.buckets[bucket] = make(map[string]*rollupAccum)
+		}
+		acc, ok := s.buckets[bucket][series]
+		if !ok {
+			acc = &rollupAccum{labels: labels, sums: make(map[string]float64), counts: make(map[string]int)}
+			s.buckets[bucket][series] = acc
+		}
+		for k, v := range values {
+			acc.sums[k] += v
+			acc.counts[k]++
+		}
+	}
+}
+
+func seriesKey(labels map[string]any) string {
+	var b strings.Builder
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		fmt.Fprintf(&b, "%s=%v,", k, labels[k])
+	}
+	return b.String()
+}
+
+// serve returns req's rows from the rollups, in ascending time order, if they should and can serve it. The rows cover
+// req's range up to tailStart; the caller fetches the rest raw.
+func (r *rollups) serve(req harper.GetAnalyticsRequest, now time.Time) (results []harper.GetAnalyticsResult, tailStart int64, ok bool) {
+	store, found := r.stores[req.Metric]
+	if !found || len(req.Conditions) > 0 || req.StartTime == 0 {
+		return nil, 0, false
+	}
+	end := req.EndTime
+	if end == 0 {
+		end = now.UnixMilli()
+	}
+	if time.Duration(end-req.StartTime)*time.Millisecond < r.minRange {
+		return nil, 0, false
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	if !store.ready || req.StartTime < store.coveredFrom {
+		return nil, 0, false
+	}
+
+	attributes, _ := req.GetAttributes.([]string)
+	tailStart = min(store.coveredTo, end)
+	buckets := slices.Sorted(maps.Keys(store.buckets))
+	for _, bucket := range buckets {
+		if bucket < req.StartTime || bucket >= tailStart {
+			continue
+		}
+		series := store.buckets[bucket]
+		for _, key := range slices.Sorted(maps.Keys(series)) {
+			acc := series[key]
+			row := harper.GetAnalyticsResult{"id": time.UnixMilli(bucket), "metric": req.Metric}
+			maps.Copy(row, acc.labels)
+			for k, sum := range acc.sums {
+				row[k] = sum / float64(acc.counts[k])
+			}
+			if len(attributes) > 0 {
+				maps.DeleteFunc(row, func(k string, _ any) bool {
+					return k != "id" && k != "metric" && !slices.Contains(attributes, k)
+				})
+			}
+			results = append(results, row)
+		}
+	}
+
+	return results, tailStart, true
+}
+
+// getAnalytics runs req, serving it from the rollups plus a raw tail when possible. usedRollups reports whether it
+// did.
+func (d *Datasource) getAnalytics(client HarperClient, req harper.GetAnalyticsRequest) (results []harper.GetAnalyticsResult, usedRollups bool, err error) {
+	if d.rollups == nil {
+		results, err = client.GetAnalytics(req)
+		return results, false, err
+	}
+
+	rolled, tailStart, ok := d.rollups.serve(req, time.Now())
+	if !ok {
+		results, err = client.GetAnalytics(req)
+		return results, false, err
+	}
+
+	if req.EndTime == 0 || tailStart <= req.EndTime {
+		tailReq := req
+		tailReq.StartTime = tailStart
+		tail, err := client.GetAnalytics(tailReq)
+		if err != nil {
+			return nil, false, err
+		}
+		// every rolled up row is before tailStart, so the results stay in ascending time order
+		rolled = append(rolled, tail...)
+	}
+
+	return rolled, true, nil
+}
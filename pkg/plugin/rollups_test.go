@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+)
+
+func TestRollups(t *testing.T) {
+	client := newFakeHarperClient()
+	now := time.Now()
+	var times []time.Time
+	for ts := now.Add(-30 * time.Hour); ts.Before(now); ts = ts.Add(20 * time.Second) {
+		times = append(times, ts)
+	}
+	client.addAnalytics("db-read", times, map[string]any{"node": "node-1", "count": 6.0})
+
+	r, err := newRollups(RollupSettings{Metrics: []string{"db-read"}, Retention: "48h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.update(r.stores["db-read"], client, now); err != nil {
+		t.Fatal(err)
+	}
+	ds := &Datasource{rollups: r}
+
+	longRange := harper.GetAnalyticsRequest{Metric: "db-read", StartTime: now.Add(-26 * time.Hour).UnixMilli()}
+	results, usedRollups, err := ds.getAnalytics(client, longRange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !usedRollups {
+		t.Fatal("expected a 26h query to be served from rollups")
+	}
+	// one row per complete minute, plus the raw rows since the last complete minute
+	if len(results) < 26*60-1 || len(results) > 26*60+4 {
+		t.Errorf("expected about %d rows, got %d", 26*60, len(results))
+	}
+	for i, row := range results {
+		if row["count"] != 6.0 || row["node"] != "node-1" {
+			t.Fatalf("unexpected row %v", row)
+		}
+		if i > 0 && row["id"].(time.Time).Before(results[i-1]["id"].(time.Time)) {
+			t.Fatalf("rows are not in ascending time order at %d", i)
+		}
+	}
+
+	shortRange := harper.GetAnalyticsRequest{Metric: "db-read", StartTime: now.Add(-time.Hour).UnixMilli()}
+	if _, usedRollups, _ := ds.getAnalytics(client, shortRange); usedRollups {
+		t.Error("expected a 1h query to use raw data")
+	}
+}
@@ -0,0 +1,601 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// timestampAttributes are the attributes Harper maintains on every record, as epoch milliseconds. They're converted
+// to time fields so records can be charted.
+var timestampAttributes = []string{"__createdtime__", "__updatedtime__"}
+
+// searchByConditionsOperation is Harper's search_by_conditions operation. (The SDK's SearchByConditions drops the
+// top-level operator, so the operation is built here and sent as a raw request.)
+type searchByConditionsOperation struct {
+	Operation     string                   `json:"operation"`
+	Database      string                   `json:"database"`
+	Table         string                   `json:"table"`
+	Operator      string                   `json:"operator,omitempty"`
+	Conditions    []harper.SearchCondition `json:"conditions"`
+	GetAttributes []string                 `json:"get_attributes"`
+	Sort          *harper.Sort             `json:"sort,omitempty"`
+	Limit         int                      `json:"limit,omitempty"`
+	Offset        int                      `json:"offset,omitempty"`
+}
+
+func (o searchByConditionsOperation) Prepare() any {
+	return o
+}
+
+// toSearchCondition converts a query condition, and any nested conditions, to a Harper search condition, with the
+// value coerced to its declared type.
+func (c *Condition) toSearchCondition() (harper.SearchCondition, error) {
+	switch c.Comparator {
+	case comparatorIn:
+		return c.toInCondition()
+	case comparatorBetween, comparatorNotBetween:
+		return c.toRangeCondition()
+	case comparatorIsNull:
+		return harper.SearchCondition{Attribute: c.Attribute, Comparator: "equals", Value: jsonNull}, nil
+	case comparatorNotNull:
+		return harper.SearchCondition{Attribute: c.Attribute, Comparator: "not_equal", Value: jsonNull}, nil
+	}
+
+	val, err := c.Value.coerce()
+	if err != nil {
+		return harper.SearchCondition{}, &QueryValidationError{
+			Field:   "queryAttrs.conditions",
+			Problem: fmt.Sprintf("value of '%s' %s", c.Attribute, err),
+		}
+	}
+
+	sc := harper.SearchCondition{
+		Attribute:  c.Attribute,
+		Comparator: c.Comparator,
+		Value:      val,
+		Operator:   c.Operator,
+	}
+	for _, nested := range c.Conditions {
+		nestedCondition, err := nested.toSearchCondition()
+		if err != nil {
+			return harper.SearchCondition{}, err
+		}
+		sc.Conditions = append(sc.Conditions, &nestedCondition)
+	}
+	return sc, nil
+}
+
+// comparatorIsNull and comparatorNotNull match records whose attribute is, or isn't, null or missing. They take no
+// value, and are sent as equals and not_equal conditions on null.
+const (
+	comparatorIsNull  = "is_null"
+	comparatorNotNull = "not_null"
+)
+
+// jsonNull is a condition value that's sent as null. (A nil value would be left out of the condition.)
+var jsonNull = json.RawMessage("null")
+
+// comparatorIn matches any of a list of values. Harper has no such comparator, so it's sent as a group of equals
+// conditions.
+const comparatorIn = "in"
+
+// toInCondition converts an in condition to an or group with an equals condition per value, each coerced to the
+// declared type.
+func (c *Condition) toInCondition() (harper.SearchCondition, error) {
+	sc := harper.SearchCondition{Operator: "or"}
+	for _, v := range c.Value.list() {
+		equals := &Condition{Attribute: c.Attribute, Comparator: "equals", Value: SearchValue{Val: v, Type: c.Value.elemType()}}
+		nested, err := equals.toSearchCondition()
+		if err != nil {
+			return harper.SearchCondition{}, err
+		}
+		sc.Conditions = append(sc.Conditions, &nested)
+	}
+	if len(sc.Conditions) == 0 {
+		return harper.SearchCondition{}, &QueryValidationError{
+			Field:   "queryAttrs.conditions",
+			Problem: fmt.Sprintf("expected at least one value for '%s'", c.Attribute),
+		}
+	}
+	if len(sc.Conditions) == 1 {
+		return *sc.Conditions[0], nil
+	}
+	return sc, nil
+}
+
+const (
+	comparatorBetween    = "between"
+	comparatorNotBetween = "not_between"
+)
+
+// toRangeCondition converts a between or not_between condition, whose value is a pair of bounds (which may be a
+// string of the two, comma-separated), each coerced to the declared type. Harper's between is inclusive and it has no
+// not_between, so that's sent as an or group of a less_than and a greater_than condition.
+func (c *Condition) toRangeCondition() (harper.SearchCondition, error) {
+	values := c.Value.list()
+	if s, ok := c.Value.Val.(string); ok && len(values) == 1 {
+		values = splitValues(s)
+	}
+	if len(values) != 2 {
+		return harper.SearchCondition{}, &QueryValidationError{
+			Field:   "queryAttrs.conditions",
+			Problem: fmt.Sprintf("expected a lower and an upper bound for '%s'", c.Attribute),
+		}
+	}
+
+	bounds := make([]any, len(values))
+	for i, v := range values {
+		bound, err := SearchValue{Val: v, Type: c.Value.elemType()}.coerce()
+		if err != nil {
+			return harper.SearchCondition{}, &QueryValidationError{
+				Field:   "queryAttrs.conditions",
+				Problem: fmt.Sprintf("bound of '%s' %s", c.Attribute, err),
+			}
+		}
+		bounds[i] = bound
+	}
+
+	if c.Comparator == comparatorBetween {
+		return harper.SearchCondition{Attribute: c.Attribute, Comparator: comparatorBetween, Value: bounds}, nil
+	}
+	return harper.SearchCondition{
+		Operator: "or",
+		Conditions: []*harper.SearchCondition{
+			{Attribute: c.Attribute, Comparator: "less_than", Value: bounds[0]},
+			{Attribute: c.Attribute, Comparator: "greater_than", Value: bounds[1]},
+		},
+	}, nil
+}
+
+// list returns the value as a list: itself if it's one, the elements of a multi-value dashboard variable as it expands
+// in a string (in braces, e.g. "{node-1,node-2}"), or else a list of just it, so a plain string with a comma in it is
+// a single value.
+func (v SearchValue) list() []any {
+	switch val := v.Val.(type) {
+	case []any:
+		return val
+	case string:
+		if inner, ok := strings.CutPrefix(val, "{"); ok && strings.HasSuffix(inner, "}") {
+			return splitValues(strings.TrimSuffix(inner, "}"))
+		}
+	}
+	return []any{v.Val}
+}
+
+// splitValues returns the elements of a string of comma-separated values.
+func splitValues(s string) []any {
+	var values []any
+	for _, e := range strings.Split(s, ",") {
+		values = append(values, strings.TrimSpace(e))
+	}
+	return values
+}
+
+// elemType is the type of each of the value's elements, when it's a list.
+func (v SearchValue) elemType() string {
+	if v.Type == searchValueTypeNumberArray {
+		return searchValueTypeNumber
+	}
+	return v.Type
+}
+
+const (
+	searchValueTypeString      = "string"
+	searchValueTypeNumber      = "number"
+	searchValueTypeBoolean     = "boolean"
+	searchValueTypeNumberArray = "number_array"
+	searchValueTypeTimestamp   = "timestamp"
+)
+
+// coerce returns the value converted to its declared type, so values that arrive as strings (e.g. from template
+// variables) are compared as what they are. Timestamps are sent as epoch milliseconds and may be given as RFC 3339
+// strings. Values without a type, or "auto", are passed through as they are.
+func (v SearchValue) coerce() (any, error) {
+	switch v.Type {
+	case "", "auto":
+		return v.Val, nil
+	case searchValueTypeString:
+		if v.Val == nil {
+			return nil, nil
+		}
+		if s, ok := v.Val.(string); ok {
+			return s, nil
+		}
+		return fmt.Sprint(v.Val), nil
+	case searchValueTypeNumber:
+		return coerceNumber(v.Val)
+	case searchValueTypeBoolean:
+		switch val := v.Val.(type) {
+		case bool:
+			return val, nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(val))
+			if err != nil {
+				return nil, fmt.Errorf("'%s' isn't a boolean", val)
+			}
+			return b, nil
+		}
+		return nil, fmt.Errorf("isn't a boolean")
+	case searchValueTypeNumberArray:
+		var elems []any
+		switch val := v.Val.(type) {
+		case []any:
+			elems = val
+		case string:
+			for _, e := range strings.Split(val, ",") {
+				elems = append(elems, e)
+			}
+		default:
+			elems = []any{val}
+		}
+		nums := make([]float64, len(elems))
+		for i, e := range elems {
+			n, err := coerceNumber(e)
+			if err != nil {
+				return nil, err
+			}
+			nums[i] = n
+		}
+		return nums, nil
+	case searchValueTypeTimestamp:
+		if s, ok := v.Val.(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(s)); err == nil {
+				return t.UnixMilli(), nil
+			}
+		}
+		n, err := coerceNumber(v.Val)
+		if err != nil {
+			return nil, fmt.Errorf("isn't a timestamp")
+		}
+		return int64(n), nil
+	}
+	return nil, fmt.Errorf("has unknown type '%s'", v.Type)
+}
+
+func coerceNumber(v any) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("'%s' isn't a number", v)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("isn't a number")
+}
+
+func (s *SortVal) toSort() *harper.Sort {
+	if s == nil || s.Attribute == "" {
+		return nil
+	}
+	return &harper.Sort{Attribute: s.Attribute, Descending: s.Descending, Next: s.Next.toSort()}
+}
+
+func (d *Datasource) querySearchByConditions(ctx context.Context, client HarperClient, refID string, request SearchByConditionsQuery) (backend.DataResponse, error) {
+	if request.Limit < 0 {
+		return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.limit", Problem: "must not be negative"}
+	}
+	if request.Offset < 0 {
+		return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.offset", Problem: "must not be negative"}
+	}
+	if _, ok := epochUnits[request.TimeUnit]; request.TimeUnit != "" && !ok {
+		return backend.DataResponse{}, &QueryValidationError{Field: "queryAttrs.timeUnit", Problem: "expected s, ms, us or ns"}
+	}
+
+	op := searchByConditionsOperation{
+		Operation:     harper.OP_SEARCH_BY_CONDITIONS,
+		Database:      request.Database,
+		Table:         request.Table,
+		Operator:      request.Operator,
+		Conditions:    make([]harper.SearchCondition, 0, len(request.Conditions)),
+		GetAttributes: request.Attributes,
+		Sort:          request.Sort.toSort(),
+		Offset:        request.Offset,
+	}
+	for _, c := range request.Conditions {
+		sc, err := c.toSearchCondition()
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		op.Conditions = append(op.Conditions, sc)
+	}
+	if len(op.GetAttributes) == 0 {
+		op.GetAttributes = []string{"*"}
+	}
+
+	// (unlimited searches, and those over it, are limited to the datasource's maximum rows)
+	limit := request.Limit
+	if limit == 0 || limit > d.maxRows() {
+		limit = d.maxRows()
+	}
+	records, err := d.searchRecords(ctx, client, refID, op, limit)
+	if err != nil {
+		return backend.DataResponse{}, fmt.Errorf("could not search Harper table '%s.%s': '%w'", request.Database, request.Table, err)
+	}
+
+	truncated := len(records) > limit
+	if truncated {
+		records = records[:limit]
+	}
+
+	var attributes []string
+	if !slices.Contains(request.Attributes, "*") {
+		attributes = request.Attributes
+	}
+	frame, err := recordsToFrame(frameName(refID, request.Database+"."+request.Table), records, attributes)
+	if err != nil {
+		return backend.DataResponse{}, err
+	}
+	frame.SetRefID(refID)
+	if request.TimeField != "" {
+		if err := setTimeField(frame, request.TimeField, request.TimeUnit); err != nil {
+			return backend.DataResponse{}, err
+		}
+	}
+	applyFieldNaming(frame, d.settings.FieldNaming)
+	setFieldDisplayHints(frame)
+	switch {
+	case truncated && limit != request.Limit:
+		frame.AppendNotices(maxRowsNotice(limit))
+	case truncated:
+		frame.AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text: fmt.Sprintf("Results truncated to %d records; raise the limit or page through them with the offset",
+				request.Limit),
+		})
+	}
+
+	return backend.DataResponse{Frames: data.Frames{frame}}, nil
+}
+
+// searchRecords sends op, in pages of the configured page size if set, until limit records (if not 0) plus one more,
+// to tell whether the results were truncated, have been fetched or there are no more. It stops between pages if ctx
+// is done.
+func (d *Datasource) searchRecords(ctx context.Context, client HarperClient, refID string, op searchByConditionsOperation, limit int) ([]map[string]any, error) {
+	pageSize := d.settings.SearchPageSize
+
+	var records []map[string]any
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		op.Limit = pageSize
+		if limit > 0 && (pageSize <= 0 || limit+1-len(records) < pageSize) {
+			op.Limit = limit + 1 - len(records)
+		}
+
+		d.logger.Debug("executing Harper operation", "refID", refID, "operation", op.Operation, "request", op)
+		start := time.Now()
+		var rows []json.RawMessage
+		if err := client.RawRequest(op, &rows); err != nil {
+			return nil, err
+		}
+		page, _, err := decodeRecords(rows)
+		if err != nil {
+			return nil, err
+		}
+		d.logger.Debug("Harper operation completed", "refID", refID, "operation", op.Operation,
+			"duration", time.Since(start), "results", len(page))
+
+		records = append(records, page...)
+		if op.Limit <= 0 || len(page) < op.Limit || (limit > 0 && len(records) > limit) {
+			return records, nil
+		}
+		op.Offset += len(page)
+	}
+}
+
+// recordsToFrame converts Harper records to a frame with one field per attribute. Fields are in the order of
+// attributes if given, or else sorted by name. Each field's type is inferred from its values: numbers, strings and
+// booleans map to the nullable field type of the same kind, Harper's timestamp attributes to time, and attributes
+// with mixed or nested values to JSON strings. Numbers decoded as json.Number are int64 if every value of the attribute
+// is an integer, so large IDs keep their precision, and float64 otherwise.
+func recordsToFrame(name string, records []map[string]any, attributes []string) (*data.Frame, error) {
+	if len(attributes) == 0 {
+		seen := make(map[string]bool)
+		for _, record := range records {
+			for k := range record {
+				seen[k] = true
+			}
+		}
+		attributes = slices.Sorted(maps.Keys(seen))
+	}
+
+	frame := data.NewFrame(name)
+	for _, attr := range attributes {
+		fieldType := inferFieldType(attr, records)
+		field := data.NewFieldFromFieldType(fieldType, len(records))
+		field.Name = attr
+		if fieldType == data.FieldTypeNullableTime {
+			setEpochTimes(field, records, attr, "")
+			frame.Fields = append(frame.Fields, field)
+			continue
+		}
+		for i, record := range records {
+			v, err := convertValue(record[attr], fieldType)
+			if err != nil {
+				return nil, fmt.Errorf("could not convert attribute '%s': '%w'", attr, err)
+			}
+			field.Set(i, v)
+		}
+		frame.Fields = append(frame.Fields, field)
+	}
+
+	return frame, nil
+}
+
+// inferFieldType returns the field type for attr's values across records.
+func inferFieldType(attr string, records []map[string]any) data.FieldType {
+	fieldType := data.FieldTypeUnknown
+	for _, record := range records {
+		var t data.FieldType
+		switch v := record[attr].(type) {
+		case nil:
+			continue
+		case float64, json.Number:
+			t = data.FieldTypeNullableFloat64
+			if n, ok := v.(json.Number); ok {
+				if _, err := n.Int64(); err == nil {
+					t = data.FieldTypeNullableInt64
+				}
+			}
+			if slices.Contains(timestampAttributes, attr) {
+				t = data.FieldTypeNullableTime
+			}
+		case bool:
+			t = data.FieldTypeNullableBool
+		case string:
+			t = data.FieldTypeNullableString
+		default:
+			return data.FieldTypeNullableJSON
+		}
+
+		switch {
+		case fieldType == data.FieldTypeUnknown || fieldType == t:
+			fieldType = t
+		case isNumberFieldType(fieldType) && isNumberFieldType(t):
+			// integers mixed with fractions
+			fieldType = data.FieldTypeNullableFloat64
+		case fieldType != t:
+			return data.FieldTypeNullableJSON
+		}
+	}
+
+	if fieldType == data.FieldTypeUnknown {
+		return data.FieldTypeNullableString
+	}
+	return fieldType
+}
+
+func isNumberFieldType(t data.FieldType) bool {
+	return t == data.FieldTypeNullableInt64 || t == data.FieldTypeNullableFloat64
+}
+
+// numberValue returns v as a float64 if it's a JSON number, decoded as either float64 or json.Number.
+func numberValue(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// setEpochTimes sets the values of a time field from records' epoch timestamps for attr, in the named unit or the
+// one detected from them.
+func setEpochTimes(field *data.Field, records []map[string]any, attr string, unitName string) {
+	var values []float64
+	for _, record := range records {
+		if v, ok := numberValue(record[attr]); ok {
+			values = append(values, v)
+		}
+	}
+	unit := epochUnit(unitName, values)
+
+	for i, record := range records {
+		if v, ok := numberValue(record[attr]); ok {
+			t := epochToTime(v, unit)
+			field.Set(i, &t)
+		}
+	}
+}
+
+// convertValue converts a JSON-decoded value to a value for a field of fieldType, as inferred by inferFieldType.
+// Time fields are set by setEpochTimes instead.
+func convertValue(v any, fieldType data.FieldType) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	switch fieldType {
+	case data.FieldTypeNullableInt64:
+		i, err := v.(json.Number).Int64()
+		if err != nil {
+			return nil, err
+		}
+		return &i, nil
+	case data.FieldTypeNullableFloat64:
+		f, _ := numberValue(v)
+		return &f, nil
+	case data.FieldTypeNullableBool:
+		b := v.(bool)
+		return &b, nil
+	case data.FieldTypeNullableString:
+		s := v.(string)
+		return &s, nil
+	default:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		msg := json.RawMessage(raw)
+		return &msg, nil
+	}
+}
+
+// setTimeField converts frame's attribute field to a time field and moves it first, so Grafana uses it as the time
+// of each record. Numbers are read as epoch timestamps in the named unit, or the one detected from them, and strings
+// as RFC 3339 times. A frame without the attribute, e.g. because there are no records, is left as it is.
+func setTimeField(frame *data.Frame, attribute string, unitName string) error {
+	field, idx := frame.FieldByName(attribute)
+	if idx < 0 {
+		return nil
+	}
+
+	var epochs []float64
+	for i := range field.Len() {
+		if v, ok := field.ConcreteAt(i); ok {
+			switch v := v.(type) {
+			case float64:
+				epochs = append(epochs, v)
+			case int64:
+				epochs = append(epochs, float64(v))
+			}
+		}
+	}
+	unit := epochUnit(unitName, epochs)
+
+	times := make([]*time.Time, field.Len())
+	for i := range times {
+		v, ok := field.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		var t time.Time
+		switch v := v.(type) {
+		case time.Time:
+			t = v
+		case float64:
+			t = epochToTime(v, unit)
+		case int64:
+			t = epochToTime(float64(v), unit)
+		case string:
+			var err error
+			if t, err = time.Parse(time.RFC3339Nano, v); err != nil {
+				return &QueryValidationError{Field: "queryAttrs.timeField", Problem: fmt.Sprintf("'%s' isn't a timestamp: %s", attribute, err)}
+			}
+		default:
+			return &QueryValidationError{Field: "queryAttrs.timeField", Problem: fmt.Sprintf("'%s' isn't a timestamp", attribute)}
+		}
+		times[i] = &t
+	}
+
+	timeField := data.NewField(field.Name, field.Labels, times)
+	frame.Fields = append([]*data.Field{timeField}, slices.Delete(frame.Fields, idx, idx+1)...)
+	return nil
+}
@@ -0,0 +1,442 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestQuerySearchByConditions(t *testing.T) {
+	var sent map[string]any
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "search_by_conditions" {
+			return nil, nil
+		}
+		sent = op
+		return []map[string]any{
+			{"id": 1, "name": "Harper", "age": 5, "__createdtime__": 1_700_000_000_000, "tags": []string{"good"}},
+			{"id": 2, "name": "Penny", "age": nil, "__createdtime__": 1_700_000_001_000, "tags": nil},
+		}, nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	queryJSON, _ := json.Marshal(map[string]any{
+		"operation": "search_by_conditions",
+		"queryAttrs": map[string]any{
+			"database": "dev",
+			"table":    "dog",
+			"operator": "or",
+			"sort":     map[string]any{"attribute": "age", "descending": true},
+			"conditions": []map[string]any{
+				{"attribute": "age", "comparator": "greater_than", "value": map[string]any{"val": 3, "type": "number"}},
+				{"operator": "and", "conditions": []map[string]any{
+					{"attribute": "name", "comparator": "starts_with", "value": map[string]any{"val": "P", "type": "string"}},
+				}},
+			},
+		},
+	})
+	res, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: queryJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sent["database"] != "dev" || sent["operator"] != "or" || sent["sort"].(map[string]any)["descending"] != true {
+		t.Errorf("unexpected operation sent: %v", sent)
+	}
+	nested := sent["conditions"].([]any)[1].(map[string]any)["conditions"].([]any)[0].(map[string]any)
+	if nested["attribute"] != "name" || nested["value"] != "P" {
+		t.Errorf("expected nested conditions to be sent, got %v", sent["conditions"])
+	}
+
+	frame := res.Frames[0]
+	if frame.Name != "A: dev.dog" || frame.Rows() != 2 {
+		t.Fatalf("expected 2 rows in frame 'A: dev.dog', got %d in '%s'", frame.Rows(), frame.Name)
+	}
+	want := map[string]data.FieldType{
+		"__createdtime__": data.FieldTypeNullableTime,
+		"age":             data.FieldTypeNullableInt64,
+		"id":              data.FieldTypeNullableInt64,
+		"name":            data.FieldTypeNullableString,
+		"tags":            data.FieldTypeNullableJSON,
+	}
+	for _, field := range frame.Fields {
+		if field.Type() != want[field.Name] {
+			t.Errorf("expected %s to be %s, got %s", field.Name, want[field.Name], field.Type())
+		}
+	}
+}
+
+func TestSortValToSort(t *testing.T) {
+	sort := (&SortVal{
+		Attribute: "breed",
+		Next:      &SortVal{Attribute: "age", Descending: true, Next: &SortVal{Attribute: "name"}},
+	}).toSort()
+
+	var keys []string
+	for s := sort; s != nil; s = s.Next {
+		key := s.Attribute
+		if s.Descending {
+			key += " desc"
+		}
+		keys = append(keys, key)
+	}
+	if strings.Join(keys, ", ") != "breed, age desc, name" {
+		t.Errorf("expected the whole sort chain, got %v", keys)
+	}
+
+	if (&SortVal{}).toSort() != nil {
+		t.Error("expected no sort without an attribute")
+	}
+}
+
+func TestQuerySearchByConditionsLimit(t *testing.T) {
+	var sent map[string]any
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "search_by_conditions" {
+			return nil, nil
+		}
+		sent = op
+		records := []map[string]any{{"id": 1}, {"id": 2}, {"id": 3}}
+		if limit, ok := op["limit"].(float64); ok && int(limit) < len(records) {
+			records = records[:int(limit)]
+		}
+		return records, nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	search := func(limit int) *data.Frame {
+		t.Helper()
+		queryJSON, _ := json.Marshal(map[string]any{
+			"operation":  "search_by_conditions",
+			"queryAttrs": map[string]any{"database": "dev", "table": "dog", "limit": limit, "offset": 10},
+		})
+		res, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: queryJSON})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Frames[0]
+	}
+
+	frame := search(2)
+	if sent["offset"] != float64(10) {
+		t.Errorf("expected the offset to be sent, got %v", sent)
+	}
+	if frame.Rows() != 2 {
+		t.Errorf("expected 2 rows, got %d", frame.Rows())
+	}
+	if frame.Meta == nil || len(frame.Meta.Notices) != 1 {
+		t.Errorf("expected a truncation notice, got %+v", frame.Meta)
+	}
+
+	frame = search(3)
+	if frame.Rows() != 3 {
+		t.Errorf("expected 3 rows, got %d", frame.Rows())
+	}
+	if frame.Meta != nil && len(frame.Meta.Notices) > 0 {
+		t.Errorf("expected no truncation notice, got %v", frame.Meta.Notices)
+	}
+}
+
+func TestQuerySearchByConditionsPaging(t *testing.T) {
+	var requests int
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		requests++
+		records := make([]map[string]any, 0)
+		for i := range 7 {
+			records = append(records, map[string]any{"id": i})
+		}
+		offset, _ := op["offset"].(float64)
+		records = records[min(int(offset), len(records)):]
+		if limit, ok := op["limit"].(float64); ok && int(limit) < len(records) {
+			records = records[:int(limit)]
+		}
+		return records, nil
+	}
+	ds := newTestDatasource(t, Settings{SearchPageSize: 3}, client)
+
+	search := func(ctx context.Context, limit int) (backend.DataResponse, error) {
+		queryJSON, _ := json.Marshal(map[string]any{
+			"operation":  "search_by_conditions",
+			"queryAttrs": map[string]any{"database": "dev", "table": "dog", "limit": limit},
+		})
+		return ds.query(ctx, backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: queryJSON})
+	}
+
+	res, err := search(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := res.Frames[0].Rows(); rows != 7 || requests != 3 {
+		t.Errorf("expected 7 rows in 3 pages, got %d rows in %d", rows, requests)
+	}
+	if id, _ := res.Frames[0].Fields[0].NullableFloatAt(6); id == nil || *id != 6 {
+		t.Errorf("expected the pages in order, got last id %v", id)
+	}
+
+	requests = 0
+	res, err = search(context.Background(), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := res.Frames[0].Rows(); rows != 5 || requests != 2 {
+		t.Errorf("expected 5 rows in 2 pages, got %d rows in %d", rows, requests)
+	}
+	if res.Frames[0].Meta == nil || len(res.Frames[0].Meta.Notices) != 1 {
+		t.Error("expected a truncation notice")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := search(ctx, 0); err == nil {
+		t.Error("expected a cancelled query to fail")
+	}
+}
+
+func TestQuerySearchByConditionsTimeField(t *testing.T) {
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		return []map[string]any{
+			{"id": 1, "status": "shipped", "orderedAt": "2024-05-01T12:00:00Z", "shippedAt": 1_714_568_400_000},
+			{"id": 2, "status": "pending", "orderedAt": "2024-05-01T13:00:00Z", "shippedAt": nil},
+		}, nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	search := func(timeField string) (backend.DataResponse, error) {
+		queryJSON, _ := json.Marshal(map[string]any{
+			"operation":  "search_by_conditions",
+			"queryAttrs": map[string]any{"database": "dev", "table": "order", "timeField": timeField},
+		})
+		return ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: queryJSON})
+	}
+
+	for _, timeField := range []string{"orderedAt", "shippedAt"} {
+		res, err := search(timeField)
+		if err != nil {
+			t.Fatal(err)
+		}
+		field := res.Frames[0].Fields[0]
+		if field.Name != timeField || field.Type() != data.FieldTypeNullableTime {
+			t.Errorf("expected %s to be the first field, as time, got %s (%s)", timeField, field.Name, field.Type())
+		}
+		if len(res.Frames[0].Fields) != 4 {
+			t.Errorf("expected 4 fields, got %d", len(res.Frames[0].Fields))
+		}
+	}
+
+	if _, err := search("status"); err == nil {
+		t.Error("expected an attribute that isn't a timestamp to be rejected")
+	}
+}
+
+func TestRecordsToFrameEpochSeconds(t *testing.T) {
+	records := []map[string]any{{"__createdtime__": 1_714_564_800.0}, {"__createdtime__": 1_714_564_801.5}}
+	frame, err := recordsToFrame("A", records, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := frame.Fields[0].At(1).(*time.Time)
+	if want := time.UnixMilli(1_714_564_801_500); got == nil || !got.Equal(want) {
+		t.Errorf("expected epoch seconds to be detected, got %v", got)
+	}
+}
+
+func TestSearchValueCoerce(t *testing.T) {
+	tests := []struct {
+		value SearchValue
+		want  any
+	}{
+		{SearchValue{Val: "dog"}, "dog"},
+		{SearchValue{Val: "42", Type: "auto"}, "42"},
+		{SearchValue{Val: 42.0, Type: "string"}, "42"},
+		{SearchValue{Val: " 4.5 ", Type: "number"}, 4.5},
+		{SearchValue{Val: "TRUE", Type: "boolean"}, true},
+		{SearchValue{Val: "1, 2,3", Type: "number_array"}, []float64{1, 2, 3}},
+		{SearchValue{Val: []any{"1", 2.0}, Type: "number_array"}, []float64{1, 2}},
+		{SearchValue{Val: "2024-05-01T12:00:00Z", Type: "timestamp"}, int64(1_714_564_800_000)},
+		{SearchValue{Val: "1714564800000", Type: "timestamp"}, int64(1_714_564_800_000)},
+	}
+	for _, tt := range tests {
+		got, err := tt.value.coerce()
+		if err != nil {
+			t.Errorf("could not coerce %v: %v", tt.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expected %v to be coerced to %#v, got %#v", tt.value, tt.want, got)
+		}
+	}
+
+	for _, value := range []SearchValue{
+		{Val: "many", Type: "number"},
+		{Val: "maybe", Type: "boolean"},
+		{Val: "1,two", Type: "number_array"},
+		{Val: "yesterday", Type: "timestamp"},
+		{Val: "x", Type: "uuid"},
+	} {
+		if _, err := value.coerce(); err == nil {
+			t.Errorf("expected %v not to be coerced", value)
+		}
+	}
+}
+
+func TestQuerySearchByConditionsCoercesValues(t *testing.T) {
+	client := newFakeHarperClient()
+	var sent map[string]any
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "search_by_conditions" {
+			return nil, nil
+		}
+		sent = op
+		return []map[string]any{}, nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	query := func(value map[string]any) error {
+		queryJSON, _ := json.Marshal(map[string]any{
+			"operation": "search_by_conditions",
+			"queryAttrs": map[string]any{
+				"database":   "dev",
+				"table":      "dog",
+				"conditions": []map[string]any{{"attribute": "age", "comparator": "greater_than", "value": value}},
+			},
+		})
+		_, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: queryJSON})
+		return err
+	}
+
+	if err := query(map[string]any{"val": "3", "type": "number"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := sent["conditions"].([]any)[0].(map[string]any)["value"]; got != 3.0 {
+		t.Errorf("expected the value to be sent as a number, got %#v", got)
+	}
+
+	var vErr *QueryValidationError
+	if err := query(map[string]any{"val": "three", "type": "number"}); !errors.As(err, &vErr) {
+		t.Errorf("expected a validation error, got %v", err)
+	}
+}
+
+func TestInCondition(t *testing.T) {
+	sc, err := (&Condition{
+		Attribute:  "node",
+		Comparator: "in",
+		Value:      SearchValue{Val: "{node-1,node-2}", Type: "string"},
+	}).toSearchCondition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Operator != "or" || len(sc.Conditions) != 2 {
+		t.Fatalf("expected an or group of 2 conditions, got %+v", sc)
+	}
+	for i, want := range []string{"node-1", "node-2"} {
+		c := sc.Conditions[i]
+		if c.Attribute != "node" || c.Comparator != "equals" || c.Value != want {
+			t.Errorf("expected node equals %s, got %+v", want, c)
+		}
+	}
+
+	sc, err = (&Condition{
+		Attribute:  "port",
+		Comparator: "in",
+		Value:      SearchValue{Val: []any{"9925"}, Type: "number"},
+	}).toSearchCondition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Comparator != "equals" || sc.Value != 9925.0 {
+		t.Errorf("expected a single value to be an equals condition, got %+v", sc)
+	}
+
+	if _, err := (&Condition{Attribute: "node", Comparator: "in", Value: SearchValue{Val: []any{}}}).toSearchCondition(); err == nil {
+		t.Error("expected an empty list to be rejected")
+	}
+
+	// a value with a comma in it, outside a multi-value variable's braces, is a single value
+	sc, err = (&Condition{
+		Attribute:  "name",
+		Comparator: "in",
+		Value:      SearchValue{Val: "Smith, John", Type: "string"},
+	}).toSearchCondition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Comparator != "equals" || sc.Value != "Smith, John" {
+		t.Errorf("expected name equals Smith, John, got %+v", sc)
+	}
+	sc, err = (&Condition{
+		Attribute:  "name",
+		Comparator: "in",
+		Value:      SearchValue{Val: []any{"Smith, John", "Doe, Jane"}, Type: "string"},
+	}).toSearchCondition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sc.Conditions) != 2 || sc.Conditions[0].Value != "Smith, John" || sc.Conditions[1].Value != "Doe, Jane" {
+		t.Errorf("expected a condition per list element, got %+v", sc)
+	}
+}
+
+func TestRangeConditions(t *testing.T) {
+	sc, err := (&Condition{
+		Attribute:  "__createdtime__",
+		Comparator: "between",
+		Value:      SearchValue{Val: []any{"2024-05-01T00:00:00Z", "1714608000000"}, Type: "timestamp"},
+	}).toSearchCondition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{int64(1_714_521_600_000), int64(1_714_608_000_000)}; sc.Comparator != "between" || !reflect.DeepEqual(sc.Value, want) {
+		t.Errorf("expected a between condition on %v, got %+v", want, sc)
+	}
+
+	sc, err = (&Condition{
+		Attribute:  "age",
+		Comparator: "not_between",
+		Value:      SearchValue{Val: "3,7", Type: "number_array"},
+	}).toSearchCondition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Operator != "or" || len(sc.Conditions) != 2 ||
+		sc.Conditions[0].Comparator != "less_than" || sc.Conditions[0].Value != 3.0 ||
+		sc.Conditions[1].Comparator != "greater_than" || sc.Conditions[1].Value != 7.0 {
+		t.Errorf("expected age < 3 or age > 7, got %+v", sc)
+	}
+
+	for _, val := range []any{[]any{1.0}, []any{1.0, 2.0, 3.0}, 5.0} {
+		if _, err := (&Condition{Attribute: "age", Comparator: "between", Value: SearchValue{Val: val}}).toSearchCondition(); err == nil {
+			t.Errorf("expected %v to be rejected as bounds", val)
+		}
+	}
+}
+
+func TestNullConditions(t *testing.T) {
+	for comparator, want := range map[string]string{
+		"is_null":  `{"attribute":"owner","comparator":"equals","value":null}`,
+		"not_null": `{"attribute":"owner","comparator":"not_equal","value":null}`,
+	} {
+		sc, err := (&Condition{Attribute: "owner", Comparator: comparator, Value: SearchValue{Val: "ignored"}}).toSearchCondition()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := json.Marshal(sc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("expected %s to be sent as %s, got %s", comparator, want, got)
+		}
+	}
+}
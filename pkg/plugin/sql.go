@@ -0,0 +1,116 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+type SQLQuery struct {
+	SQL string `json:"sql" validate:"required"`
+}
+
+type sqlOperation struct {
+	Operation string `json:"operation"`
+	SQL       string `json:"sql"`
+}
+
+func (o sqlOperation) Prepare() any {
+	return o
+}
+
+func (d *Datasource) querySQL(client HarperClient, refID string, request SQLQuery) (backend.DataResponse, error) {
+	op := sqlOperation{Operation: harper.OP_SQL, SQL: request.SQL}
+
+	d.logger.Debug("executing Harper operation", "refID", refID, "operation", op.Operation, "sql", op.SQL)
+	start := time.Now()
+	var rows []json.RawMessage
+	if err := client.RawRequest(op, &rows); err != nil {
+		return backend.DataResponse{}, fmt.Errorf("could not run SQL query: '%w'", err)
+	}
+	d.logger.Debug("Harper operation completed", "refID", refID, "operation", op.Operation,
+		"duration", time.Since(start), "results", len(rows))
+	truncated := len(rows) > d.maxRows()
+	if truncated {
+		rows = rows[:d.maxRows()]
+	}
+
+	records, columns, err := decodeRecords(rows)
+	if err != nil {
+		return backend.DataResponse{}, fmt.Errorf("could not decode SQL result: '%w'", err)
+	}
+
+	frame, err := recordsToFrame(frameName(refID, "SQL"), records, columns)
+	if err != nil {
+		return backend.DataResponse{}, err
+	}
+	frame.SetRefID(refID)
+	frame.SetMeta(&data.FrameMeta{ExecutedQueryString: request.SQL})
+	applyFieldNaming(frame, d.settings.FieldNaming)
+	setFieldDisplayHints(frame)
+	if truncated {
+		frame.AppendNotices(maxRowsNotice(d.maxRows()))
+	}
+
+	return backend.DataResponse{Frames: data.Frames{frame}}, nil
+}
+
+// decodeRecords decodes JSON objects into records, also returning every key in the order it first appears, so the
+// frame's columns follow the SELECT list rather than being sorted. Numbers are decoded as json.Number, so integers
+// too large for a float64 keep their precision.
+func decodeRecords(rows []json.RawMessage) ([]map[string]any, []string, error) {
+	records := make([]map[string]any, 0, len(rows))
+	var columns []string
+	seen := make(map[string]bool)
+
+	for _, row := range rows {
+		var record map[string]any
+		dec := json.NewDecoder(bytes.NewReader(row))
+		dec.UseNumber()
+		if err := dec.Decode(&record); err != nil {
+			return nil, nil, err
+		}
+		records = append(records, record)
+
+		keys, err := objectKeys(row)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, k := range keys {
+			if !seen[k] {
+				seen[k] = true
+				columns = append(columns, k)
+			}
+		}
+	}
+
+	return records, columns, nil
+}
+
+// objectKeys returns the top-level keys of a JSON object in document order.
+func objectKeys(raw json.RawMessage) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, tok.(string))
+
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
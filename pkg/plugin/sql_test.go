@@ -0,0 +1,76 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestQuerySQL(t *testing.T) {
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "sql" {
+			return nil, nil
+		}
+		return json.RawMessage(`[{"name":"Harper","age":5,"good":true},{"name":"Penny","age":2,"good":true}]`), nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	queryJSON, _ := json.Marshal(map[string]any{
+		"operation":  "sql",
+		"queryAttrs": map[string]any{"sql": "SELECT name, age, good FROM dev.dog"},
+	})
+	res, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: queryJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := res.Frames[0]
+	if frame.Rows() != 2 {
+		t.Fatalf("expected 2 rows, got %d", frame.Rows())
+	}
+	for i, name := range []string{"name", "age", "good"} {
+		if frame.Fields[i].Name != name {
+			t.Errorf("expected column %d to be %s, got %s", i, name, frame.Fields[i].Name)
+		}
+	}
+
+	writeJSON, _ := json.Marshal(map[string]any{
+		"operation":  "sql",
+		"queryAttrs": map[string]any{"sql": "DELETE FROM dev.dog"},
+	})
+	if _, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "B", JSON: writeJSON}); err == nil {
+		t.Error("expected a write statement to be rejected")
+	}
+}
+
+func TestQuerySQLNumberTypes(t *testing.T) {
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		return json.RawMessage(`[{"id":9007199254740993,"weight":30,"count":1},{"id":9007199254740995,"weight":29.5,"count":null}]`), nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	queryJSON, _ := json.Marshal(map[string]any{
+		"operation":  "sql",
+		"queryAttrs": map[string]any{"sql": "SELECT id, weight, count FROM dev.dog"},
+	})
+	res, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: queryJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := res.Frames[0]
+	want := []data.FieldType{data.FieldTypeNullableInt64, data.FieldTypeNullableFloat64, data.FieldTypeNullableInt64}
+	for i, fieldType := range want {
+		if frame.Fields[i].Type() != fieldType {
+			t.Errorf("expected %s to be %s, got %s", frame.Fields[i].Name, fieldType, frame.Fields[i].Type())
+		}
+	}
+	if id := frame.Fields[0].At(1).(*int64); *id != 9007199254740995 {
+		t.Errorf("expected the ID to keep its precision, got %d", *id)
+	}
+}
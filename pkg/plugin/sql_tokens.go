@@ -0,0 +1,212 @@
+package plugin
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kinds of SQL token.
+const (
+	// sqlWord is a keyword, identifier or number.
+	sqlWord = iota
+	// sqlQuotedIdent is a `quoted` or "quoted" identifier.
+	sqlQuotedIdent
+	// sqlString is a 'string literal'.
+	sqlString
+	// sqlPunct is any other character, such as ".", ",", "(" or ";".
+	sqlPunct
+)
+
+// sqlToken is a token of a SQL statement, at stmt[start:end]. Its text is an identifier's name without its quotes.
+type sqlToken struct {
+	kind       int
+	text       string
+	start, end int
+}
+
+// isWord returns whether the token is the keyword word, in any case.
+func (t sqlToken) isWord(word string) bool {
+	return t.kind == sqlWord && strings.EqualFold(t.text, word)
+}
+
+// isIdent returns whether the token is a word or quoted identifier.
+func (t sqlToken) isIdent() bool {
+	return t.kind == sqlWord || t.kind == sqlQuotedIdent
+}
+
+// sqlTokens splits stmt into tokens, skipping whitespace and comments. ok is false if a quote or comment isn't closed,
+// so the statement can't be read reliably.
+func sqlTokens(stmt string) (tokens []sqlToken, ok bool) {
+	for i := 0; i < len(stmt); {
+		c := stmt[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case strings.HasPrefix(stmt[i:], "--"):
+			end := strings.IndexByte(stmt[i:], '\n')
+			if end < 0 {
+				return tokens, true
+			}
+			i += end + 1
+		case strings.HasPrefix(stmt[i:], "/*"):
+			end := strings.Index(stmt[i+2:], "*/")
+			if end < 0 {
+				return nil, false
+			}
+			i += 2 + end + 2
+		case c == '\'' || c == '"' || c == '`':
+			end, text, closed := scanQuoted(stmt, i)
+			if !closed {
+				return nil, false
+			}
+			kind := sqlQuotedIdent
+			if c == '\'' {
+				kind = sqlString
+			}
+			tokens = append(tokens, sqlToken{kind: kind, text: text, start: i, end: end})
+			i = end
+		case isSQLWordByte(stmt, i):
+			end := i
+			for end < len(stmt) && isSQLWordByte(stmt, end) {
+				_, size := utf8.DecodeRuneInString(stmt[end:])
+				end += size
+			}
+			tokens = append(tokens, sqlToken{kind: sqlWord, text: stmt[i:end], start: i, end: end})
+			i = end
+		default:
+			_, size := utf8.DecodeRuneInString(stmt[i:])
+			tokens = append(tokens, sqlToken{kind: sqlPunct, text: stmt[i : i+size], start: i, end: i + size})
+			i += size
+		}
+	}
+	return tokens, true
+}
+
+// scanQuoted reads the quoted string starting at stmt[start], where a doubled quote is part of the string. It returns
+// the index after the closing quote and the unquoted text. A string literal with a backslash in it can't be read
+// (closed is false), since whether the backslash escapes the quote after it depends on the SQL dialect.
+func scanQuoted(stmt string, start int) (end int, text string, closed bool) {
+	quote := stmt[start]
+	var b strings.Builder
+	for i := start + 1; i < len(stmt); i++ {
+		switch {
+		case stmt[i] == '\\' && quote == '\'':
+			return len(stmt), "", false
+		case stmt[i] != quote:
+			b.WriteByte(stmt[i])
+		case i+1 < len(stmt) && stmt[i+1] == quote:
+			i++
+			b.WriteByte(quote)
+		default:
+			return i + 1, b.String(), true
+		}
+	}
+	return len(stmt), "", false
+}
+
+func isSQLWordByte(stmt string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(stmt[i:])
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// sqlStatements splits tokens into the statements separated by semicolons, leaving out empty ones.
+func sqlStatements(tokens []sqlToken) [][]sqlToken {
+	var statements [][]sqlToken
+	start := 0
+	for i, t := range tokens {
+		if t.kind == sqlPunct && t.text == ";" {
+			if i > start {
+				statements = append(statements, tokens[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		statements = append(statements, tokens[start:])
+	}
+	return statements
+}
+
+// sqlTable is a table a SQL statement reads or writes.
+type sqlTable struct {
+	// database is "" if the table isn't qualified with one.
+	database string
+	table    string
+	// databaseToken is where the database name is in the statement.
+	databaseToken sqlToken
+}
+
+// sqlClauseKeywords are the keywords that may follow a table reference, so aren't its alias.
+var sqlClauseKeywords = []string{
+	"cross", "except", "fetch", "for", "full", "group", "having", "inner", "intersect", "join", "left", "limit",
+	"natural", "offset", "on", "order", "outer", "right", "set", "union", "using", "values", "where", "window",
+}
+
+// sqlTables returns the tables in the FROM, JOIN, INTO and UPDATE clauses of stmt, including those after commas and
+// in subqueries. ok is false if stmt can't be read or one of the clauses names something other than a table, such
+// as a table function, so the tables it uses can't all be known.
+func sqlTables(stmt string) (tables []sqlTable, ok bool) {
+	tokens, ok := sqlTokens(stmt)
+	if !ok {
+		return nil, false
+	}
+	isPunct := func(i int, p string) bool {
+		return i < len(tokens) && tokens[i].kind == sqlPunct && tokens[i].text == p
+	}
+
+	for i, t := range tokens {
+		if !t.isWord("from") && !t.isWord("join") && !t.isWord("into") && !t.isWord("update") {
+			continue
+		}
+		// (a table's columns may follow it in an INTO clause, but otherwise it's a function call)
+		columnsMayFollow := t.isWord("into")
+
+		for j := i + 1; ; j++ {
+			switch {
+			case isPunct(j, "("):
+				// a subquery, whose own clauses are read in turn
+				depth := 0
+				for ; j < len(tokens); j++ {
+					if isPunct(j, "(") {
+						depth++
+					} else if isPunct(j, ")") {
+						if depth--; depth == 0 {
+							break
+						}
+					}
+				}
+				if j == len(tokens) {
+					return nil, false
+				}
+				j++
+			case j < len(tokens) && tokens[j].isIdent():
+				table := sqlTable{table: tokens[j].text}
+				if isPunct(j+1, ".") && j+2 < len(tokens) && tokens[j+2].isIdent() {
+					table = sqlTable{database: tokens[j].text, table: tokens[j+2].text, databaseToken: tokens[j]}
+					j += 2
+				}
+				j++
+				if isPunct(j, ".") || (isPunct(j, "(") && !columnsMayFollow) {
+					return nil, false
+				}
+				tables = append(tables, table)
+			default:
+				return nil, false
+			}
+
+			// skip the alias, if any
+			if j < len(tokens) && tokens[j].isWord("as") {
+				j++
+			}
+			if j < len(tokens) && tokens[j].isIdent() && !slices.ContainsFunc(sqlClauseKeywords, tokens[j].isWord) {
+				j++
+			}
+			if !isPunct(j, ",") {
+				break
+			}
+		}
+	}
+	return tables, true
+}
@@ -0,0 +1,132 @@
+package plugin
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+// pluginID is the datasource plugin's type, as used in dashboard datasource references.
+const pluginID = "harperfast-harper-datasource"
+
+//go:embed dashboards/*.json
+var starterDashboardFiles embed.FS
+
+type starterDashboardsHandler struct {
+	datasource *Datasource
+}
+
+func newStarterDashboardsHandler(datasource *Datasource) *starterDashboardsHandler {
+	return &starterDashboardsHandler{datasource: datasource}
+}
+
+// starterDashboardInfo describes a starter dashboard in the GET /dashboards listing.
+type starterDashboardInfo struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// starterDashboard returns the bundled dashboard id with every reference to this plugin's datasources pointed at the
+// datasource with uid.
+func starterDashboard(id string, uid string) (map[string]any, error) {
+	raw, err := starterDashboardFiles.ReadFile(path.Join("dashboards", id+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var dashboard map[string]any
+	if err := json.Unmarshal(raw, &dashboard); err != nil {
+		return nil, fmt.Errorf("could not unmarshal starter dashboard '%s': '%w'", id, err)
+	}
+	injectDatasourceUID(dashboard, uid)
+
+	return dashboard, nil
+}
+
+// injectDatasourceUID sets the uid of every datasource reference to this plugin in v, recursively.
+func injectDatasourceUID(v any, uid string) {
+	switch v := v.(type) {
+	case map[string]any:
+		if ref, ok := v["datasource"].(map[string]any); ok && ref["type"] == pluginID {
+			ref["uid"] = uid
+		}
+		for _, child := range v {
+			injectDatasourceUID(child, uid)
+		}
+	case []any:
+		for _, child := range v {
+			injectDatasourceUID(child, uid)
+		}
+	}
+}
+
+func starterDashboardIDs() ([]string, error) {
+	entries, err := starterDashboardFiles.ReadDir("dashboards")
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// ServeHTTP serves GET /dashboards, the list of starter dashboards, and GET /dashboards/{id}, a starter dashboard
+// ready to import for this datasource.
+func (sh *starterDashboardsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+
+	var resp any
+	if id := r.PathValue("id"); id != "" {
+		dashboard, err := starterDashboard(id, sh.datasource.uid)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("no starter dashboard '%s'", id), http.StatusNotFound)
+			return
+		}
+		resp = dashboard
+	} else {
+		ids, err := starterDashboardIDs()
+		if err != nil {
+			sh.datasource.logger.Error("failed to list starter dashboards", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		infos := make([]starterDashboardInfo, 0, len(ids))
+		for _, id := range ids {
+			dashboard, err := starterDashboard(id, sh.datasource.uid)
+			if err != nil {
+				sh.datasource.logger.Error("failed to load starter dashboard", "id", id, "error", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			title, _ := dashboard["title"].(string)
+			description, _ := dashboard["description"].(string)
+			infos = append(infos, starterDashboardInfo{ID: id, Title: title, Description: description})
+		}
+		resp = infos
+	}
+
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		sh.datasource.logger.Error("error marshaling starter dashboards to JSON", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(jsonResp)
+	if err != nil {
+		sh.datasource.logger.Error("error writing response", "error", err)
+	}
+}
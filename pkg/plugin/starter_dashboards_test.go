@@ -0,0 +1,32 @@
+package plugin
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestStarterDashboards(t *testing.T) {
+	ids, err := starterDashboardIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) == 0 {
+		t.Fatal("expected bundled starter dashboards")
+	}
+
+	for _, id := range ids {
+		dashboard, err := starterDashboard(id, "my-harper")
+		if err != nil {
+			t.Fatalf("%s: %v", id, err)
+		}
+		if dashboard["title"] == "" || dashboard["uid"] == "" {
+			t.Errorf("%s: expected a title and uid", id)
+		}
+
+		dashboardJSON, _ := json.Marshal(dashboard)
+		if strings.Contains(string(dashboardJSON), "${harperfastdatasource}") {
+			t.Errorf("%s: expected every datasource reference to use the datasource UID", id)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// SystemInformationQuery selects the system_information sections to fetch (e.g. "cpu", "memory", "disk",
+// "network"); all of them if empty.
+type SystemInformationQuery struct {
+	Attributes []string `json:"attributes"`
+}
+
+type systemInformationOperation struct {
+	Operation  string   `json:"operation"`
+	Attributes []string `json:"attributes,omitempty"`
+}
+
+func (o systemInformationOperation) Prepare() any {
+	return o
+}
+
+// querySystemInformation returns the node's system information as a single-row frame of every scalar value, with
+// dotted field names following the response's nesting (e.g. "memory.total"), and one frame per list of objects
+// (e.g. "disk.size" or "network.stats") with a row per element.
+func (d *Datasource) querySystemInformation(client HarperClient, refID string, request SystemInformationQuery) (backend.DataResponse, error) {
+	op := systemInformationOperation{Operation: harper.OP_SYSTEM_INFORMATION, Attributes: request.Attributes}
+
+	d.logger.Debug("executing Harper operation", "refID", refID, "operation", op.Operation, "request", op)
+	start := time.Now()
+	var info map[string]any
+	if err := client.RawRequest(op, &info); err != nil {
+		return backend.DataResponse{}, fmt.Errorf("could not get Harper system information: '%w'", err)
+	}
+	d.logger.Debug("Harper operation completed", "refID", refID, "operation", op.Operation, "duration", time.Since(start))
+
+	scalars := make(map[string]any)
+	lists := make(map[string][]any)
+	flattenSystemInformation("", info, scalars, lists)
+
+	frame, err := recordsToFrame(frameName(refID, op.Operation), []map[string]any{scalars}, slices.Sorted(maps.Keys(scalars)))
+	if err != nil {
+		return backend.DataResponse{}, err
+	}
+	frame.Fields = append([]*data.Field{data.NewField("time", nil, []time.Time{start})}, frame.Fields...)
+	frames := data.Frames{frame}
+
+	listPaths := slices.Sorted(maps.Keys(lists))
+	for _, path := range listPaths {
+		records := make([]map[string]any, 0, len(lists[path]))
+		for _, elem := range lists[path] {
+			record := make(map[string]any)
+			flattenSystemInformation("", elem, record, nil)
+			records = append(records, record)
+		}
+		listFrame, err := recordsToFrame(frameName(refID, op.Operation+" "+path), records, nil)
+		if err != nil {
+			return backend.DataResponse{}, err
+		}
+		frames = append(frames, listFrame)
+	}
+
+	for i, f := range frames {
+		// list frames' fields are named relative to the list
+		prefix := ""
+		if i > 0 {
+			prefix = listPaths[i-1] + "."
+		}
+		displayNames := make(map[*data.Field]string)
+		for _, field := range f.Fields {
+			if name, ok := sysinfoDisplayNames[prefix+field.Name]; ok {
+				displayNames[field] = name
+			}
+		}
+
+		f.SetRefID(refID)
+		applyFieldNaming(f, d.settings.FieldNaming)
+		setFieldDisplayHints(f)
+		for field, name := range displayNames {
+			field.Config.DisplayNameFromDS = name
+		}
+	}
+
+	return backend.DataResponse{Frames: frames}, nil
+}
+
+// sysinfoDisplayNames are readable names for the common system information fields, by their dotted path. Panels show
+// them instead of the paths, which are kept as the field names.
+var sysinfoDisplayNames = map[string]string{
+	"cpu.brand":                          "CPU",
+	"cpu.cores":                          "CPU cores",
+	"cpu.physicalCores":                  "CPU physical cores",
+	"cpu.speed":                          "CPU speed (GHz)",
+	"cpu.current_load.avgLoad":           "Load average",
+	"cpu.current_load.currentLoad":       "CPU load",
+	"cpu.current_load.currentLoadUser":   "CPU load (user)",
+	"cpu.current_load.currentLoadSystem": "CPU load (system)",
+	"cpu.current_load.currentLoadNice":   "CPU load (nice)",
+	"cpu.current_load.currentLoadIdle":   "CPU idle",
+	"cpu.current_load.currentLoadIrq":    "CPU load (IRQ)",
+	"disk.io.rIO":                        "Disk reads",
+	"disk.io.wIO":                        "Disk writes",
+	"disk.io.tIO":                        "Disk I/O operations",
+	"disk.read_write.rx":                 "Disk bytes read",
+	"disk.read_write.wx":                 "Disk bytes written",
+	"disk.read_write.tx":                 "Disk bytes transferred",
+	"disk.read_write.ms":                 "Disk I/O time",
+	"disk.size.fs":                       "File system",
+	"disk.size.mount":                    "Mount point",
+	"disk.size.size":                     "Disk size",
+	"disk.size.used":                     "Disk used",
+	"disk.size.available":                "Disk available",
+	"disk.size.use":                      "Disk used (%)",
+	"memory.total":                       "Memory total",
+	"memory.free":                        "Memory free",
+	"memory.used":                        "Memory used",
+	"memory.active":                      "Memory active",
+	"memory.available":                   "Memory available",
+	"memory.swaptotal":                   "Swap total",
+	"memory.swapused":                    "Swap used",
+	"memory.swapfree":                    "Swap free",
+	"memory.rss":                         "Resident set size",
+	"memory.heapTotal":                   "Heap total",
+	"memory.heapUsed":                    "Heap used",
+	"memory.external":                    "External memory",
+	"memory.arrayBuffers":                "Array buffers",
+	"network.default_interface":          "Default network interface",
+	"network.latency.ms":                 "Network latency",
+	"network.stats.iface":                "Interface",
+	"network.stats.rx_bytes":             "Bytes received",
+	"network.stats.tx_bytes":             "Bytes sent",
+	"network.stats.rx_dropped":           "Received packets dropped",
+	"network.stats.tx_dropped":           "Sent packets dropped",
+	"network.stats.rx_errors":            "Receive errors",
+	"network.stats.tx_errors":            "Send errors",
+	"system.hostname":                    "Hostname",
+	"system.platform":                    "Platform",
+	"system.distro":                      "Distribution",
+	"system.release":                     "Release",
+	"system.kernel":                      "Kernel",
+	"system.arch":                        "Architecture",
+	"system.node_version":                "Node.js version",
+	"time.uptime":                        "Uptime",
+	"time.timezone":                      "Time zone",
+}
+
+// flattenSystemInformation adds v's scalar values to scalars under dotted paths. Lists of objects are added to lists
+// (if it's not nil) under their path; other lists are kept as JSON values in scalars.
+func flattenSystemInformation(path string, v any, scalars map[string]any, lists map[string][]any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			flattenSystemInformation(childPath, child, scalars, lists)
+		}
+	case []any:
+		if lists != nil && len(v) > 0 && !slices.ContainsFunc(v, func(e any) bool { _, ok := e.(map[string]any); return !ok }) {
+			lists[path] = v
+			return
+		}
+		raw, _ := json.Marshal(v)
+		scalars[path] = json.RawMessage(raw)
+	default:
+		scalars[path] = v
+	}
+}
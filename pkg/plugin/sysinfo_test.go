@@ -0,0 +1,76 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestQuerySystemInformation(t *testing.T) {
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		if op["operation"] != "system_information" {
+			return nil, nil
+		}
+		return json.RawMessage(`{
+			"memory": {"total": 1024, "free": 256},
+			"cpu": {"brand": "Apple M1", "current_load": {"currentLoad": 12.5, "cpus": [{"load": 10}, {"load": 15}]}},
+			"disk": {"size": [{"fs": "/dev/disk1", "size": 500, "used": 100}]}
+		}`), nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	queryJSON, _ := json.Marshal(map[string]any{
+		"operation":  "system_information",
+		"queryAttrs": map[string]any{"attributes": []string{"cpu", "memory", "disk"}},
+	})
+	res, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: queryJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Frames) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(res.Frames))
+	}
+
+	frame := res.Frames[0]
+	if frame.Rows() != 1 {
+		t.Fatalf("expected 1 row, got %d", frame.Rows())
+	}
+	if frame.Fields[0].Name != "time" {
+		t.Errorf("expected the first field to be time, got %s", frame.Fields[0].Name)
+	}
+	field, _ := frame.FieldByName("memory.total")
+	if field == nil {
+		t.Fatal("expected a memory.total field")
+	}
+	if v, _ := field.NullableFloatAt(0); v == nil || *v != 1024 {
+		t.Errorf("expected memory.total to be 1024, got %v", v)
+	}
+	if field, _ := frame.FieldByName("cpu.current_load.currentLoad"); field == nil {
+		t.Error("expected a cpu.current_load.currentLoad field")
+	}
+	if name := field.Config.DisplayNameFromDS; name != "Memory total" {
+		t.Errorf("expected memory.total to be displayed as Memory total, got %q", name)
+	}
+	for _, f := range res.Frames[1:] {
+		if field, _ := f.FieldByName("used"); field != nil && field.Config.DisplayNameFromDS != "Disk used" {
+			t.Errorf("expected disk.size's used to be displayed as Disk used, got %q", field.Config.DisplayNameFromDS)
+		}
+	}
+
+	// lists of objects get a frame each, with a row per element
+	for _, f := range res.Frames[1:] {
+		if f.RefID != "A" {
+			t.Errorf("expected frame %s to have ref ID A, got %s", f.Name, f.RefID)
+		}
+	}
+	if res.Frames[1].Rows() != 2 {
+		t.Errorf("expected 2 cpu rows, got %d", res.Frames[1].Rows())
+	}
+	if res.Frames[2].Rows() != 1 {
+		t.Errorf("expected 1 disk row, got %d", res.Frames[2].Rows())
+	}
+}
@@ -0,0 +1,235 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+const (
+	tenantSourceOrg    = "org"
+	tenantSourceHeader = "header"
+
+	tenantPlaceholder = "{tenant}"
+)
+
+// TenancySettings configure multi-tenant mode, where every database name in outgoing operations is rewritten with a
+// tenant-specific prefix and/or suffix so one datasource can serve several customers' schemas. The tenant is the
+// Grafana org ID (Source "org", the default) or the value of one of the tenantHeaders (Source "header"), optionally
+// mapped to a tenant name through Tenants. "{tenant}" in DatabasePrefix and DatabaseSuffix is replaced with the
+// tenant. Only the tenantOperations may be sent in multi-tenant mode.
+type TenancySettings struct {
+	Enabled        bool              `json:"enabled"`
+	Source         string            `json:"source"`
+	Header         string            `json:"header"`
+	Tenants        map[string]string `json:"tenants"`
+	DatabasePrefix string            `json:"databasePrefix"`
+	DatabaseSuffix string            `json:"databaseSuffix"`
+}
+
+// tenantHeaders are the request headers header-based tenancy may read the tenant from: those Grafana sets itself on
+// query and resource requests, replacing any the browser sent, so users can't choose another tenant.
+var tenantHeaders = []string{"X-Grafana-User"}
+
+// check returns an error if the settings enable tenancy with an unknown source or a header Grafana doesn't set.
+func (ts TenancySettings) check() error {
+	if !ts.Enabled {
+		return nil
+	}
+	switch ts.Source {
+	case "", tenantSourceOrg:
+	case tenantSourceHeader:
+		if !slices.ContainsFunc(tenantHeaders, func(h string) bool { return strings.EqualFold(h, ts.Header) }) {
+			return fmt.Errorf("the tenant header '%s' isn't one Grafana sets: expected one of %s", ts.Header,
+				strings.Join(tenantHeaders, ", "))
+		}
+	default:
+		return fmt.Errorf("unsupported tenant source '%s'", ts.Source)
+	}
+	return nil
+}
+
+// TenantError is returned when a request's tenant can't be determined in multi-tenant mode.
+type TenantError struct {
+	Reason string
+}
+
+func (e *TenantError) Error() string {
+	return "could not determine the tenant for this request: " + e.Reason
+}
+
+type requestHeadersKey struct{}
+
+// withRequestHeaders stores the headers of the incoming Grafana request in ctx, for header-based tenancy.
+func withRequestHeaders(ctx context.Context, headers http.Header) context.Context {
+	return context.WithValue(ctx, requestHeadersKey{}, headers)
+}
+
+// queryRequestHeaders returns the headers Grafana forwarded with a query request. Depending on the Grafana version,
+// request metadata such as X-Dashboard-Uid arrives either as a forwarded HTTP header or as a plain request header, so
+// both are included.
+func queryRequestHeaders(req *backend.QueryDataRequest) http.Header {
+	headers := req.GetHTTPHeaders()
+	for k, v := range req.Headers {
+		if headers.Get(k) == "" {
+			headers.Set(k, v)
+		}
+	}
+	return headers
+}
+
+func requestHeadersFromContext(ctx context.Context) http.Header {
+	headers, _ := ctx.Value(requestHeadersKey{}).(http.Header)
+	return headers
+}
+
+// resolveTenant determines the tenant for a request, or returns "" when tenancy is disabled.
+func (ts TenancySettings) resolveTenant(ctx context.Context, pCtx backend.PluginContext) (string, error) {
+	if !ts.Enabled {
+		return "", nil
+	}
+
+	var id string
+	switch ts.Source {
+	case "", tenantSourceOrg:
+		if pCtx.OrgID == 0 {
+			return "", &TenantError{Reason: "no Grafana org ID"}
+		}
+		id = strconv.FormatInt(pCtx.OrgID, 10)
+	case tenantSourceHeader:
+		if err := ts.check(); err != nil {
+			return "", &TenantError{Reason: err.Error()}
+		}
+		id = requestHeadersFromContext(ctx).Get(ts.Header)
+		if id == "" {
+			return "", &TenantError{Reason: fmt.Sprintf("missing '%s' header", ts.Header)}
+		}
+	default:
+		return "", &TenantError{Reason: fmt.Sprintf("unsupported tenant source '%s'", ts.Source)}
+	}
+
+	if len(ts.Tenants) > 0 {
+		tenant, ok := ts.Tenants[id]
+		if !ok {
+			return "", &TenantError{Reason: fmt.Sprintf("no tenant is mapped to '%s'", id)}
+		}
+		return tenant, nil
+	}
+
+	return id, nil
+}
+
+// tenantDatabase maps a database name as seen by dashboards to the tenant's actual database.
+func (ts TenancySettings) tenantDatabase(tenant string, database string) string {
+	prefix := strings.ReplaceAll(ts.DatabasePrefix, tenantPlaceholder, tenant)
+	suffix := strings.ReplaceAll(ts.DatabaseSuffix, tenantPlaceholder, tenant)
+	return prefix + database + suffix
+}
+
+// rawOperation is an operation already in its JSON object form.
+type rawOperation map[string]any
+
+func (o rawOperation) Prepare() any {
+	return map[string]any(o)
+}
+
+// tenantOperations are the operations multi-tenant mode permits: those that act on a named database, which can be
+// mapped to the tenant's. Anything else, such as listing users, reading the server log or analytics, spans every
+// tenant and is rejected.
+var tenantOperations = []string{
+	harper.OP_CREATE_ATTRIBUTE,
+	harper.OP_CREATE_TABLE,
+	harper.OP_DELETE,
+	harper.OP_DESCRIBE_DATABASE,
+	harper.OP_DESCRIBE_SCHEMA,
+	harper.OP_DESCRIBE_TABLE,
+	harper.OP_DROP_ATTRIBUTE,
+	harper.OP_DROP_TABLE,
+	harper.OP_INSERT,
+	harper.OP_READ_AUDIT_LOG,
+	harper.OP_READ_TRANSACTION_LOG,
+	harper.OP_SEARCH_BY_CONDITIONS,
+	harper.OP_SEARCH_BY_HASH,
+	harper.OP_SEARCH_BY_ID,
+	harper.OP_SEARCH_BY_VALUE,
+	harper.OP_SQL, // its tables must all name their database, see rewriteSQLDatabases
+	harper.OP_UPDATE,
+	harper.OP_UPSERT,
+}
+
+// checkTenantOperation returns an *OperationNotAllowedError if the operation name can't be scoped to a tenant.
+func checkTenantOperation(name string) error {
+	if !slices.Contains(tenantOperations, name) {
+		return &OperationNotAllowedError{
+			Operation: name,
+			Reason:    "in multi-tenant mode only operations on the tenant's databases are permitted",
+		}
+	}
+	return nil
+}
+
+// rewriteForTenant returns op with its database (or schema) and the database of every table in its SQL mapped to the
+// tenant's databases. Operations whose databases can't all be mapped, as they'd read Harper's default database, one
+// that isn't the tenant's or none at all, are rejected. The policy has already checked op is one of the
+// tenantOperations.
+func (ts TenancySettings) rewriteForTenant(tenant string, op rawOperation) (rawOperation, error) {
+	name, _ := op["operation"].(string)
+
+	rewritten := maps.Clone(op)
+
+	var mapped bool
+	for _, key := range []string{"database", "schema"} {
+		if db, ok := op[key].(string); ok && db != "" {
+			rewritten[key] = ts.tenantDatabase(tenant, db)
+			mapped = true
+		}
+	}
+	if !mapped && name != harper.OP_SQL {
+		return nil, &OperationNotAllowedError{Operation: name, Reason: "in multi-tenant mode it must name its database"}
+	}
+
+	if stmt, ok := op["sql"].(string); ok {
+		sql, err := rewriteSQLDatabases(stmt, func(db string) string { return ts.tenantDatabase(tenant, db) })
+		if err != nil {
+			return nil, &OperationNotAllowedError{Operation: name, Reason: err.Error()}
+		}
+		rewritten["sql"] = sql
+	}
+
+	return rewritten, nil
+}
+
+// rewriteSQLDatabases applies mapDB to the database of every table in stmt, returning an error if there's a table
+// without one, or the tables can't all be found.
+func rewriteSQLDatabases(stmt string, mapDB func(string) string) (string, error) {
+	tables, ok := sqlTables(stmt)
+	if !ok {
+		return "", fmt.Errorf("in multi-tenant mode the tables SQL queries use must all be known")
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, table := range tables {
+		if table.database == "" {
+			return "", fmt.Errorf("in multi-tenant mode SQL queries must name the database of table '%s'", table.table)
+		}
+		db, mappedDB := table.databaseToken, mapDB(table.database)
+		b.WriteString(stmt[last:db.start])
+		if tokens, _ := sqlTokens(mappedDB); db.kind == sqlWord && len(tokens) == 1 && tokens[0].kind == sqlWord {
+			b.WriteString(mappedDB)
+		} else {
+			// (names that aren't a single word, such as with a tenant's "-", are quoted)
+			b.WriteString("`" + strings.ReplaceAll(mappedDB, "`", "``") + "`")
+		}
+		last = db.end
+	}
+	b.WriteString(stmt[last:])
+	return b.String(), nil
+}
@@ -0,0 +1,157 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestPolicyClientTenancy(t *testing.T) {
+	tenancy := TenancySettings{Enabled: true, DatabasePrefix: "t_{tenant}_"}
+
+	tests := []struct {
+		name    string
+		op      testOperation
+		wantOp  map[string]any
+		wantErr bool
+	}{
+		{
+			"database",
+			testOperation{"operation": "describe_table", "database": "dev", "table": "dog"},
+			map[string]any{"operation": "describe_table", "database": "t_acme_dev", "table": "dog"},
+			false,
+		},
+		{
+			"sql",
+			testOperation{"operation": "sql", "sql": "SELECT * FROM dev.dog d JOIN `hr`.salary s ON d.id = s.id"},
+			map[string]any{"operation": "sql", "sql": "SELECT * FROM t_acme_dev.dog d JOIN `t_acme_hr`.salary s ON d.id = s.id"},
+			false,
+		},
+		{
+			"sql comma join",
+			testOperation{"operation": "sql", "sql": "SELECT * FROM dev.dog, hr . salary AS s, `t2_dev`.secrets"},
+			map[string]any{"operation": "sql", "sql": "SELECT * FROM t_acme_dev.dog, t_acme_hr . salary AS s, `t_acme_t2_dev`.secrets"},
+			false,
+		},
+		{
+			"sql subquery",
+			testOperation{"operation": "sql", "sql": "SELECT * FROM dev.dog d WHERE d.id IN (SELECT id FROM hr.salary) AND d.name <> 'FROM x.y'"},
+			map[string]any{"operation": "sql", "sql": "SELECT * FROM t_acme_dev.dog d WHERE d.id IN (SELECT id FROM t_acme_hr.salary) AND d.name <> 'FROM x.y'"},
+			false,
+		},
+		{"sql unqualified table", testOperation{"operation": "sql", "sql": "SELECT * FROM dev.dog d JOIN salary s ON d.id = s.id"}, nil, true},
+		{"sql table function", testOperation{"operation": "sql", "sql": "SELECT * FROM dev.dog, files('t2_dev')"}, nil, true},
+		{"no database", testOperation{"operation": "search_by_value", "table": "dog", "search_attribute": "id", "search_value": "*"}, nil, true},
+		{"describe the default database", testOperation{"operation": "describe_database"}, nil, true},
+		{"describe all", testOperation{"operation": "describe_all"}, nil, true},
+		{"list users", testOperation{"operation": "list_users"}, nil, true},
+		{"list roles", testOperation{"operation": "list_roles"}, nil, true},
+		{"user info", testOperation{"operation": "user_info"}, nil, true},
+		{"read log", testOperation{"operation": "read_log"}, nil, true},
+		{"system information", testOperation{"operation": "system_information"}, nil, true},
+		{"registration info", testOperation{"operation": "registration_info"}, nil, true},
+		{"cluster status", testOperation{"operation": "cluster_status"}, nil, true},
+		{"get job", testOperation{"operation": "get_job", "id": "1"}, nil, true},
+		{"search jobs", testOperation{"operation": "search_jobs_by_start_date", "database": "dev"}, nil, true},
+		{"get analytics", testOperation{"operation": "get_analytics", "metric": "db-read"}, nil, true},
+		{"list metrics", testOperation{"operation": "list_metrics"}, nil, true},
+		{"describe metric", testOperation{"operation": "describe_metric", "metric": "db-read"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent map[string]any
+			fake := newFakeHarperClient()
+			fake.raw = func(op map[string]any) (any, error) {
+				sent = op
+				return nil, nil
+			}
+			pc := newPolicyClient(fake, Settings{Tenancy: tenancy}).forTenant("acme")
+
+			err := pc.RawRequest(tt.op, nil)
+			if tt.wantErr {
+				var policyErr *OperationNotAllowedError
+				if !errors.As(err, &policyErr) {
+					t.Errorf("expected an OperationNotAllowedError, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for k, v := range tt.wantOp {
+				if sent[k] != v {
+					t.Errorf("expected %s to be %q, got %q", k, v, sent[k])
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyClientTenancyAnalytics(t *testing.T) {
+	fake := newFakeHarperClient()
+	fake.addAnalytics("db-read", []time.Time{time.Now()}, map[string]any{"count": 1.0})
+	pc := newPolicyClient(fake, Settings{Tenancy: TenancySettings{Enabled: true}}).forTenant("acme")
+
+	var policyErr *OperationNotAllowedError
+	if _, err := pc.GetAnalytics(harper.GetAnalyticsRequest{Metric: "db-read"}); !errors.As(err, &policyErr) {
+		t.Errorf("expected analytics to be rejected in multi-tenant mode, got: %v", err)
+	}
+	if _, err := pc.ListMetrics(harper.ListMetricsRequest{}); !errors.As(err, &policyErr) {
+		t.Errorf("expected listing metrics to be rejected in multi-tenant mode, got: %v", err)
+	}
+	if _, err := pc.DescribeMetric("db-read"); !errors.As(err, &policyErr) {
+		t.Errorf("expected describing a metric to be rejected in multi-tenant mode, got: %v", err)
+	}
+}
+
+func TestResolveTenant(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("X-Grafana-User", "blue")
+	headers.Set("X-Tenant", "red")
+	ctx := withRequestHeaders(context.Background(), headers)
+	pCtx := backend.PluginContext{OrgID: 2}
+
+	tests := []struct {
+		name       string
+		settings   TenancySettings
+		wantTenant string
+		wantErr    bool
+	}{
+		{"disabled", TenancySettings{}, "", false},
+		{"org", TenancySettings{Enabled: true}, "2", false},
+		{"mapped org", TenancySettings{Enabled: true, Tenants: map[string]string{"2": "acme"}}, "acme", false},
+		{"unmapped org", TenancySettings{Enabled: true, Tenants: map[string]string{"3": "acme"}}, "", true},
+		{"header", TenancySettings{Enabled: true, Source: "header", Header: "x-grafana-user"}, "blue", false},
+		// (the browser may send any other header)
+		{"browser header", TenancySettings{Enabled: true, Source: "header", Header: "X-Tenant"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant, err := tt.settings.resolveTenant(ctx, pCtx)
+			var tenantErr *TenantError
+			if tt.wantErr != errors.As(err, &tenantErr) {
+				t.Fatalf("expected TenantError: %v, got: %v", tt.wantErr, err)
+			}
+			if tenant != tt.wantTenant {
+				t.Errorf("expected tenant %q, got %q", tt.wantTenant, tenant)
+			}
+		})
+	}
+
+	settings := TenancySettings{Enabled: true, Source: "header", Header: "X-Grafana-User"}
+	var tenantErr *TenantError
+	if _, err := settings.resolveTenant(context.Background(), pCtx); !errors.As(err, &tenantErr) {
+		t.Errorf("expected a missing header to be a TenantError, got: %v", err)
+	}
+	settings.Header = "X-Tenant"
+	if err := settings.check(); err == nil {
+		t.Error("expected a tenant header Grafana doesn't set to be rejected")
+	}
+}
@@ -0,0 +1,58 @@
+package plugin
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
+)
+
+// parseTimeShift parses a time shift such as "-1d" or "-7d" (Grafana's duration units, including d, w, M and y).
+// Negative shifts are into the past.
+func parseTimeShift(s string) (time.Duration, error) {
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign = -1
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	d, err := gtime.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return sign * d, nil
+}
+
+// shiftAnalyticsTimes moves the timestamps of analytics rows by d.
+func shiftAnalyticsTimes(results []harper.GetAnalyticsResult, d time.Duration) {
+	for _, row := range results {
+		if ts, ok := row["id"].(time.Time); ok {
+			row["id"] = ts.Add(d)
+		}
+	}
+}
+
+// periodLabel is the attribute that tells the current and previous periods' rows apart when comparing them.
+const periodLabel = "period"
+
+// mergePeriods labels the rows of the current period and the previous one, already shifted onto the current period,
+// and merges them in time order.
+func mergePeriods(current []harper.GetAnalyticsResult, previous []harper.GetAnalyticsResult) []harper.GetAnalyticsResult {
+	for _, row := range current {
+		row[periodLabel] = "current"
+	}
+	for _, row := range previous {
+		row[periodLabel] = "previous"
+	}
+	merged := append(slices.Clip(current), previous...)
+	slices.SortStableFunc(merged, func(a, b harper.GetAnalyticsResult) int {
+		ta, _ := a["id"].(time.Time)
+		tb, _ := b["id"].(time.Time)
+		return ta.Compare(tb)
+	})
+	return merged
+}
@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestParseTimeShift(t *testing.T) {
+	tests := map[string]time.Duration{
+		"-1d": -24 * time.Hour,
+		"-7d": -7 * 24 * time.Hour,
+		"+2h": 2 * time.Hour,
+		"30m": 30 * time.Minute,
+	}
+	for s, want := range tests {
+		got, err := parseTimeShift(s)
+		if err != nil || got != want {
+			t.Errorf("expected %s to be %v, got %v (%v)", s, want, got, err)
+		}
+	}
+	if _, err := parseTimeShift("-yesterday"); err == nil {
+		t.Error("expected an invalid shift to be rejected")
+	}
+}
+
+func TestQueryAnalyticsTimeShift(t *testing.T) {
+	client := newFakeHarperClient()
+	now := time.UnixMilli(1_700_000_000_000)
+	lastWeek := now.Add(-7 * 24 * time.Hour)
+	client.addAnalytics("db-read", []time.Time{lastWeek}, map[string]any{"node": "node-1", "count": 3.0})
+	client.addAnalytics("db-read", []time.Time{now}, map[string]any{"node": "node-1", "count": 5.0})
+	ds := newTestDatasource(t, Settings{}, client)
+
+	query := analyticsQuery("A", map[string]any{"metric": "db-read", "timeShift": "-7d"})
+	query.TimeRange = backend.TimeRange{From: now.Add(-time.Hour), To: now.Add(time.Hour)}
+	res, err := ds.query(context.Background(), backend.PluginContext{}, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req := client.lastAnalyticsRequest; req.StartTime != lastWeek.Add(-time.Hour).UnixMilli() {
+		t.Errorf("expected the range to be shifted back a week, got start %d", req.StartTime)
+	}
+	frame := res.Frames[0]
+	if frame.Name != "A: db-read (-7d)" || frame.Rows() != 1 {
+		t.Fatalf("expected a row from last week in 'A: db-read (-7d)', got %d in '%s'", frame.Rows(), frame.Name)
+	}
+	if ts, _ := frame.Fields[0].ConcreteAt(0); !ts.(time.Time).Equal(now) {
+		t.Errorf("expected last week's row to be shifted into this week, got %v", ts)
+	}
+	if v, _ := frame.Fields[1].NullableFloatAt(0); v == nil || *v != 3 {
+		t.Errorf("expected last week's value, got %v", v)
+	}
+}
+
+func TestQueryAnalyticsComparePrevious(t *testing.T) {
+	client := newFakeHarperClient()
+	now := time.UnixMilli(1_700_000_000_000)
+	client.addAnalytics("db-read", []time.Time{now.Add(-90 * time.Minute)}, map[string]any{"node": "node-1", "count": 3.0})
+	client.addAnalytics("db-read", []time.Time{now.Add(-30 * time.Minute)}, map[string]any{"node": "node-1", "count": 5.0})
+	ds := newTestDatasource(t, Settings{}, client)
+
+	query := analyticsQuery("A", map[string]any{"metric": "db-read", "comparePrevious": true})
+	query.TimeRange = backend.TimeRange{From: now.Add(-time.Hour), To: now}
+	res, err := ds.query(context.Background(), backend.PluginContext{}, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := res.Frames[0]
+	if frame.Rows() != 1 {
+		t.Fatalf("expected both periods' rows to share one timestamp, got %d rows", frame.Rows())
+	}
+	values := make(map[string]float64)
+	for _, field := range frame.Fields[1:] {
+		if v, _ := field.NullableFloatAt(0); v != nil {
+			values[field.Labels["period"]] = *v
+		}
+	}
+	if values["current"] != 5 || values["previous"] != 3 {
+		t.Errorf("expected current and previous series, got %v", values)
+	}
+
+	if _, err := ds.query(context.Background(), backend.PluginContext{},
+		analyticsQuery("B", map[string]any{"metric": "db-read", "comparePrevious": true})); err == nil {
+		t.Error("expected a comparison without a time range to be rejected")
+	}
+}
@@ -0,0 +1,180 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/go-resty/resty/v2"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Ways the datasource authenticates with Harper.
+const (
+	// authMethodBasic sends the username and password with every operation, as HTTP basic authentication.
+	authMethodBasic = "basic"
+	// authMethodToken sends an operation token (a JWT) instead, refreshing it when Harper rejects it.
+	authMethodToken = "token"
+)
+
+var authMethods = []string{"", authMethodBasic, authMethodToken}
+
+// tokenAuth holds the operation token an instance's Harper client authenticates with, and refreshes it. It's shared by
+// every copy of the client, so a token refreshed by one query is used by all of them.
+type tokenAuth struct {
+	// issuer sends the operations that create and refresh tokens, authenticated with the username and password if
+	// they're set.
+	issuer   *harper.Client
+	username string
+	password string
+	logger   log.Logger
+
+	mu             sync.Mutex
+	operationToken string
+	refreshToken   string
+}
+
+// newTokenAuth returns the tokenAuth of a client whose tokens start as those configured, if any, and are refreshed
+// with the refresh token or, failing that, created with the username and password.
+func newTokenAuth(issuer *harper.Client, username, password, operationToken, refreshToken string, logger log.Logger) *tokenAuth {
+	return &tokenAuth{
+		issuer:         issuer,
+		username:       username,
+		password:       password,
+		logger:         logger,
+		operationToken: operationToken,
+		refreshToken:   refreshToken,
+	}
+}
+
+func (ta *tokenAuth) token() string {
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+	return ta.operationToken
+}
+
+// authenticate sets the operation token on every request client sends.
+func (ta *tokenAuth) authenticate(client *harper.Client) *harper.Client {
+	client.HttpClient.OnBeforeRequest(func(_ *resty.Client, r *resty.Request) error {
+		if token := ta.token(); token != "" {
+			r.SetAuthToken(token)
+		}
+		return nil
+	})
+	return client
+}
+
+// refresh replaces the operation token stale, unless another caller already has, refreshing it with the refresh
+// token or, if there's none or it's been rejected too, creating new tokens with the password. The operations are sent
+// under ctx.
+func (ta *tokenAuth) refresh(ctx context.Context, stale string) error {
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+	if ta.operationToken != stale {
+		return nil
+	}
+
+	var refreshErr error
+	if ta.refreshToken != "" {
+		issuer := *ta.issuer
+		issuer.HttpClient = ta.issuer.HttpClient.Clone().SetAuthToken(ta.refreshToken)
+		refreshed, err := clientWithContext(&issuer, ctx).(*harper.Client).RefreshOperationToken(ta.refreshToken)
+		if err == nil {
+			ta.logger.Debug("refreshed the Harper operation token")
+			ta.operationToken = refreshed.OperationToken
+			return nil
+		}
+		ta.logger.Debug("could not refresh the Harper operation token", "error", err)
+		refreshErr = err
+	}
+
+	if ta.password == "" {
+		if refreshErr == nil {
+			return fmt.Errorf("no refresh token or password to get a new operation token with")
+		}
+		return fmt.Errorf("could not refresh the operation token: %w", refreshErr)
+	}
+	created, err := clientWithContext(ta.issuer, ctx).(*harper.Client).CreateAuthenticationTokens(ta.username, ta.password)
+	if err != nil {
+		return fmt.Errorf("could not create operation tokens: %w", err)
+	}
+	ta.logger.Debug("created Harper operation tokens", "username", ta.username)
+	ta.operationToken, ta.refreshToken = created.OperationToken, created.RefreshToken
+	return nil
+}
+
+// tokenClient wraps a HarperClient authenticated by a tokenAuth to get a token before its first operation, and to
+// refresh the token and try again once when Harper rejects it (HTTP 401), as it does once it expires.
+type tokenClient struct {
+	HarperClient
+	auth *tokenAuth
+
+	// ctx is the context the client's calls, and the token refreshes they need, are made under.
+	ctx context.Context
+}
+
+func newTokenClient(client HarperClient, auth *tokenAuth) *tokenClient {
+	return &tokenClient{HarperClient: client, auth: auth, ctx: context.Background()}
+}
+
+func (tc *tokenClient) withContext(ctx context.Context) HarperClient {
+	// (the token operations' responses mustn't be streamed into the columns of an analytics query)
+	refreshCtx := context.WithValue(ctx, analyticsStreamKey{}, nil)
+	return &tokenClient{HarperClient: clientWithContext(tc.HarperClient, ctx), auth: tc.auth, ctx: refreshCtx}
+}
+
+// do calls try with a token, and again with a refreshed one if Harper rejects the first.
+func (tc *tokenClient) do(try func() error) error {
+	token := tc.auth.token()
+	if token == "" {
+		if err := tc.auth.refresh(tc.ctx, ""); err != nil {
+			return err
+		}
+		token = tc.auth.token()
+	}
+
+	err := try()
+	var opErr *harper.OperationError
+	if !errors.As(err, &opErr) || opErr.StatusCode != http.StatusUnauthorized {
+		return err
+	}
+	if refreshErr := tc.auth.refresh(tc.ctx, token); refreshErr != nil {
+		tc.auth.logger.Warn("Harper rejected the operation token and it couldn't be refreshed", "error", refreshErr)
+		return err
+	}
+	return try()
+}
+
+func (tc *tokenClient) GetAnalytics(req harper.GetAnalyticsRequest) ([]harper.GetAnalyticsResult, error) {
+	var results []harper.GetAnalyticsResult
+	err := tc.do(func() (err error) {
+		results, err = tc.HarperClient.GetAnalytics(req)
+		return err
+	})
+	return results, err
+}
+
+func (tc *tokenClient) ListMetrics(req harper.ListMetricsRequest) ([]harper.ListMetricsResult, error) {
+	var metrics []harper.ListMetricsResult
+	err := tc.do(func() (err error) {
+		metrics, err = tc.HarperClient.ListMetrics(req)
+		return err
+	})
+	return metrics, err
+}
+
+func (tc *tokenClient) DescribeMetric(metric string) (*harper.DescribeMetricResult, error) {
+	var desc *harper.DescribeMetricResult
+	err := tc.do(func() (err error) {
+		desc, err = tc.HarperClient.DescribeMetric(metric)
+		return err
+	})
+	return desc, err
+}
+
+func (tc *tokenClient) RawRequest(op harper.Operation, result any) error {
+	return tc.do(func() error { return tc.HarperClient.RawRequest(op, result) })
+}
@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// fakeTokenServer is a Harper ops API that only accepts operations with its current operation token.
+type fakeTokenServer struct {
+	mu                 sync.Mutex
+	operationToken     string
+	refreshToken       string
+	issued             int
+	created, refreshed int
+}
+
+func (s *fakeTokenServer) issue() string {
+	s.issued++
+	s.operationToken = fmt.Sprintf("operation-%d", s.issued)
+	return s.operationToken
+}
+
+func (s *fakeTokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var op map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&op)
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case op["operation"] == harper.OP_CREATE_AUTHENTICATION_TOKENS && op["username"] == "admin" && op["password"] == "password":
+		s.created++
+		s.refreshToken = fmt.Sprintf("refresh-%d", s.created)
+		_ = json.NewEncoder(w).Encode(map[string]string{"operation_token": s.issue(), "refresh_token": s.refreshToken})
+	case op["operation"] == harper.OP_REFRESH_OPERATION_TOKEN && r.Header.Get("Authorization") == "Bearer "+s.refreshToken:
+		s.refreshed++
+		_ = json.NewEncoder(w).Encode(map[string]string{"operation_token": s.issue()})
+	case r.Header.Get("Authorization") == "Bearer "+s.operationToken:
+		_, _ = w.Write([]byte("[]"))
+	default:
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error": "invalid token"}`))
+	}
+}
+
+func newTokenDatasource(t *testing.T, srv *httptest.Server, secrets map[string]string) *Datasource {
+	t.Helper()
+	jsonData, _ := json.Marshal(map[string]any{
+		"opsAPIURL":               srv.URL,
+		"username":                "admin",
+		"authMethod":              authMethodToken,
+		"metadataRefreshInterval": "0s",
+	})
+	inst, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		UID:                     t.Name(),
+		JSONData:                jsonData,
+		DecryptedSecureJSONData: secrets,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := inst.(*Datasource)
+	t.Cleanup(ds.Dispose)
+	return ds
+}
+
+func TestTokenAuth(t *testing.T) {
+	harperServer := &fakeTokenServer{}
+	srv := httptest.NewServer(harperServer)
+	defer srv.Close()
+	ds := newTokenDatasource(t, srv, map[string]string{"password": "password"})
+
+	userInfo := rawOperation{"operation": harper.OP_USER_INFO}
+	if err := ds.harperClient.RawRequest(userInfo, nil); err != nil {
+		t.Fatal(err)
+	}
+	harperServer.mu.Lock()
+	if harperServer.created != 1 {
+		t.Errorf("expected tokens to be created once, got %d", harperServer.created)
+	}
+	// the operation token expires
+	harperServer.operationToken = "expired"
+	harperServer.mu.Unlock()
+
+	if err := ds.harperClient.RawRequest(userInfo, nil); err != nil {
+		t.Fatalf("expected the operation to be retried with a refreshed token, got %v", err)
+	}
+	harperServer.mu.Lock()
+	if harperServer.refreshed == 0 || harperServer.created != 1 {
+		t.Errorf("expected the token to be refreshed with the refresh token, got %d refreshes and %d creations",
+			harperServer.refreshed, harperServer.created)
+	}
+	// both tokens expire
+	harperServer.operationToken, harperServer.refreshToken = "expired", "expired"
+	harperServer.mu.Unlock()
+
+	if err := ds.harperClient.RawRequest(userInfo, nil); err != nil {
+		t.Fatalf("expected the operation to be retried with new tokens, got %v", err)
+	}
+	harperServer.mu.Lock()
+	if harperServer.created != 2 {
+		t.Errorf("expected new tokens to be created with the password, got %d creations", harperServer.created)
+	}
+	harperServer.mu.Unlock()
+}
+
+func TestTokenAuthConfiguredTokens(t *testing.T) {
+	harperServer := &fakeTokenServer{operationToken: "configured", refreshToken: "configured-refresh"}
+	srv := httptest.NewServer(harperServer)
+	defer srv.Close()
+	ds := newTokenDatasource(t, srv, map[string]string{"operationToken": "configured", "refreshToken": "configured-refresh"})
+
+	userInfo := rawOperation{"operation": harper.OP_USER_INFO}
+	if err := ds.harperClient.RawRequest(userInfo, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	harperServer.mu.Lock()
+	harperServer.operationToken, harperServer.refreshToken = "expired", "expired"
+	harperServer.mu.Unlock()
+	err := ds.harperClient.RawRequest(userInfo, nil)
+	if statusFromError(err) != backend.StatusUnauthorized {
+		t.Errorf("expected the operation to be unauthorized without a password to create tokens with, got %v", err)
+	}
+	harperServer.mu.Lock()
+	if harperServer.created != 0 {
+		t.Errorf("expected no tokens to be created, got %d", harperServer.created)
+	}
+	harperServer.mu.Unlock()
+
+	if _, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{"authMethod": "token"}`),
+	}); err == nil {
+		t.Error("expected token authentication without any credentials to be rejected")
+	}
+}
@@ -0,0 +1,64 @@
+package plugin
+
+import (
+	"maps"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+)
+
+// analyticsTransforms are the transformations get_analytics queries can apply to counters:
+//   - delta: the difference from the previous point
+//   - increase: the difference from the previous point, treating a decrease as a counter reset
+//   - rate: the increase per second
+var analyticsTransforms = []string{"rate", "increase", "delta"}
+
+// transformCounters replaces each numeric attribute of rows (in ascending time order) with its change since the
+// series' previous row, as named by fn. Each series' first row has nothing to compare with and is dropped.
+func transformCounters(results []harper.GetAnalyticsResult, fn string) []harper.GetAnalyticsResult {
+	type point struct {
+		ts     time.Time
+		values map[string]float64
+	}
+	previous := make(map[string]point)
+
+	transformed := make([]harper.GetAnalyticsResult, 0, len(results))
+	for _, row := range results {
+		ts, ok := row["id"].(time.Time)
+		if !ok {
+			continue
+		}
+		labels, values := splitAnalyticsRow(row)
+		series := seriesKey(labels)
+
+		prev, seen := previous[series]
+		previous[series] = point{ts: ts, values: values}
+		if !seen {
+			continue
+		}
+		elapsed := ts.Sub(prev.ts).Seconds()
+		if fn == "rate" && elapsed <= 0 {
+			continue
+		}
+
+		out := harper.GetAnalyticsResult{"id": ts}
+		maps.Copy(out, labels)
+		for k, v := range values {
+			prevValue, ok := prev.values[k]
+			if !ok {
+				continue
+			}
+			change := v - prevValue
+			if fn != "delta" && change < 0 {
+				// the counter was reset, so it has counted v since
+				change = v
+			}
+			if fn == "rate" {
+				change /= elapsed
+			}
+			out[k] = change
+		}
+		transformed = append(transformed, out)
+	}
+	return transformed
+}
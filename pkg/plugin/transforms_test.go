@@ -0,0 +1,48 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+)
+
+func TestTransformCounters(t *testing.T) {
+	start := time.UnixMilli(1_700_000_000_000)
+	var results []harper.GetAnalyticsResult
+	for i, v := range []float64{100, 110, 130, 20} {
+		results = append(results,
+			harper.GetAnalyticsResult{"id": start.Add(time.Duration(i) * 10 * time.Second), "node": "node-1", "bytes": v},
+			harper.GetAnalyticsResult{"id": start.Add(time.Duration(i) * 10 * time.Second), "node": "node-2", "bytes": 2 * v},
+		)
+	}
+
+	tests := []struct {
+		fn   string
+		want []float64
+	}{
+		{"delta", []float64{10, 20, -110}},
+		{"increase", []float64{10, 20, 20}},
+		{"rate", []float64{1, 2, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fn, func(t *testing.T) {
+			transformed := transformCounters(results, tt.fn)
+			if len(transformed) != 6 {
+				t.Fatalf("expected 3 rows per node, got %d", len(transformed))
+			}
+			var got []float64
+			for _, row := range transformed {
+				if row["node"] == "node-1" {
+					got = append(got, row["bytes"].(float64))
+				}
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("expected %v, got %v", tt.want, got)
+					break
+				}
+			}
+		})
+	}
+}
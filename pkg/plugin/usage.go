@@ -0,0 +1,148 @@
+package plugin
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// usageStats counts the queries made against each metric and table, and how long they took, so admins can see which
+// ones dashboards actually use. It's kept in memory and resets whenever the datasource instance is recreated.
+type usageStats struct {
+	mu      sync.Mutex
+	entries map[usageKey]*usageEntry
+}
+
+type usageKey struct {
+	Type string
+	Name string
+}
+
+type usageEntry struct {
+	queries       int
+	errors        int
+	totalDuration time.Duration
+	maxDuration   time.Duration
+	lastQueried   time.Time
+}
+
+// usageReport is the GET /usage response item for one metric or table.
+type usageReport struct {
+	Type         string    `json:"type"`
+	Name         string    `json:"name"`
+	Queries      int       `json:"queries"`
+	Errors       int       `json:"errors"`
+	AvgLatencyMs float64   `json:"avgLatencyMs"`
+	MaxLatencyMs float64   `json:"maxLatencyMs"`
+	LastQueried  time.Time `json:"lastQueried"`
+}
+
+func newUsageStats() *usageStats {
+	return &usageStats{entries: make(map[usageKey]*usageEntry)}
+}
+
+// queryTarget returns what a Grafana query reads: a ("metric", name) or ("table", "database.table") pair, or ok =
+// false if it can't be determined.
+func queryTarget(queryJSON json.RawMessage) (targetType string, name string, ok bool) {
+	var q struct {
+		QueryAttrs struct {
+			Metric   string `json:"metric"`
+			Database string `json:"database"`
+			Table    string `json:"table"`
+		} `json:"queryAttrs"`
+	}
+	if err := json.Unmarshal(queryJSON, &q); err != nil {
+		return "", "", false
+	}
+
+	switch {
+	case q.QueryAttrs.Metric != "":
+		return "metric", q.QueryAttrs.Metric, true
+	case q.QueryAttrs.Table != "":
+		return "table", q.QueryAttrs.Database + "." + q.QueryAttrs.Table, true
+	default:
+		return "", "", false
+	}
+}
+
+// record counts a query for queryJSON's metric or table.
+func (u *usageStats) record(queryJSON json.RawMessage, duration time.Duration, err error) {
+	targetType, name, ok := queryTarget(queryJSON)
+	if !ok {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	key := usageKey{Type: targetType, Name: name}
+	entry, ok := u.entries[key]
+	if !ok {
+		entry = &usageEntry{}
+		u.entries[key] = entry
+	}
+	entry.queries++
+	if err != nil {
+		entry.errors++
+	}
+	entry.totalDuration += duration
+	entry.maxDuration = max(entry.maxDuration, duration)
+	entry.lastQueried = time.Now()
+}
+
+// report returns the usage of every metric and table queried so far, most queried first.
+func (u *usageStats) report() []usageReport {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	reports := make([]usageReport, 0, len(u.entries))
+	for key, entry := range u.entries {
+		reports = append(reports, usageReport{
+			Type:         key.Type,
+			Name:         key.Name,
+			Queries:      entry.queries,
+			Errors:       entry.errors,
+			AvgLatencyMs: float64(entry.totalDuration.Microseconds()) / float64(entry.queries) / 1000,
+			MaxLatencyMs: float64(entry.maxDuration.Microseconds()) / 1000,
+			LastQueried:  entry.lastQueried,
+		})
+	}
+
+	slices.SortFunc(reports, func(a, b usageReport) int {
+		return cmp.Or(cmp.Compare(b.Queries, a.Queries), cmp.Compare(a.Type, b.Type), cmp.Compare(a.Name, b.Name))
+	})
+
+	return reports
+}
+
+type usageHandler struct {
+	datasource *Datasource
+}
+
+func newUsageHandler(datasource *Datasource) *usageHandler {
+	return &usageHandler{datasource: datasource}
+}
+
+func (uh *usageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+
+	jsonResp, err := json.Marshal(uh.datasource.usage.report())
+	if err != nil {
+		uh.datasource.logger.Error("error marshaling usage to JSON", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err = w.Write(jsonResp)
+	if err != nil {
+		uh.datasource.logger.Error("error writing response", "error", err)
+	}
+}
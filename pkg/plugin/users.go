@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	harper "github.com/HarperFast/sdk-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// simpleOperation is an operation that takes no parameters.
+type simpleOperation struct {
+	Operation string `json:"operation"`
+}
+
+func (o simpleOperation) Prepare() any {
+	return o
+}
+
+// rolePermission is the part of a Harper role's permissions that's summarized in its own fields. The rest (per
+// database and table grants) is kept as JSON.
+type rolePermission struct {
+	SuperUser   bool `json:"super_user"`
+	ClusterUser bool `json:"cluster_user"`
+}
+
+type roleRecord struct {
+	ID         string          `json:"id"`
+	Role       string          `json:"role"`
+	Permission json.RawMessage `json:"permission"`
+}
+
+// userRecord is a Harper user. Only these attributes are decoded, so password hashes are never passed on even if
+// Harper returns them.
+type userRecord struct {
+	Username    string     `json:"username"`
+	Active      bool       `json:"active"`
+	Role        roleRecord `json:"role"`
+	CreatedTime *float64   `json:"__createdtime__"`
+	UpdatedTime *float64   `json:"__updatedtime__"`
+}
+
+// queryListUsers returns a frame with a row per Harper user and their role, for auditing accounts.
+func (d *Datasource) queryListUsers(client HarperClient, refID string) (backend.DataResponse, error) {
+	op := simpleOperation{Operation: harper.OP_LIST_USERS}
+
+	d.logger.Debug("executing Harper operation", "refID", refID, "operation", op.Operation)
+	start := time.Now()
+	var users []userRecord
+	if err := client.RawRequest(op, &users); err != nil {
+		return backend.DataResponse{}, fmt.Errorf("could not list Harper users: '%w'", err)
+	}
+	d.logger.Debug("Harper operation completed", "refID", refID, "operation", op.Operation,
+		"duration", time.Since(start), "results", len(users))
+
+	frame := data.NewFrame(frameName(refID, "users"),
+		data.NewField("username", nil, []string{}),
+		data.NewField("active", nil, []bool{}),
+		data.NewField("role", nil, []string{}),
+		data.NewField("super user", nil, []bool{}),
+		data.NewField("cluster user", nil, []bool{}),
+		data.NewField("created", nil, []*time.Time{}),
+		data.NewField("updated", nil, []*time.Time{}),
+	).SetMeta(&data.FrameMeta{PreferredVisualization: data.VisTypeTable}).SetRefID(refID)
+
+	for _, user := range users {
+		perm := user.Role.permission()
+		frame.AppendRow(user.Username, user.Active, user.Role.Role, perm.SuperUser, perm.ClusterUser,
+			epochMillisToTime(user.CreatedTime), epochMillisToTime(user.UpdatedTime))
+	}
+
+	return backend.DataResponse{Frames: data.Frames{frame}}, nil
+}
+
+// queryListRoles returns a frame with a row per Harper role and its permissions.
+func (d *Datasource) queryListRoles(client HarperClient, refID string) (backend.DataResponse, error) {
+	op := simpleOperation{Operation: harper.OP_LIST_ROLES}
+
+	d.logger.Debug("executing Harper operation", "refID", refID, "operation", op.Operation)
+	start := time.Now()
+	var roles []roleRecord
+	if err := client.RawRequest(op, &roles); err != nil {
+		return backend.DataResponse{}, fmt.Errorf("could not list Harper roles: '%w'", err)
+	}
+	d.logger.Debug("Harper operation completed", "refID", refID, "operation", op.Operation,
+		"duration", time.Since(start), "results", len(roles))
+
+	frame := data.NewFrame(frameName(refID, "roles"),
+		data.NewField("role", nil, []string{}),
+		data.NewField("id", nil, []string{}),
+		data.NewField("super user", nil, []bool{}),
+		data.NewField("cluster user", nil, []bool{}),
+		data.NewField("permissions", nil, []json.RawMessage{}),
+	).SetMeta(&data.FrameMeta{PreferredVisualization: data.VisTypeTable}).SetRefID(refID)
+
+	for _, role := range roles {
+		perm := role.permission()
+		permissions := role.Permission
+		if permissions == nil {
+			permissions = json.RawMessage("{}")
+		}
+		frame.AppendRow(role.Role, role.ID, perm.SuperUser, perm.ClusterUser, permissions)
+	}
+
+	return backend.DataResponse{Frames: data.Frames{frame}}, nil
+}
+
+func (r roleRecord) permission() rolePermission {
+	var perm rolePermission
+	// roles without permissions (or with ones in an unexpected shape) have no flags set
+	_ = json.Unmarshal(r.Permission, &perm)
+	return perm
+}
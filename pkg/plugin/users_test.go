@@ -0,0 +1,60 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestQueryListUsersAndRoles(t *testing.T) {
+	role := `{"id":"r1","role":"super_user","permission":{"super_user":true}}`
+	client := newFakeHarperClient()
+	client.raw = func(op map[string]any) (any, error) {
+		switch op["operation"] {
+		case "list_users":
+			return json.RawMessage(`[
+				{"username":"admin","active":true,"password":"secret-hash","role":` + role + `,"__createdtime__":1714564800000},
+				{"username":"reader","active":false,"role":{"id":"r2","role":"reader","permission":{"dev":{"tables":{}}}}}
+			]`), nil
+		case "list_roles":
+			return json.RawMessage(`[` + role + `,{"id":"r2","role":"reader"}]`), nil
+		}
+		return nil, nil
+	}
+	ds := newTestDatasource(t, Settings{}, client)
+
+	usersJSON, _ := json.Marshal(map[string]any{"operation": "list_users"})
+	res, err := ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "A", JSON: usersJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := res.Frames[0]
+	if frame.Rows() != 2 {
+		t.Fatalf("expected 2 users, got %d", frame.Rows())
+	}
+	for _, field := range frame.Fields {
+		if strings.Contains(field.Name, "password") {
+			t.Errorf("expected no password field, got %s", field.Name)
+		}
+	}
+	superUser, _ := frame.FieldByName("super user")
+	if superUser.At(0) != true || superUser.At(1) != false {
+		t.Errorf("unexpected super user flags %v, %v", superUser.At(0), superUser.At(1))
+	}
+
+	rolesJSON, _ := json.Marshal(map[string]any{"operation": "list_roles"})
+	res, err = ds.query(context.Background(), backend.PluginContext{}, backend.DataQuery{RefID: "B", JSON: rolesJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame = res.Frames[0]
+	if frame.Rows() != 2 {
+		t.Fatalf("expected 2 roles, got %d", frame.Rows())
+	}
+	if frame.Fields[0].At(1) != "reader" {
+		t.Errorf("expected the second role to be reader, got %v", frame.Fields[0].At(1))
+	}
+}
@@ -1,7 +1,17 @@
 import React, { ChangeEvent } from 'react';
-import { Field, Divider, Input, SecretInput, Switch } from '@grafana/ui';
+import {
+	Field,
+	Divider,
+	Input,
+	RadioButtonGroup,
+	SecretInput,
+	SecretTextArea,
+	SecureSocksProxySettings,
+	Switch,
+} from '@grafana/ui';
 import { ConfigSection, DataSourceDescription } from '@grafana/plugin-ui';
 import { DataSourcePluginOptionsEditorProps } from '@grafana/data';
+import { config } from '@grafana/runtime';
 import { HarperDataSourceOptions, HarperSecureJsonData } from '../types';
 
 interface Props extends DataSourcePluginOptionsEditorProps<HarperDataSourceOptions, HarperSecureJsonData> {}
@@ -20,6 +30,17 @@ export function ConfigEditor(props: Props) {
 		});
 	};
 
+	const onTimeoutChange = (key: 'timeout' | 'dialTimeout') => (event: ChangeEvent<HTMLInputElement>) => {
+		const value = parseInt(event.target.value, 10);
+		onOptionsChange({
+			...options,
+			jsonData: {
+				...jsonData,
+				[key]: value > 0 ? value : undefined,
+			},
+		});
+	};
+
 	const onUsernameChange = (event: ChangeEvent<HTMLInputElement>) => {
 		onOptionsChange({
 			...options,
@@ -35,6 +56,7 @@ export function ConfigEditor(props: Props) {
 		onOptionsChange({
 			...options,
 			secureJsonData: {
+				...options.secureJsonData,
 				password: event.target.value,
 			},
 		});
@@ -54,6 +76,66 @@ export function ConfigEditor(props: Props) {
 		});
 	};
 
+	const onAuthMethodChange = (authMethod: 'basic' | 'token') => {
+		onOptionsChange({
+			...options,
+			jsonData: {
+				...jsonData,
+				authMethod,
+			},
+		});
+	};
+
+	const onTokenChange = (key: 'operationToken' | 'refreshToken') => (event: ChangeEvent<HTMLInputElement>) => {
+		onOptionsChange({
+			...options,
+			secureJsonData: {
+				...options.secureJsonData,
+				[key]: event.target.value,
+			},
+		});
+	};
+
+	const onResetToken = (key: 'operationToken' | 'refreshToken') => () => {
+		onOptionsChange({
+			...options,
+			secureJsonFields: {
+				...options.secureJsonFields,
+				[key]: false,
+			},
+			secureJsonData: {
+				...options.secureJsonData,
+				[key]: '',
+			},
+		});
+	};
+
+	const tokenAuth = jsonData.authMethod === 'token';
+
+	const onCACertChange = (event: ChangeEvent<HTMLTextAreaElement>) => {
+		onOptionsChange({
+			...options,
+			secureJsonData: {
+				...options.secureJsonData,
+				tlsCACert: event.target.value,
+			},
+		});
+	};
+
+	const onResetCACert = () => {
+		onOptionsChange({
+			...options,
+			secureJsonFields: {
+				...options.secureJsonFields,
+				tlsCACert: false,
+			},
+			secureJsonData: {
+				...options.secureJsonData,
+				tlsCACert: '',
+			},
+		});
+	};
+
 	const onTlsSkipVerifyChange = (event: ChangeEvent<HTMLInputElement>) => {
 		const newValue = !jsonData.tlsSkipVerify;
 		onOptionsChange({
@@ -85,14 +167,62 @@ export function ConfigEditor(props: Props) {
 						width={80}
 					/>
 				</Field>
+
+				<Field
+					label="Timeout"
+					description="How long, in seconds, a request to Harper may take before it's abandoned. Defaults to 30."
+				>
+					<Input
+						id="config-editor-timeout"
+						type="number"
+						min={1}
+						onChange={onTimeoutChange('timeout')}
+						value={jsonData.timeout ?? ''}
+						placeholder="30"
+						width={20}
+					/>
+				</Field>
+
+				<Field
+					label="Dial timeout"
+					description="How long, in seconds, connecting to Harper may take. Defaults to 10."
+				>
+					<Input
+						id="config-editor-dial-timeout"
+						type="number"
+						min={1}
+						onChange={onTimeoutChange('dialTimeout')}
+						value={jsonData.dialTimeout ?? ''}
+						placeholder="10"
+						width={20}
+					/>
+				</Field>
+
+				{config.secureSocksDSProxyEnabled && (
+					<SecureSocksProxySettings options={options} onOptionsChange={onOptionsChange} />
+				)}
 			</ConfigSection>
 
 			<Divider />
 
 			<ConfigSection title="Authentication">
-				<Field label="Username" required>
+				<Field
+					label="Method"
+					description="Basic authentication sends the username and password with every request. Token authentication sends an operation token instead, refreshing it when it expires, and creating new tokens with the username and password if they're set."
+				>
+					<RadioButtonGroup
+						options={[
+							{ label: 'Basic', value: 'basic' },
+							{ label: 'Token', value: 'token' },
+						]}
+						value={jsonData.authMethod ?? 'basic'}
+						onChange={onAuthMethodChange}
+					/>
+				</Field>
+
+				<Field label="Username" required={!tokenAuth}>
 					<Input
-						required
+						required={!tokenAuth}
 						id="config-editor-username"
 						onChange={onUsernameChange}
 						value={jsonData.username}
@@ -101,9 +231,9 @@ export function ConfigEditor(props: Props) {
 					/>
 				</Field>
 
-				<Field label="Password" required>
+				<Field label="Password" required={!tokenAuth}>
 					<SecretInput
-						required
+						required={!tokenAuth}
 						id="config-editor-password"
 						isConfigured={secureJsonFields.password}
 						value={secureJsonData?.password}
@@ -114,6 +244,37 @@ export function ConfigEditor(props: Props) {
 					/>
 				</Field>
 
+				{tokenAuth && (
+					<>
+						<Field
+							label="Operation token"
+							description="A Harper operation token (JWT) to authenticate with. Optional if a refresh token or a password is set."
+						>
+							<SecretInput
+								id="config-editor-operation-token"
+								isConfigured={secureJsonFields.operationToken}
+								value={secureJsonData?.operationToken}
+								placeholder="Enter an operation token"
+								width={40}
+								onReset={onResetToken('operationToken')}
+								onChange={onTokenChange('operationToken')}
+							/>
+						</Field>
+
+						<Field label="Refresh token" description="The refresh token the operation token is refreshed with.">
+							<SecretInput
+								id="config-editor-refresh-token"
+								isConfigured={secureJsonFields.refreshToken}
+								value={secureJsonData?.refreshToken}
+								placeholder="Enter a refresh token"
+								width={40}
+								onReset={onResetToken('refreshToken')}
+								onChange={onTokenChange('refreshToken')}
+							/>
+						</Field>
+					</>
+				)}
+
 				<Field
 					label="Skip TLS Verification"
 					description="Don't verify the TLS certificate of the Harper server. Use this option if you're using a self-signed certificate, but only in non-production environments as it is insecure."
@@ -123,6 +284,22 @@ export function ConfigEditor(props: Props) {
 						onChange={onTlsSkipVerifyChange}
 					/>
 				</Field>
+
+				<Field
+					label="CA certificate"
+					description="The PEM certificate of a private CA to trust the Harper server's certificate from, without adding it to Grafana's trust store."
+				>
+					<SecretTextArea
+						id="config-editor-tls-ca-cert"
+						isConfigured={secureJsonFields.tlsCACert}
+						value={secureJsonData?.tlsCACert}
+						placeholder="-----BEGIN CERTIFICATE-----"
+						cols={80}
+						rows={6}
+						onReset={onResetCACert}
+						onChange={onCACertChange}
+					/>
+				</Field>
 			</ConfigSection>
 		</>
 	);
@@ -68,6 +68,10 @@ const comparators = [
 	'less_than',
 	'less_than_equal',
 	'between',
+	'not_between',
+	'in',
+	'is_null',
+	'not_null',
 ];
 
 function ConditionForm({ datasource, queryAttrs, onQueryAttrsChange, loadAttributes, index }: ConditionFormProps) {
@@ -335,6 +339,17 @@ function AnalyticsQueryEditor({ queryAttrs, onQueryAttrsChange, datasource }: An
 					onChange={updateSelectedAttrs}
 				/>
 			</InlineField>
+			<InlineField label="Legend" tooltip="Series names, with {{label}} placeholders, e.g. {{node}} {{metric}}">
+				<Input
+					id="analytics-legend-format"
+					width={40}
+					placeholder="Auto"
+					defaultValue={queryAttrs?.legendFormat}
+					onBlur={(e: ChangeEvent<HTMLInputElement>) => {
+						onQueryAttrsChange({ ...queryAttrs, legendFormat: e.target.value });
+					}}
+				/>
+			</InlineField>
 			<Label style={{ marginTop: '25px' }}>Conditions</Label>
 			<ConditionsForm
 				datasource={datasource}
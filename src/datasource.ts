@@ -1,4 +1,12 @@
-import { DataSourceInstanceSettings, CoreApp, ScopedVars } from '@grafana/data';
+import {
+	AdHocVariableFilter,
+	CoreApp,
+	DataSourceGetTagKeysOptions,
+	DataSourceGetTagValuesOptions,
+	DataSourceInstanceSettings,
+	MetricFindValue,
+	ScopedVars,
+} from '@grafana/data';
 import { DataSourceWithBackend, getTemplateSrv } from '@grafana/runtime';
 
 import {
@@ -10,11 +18,17 @@ import {
 	DescribeMetricResponse,
 	ListMetricsRequest,
 	MetricType,
+	UsedVariable,
 } from './types';
 
+// comparators that take no value
+const nullComparators = ['is_null', 'not_null'];
+
 export class DataSource extends DataSourceWithBackend<HarperQuery, HarperDataSourceOptions> {
 	constructor(instanceSettings: DataSourceInstanceSettings<HarperDataSourceOptions>) {
 		super(instanceSettings);
+		// annotation queries are ordinary queries with the 'annotations' operation, run by the backend
+		this.annotations = {};
 	}
 
 	getDefaultQuery(_: CoreApp): Partial<HarperQuery> {
@@ -65,15 +79,18 @@ export class DataSource extends DataSourceWithBackend<HarperQuery, HarperDataSou
 		return { val: trimmedFieldVal, type: 'string' };
 	}
 
-	applyTemplateVariables(queryTemplate: HarperQuery, scopedVars: ScopedVars) {
+	applyTemplateVariables(queryTemplate: HarperQuery, scopedVars: ScopedVars, filters?: AdHocVariableFilter[]) {
 		const templateSrv = getTemplateSrv();
 		let query = { ...queryTemplate };
+		if (filters?.length) {
+			query.adhocFilters = filters;
+		}
 		if (queryTemplate.queryAttrs) {
 			if ('conditions' in queryTemplate.queryAttrs) {
 				const conditions = queryTemplate.queryAttrs?.conditions
-					?.filter((c) => c.attribute && c.comparator && c.value?.val)
+					?.filter((c) => c.attribute && c.comparator && (c.value?.val || nullComparators.includes(c.comparator)))
 					.map((c) => {
-						const searchFieldVal: any = templateSrv.replace(c.value?.val.toString(), scopedVars);
+						const searchFieldVal: any = templateSrv.replace(c.value?.val?.toString() ?? '', scopedVars);
 						const searchValType = c.searchValueType ?? 'auto';
 						const searchVal = this.coerceValue(searchFieldVal, searchValType);
 						return { attribute: c.attribute, comparator: c.comparator, value: searchVal };
@@ -85,10 +102,34 @@ export class DataSource extends DataSourceWithBackend<HarperQuery, HarperDataSou
 				const to = Number.parseInt(templateSrv.replace(queryTemplate.queryAttrs?.to?.toString(), scopedVars), 10);
 				query.queryAttrs = { ...query.queryAttrs, from, to };
 			}
+			const usedVars = this.usedVariables(queryTemplate, scopedVars);
+			if (Object.keys(usedVars).length) {
+				query.scopedVars = usedVars;
+			}
 		}
 		return query;
 	}
 
+	/** usedVariables returns the values of the dashboard variables the query's attributes refer to, so the backend can
+	 * interpolate the ones in fields that aren't interpolated here, such as metric, database and table names.
+	 */
+	usedVariables(query: HarperQuery, scopedVars: ScopedVars) {
+		const templateSrv = getTemplateSrv();
+		const attrs = JSON.stringify(query.queryAttrs ?? {});
+		const used: Record<string, UsedVariable> = {};
+		for (const { name } of templateSrv.getVariables()) {
+			const pattern = new RegExp(`\\$\\{${name}(:\\w+)?\\}|\\$${name}\\b|\\[\\[${name}\\]\\]`);
+			if (!pattern.test(attrs)) {
+				continue;
+			}
+			used[name] = {
+				text: templateSrv.replace(`\${${name}:text}`, scopedVars),
+				value: JSON.parse(templateSrv.replace(`\${${name}:json}`, scopedVars)),
+			};
+		}
+		return used;
+	}
+
 	isSearchByConditionsQuery(query: HarperQuery) {
 		return (
 			query.operation === 'search_by_conditions' &&
@@ -129,6 +170,7 @@ export class DataSource extends DataSourceWithBackend<HarperQuery, HarperDataSou
 	filterQuery(query: HarperQuery) {
 		// prevent the query from being executed until it's minimally valid
 		return (
+			query.operation === 'annotations' ||
 			(this.isSearchByConditionsQuery(query) && this.isReadySearchByConditionsQuery(query)) ||
 			(this.isGetAnalyticsQuery(query) && this.isReadyGetAnalyticsQuery(query))
 		);
@@ -150,4 +192,29 @@ export class DataSource extends DataSourceWithBackend<HarperQuery, HarperDataSou
 	describeMetric(metric: string): Promise<DescribeMetricResponse> {
 		return this.getResource(`/metrics/${metric}`);
 	}
+
+	/**
+	 *  tagParams names the metric, or table, whose attributes ad hoc filters are offered for: that of the first of the
+	 *  dashboard's queries that has one.
+	 */
+	tagParams(queries?: HarperQuery[]): Record<string, string> {
+		for (const query of queries ?? []) {
+			const attrs = query.queryAttrs;
+			if (attrs && 'metric' in attrs && attrs.metric) {
+				return { metric: attrs.metric };
+			}
+			if (attrs && 'table' in attrs && attrs.database && attrs.table) {
+				return { database: attrs.database, table: attrs.table };
+			}
+		}
+		return {};
+	}
+
+	getTagKeys(options?: DataSourceGetTagKeysOptions<HarperQuery>): Promise<MetricFindValue[]> {
+		return this.getResource('/tag-keys', this.tagParams(options?.queries));
+	}
+
+	getTagValues(options: DataSourceGetTagValuesOptions<HarperQuery>): Promise<MetricFindValue[]> {
+		return this.getResource('/tag-values', { ...this.tagParams(options.queries), key: options.key });
+	}
 }
@@ -1,4 +1,4 @@
-import { DataSourceJsonData } from '@grafana/data';
+import { AdHocVariableFilter, DataSourceJsonData } from '@grafana/data';
 import { DataQuery } from '@grafana/schema';
 
 type Sort = {
@@ -38,6 +38,7 @@ export interface AnalyticsQueryAttrs {
 	from?: string | number;
 	to?: string | number;
 	conditions?: Condition[];
+	legendFormat?: string;
 }
 
 export type QueryAttrs = SearchByConditionsQueryAttrs | AnalyticsQueryAttrs;
@@ -45,6 +46,14 @@ export type QueryAttrs = SearchByConditionsQueryAttrs | AnalyticsQueryAttrs;
 export interface HarperQuery extends DataQuery {
 	operation?: string;
 	queryAttrs?: QueryAttrs;
+	adhocFilters?: AdHocVariableFilter[];
+	// the values of the dashboard variables queryAttrs uses, which the backend interpolates
+	scopedVars?: Record<string, UsedVariable>;
+}
+
+export interface UsedVariable {
+	text: string;
+	value: string | string[];
 }
 
 export const DEFAULT_QUERY: Partial<HarperQuery> = {
@@ -57,7 +66,10 @@ export const DEFAULT_QUERY: Partial<HarperQuery> = {
 export interface HarperDataSourceOptions extends DataSourceJsonData {
 	opsAPIURL?: string;
 	username?: string;
+	authMethod?: 'basic' | 'token';
 	tlsSkipVerify?: boolean;
+	timeout?: number;
+	dialTimeout?: number;
 }
 
 /**
@@ -65,6 +77,9 @@ export interface HarperDataSourceOptions extends DataSourceJsonData {
  */
 export interface HarperSecureJsonData {
 	password?: string;
+	operationToken?: string;
+	refreshToken?: string;
+	tlsCACert?: string;
 }
 
 export type MetricType = 'builtin' | 'custom';